@@ -13,6 +13,11 @@ output "public_subnets" {
   value       = module.vpc.public_subnets
 }
 
+output "alb_name" {
+  description = "The name of the ALB"
+  value       = module.alb.alb_name
+}
+
 output "alb_dns_name" {
   description = "The DNS name of the ALB"
   value       = module.alb.alb_dns_name
@@ -64,6 +64,8 @@ resource "aws_lb_listener" "http" {
       status_code = "HTTP_301"
     }
   }
+
+  tags = local.common_tags
 }
 
 resource "aws_lb_listener" "https" {
@@ -82,6 +84,8 @@ resource "aws_lb_listener" "https" {
       status_code  = "404"
     }
   }
+
+  tags = local.common_tags
 }
 
 resource "aws_lb_target_group" "apps" {
@@ -103,10 +107,7 @@ resource "aws_lb_target_group" "apps" {
     interval            = 30
   }
 
-  tags = {
-    Environment = var.environment
-    Project     = var.project_name
-  }
+  tags = local.common_tags
 }
 
 resource "aws_lb_listener_rule" "apps" {
@@ -131,4 +132,6 @@ resource "aws_lb_listener_rule" "apps" {
       values = each.value.domain
     }
   }
+
+  tags = local.common_tags
 }
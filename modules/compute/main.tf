@@ -8,6 +8,14 @@ data "aws_ami" "amazon_linux_2" {
   }
 }
 
+locals {
+  common_tags = {
+    Environment = var.environment
+    Project     = var.project_name
+    ManagedBy   = "terraform"
+  }
+}
+
 resource "aws_security_group" "ec2" {
   name        = "${var.project_name}-${var.environment}-ec2-sg"
   description = "Security group for EC2 instances"
@@ -32,10 +40,9 @@ resource "aws_security_group" "ec2" {
     cidr_blocks = ["0.0.0.0/0"]
   }
 
-  tags = {
-    Name        = "${var.project_name}-${var.environment}-ec2-sg"
-    Environment = var.environment
-  }
+  tags = merge(local.common_tags, {
+    Name = "${var.project_name}-${var.environment}-ec2-sg"
+  })
 }
 
 resource "aws_iam_role" "ec2_role" {
@@ -53,6 +60,8 @@ resource "aws_iam_role" "ec2_role" {
       }
     ]
   })
+
+  tags = local.common_tags
 }
 
 resource "aws_iam_role_policy_attachment" "s3_access" {
@@ -63,6 +72,8 @@ resource "aws_iam_role_policy_attachment" "s3_access" {
 resource "aws_iam_instance_profile" "ec2_profile" {
   name = "${var.project_name}-${var.environment}-ec2-profile"
   role = aws_iam_role.ec2_role.name
+
+  tags = local.common_tags
 }
 
 resource "aws_launch_template" "app" {
@@ -102,16 +113,10 @@ resource "aws_launch_template" "app" {
 
   tag_specifications {
     resource_type = "instance"
-    tags = {
-      Environment = var.environment
-      Project     = var.project_name
-    }
+    tags          = local.common_tags
   }
 
-  tags = {
-    Environment = var.environment
-    Project     = var.project_name
-  }
+  tags = local.common_tags
 }
 
 resource "aws_autoscaling_group" "app" {
@@ -138,4 +143,10 @@ resource "aws_autoscaling_group" "app" {
     value               = var.project_name
     propagate_at_launch = true
   }
+
+  tag {
+    key                 = "ManagedBy"
+    value               = "terraform"
+    propagate_at_launch = true
+  }
 }
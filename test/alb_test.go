@@ -5,236 +5,179 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"test/utils"
 )
 
 func TestALBModule(t *testing.T) {
 	t.Parallel()
 
-	// Use the same workingDir for both stages
-	workingDir := test_structure.CopyTerraformFolderToTemp(t, "../", "modules/alb")
-
-	// Generate a random name to prevent a naming conflict
-	uniqueID := strings.ToLower(random.UniqueId()) // The module lowercases the project name
-	projectName := fmt.Sprintf("%s", uniqueID)
-
-	// Test cases
-	testCases := []struct {
-		name           string
-		region         string
-		environment    string
-		certificateArn string
-		apps           map[string]interface{}
-	}{
-		{
-			name:           "us-east-1-ci",
-			region:         "us-east-1",
-			environment:    "ci",
-			certificateArn: "arn:aws:acm:us-east-1:683721267198:certificate/aa67a8ae-f2fe-4cef-95e6-a676fd11f5be", // Replace with a valid certificate ARN for testing
-			apps: map[string]interface{}{
-				"app1": map[string]interface{}{
-					"port":             8085,
-					"path":             "/app1/*",
-					"health_check_url": "/app1/status",
-					"domain":           []string{"merkata.cloudns.be"},
-					"priority":         100,
-				},
-				"app2": map[string]interface{}{
-					"port":             8086,
-					"path":             "/app2/*",
-					"health_check_url": "/app2/status",
-					"domain":           []string{"merkata.cloudns.be"},
-					"priority":         200,
-				},
-			},
-		},
-	}
-
-	for _, testCase := range testCases {
-		tc := testCase // Required to avoid variable capture in closure
-
-		t.Run(tc.name, func(t *testing.T) {
-			t.Parallel()
+	loadTestMatrix(t).Run(t, utils.MatrixTestALB, func(t *testing.T, tc utils.MatrixCase) {
+		// Use the same workingDir for both stages
+		workingDir := test_structure.CopyTerraformFolderToTemp(t, "../", "modules/alb")
 
-			// Create VPC first as ALB depends on it
-			vpcOpts := createVPC(t, tc.region, tc.environment, projectName)
-			defer terraform.Destroy(t, vpcOpts)
+		// Generate a random name to prevent a naming conflict
+		uniqueID := strings.ToLower(random.UniqueId()) // The module lowercases the project name
+		projectName := fmt.Sprintf("alb%s", uniqueID)
 
-			// Deploy VPC and get outputs
-			terraform.InitAndApply(t, vpcOpts)
-			vpcID := terraform.Output(t, vpcOpts, "vpc_id")
-			publicSubnets := terraform.OutputList(t, vpcOpts, "public_subnets")
-
-			// Set up ALB options
-			terraformOptions := &terraform.Options{
+		albOptions := func(vpcID string, publicSubnets []string, certificateArn string) *terraform.Options {
+			return &terraform.Options{
 				TerraformDir: workingDir,
 				Vars: map[string]interface{}{
-					"environment":     tc.environment,
+					"environment":     tc.Environment,
 					"project_name":    projectName,
 					"vpc_id":          vpcID,
 					"public_subnets":  publicSubnets,
-					"certificate_arn": tc.certificateArn,
-					"apps":            tc.apps,
+					"certificate_arn": certificateArn,
+					"apps":            tc.Apps.ToVars(),
 				},
 				EnvVars: map[string]string{
-					"AWS_DEFAULT_REGION": tc.region,
+					"AWS_DEFAULT_REGION": tc.Region,
 				},
 			}
+		}
+
+		// In plan mode only validate the planned values, using placeholder network inputs
+		if utils.IsPlanMode() {
+			plan := utils.InitAndPlanOffline(t, albOptions(utils.PlanVPCID, utils.PlanPublicSubnets(), utils.PlanCertificateArn), t.TempDir())
+			validateALBPlan(t, plan, tc.Environment, projectName, tc.Apps)
+			return
+		}
+
+		// Clean up resources when the test finishes
+		defer test_structure.RunTestStage(t, utils.StageTeardown, func() {
+			// A deploy that failed before saving its options left no ALB behind
+			if test_structure.IsTestDataPresent(t, test_structure.FormatTestDataPath(workingDir, "TerraformOptions.json")) {
+				deployedOptions := test_structure.LoadTerraformOptions(t, workingDir)
+				// Deletion protection is on in prod, so it is turned off first
+				utils.Destroy(t, deployedOptions)
+				// The certificate was imported for this ALB, so it goes once the ALB is destroyed
+				if certificateArn, ok := deployedOptions.Vars["certificate_arn"].(string); ok {
+					assert.NoError(t, utils.DeleteCertificateE(utils.CreateClients(tc.Region).ACM, certificateArn, utils.CertificateDeleteWaitOptions()))
+				}
+			}
+		})
+
+		// The ALB deploys into the VPC shared with the other module tests
+		vpc := sharedFixtures.VPCStage(t, workingDir, tc.Region, tc.Environment, tc.VPCCIDR)
 
-			// Clean up resources when the test finishes
-			defer terraform.Destroy(t, terraformOptions)
+		// Deploy the ALB
+		test_structure.RunTestStage(t, utils.StageDeployALB, func() {
+			// A self-signed certificate for the apps' domains, so the test runs in any account
+			certificateArn, err := utils.ImportSelfSignedCertificateE(utils.CreateClients(tc.Region).ACM, tc.Apps.Domains(),
+				24*time.Hour, map[string]string{"Environment": tc.Environment, "Project": projectName})
+			require.NoError(t, err)
 
-			// Deploy the ALB
+			terraformOptions := albOptions(vpc.ID, vpc.PublicSubnets, certificateArn)
+			test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
 			terraform.InitAndApply(t, terraformOptions)
+			utils.AssertIdempotent(t, terraformOptions, t.TempDir())
+			utils.SaveOutputs(t, workingDir, terraformOptions)
+		})
 
-			// Get outputs
-			albDNSName := terraform.Output(t, terraformOptions, "alb_dns_name")
-			albName := terraform.Output(t, terraformOptions, "alb_name")
-			targetGroupArns := terraform.OutputMap(t, terraformOptions, "target_group_arns")
-			albSGID := terraform.Output(t, terraformOptions, "alb_security_group_id")
+		test_structure.RunTestStage(t, utils.StageValidate, func() {
+			// A rerun has a new random name, so use the one the ALB was deployed with
+			deployedProject := test_structure.LoadTerraformOptions(t, workingDir).Vars["project_name"].(string)
+			outputs := utils.LoadOutputs(t, workingDir)
 
-			// Create AWS ELBv2 client
-			elbv2Client := createELBv2Client(tc.region)
+			// Create AWS clients
+			clients := utils.CreateClients(tc.Region)
+			elbv2Client := clients.ELBv2
 
 			// Test ALB Configuration
-			testALBConfiguration(t, elbv2Client, albDNSName, tc.environment, projectName)
+			testALBConfiguration(t, elbv2Client, outputs.String("alb_dns_name"), tc.Environment, deployedProject)
 
 			// Test Target Groups
-			testTargetGroups(t, elbv2Client, targetGroupArns, tc.apps, vpcID)
+			testTargetGroups(t, elbv2Client, outputs.Map("target_group_arns"), tc.Apps, vpc.ID,
+				utils.RequiredTags(tc.Environment, deployedProject))
 
 			// Test Listener Rules
-			testListenerRules(t, elbv2Client, albName, tc.apps)
+			testListenerRules(t, elbv2Client, outputs.String("alb_name"), tc.Apps)
 
 			// Test Security Group Rules
-			testSecurityGroupRules(t, tc.region, albSGID, tc.apps)
+			testSecurityGroupRules(t, clients.EC2, outputs.String("alb_security_group_id"), tc.Apps)
 		})
-	}
-}
-
-func createVPC(t *testing.T, region, environment, projectName string) *terraform.Options {
-	return &terraform.Options{
-		TerraformDir: "../modules/vpc",
-		Vars: map[string]interface{}{
-			"environment":  environment,
-			"project_name": projectName,
-			"vpc_cidr":     "10.0.0.0/16",
-		},
-		EnvVars: map[string]string{
-			"AWS_DEFAULT_REGION": region,
-		},
-	}
-}
-
-func createELBv2Client(region string) *elbv2.ELBV2 {
-	return elbv2.New(createSession(region))
+	})
 }
 
-func testALBConfiguration(t *testing.T, client *elbv2.ELBV2, albDNSName, environment, projectName string) {
-	// Get ALB by DNS name
-	input := &elbv2.DescribeLoadBalancersInput{
-		Names: []*string{aws.String(fmt.Sprintf("%s-%s-alb", projectName, environment))},
-	}
-
-	result, err := client.DescribeLoadBalancers(input)
+func testALBConfiguration(t utils.AssertT, client utils.ELBv2API, albDNSName, environment, projectName string) {
+	alb, err := utils.DescribeALBE(client, fmt.Sprintf("%s-%s-alb", projectName, environment))
 	require.NoError(t, err)
-	require.Len(t, result.LoadBalancers, 1)
-
-	alb := result.LoadBalancers[0]
 
 	// Verify ALB configuration
-	assert.Equal(t, "application", *alb.Type)
-	assert.False(t, *alb.Scheme == "internal")
-	assert.Equal(t, albDNSName, *alb.DNSName)
+	assert.Equal(t, "application", alb.Type)
+	assert.False(t, alb.Scheme == "internal")
+	assert.Equal(t, albDNSName, alb.DNSName)
 
-	// Check ALB Tags
-	tagsInput := &elbv2.DescribeTagsInput{
-		ResourceArns: []*string{alb.LoadBalancerArn},
-	}
-
-	tagsOutput, err := client.DescribeTags(tagsInput)
-	require.NoError(t, err)
-	require.Len(t, tagsOutput.TagDescriptions, 1)
+	// Deletion protection is only on in prod
+	assert.Equal(t, environment == "prod", alb.DeletionProtection, "deletion protection of %s", alb.Name)
 
-	hasExpectedTags := hasRequiredELBTags(tagsOutput.TagDescriptions[0].Tags, map[string]string{
-		"Environment": environment,
-		"Project":     projectName,
-		"ManagedBy":   "terraform",
+	// Check ALB Tags
+	utils.AssertTagPolicy(t, utils.RequiredTags(environment, projectName), utils.TaggedResource{
+		Kind: "load balancer",
+		ID:   alb.ARN,
+		Tags: alb.Tags,
 	})
-	assert.True(t, hasExpectedTags)
 }
 
-func testTargetGroups(t *testing.T, client *elbv2.ELBV2, targetGroupArns map[string]string, apps map[string]interface{}, vpcID string) {
+func testTargetGroups(t utils.AssertT, client utils.ELBv2API, targetGroupArns map[string]string, apps utils.Apps, vpcID string, policy utils.TagPolicy) {
+	var names, arns []string
 	for appName, arn := range targetGroupArns {
-		input := &elbv2.DescribeTargetGroupsInput{
-			TargetGroupArns: []*string{aws.String(arn)},
-		}
+		names = append(names, appName)
+		arns = append(arns, arn)
+	}
+	targetGroups, err := utils.DescribeTargetGroupsE(client, arns)
+	require.NoError(t, err)
 
-		result, err := client.DescribeTargetGroups(input)
-		require.NoError(t, err)
-		require.Len(t, result.TargetGroups, 1)
+	var tagged []utils.TaggedResource
+	for i, tg := range targetGroups {
+		tagged = append(tagged, utils.TaggedResource{Kind: "target group", ID: tg.ARN, Tags: tg.Tags})
 
-		tg := result.TargetGroups[0]
-		app := apps[appName].(map[string]interface{})
+		app, ok := apps[names[i]]
+		if !ok {
+			t.Errorf("Target group %s does not belong to any configured app", names[i])
+			continue
+		}
 
 		// Verify target group configuration
-		assert.Equal(t, vpcID, *tg.VpcId)
-		assert.Equal(t, "HTTP", *tg.Protocol)
-		assert.Equal(t, int64(app["port"].(int)), *tg.Port)
+		assert.Equal(t, vpcID, tg.VpcID)
+		assert.Equal(t, "HTTP", tg.Protocol)
+		assert.Equal(t, app.Port, tg.Port)
 
 		// Verify health check configuration
-		assert.Equal(t, app["health_check_url"].(string), *tg.HealthCheckPath)
-		assert.Equal(t, int64(3), *tg.HealthyThresholdCount)
-		assert.Equal(t, int64(3), *tg.UnhealthyThresholdCount)
+		assert.Equal(t, app.HealthCheckURL, tg.HealthCheckPath)
+		assert.Equal(t, 3, tg.HealthyThreshold)
+		assert.Equal(t, 3, tg.UnhealthyThreshold)
 	}
-}
 
-func testListenerRules(t *testing.T, client *elbv2.ELBV2, albName string, apps map[string]interface{}) {
-	// Get ALB by name
-	input := &elbv2.DescribeLoadBalancersInput{
-		Names: []*string{aws.String(albName)},
-	}
+	// Verify tags
+	utils.AssertTagPolicy(t, policy, tagged...)
+}
 
-	result, err := client.DescribeLoadBalancers(input)
+func testListenerRules(t utils.AssertT, client utils.ELBv2API, albName string, apps utils.Apps) {
+	alb, err := utils.DescribeALBE(client, albName)
 	require.NoError(t, err)
-	require.Len(t, result.LoadBalancers, 1)
-
-	listenersInput := &elbv2.DescribeListenersInput{
-		LoadBalancerArn: result.LoadBalancers[0].LoadBalancerArn,
-	}
 
-	listeners, err := client.DescribeListeners(listenersInput)
+	// Check the HTTPS listener's rules
+	rules, err := utils.DescribeListenerRulesE(client, alb.ARN, "HTTPS")
 	require.NoError(t, err)
 
-	// Find HTTPS listener
-	var httpsListener *elbv2.Listener
-	for _, listener := range listeners.Listeners {
-		if listener != nil && listener.Protocol != nil && *listener.Protocol == "HTTPS" {
-			httpsListener = listener
-			break
-		}
-	}
-	require.NotNil(t, httpsListener, "HTTPS listener not found")
-
-	// Check listener rules
-	rulesInput := &elbv2.DescribeRulesInput{
-		ListenerArn: httpsListener.ListenerArn,
-	}
-
-	rules, err := client.DescribeRules(rulesInput)
+	// No app may shadow another one's host and path
+	listenerRules, err := utils.RulesFromELBv2(rules)
 	require.NoError(t, err)
+	utils.AssertNoRuleConflicts(t, listenerRules)
 
 	// Create a map of rules by priority for easier lookup
 	rulesByPriority := make(map[int]*elbv2.Rule)
-	for _, rule := range rules.Rules {
+	for _, rule := range rules {
 		if rule != nil && rule.Priority != nil && *rule.Priority != "default" {
 			priority, err := strconv.Atoi(*rule.Priority)
 			if err != nil {
@@ -257,9 +200,8 @@ func testListenerRules(t *testing.T, client *elbv2.ELBV2, albName string, apps m
 	}
 
 	// Verify each app's configuration
-	for appName, appConfig := range apps {
-		app := appConfig.(map[string]interface{})
-		priority := app["priority"].(int)
+	for appName, app := range apps {
+		priority := app.Priority
 
 		t.Logf("Checking app %s with priority %d", appName, priority)
 
@@ -285,7 +227,7 @@ func testListenerRules(t *testing.T, client *elbv2.ELBV2, albName string, apps m
 		require.NotNil(t, pathCondition.PathPatternConfig, "Path pattern config is nil for app %s", appName)
 		require.NotEmpty(t, pathCondition.PathPatternConfig.Values, "Path pattern values are empty for app %s", appName)
 
-		expectedPath := app["path"].(string)
+		expectedPath := app.Path
 		actualPath := *pathCondition.PathPatternConfig.Values[0]
 		if expectedPath != actualPath {
 			t.Errorf("Path pattern mismatch for app %s (priority %d):\nExpected: %s\nActual: %s",
@@ -298,7 +240,8 @@ func testListenerRules(t *testing.T, client *elbv2.ELBV2, albName string, apps m
 		require.NotNil(t, hostCondition.HostHeaderConfig, "Host header config is nil for app %s", appName)
 		require.NotEmpty(t, hostCondition.HostHeaderConfig.Values, "Host header values are empty for app %s", appName)
 
-		expectedDomain := app["domain"].([]string)[0]
+		require.NotEmpty(t, app.Domain, "No domain configured for app %s", appName)
+		expectedDomain := app.Domain[0]
 		actualDomain := *hostCondition.HostHeaderConfig.Values[0]
 		if expectedDomain != actualDomain {
 			t.Errorf("Host header mismatch for app %s (priority %d):\nExpected: %s\nActual: %s",
@@ -307,18 +250,11 @@ func testListenerRules(t *testing.T, client *elbv2.ELBV2, albName string, apps m
 	}
 }
 
-func testSecurityGroupRules(t *testing.T, region, sgID string, apps map[string]interface{}) {
-	ec2Client := createEC2Client(region)
-
-	input := &ec2.DescribeSecurityGroupsInput{
-		GroupIds: []*string{aws.String(sgID)},
-	}
-
-	result, err := ec2Client.DescribeSecurityGroups(input)
+func testSecurityGroupRules(t utils.AssertT, ec2Client utils.EC2API, sgID string, apps utils.Apps) {
+	groups, err := utils.DescribeSecurityGroupsE(ec2Client, sgID)
 	require.NoError(t, err)
-	require.Len(t, result.SecurityGroups, 1)
 
-	sg := result.SecurityGroups[0]
+	sg := groups[0]
 
 	// Verify inbound rules
 	foundHTTP := false
@@ -343,27 +279,3 @@ func testSecurityGroupRules(t *testing.T, region, sgID string, apps map[string]i
 	require.Len(t, sg.IpPermissionsEgress, 1)
 	assert.Equal(t, "-1", *sg.IpPermissionsEgress[0].IpProtocol) // All traffic
 }
-
-func hasRequiredELBTags(tags []*elbv2.Tag, requiredTags map[string]string) bool {
-	tagMap := make(map[string]string)
-	for _, tag := range tags {
-		tagMap[*tag.Key] = *tag.Value
-	}
-
-	for key, value := range requiredTags {
-		if tagMap[key] != value {
-			return false
-		}
-	}
-	return true
-}
-
-func createSession(region string) *session.Session {
-	return session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(region),
-	}))
-}
-
-func createEC2Client(region string) *ec2.EC2 {
-	return ec2.New(createSession(region))
-}
@@ -0,0 +1,320 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/fakeaws"
+	"test/utils"
+)
+
+// recordingT collects assertion failures instead of failing the test, so the
+// helpers can be checked for the problems they are supposed to catch
+type recordingT struct {
+	mu     sync.Mutex
+	errors []string
+	failed bool
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) FailNow() {
+	r.mu.Lock()
+	r.failed = true
+	r.mu.Unlock()
+	runtime.Goexit()
+}
+
+func (r *recordingT) Logf(format string, args ...interface{}) {}
+
+// record runs an assertion helper in its own goroutine, as FailNow must stop it
+func record(fn func(t utils.AssertT)) *recordingT {
+	r := &recordingT{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(r)
+	}()
+	<-done
+	return r
+}
+
+func (r *recordingT) passed() bool {
+	return !r.failed && len(r.errors) == 0
+}
+
+func TestAssertionHelpersPassOnHealthyDeployment(t *testing.T) {
+	d := newFakeDeployment("ci", "demo")
+	server := fakeaws.Start(t, d.Fixtures())
+
+	clients := utils.CreateClients(d.Region)
+	elbv2Client := clients.ELBv2
+	ec2Client := clients.EC2
+	asgClient := clients.AutoScaling
+	iamClient := clients.IAM
+
+	testALBConfiguration(t, elbv2Client, d.ALBDNSName, d.Environment, d.ProjectName)
+	testTargetGroups(t, elbv2Client, d.TargetGroupArns, d.Apps, d.VPCID, d.tagPolicy())
+	testListenerRules(t, elbv2Client, d.ALBName, d.Apps)
+	testSecurityGroupRules(t, ec2Client, d.ALBSecurityGroupID, d.Apps)
+	testRouteTopology(t, ec2Client, d.VPCID, d.PrivateSubnets, d.PublicSubnets, d.Environment)
+
+	testLaunchTemplate(t, ec2Client, d.LaunchTemplateID, d.computeVars())
+	testAutoScalingGroup(t, asgClient, d.ASGName, d.computeVars())
+	testIAMConfiguration(t, iamClient, d.RoleName, d.tagPolicy())
+	testSecurityGroup(t, ec2Client, d.EC2SecurityGroupID, d.Apps, d.tagPolicy())
+	testSecurityGroupReachability(t, ec2Client, d.ALBSecurityGroupID, d.EC2SecurityGroupID, d.Apps)
+
+	// Every helper should have gone through the fake endpoint
+	assert.Contains(t, server.Calls(), "elasticloadbalancing:DescribeRules")
+	assert.Contains(t, server.Calls(), "ec2:DescribeLaunchTemplateVersions")
+	assert.Contains(t, server.Calls(), "autoscaling:DescribeAutoScalingGroups")
+	assert.Contains(t, server.Calls(), "iam:ListAttachedRolePolicies")
+}
+
+func TestAssertionHelpersDetectMisconfiguration(t *testing.T) {
+	testCases := []struct {
+		name string
+		// environment of the deployment, ci if empty
+		environment string
+		mutate      func(d *fakeDeployment, f *fakeaws.Fixtures)
+		check       func(t utils.AssertT, c *utils.Clients, d *fakeDeployment)
+	}{
+		{
+			name: "alb missing ManagedBy tag",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.ELBTags[d.ALBArn] = elbTags(map[string]string{"Environment": d.Environment, "Project": d.ProjectName})
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testALBConfiguration(t, c.ELBv2, d.ALBDNSName, d.Environment, d.ProjectName)
+			},
+		},
+		{
+			name:        "alb without deletion protection in prod",
+			environment: "prod",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				delete(f.LoadBalancerAttributes, d.ALBArn)
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testALBConfiguration(t, c.ELBv2, d.ALBDNSName, d.Environment, d.ProjectName)
+			},
+		},
+		{
+			name: "target group on the wrong port",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.TargetGroups[0].Port = aws.Int64(9090)
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testTargetGroups(t, c.ELBv2, d.TargetGroupArns, d.Apps, d.VPCID, d.tagPolicy())
+			},
+		},
+		{
+			name: "target group missing ManagedBy tag",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.ELBTags[d.TargetGroupArns["app1"]] = elbTags(map[string]string{"Environment": d.Environment, "Project": d.ProjectName})
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testTargetGroups(t, c.ELBv2, d.TargetGroupArns, d.Apps, d.VPCID, d.tagPolicy())
+			},
+		},
+		{
+			name: "listener rule with the wrong host",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.Rules[d.HTTPSListenerArn][1].Conditions[1].HostHeaderConfig.Values = aws.StringSlice([]string{"example.com"})
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testListenerRules(t, c.ELBv2, d.ALBName, d.Apps)
+			},
+		},
+		{
+			name: "listener rule shadowed by a catch-all",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				// The app rules are untouched, but never match
+				f.Rules[d.HTTPSListenerArn] = append(f.Rules[d.HTTPSListenerArn], &elbv2.Rule{
+					RuleArn:  aws.String(d.HTTPSListenerArn + "/rule-catchall"),
+					Priority: aws.String("10"),
+					Conditions: []*elbv2.RuleCondition{{
+						Field:             aws.String("path-pattern"),
+						PathPatternConfig: &elbv2.PathPatternConditionConfig{Values: aws.StringSlice([]string{"/*"})},
+					}},
+				})
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testListenerRules(t, c.ELBv2, d.ALBName, d.Apps)
+			},
+		},
+		{
+			name: "alb security group without https",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.SecurityGroups[0].IpPermissions = f.SecurityGroups[0].IpPermissions[:1]
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testSecurityGroupRules(t, c.EC2, d.ALBSecurityGroupID, d.Apps)
+			},
+		},
+		{
+			name: "launch template volume too small",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.LaunchTemplateVersions[0].LaunchTemplateData.BlockDeviceMappings[0].Ebs.VolumeSize = aws.Int64(8)
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testLaunchTemplate(t, c.EC2, d.LaunchTemplateID, d.computeVars())
+			},
+		},
+		{
+			name: "autoscaling group scaled in",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.AutoScalingGroups[0].DesiredCapacity = aws.Int64(1)
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testAutoScalingGroup(t, c.AutoScaling, d.ASGName, d.computeVars())
+			},
+		},
+		{
+			name: "role without s3 read access",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				delete(f.AttachedRolePolicies, d.RoleName)
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testIAMConfiguration(t, c.IAM, d.RoleName, d.tagPolicy())
+			},
+		},
+		{
+			name: "role missing Project tag",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.Roles[0].Tags = iamTags(map[string]string{"Environment": d.Environment, "ManagedBy": "terraform"})
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testIAMConfiguration(t, c.IAM, d.RoleName, d.tagPolicy())
+			},
+		},
+		{
+			name: "ec2 security group missing Project tag",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.SecurityGroups[1].Tags = ec2Tags(map[string]string{"Environment": d.Environment, "ManagedBy": "terraform"})
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testSecurityGroup(t, c.EC2, d.EC2SecurityGroupID, d.Apps, d.tagPolicy())
+			},
+		},
+		{
+			name: "ec2 security group with an extra port",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				sg := f.SecurityGroups[1]
+				sg.IpPermissions = append(sg.IpPermissions, &ec2.IpPermission{
+					FromPort:   aws.Int64(22),
+					ToPort:     aws.Int64(22),
+					IpProtocol: aws.String("tcp"),
+					IpRanges:   []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+				})
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testSecurityGroup(t, c.EC2, d.EC2SecurityGroupID, d.Apps, d.tagPolicy())
+			},
+		},
+		{
+			name: "app port open to the internet instead of the alb",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				// Still one rule per app port, so only the reachability check notices
+				rule := f.SecurityGroups[1].IpPermissions[0]
+				rule.UserIdGroupPairs = nil
+				rule.IpRanges = []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testSecurityGroup(t, c.EC2, d.EC2SecurityGroupID, d.Apps, d.tagPolicy())
+				testSecurityGroupReachability(t, c.EC2, d.ALBSecurityGroupID, d.EC2SecurityGroupID, d.Apps)
+			},
+		},
+		{
+			name: "private subnet behind a deleted nat gateway",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.RouteTables[2].Routes[1].State = aws.String(ec2.RouteStateBlackhole)
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testRouteTopology(t, c.EC2, d.VPCID, d.PrivateSubnets, d.PublicSubnets, d.Environment)
+			},
+		},
+		{
+			name: "private subnet routed through the internet gateway",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.RouteTables[2].Routes[1] = f.RouteTables[1].Routes[1]
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testRouteTopology(t, c.EC2, d.VPCID, d.PrivateSubnets, d.PublicSubnets, d.Environment)
+			},
+		},
+		{
+			name:        "prod private subnet using another az's nat gateway",
+			environment: "prod",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				// Move the second private subnet to the first AZ's route table
+				f.RouteTables[2].Associations = append(f.RouteTables[2].Associations, f.RouteTables[3].Associations...)
+				f.RouteTables[3].Associations = nil
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testRouteTopology(t, c.EC2, d.VPCID, d.PrivateSubnets, d.PublicSubnets, d.Environment)
+			},
+		},
+		{
+			name: "missing https listener",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.Listeners = []*elbv2.Listener{f.Listeners[0]}
+			},
+			check: func(t utils.AssertT, c *utils.Clients, d *fakeDeployment) {
+				testListenerRules(t, c.ELBv2, d.ALBName, d.Apps)
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+
+		t.Run(tc.name, func(t *testing.T) {
+			environment := tc.environment
+			if environment == "" {
+				environment = "ci"
+			}
+			d := newFakeDeployment(environment, "demo")
+			fixtures := d.Fixtures()
+			tc.mutate(d, fixtures)
+			fakeaws.Start(t, fixtures)
+			clients := utils.CreateClients(d.Region)
+
+			result := record(func(rt utils.AssertT) { tc.check(rt, clients, d) })
+			require.False(t, result.passed(), "helper should have reported the misconfiguration")
+			t.Logf("Reported: %v", result.errors)
+		})
+	}
+}
+
+// failingELBv2 is a stub client whose calls all fail, standing in for an
+// unreachable or throttled API
+type failingELBv2 struct {
+	utils.ELBv2API
+}
+
+func (failingELBv2) DescribeLoadBalancers(*elbv2.DescribeLoadBalancersInput) (*elbv2.DescribeLoadBalancersOutput, error) {
+	return nil, errors.New("throttled")
+}
+
+func TestAssertionHelpersAcceptStubClients(t *testing.T) {
+	d := newFakeDeployment("ci", "demo")
+
+	result := record(func(rt utils.AssertT) {
+		testALBConfiguration(rt, failingELBv2{}, d.ALBDNSName, d.Environment, d.ProjectName)
+	})
+	assert.True(t, result.failed, "an API error should stop the helper")
+}
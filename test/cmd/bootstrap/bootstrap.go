@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+
+	"test/utils"
+)
+
+// STSAPI is the subset of the STS client used to check the credentials
+type STSAPI interface {
+	GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error)
+}
+
+// S3API is the subset of the S3 client used to check the state bucket
+type S3API interface {
+	HeadBucket(*s3.HeadBucketInput) (*s3.HeadBucketOutput, error)
+	GetBucketVersioning(*s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error)
+	GetBucketEncryption(*s3.GetBucketEncryptionInput) (*s3.GetBucketEncryptionOutput, error)
+	GetPublicAccessBlock(*s3.GetPublicAccessBlockInput) (*s3.GetPublicAccessBlockOutput, error)
+}
+
+// DynamoDBAPI is the subset of the DynamoDB client used to check the lock table
+type DynamoDBAPI interface {
+	DescribeTable(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error)
+}
+
+// Terraform plans and applies the backend module
+type Terraform interface {
+	Plan() (string, error)
+	Apply() (string, error)
+}
+
+// lockKey is the attribute terraform's S3 backend locks on
+const lockKey = "LockID"
+
+// Bootstrapper makes sure the state bucket and lock table the backend module
+// defines exist and are configured like it configures them
+type Bootstrapper struct {
+	Config    *Config
+	STS       STSAPI
+	S3        S3API
+	DynamoDB  DynamoDBAPI
+	Terraform Terraform
+	// Yes applies the backend module without asking
+	Yes bool
+	In  io.Reader
+	Out io.Writer
+}
+
+// Check prints the configuration Bootstrap would work with. It needs neither
+// credentials nor network access.
+func Check(config *Config, out io.Writer) {
+	fmt.Fprintf(out, "backend module: %s\n", config.Dir)
+	fmt.Fprintf(out, "variables: %s\n", config.VarFile)
+	fmt.Fprintf(out, "region: %s\n", config.Region)
+	fmt.Fprintf(out, "project: %s\n", config.ProjectName)
+	fmt.Fprintf(out, "state bucket: %s\n", config.StateBucketName)
+	fmt.Fprintf(out, "lock table: %s\n", config.DynamoDBTableName)
+	if len(config.Tags) > 0 {
+		keys := make([]string, 0, len(config.Tags))
+		for key := range config.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(out, "tag %s: %s\n", key, config.Tags[key])
+		}
+	}
+}
+
+// Bootstrap verifies the credentials and checks the state bucket and lock table.
+// When either is missing or misconfigured it plans the backend module and, once
+// confirmed, applies it.
+func (b *Bootstrapper) Bootstrap() error {
+	identity, err := b.STS.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("AWS credentials are not configured: %w", err)
+	}
+	fmt.Fprintf(b.Out, "using account %s as %s\n", aws.StringValue(identity.Account), aws.StringValue(identity.Arn))
+
+	problems, err := b.CheckBackend()
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Fprintf(b.Out, "state bucket %s and lock table %s are up to date\n", b.Config.StateBucketName, b.Config.DynamoDBTableName)
+		return nil
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(b.Out, problem)
+	}
+
+	plan, err := b.Terraform.Plan()
+	if err != nil {
+		return fmt.Errorf("planning %s: %w", b.Config.Dir, err)
+	}
+	fmt.Fprintln(b.Out, plan)
+	if !b.Yes && !b.confirm("Apply the backend module?") {
+		return errors.New("cannot proceed without the backend infrastructure")
+	}
+	if _, err := b.Terraform.Apply(); err != nil {
+		return fmt.Errorf("applying %s: %w", b.Config.Dir, err)
+	}
+	fmt.Fprintln(b.Out, "backend infrastructure is up to date")
+	return nil
+}
+
+// CheckBackend returns every way the state bucket and lock table differ from the
+// backend module, a missing one being a single problem
+func (b *Bootstrapper) CheckBackend() ([]string, error) {
+	bucketProblems, err := b.checkBucket()
+	if err != nil {
+		return nil, err
+	}
+	tableProblems, err := b.checkTable()
+	if err != nil {
+		return nil, err
+	}
+	return append(bucketProblems, tableProblems...), nil
+}
+
+func (b *Bootstrapper) checkBucket() ([]string, error) {
+	bucket := aws.String(b.Config.StateBucketName)
+	name := "state bucket " + b.Config.StateBucketName
+
+	_, err := b.S3.HeadBucket(&s3.HeadBucketInput{Bucket: bucket})
+	var failure awserr.RequestFailure
+	if errors.As(err, &failure) {
+		switch failure.StatusCode() {
+		case http.StatusNotFound:
+			return []string{name + " does not exist"}, nil
+		case http.StatusForbidden:
+			// Bucket names are global, so it may well be someone else's
+			return nil, fmt.Errorf("%s exists but this account cannot access it, pick another name in %s", name, b.Config.VarFile)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checking %s: %w", name, err)
+	}
+
+	var problems []string
+	versioning, err := b.S3.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: bucket})
+	if err != nil {
+		return nil, fmt.Errorf("checking %s versioning: %w", name, err)
+	}
+	if aws.StringValue(versioning.Status) != s3.BucketVersioningStatusEnabled {
+		problems = append(problems, name+" does not have versioning enabled")
+	}
+
+	encrypted := false
+	encryption, err := b.S3.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: bucket})
+	if err != nil && !isCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+		return nil, fmt.Errorf("checking %s encryption: %w", name, err)
+	}
+	if err == nil && encryption.ServerSideEncryptionConfiguration != nil {
+		for _, rule := range encryption.ServerSideEncryptionConfiguration.Rules {
+			if rule.ApplyServerSideEncryptionByDefault != nil &&
+				aws.StringValue(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm) == s3.ServerSideEncryptionAes256 {
+				encrypted = true
+			}
+		}
+	}
+	if !encrypted {
+		problems = append(problems, name+" is not encrypted with AES256 by default")
+	}
+
+	block, err := b.S3.GetPublicAccessBlock(&s3.GetPublicAccessBlockInput{Bucket: bucket})
+	if err != nil && !isCode(err, "NoSuchPublicAccessBlockConfiguration") {
+		return nil, fmt.Errorf("checking %s public access block: %w", name, err)
+	}
+	if err != nil || !publicAccessBlocked(block.PublicAccessBlockConfiguration) {
+		problems = append(problems, name+" does not block all public access")
+	}
+	return problems, nil
+}
+
+func publicAccessBlocked(config *s3.PublicAccessBlockConfiguration) bool {
+	return config != nil &&
+		aws.BoolValue(config.BlockPublicAcls) && aws.BoolValue(config.BlockPublicPolicy) &&
+		aws.BoolValue(config.IgnorePublicAcls) && aws.BoolValue(config.RestrictPublicBuckets)
+}
+
+func (b *Bootstrapper) checkTable() ([]string, error) {
+	name := "lock table " + b.Config.DynamoDBTableName
+	output, err := b.DynamoDB.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(b.Config.DynamoDBTableName)})
+	if isCode(err, dynamodb.ErrCodeResourceNotFoundException) {
+		return []string{name + " does not exist"}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checking %s: %w", name, err)
+	}
+
+	var problems []string
+	table := output.Table
+	hashKey := ""
+	for _, key := range table.KeySchema {
+		if aws.StringValue(key.KeyType) == dynamodb.KeyTypeHash {
+			hashKey = aws.StringValue(key.AttributeName)
+		}
+	}
+	hashKeyType := ""
+	for _, attribute := range table.AttributeDefinitions {
+		if aws.StringValue(attribute.AttributeName) == hashKey {
+			hashKeyType = aws.StringValue(attribute.AttributeType)
+		}
+	}
+	if hashKey != lockKey || hashKeyType != dynamodb.ScalarAttributeTypeS {
+		problems = append(problems, fmt.Sprintf("%s has hash key %s (%s) instead of %s (S)", name, hashKey, hashKeyType, lockKey))
+	}
+	if table.BillingModeSummary == nil || aws.StringValue(table.BillingModeSummary.BillingMode) != dynamodb.BillingModePayPerRequest {
+		problems = append(problems, name+" is not billed per request")
+	}
+	return problems, nil
+}
+
+func isCode(err error, code string) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == code
+}
+
+// confirm asks a yes or no question on Out and reads the answer from In. Anything
+// but yes, including no input at all, is no.
+func (b *Bootstrapper) confirm(question string) bool {
+	fmt.Fprintf(b.Out, "%s (y/n) ", question)
+	answer, _ := bufio.NewReader(b.In).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// terraformRunner runs the backend module with terratest
+type terraformRunner struct {
+	t       testing.TestingT
+	options *terraform.Options
+}
+
+func newTerraformRunner(config *Config) *terraformRunner {
+	return &terraformRunner{
+		t: utils.CLIT("bootstrap"),
+		options: &terraform.Options{
+			TerraformDir: config.Dir,
+			VarFiles:     []string{config.VarFile},
+			EnvVars: map[string]string{
+				"AWS_DEFAULT_REGION": config.Region,
+			},
+		},
+	}
+}
+
+func (r *terraformRunner) Plan() (string, error) {
+	return terraform.InitAndPlanE(r.t, r.options)
+}
+
+func (r *terraformRunner) Apply() (string, error) {
+	return terraform.InitAndApplyE(r.t, r.options)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backendDir is the real backend module
+const backendDir = "../../../backend"
+
+func writeVarFile(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	return file
+}
+
+func TestLoadConfig(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"tfvars", "terraform.tfvars", `
+project_name        = "demo"
+state_bucket_name   = "demo-terraform-state"
+dynamodb_table_name = "demo-terraform-locks" # comments and any layout are fine
+tags = {
+  Owner = "platform"
+}
+`},
+		{"json", "terraform.tfvars.json", `{
+  "project_name": "demo",
+  "state_bucket_name": "demo-terraform-state",
+  "dynamodb_table_name": "demo-terraform-locks",
+  "tags": {"Owner": "platform"}
+}`},
+	}
+
+	for _, tc := range testCases {
+		config, err := LoadConfig(backendDir, writeVarFile(t, tc.file, tc.content))
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, "us-east-1", config.Region, tc.name)
+		assert.Equal(t, "demo", config.ProjectName, tc.name)
+		assert.Equal(t, "demo-terraform-state", config.StateBucketName, tc.name)
+		assert.Equal(t, "demo-terraform-locks", config.DynamoDBTableName, tc.name)
+		assert.Equal(t, map[string]string{"Owner": "platform"}, config.Tags, tc.name)
+		assert.True(t, filepath.IsAbs(config.VarFile), tc.name)
+	}
+}
+
+func TestLoadConfigProblems(t *testing.T) {
+	file := writeVarFile(t, "terraform.tfvars", `
+state_bucket_name   = "Demo_State"
+dynamodb_table_name = ["locks"]
+region              = "eu-west-1"
+`)
+	_, err := LoadConfig(backendDir, file)
+	require.Error(t, err)
+	assert.Equal(t, file+":\n"+
+		"  dynamodb_table_name must be a string\n"+
+		"  project_name is required\n"+
+		"  region is not a variable of "+backendDir+"\n"+
+		`  state_bucket_name "Demo_State" is not a valid S3 bucket name`, err.Error())
+
+	_, err = LoadConfig(backendDir, writeVarFile(t, "terraform.tfvars", `project_name = `))
+	assert.Error(t, err, "syntax errors are reported")
+	_, err = LoadConfig(backendDir, filepath.Join(t.TempDir(), "missing.tfvars"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// fakeBackend serves the state bucket and lock table as the backend module
+// creates them, unless a test changes them
+type fakeBackend struct {
+	bucketStatus  int
+	versioning    string
+	encryption    *s3.ServerSideEncryptionConfiguration
+	publicAccess  *s3.PublicAccessBlockConfiguration
+	table         *dynamodb.TableDescription
+	plans, applys int
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		bucketStatus: http.StatusOK,
+		versioning:   s3.BucketVersioningStatusEnabled,
+		encryption: &s3.ServerSideEncryptionConfiguration{Rules: []*s3.ServerSideEncryptionRule{{
+			ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256)},
+		}}},
+		publicAccess: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls: aws.Bool(true), BlockPublicPolicy: aws.Bool(true),
+			IgnorePublicAcls: aws.Bool(true), RestrictPublicBuckets: aws.Bool(true),
+		},
+		table: &dynamodb.TableDescription{
+			KeySchema:            []*dynamodb.KeySchemaElement{{AttributeName: aws.String("LockID"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{{AttributeName: aws.String("LockID"), AttributeType: aws.String("S")}},
+			BillingModeSummary:   &dynamodb.BillingModeSummary{BillingMode: aws.String(dynamodb.BillingModePayPerRequest)},
+		},
+	}
+}
+
+func (f *fakeBackend) GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012"), Arn: aws.String("arn:aws:iam::123456789012:user/ci")}, nil
+}
+
+func (f *fakeBackend) HeadBucket(*s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+	if f.bucketStatus != http.StatusOK {
+		return nil, awserr.NewRequestFailure(awserr.New(http.StatusText(f.bucketStatus), "", nil), f.bucketStatus, "")
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (f *fakeBackend) GetBucketVersioning(*s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error) {
+	output := &s3.GetBucketVersioningOutput{}
+	if f.versioning != "" {
+		output.Status = aws.String(f.versioning)
+	}
+	return output, nil
+}
+
+func (f *fakeBackend) GetBucketEncryption(*s3.GetBucketEncryptionInput) (*s3.GetBucketEncryptionOutput, error) {
+	if f.encryption == nil {
+		return nil, awserr.New("ServerSideEncryptionConfigurationNotFoundError", "", nil)
+	}
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: f.encryption}, nil
+}
+
+func (f *fakeBackend) GetPublicAccessBlock(*s3.GetPublicAccessBlockInput) (*s3.GetPublicAccessBlockOutput, error) {
+	if f.publicAccess == nil {
+		return nil, awserr.New("NoSuchPublicAccessBlockConfiguration", "", nil)
+	}
+	return &s3.GetPublicAccessBlockOutput{PublicAccessBlockConfiguration: f.publicAccess}, nil
+}
+
+func (f *fakeBackend) DescribeTable(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	if f.table == nil {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "", nil)
+	}
+	return &dynamodb.DescribeTableOutput{Table: f.table}, nil
+}
+
+func (f *fakeBackend) Plan() (string, error) {
+	f.plans++
+	return "Plan: 5 to add, 0 to change, 0 to destroy.", nil
+}
+
+func (f *fakeBackend) Apply() (string, error) {
+	f.applys++
+	return "Apply complete! Resources: 5 added, 0 changed, 0 destroyed.", nil
+}
+
+func newBootstrapper(backend *fakeBackend, input string) (*Bootstrapper, *bytes.Buffer) {
+	var out bytes.Buffer
+	return &Bootstrapper{
+		Config:    &Config{Dir: backendDir, VarFile: "terraform.tfvars", StateBucketName: "demo-state", DynamoDBTableName: "demo-locks"},
+		STS:       backend,
+		S3:        backend,
+		DynamoDB:  backend,
+		Terraform: backend,
+		In:        strings.NewReader(input),
+		Out:       &out,
+	}, &out
+}
+
+func TestBootstrapUpToDate(t *testing.T) {
+	backend := newFakeBackend()
+	bootstrapper, out := newBootstrapper(backend, "")
+
+	require.NoError(t, bootstrapper.Bootstrap())
+	assert.Contains(t, out.String(), "using account 123456789012 as arn:aws:iam::123456789012:user/ci\n")
+	assert.Contains(t, out.String(), "state bucket demo-state and lock table demo-locks are up to date\n")
+	assert.Zero(t, backend.plans)
+	assert.Zero(t, backend.applys)
+}
+
+func TestBootstrapCreatesBackend(t *testing.T) {
+	testCases := []struct {
+		name    string
+		yes     bool
+		input   string
+		applied bool
+	}{
+		{"confirmed", false, "y\n", true},
+		{"declined", false, "n\n", false},
+		{"no input", false, "", false},
+		{"yes", true, "", true},
+	}
+
+	for _, tc := range testCases {
+		backend := newFakeBackend()
+		backend.bucketStatus = http.StatusNotFound
+		backend.table = nil
+		bootstrapper, out := newBootstrapper(backend, tc.input)
+		bootstrapper.Yes = tc.yes
+
+		err := bootstrapper.Bootstrap()
+		assert.Contains(t, out.String(), "state bucket demo-state does not exist\nlock table demo-locks does not exist\n", tc.name)
+		assert.Contains(t, out.String(), "Plan: 5 to add", tc.name)
+		assert.Equal(t, 1, backend.plans, tc.name)
+		if tc.applied {
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, 1, backend.applys, tc.name)
+		} else {
+			assert.EqualError(t, err, "cannot proceed without the backend infrastructure", tc.name)
+			assert.Zero(t, backend.applys, tc.name)
+		}
+		assert.Equal(t, !tc.yes, strings.Contains(out.String(), "Apply the backend module? (y/n)"), tc.name)
+	}
+}
+
+func TestCheckBackendMisconfigured(t *testing.T) {
+	backend := newFakeBackend()
+	backend.versioning = s3.BucketVersioningStatusSuspended
+	backend.encryption = nil
+	backend.publicAccess.RestrictPublicBuckets = aws.Bool(false)
+	backend.table.AttributeDefinitions[0].AttributeType = aws.String("N")
+	backend.table.BillingModeSummary = nil
+	bootstrapper, _ := newBootstrapper(backend, "")
+
+	problems, err := bootstrapper.CheckBackend()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"state bucket demo-state does not have versioning enabled",
+		"state bucket demo-state is not encrypted with AES256 by default",
+		"state bucket demo-state does not block all public access",
+		"lock table demo-locks has hash key LockID (N) instead of LockID (S)",
+		"lock table demo-locks is not billed per request",
+	}, problems)
+}
+
+func TestCheckBackendForeignBucket(t *testing.T) {
+	backend := newFakeBackend()
+	backend.bucketStatus = http.StatusForbidden
+	bootstrapper, _ := newBootstrapper(backend, "")
+
+	_, err := bootstrapper.CheckBackend()
+	assert.EqualError(t, err, "state bucket demo-state exists but this account cannot access it, pick another name in terraform.tfvars")
+}
+
+func TestCheck(t *testing.T) {
+	var out bytes.Buffer
+	Check(&Config{
+		Dir: backendDir, VarFile: "terraform.tfvars", Region: "us-east-1", ProjectName: "demo",
+		StateBucketName: "demo-state", DynamoDBTableName: "demo-locks", Tags: map[string]string{"Team": "a", "Owner": "b"},
+	}, &out)
+	assert.Equal(t, "backend module: "+backendDir+"\nvariables: terraform.tfvars\nregion: us-east-1\nproject: demo\n"+
+		"state bucket: demo-state\nlock table: demo-locks\ntag Owner: b\ntag Team: a\n", out.String())
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// Config is the backend configuration: the inputs of backend/ and the region its
+// provider deploys to
+type Config struct {
+	Dir               string
+	VarFile           string
+	Region            string
+	ProjectName       string
+	StateBucketName   string
+	DynamoDBTableName string
+	Tags              map[string]string
+}
+
+// variable is a variable block of the backend module
+type variable struct {
+	name       string
+	hasDefault bool
+}
+
+var (
+	// bucketName follows the S3 naming rules, apart from the reserved prefixes and suffixes
+	bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	tableName  = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,255}$`)
+)
+
+// LoadConfig reads the variables and the provider region from the .tf files in dir
+// and their values from varFile, as terraform would, and validates them. An
+// empty varFile means terraform.tfvars in dir.
+func LoadConfig(dir, varFile string) (*Config, error) {
+	if varFile == "" {
+		varFile = filepath.Join(dir, "terraform.tfvars")
+	}
+	// terraform runs in dir, so the variable file must not be relative
+	varFile, err := filepath.Abs(varFile)
+	if err != nil {
+		return nil, err
+	}
+	variables, region, err := parseModule(dir)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseVarFile(varFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	declared := make(map[string]bool, len(variables))
+	for _, v := range variables {
+		declared[v.name] = true
+		if _, ok := values[v.name]; !ok && !v.hasDefault {
+			problems = append(problems, fmt.Sprintf("%s is required", v.name))
+		}
+	}
+	for name := range values {
+		if !declared[name] {
+			problems = append(problems, fmt.Sprintf("%s is not a variable of %s", name, dir))
+		}
+	}
+
+	config := &Config{Dir: dir, VarFile: varFile, Region: region, Tags: map[string]string{}}
+	stringVars := map[string]*string{
+		"project_name":        &config.ProjectName,
+		"state_bucket_name":   &config.StateBucketName,
+		"dynamodb_table_name": &config.DynamoDBTableName,
+	}
+	for name, target := range stringVars {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		converted, err := convert.Convert(value, cty.String)
+		if err != nil || converted.IsNull() {
+			problems = append(problems, fmt.Sprintf("%s must be a string", name))
+			continue
+		}
+		*target = converted.AsString()
+	}
+	if value, ok := values["tags"]; ok {
+		converted, err := convert.Convert(value, cty.Map(cty.String))
+		if err != nil || converted.IsNull() {
+			problems = append(problems, "tags must be a map of strings")
+		} else {
+			for key, tag := range converted.AsValueMap() {
+				config.Tags[key] = tag.AsString()
+			}
+		}
+	}
+
+	if config.StateBucketName != "" && (!bucketName.MatchString(config.StateBucketName) || strings.Contains(config.StateBucketName, "..")) {
+		problems = append(problems, fmt.Sprintf("state_bucket_name %q is not a valid S3 bucket name", config.StateBucketName))
+	}
+	if config.DynamoDBTableName != "" && !tableName.MatchString(config.DynamoDBTableName) {
+		problems = append(problems, fmt.Sprintf("dynamodb_table_name %q is not a valid DynamoDB table name", config.DynamoDBTableName))
+	}
+	if config.Region == "" {
+		problems = append(problems, fmt.Sprintf("no region set on the aws provider in %s", dir))
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s:\n  %s", varFile, strings.Join(problems, "\n  "))
+	}
+	return config, nil
+}
+
+// parseModule returns the variables declared in the .tf files of dir and the
+// region of its aws provider, if it is a literal
+func parseModule(dir string) ([]variable, string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("no terraform files in %s", dir)
+	}
+
+	schema := &hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "provider", LabelNames: []string{"name"}},
+	}}
+	parser := hclparse.NewParser()
+	var variables []variable
+	var region string
+	for _, file := range files {
+		f, diags := parser.ParseHCLFile(file)
+		if diags.HasErrors() {
+			return nil, "", diags
+		}
+		content, _, diags := f.Body.PartialContent(schema)
+		if diags.HasErrors() {
+			return nil, "", diags
+		}
+		for _, block := range content.Blocks {
+			attributes, _ := block.Body.JustAttributes()
+			switch block.Type {
+			case "variable":
+				_, hasDefault := attributes["default"]
+				variables = append(variables, variable{name: block.Labels[0], hasDefault: hasDefault})
+			case "provider":
+				if attribute, ok := attributes["region"]; ok && block.Labels[0] == "aws" {
+					if value, diags := attribute.Expr.Value(nil); !diags.HasErrors() && value.Type() == cty.String {
+						region = value.AsString()
+					}
+				}
+			}
+		}
+	}
+	return variables, region, nil
+}
+
+// parseVarFile returns the values a .tfvars or .tfvars.json file assigns
+func parseVarFile(file string) (map[string]cty.Value, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	parser := hclparse.NewParser()
+	var f *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(file, ".json") {
+		f, diags = parser.ParseJSONFile(file)
+	} else {
+		f, diags = parser.ParseHCLFile(file)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attributes, diags := f.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	values := make(map[string]cty.Value, len(attributes))
+	for name, attribute := range attributes {
+		// Variable files hold literals only, so there is nothing to evaluate them in
+		value, diags := attribute.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		values[name] = value
+	}
+	return values, nil
+}
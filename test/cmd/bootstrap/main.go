@@ -0,0 +1,69 @@
+// Command bootstrap prepares an AWS account for the project: it verifies the
+// credentials and makes sure the S3 state bucket and the DynamoDB lock table the
+// backend module defines exist and are configured like it configures them. When
+// they are not it plans the backend module and applies it once confirmed.
+//
+// The module's inputs are read from its terraform.tfvars (or -var-file) and the
+// region from its aws provider:
+//
+//	go run ./cmd/bootstrap
+//	go run ./cmd/bootstrap -yes
+//	go run ./cmd/bootstrap -check
+//
+// -yes applies without asking, e.g. in CI. -check only validates the configuration
+// and prints it, without credentials or network access.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"test/utils"
+)
+
+func main() {
+	dir := flag.String("dir", "../backend", "the backend module")
+	varFile := flag.String("var-file", "", "variables of the backend module (default: terraform.tfvars in -dir)")
+	region := flag.String("region", "", "AWS region of the backend (default: the region of the module's aws provider)")
+	yes := flag.Bool("yes", false, "apply the backend module without asking")
+	check := flag.Bool("check", false, "only validate and print the configuration, without calling AWS")
+	flag.Parse()
+
+	if err := run(*dir, *varFile, *region, *yes, *check); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, varFile, region string, yes, check bool) error {
+	config, err := LoadConfig(dir, varFile)
+	if err != nil {
+		return err
+	}
+	if region != "" {
+		config.Region = region
+	}
+	if check {
+		Check(config, os.Stdout)
+		fmt.Println("configuration is valid")
+		return nil
+	}
+
+	sess := utils.CreateSession(config.Region)
+	bootstrapper := &Bootstrapper{
+		Config:    config,
+		STS:       sts.New(sess),
+		S3:        s3.New(sess),
+		DynamoDB:  dynamodb.New(sess),
+		Terraform: newTerraformRunner(config),
+		Yes:       yes,
+		In:        os.Stdin,
+		Out:       os.Stdout,
+	}
+	return bootstrapper.Bootstrap()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"test/utils"
+)
+
+// Exit codes besides 1 for errors
+const (
+	exitNoSecurityDrift = 0
+	exitSecurityDrift   = 2
+)
+
+// DeploymentOutputs reads the outputs the drift check needs from those of
+// `terraform output -json`
+func DeploymentOutputs(outputs map[string]interface{}) (utils.DeploymentOutputs, error) {
+	var missing []string
+	stringOutput := func(name string) string {
+		value, ok := outputs[name].(string)
+		if !ok || value == "" {
+			missing = append(missing, name)
+		}
+		return value
+	}
+
+	deployment := utils.DeploymentOutputs{
+		VPCID:                stringOutput("vpc_id"),
+		ALBName:              stringOutput("alb_name"),
+		AutoScalingGroupName: stringOutput("autoscaling_group_name"),
+		LaunchTemplateID:     stringOutput("launch_template_id"),
+		TargetGroupArns:      map[string]string{},
+	}
+	targetGroupArns, _ := outputs["target_group_arns"].(map[string]interface{})
+	for name, arn := range targetGroupArns {
+		if s, ok := arn.(string); ok {
+			deployment.TargetGroupArns[name] = s
+		}
+	}
+	if len(deployment.TargetGroupArns) == 0 {
+		missing = append(missing, "target_group_arns")
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return deployment, fmt.Errorf("missing outputs %s, is the configuration deployed?", strings.Join(missing, ", "))
+	}
+	return deployment, nil
+}
+
+// ExitCode fails on security drift only, the rest of the report is for review
+func ExitCode(report utils.DriftReport) int {
+	if report.Has(utils.DriftSecurity) {
+		return exitSecurityDrift
+	}
+	return exitNoSecurityDrift
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/utils"
+)
+
+func TestDeploymentOutputs(t *testing.T) {
+	outputs, err := DeploymentOutputs(map[string]interface{}{
+		"vpc_id":                 "vpc-0f00000000000000a",
+		"alb_name":               "demo-ci-alb",
+		"alb_dns_name":           "demo-ci-alb-1234567890.us-east-1.elb.amazonaws.com",
+		"target_group_arns":      map[string]interface{}{"app1": "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/demo-ci-app1/1"},
+		"autoscaling_group_name": "demo-ci-asg",
+		"launch_template_id":     "lt-0f00000000000000a",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, utils.DeploymentOutputs{
+		VPCID:                "vpc-0f00000000000000a",
+		ALBName:              "demo-ci-alb",
+		TargetGroupArns:      map[string]string{"app1": "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/demo-ci-app1/1"},
+		AutoScalingGroupName: "demo-ci-asg",
+		LaunchTemplateID:     "lt-0f00000000000000a",
+	}, outputs)
+
+	_, err = DeploymentOutputs(map[string]interface{}{"vpc_id": "vpc-0f00000000000000a"})
+	assert.EqualError(t, err, "missing outputs alb_name, autoscaling_group_name, launch_template_id, target_group_arns, is the configuration deployed?")
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, 0, ExitCode(utils.DriftReport{
+		{Category: utils.DriftCapacity, Attribute: "desired_capacity", Expected: "2", Actual: "4"},
+		{Category: utils.DriftTagging, Attribute: "tags.Owner", Actual: "someone"},
+	}))
+	assert.Equal(t, 2, ExitCode(utils.DriftReport{
+		{Category: utils.DriftSecurity, Attribute: "ingress", Actual: "tcp 22 from 0.0.0.0/0"},
+	}))
+}
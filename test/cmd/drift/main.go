@@ -0,0 +1,61 @@
+// Command drift reports what changed in a deployed environment since terraform
+// last applied it, e.g. a security group rule or the capacity of the Auto Scaling
+// group edited in the console. It reads the outputs and the state of the complete
+// example in -dir, describes the live resources and prints the drift by category:
+// security, capacity, routing and tagging.
+//
+//	go run ./cmd/drift -dir ../examples/complete -region us-east-1
+//
+// It exits with 2 on security drift, with 1 on errors and with 0 otherwise, so a
+// scheduled job can fail on security drift alone and still publish the report.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"test/utils"
+)
+
+func main() {
+	dir := flag.String("dir", "../examples/complete", "the deployed terraform configuration")
+	region := flag.String("region", "us-east-1", "AWS region of the deployment")
+	flag.Parse()
+
+	code, err := run(*dir, *region)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+func run(dir, region string) (int, error) {
+	t := utils.CLIT("drift")
+	// Terratest logs terraform's output, the whole state included, which would
+	// bury the report
+	options := &terraform.Options{TerraformDir: dir, NoColor: true, Logger: logger.Discard}
+	rawOutputs, err := terraform.OutputAllE(t, options)
+	if err != nil {
+		return 0, err
+	}
+	outputs, err := DeploymentOutputs(rawOutputs)
+	if err != nil {
+		return 0, err
+	}
+	stateJSON, err := terraform.ShowE(t, options)
+	if err != nil {
+		return 0, err
+	}
+
+	report, err := utils.CheckDriftE(utils.CreateClients(region), outputs, stateJSON)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Print(report)
+	return ExitCode(report), nil
+}
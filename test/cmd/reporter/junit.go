@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The JUnit XML schema as CI systems read it: a suite per package, a case per test
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+	// SystemErr holds the failures outside any test
+	SystemErr string `xml:"system-err,omitempty"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	// SystemOut lists the stages the test ran and the resources it created
+	SystemOut string `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML
+func (r *Report) WriteJUnit(w io.Writer) error {
+	var suites junitSuites
+	for _, pkg := range r.Packages {
+		suite := junitSuite{
+			Name:      pkg.Name,
+			Tests:     len(pkg.Tests),
+			Time:      seconds(pkg.Time),
+			SystemErr: strings.Join(pkg.Failures, "\n\n"),
+		}
+		for _, test := range pkg.Tests {
+			testCase := junitCase{
+				ClassName: pkg.Name,
+				Name:      test.Name,
+				Time:      seconds(test.Time),
+				SystemOut: test.details(),
+			}
+			switch test.Status {
+			case StatusSkip:
+				suite.Skipped++
+				testCase.Skipped = &struct{}{}
+			case StatusFail, StatusIncomplete:
+				suite.Failures++
+				testCase.Failure = &junitFailure{Message: test.failureMessage(), Text: strings.Join(test.Failures, "\n\n")}
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(time float64) string {
+	return fmt.Sprintf("%.3f", time)
+}
+
+// failureMessage is the first line of the test's first failure
+func (t *Test) failureMessage() string {
+	if t.Status == StatusIncomplete {
+		return "test did not finish"
+	}
+	if len(t.Failures) == 0 {
+		// The failure is in a subtest
+		return "failed"
+	}
+	message, _, _ := strings.Cut(t.Failures[0], "\n")
+	return message
+}
+
+// details lists the stages and the created resources of the test
+func (t *Test) details() string {
+	var lines []string
+	for _, stage := range t.Stages {
+		if stage.Skipped {
+			lines = append(lines, fmt.Sprintf("stage %s: skipped", stage.Name))
+		} else {
+			lines = append(lines, fmt.Sprintf("stage %s: %ss", stage.Name, seconds(stage.Time)))
+		}
+	}
+	for _, resource := range t.Resources {
+		lines = append(lines, "created "+resource.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r Resource) String() string {
+	if r.ID == "" {
+		return r.Address
+	}
+	return fmt.Sprintf("%s [id=%s]", r.Address, r.ID)
+}
@@ -0,0 +1,99 @@
+// Command reporter turns the output of `go test -json` into a report of every test
+// and subtest: its status and duration, the terratest stages it ran, the resources
+// terraform created and the assertion failures. It writes the report as JUnit XML
+// and as JSON, and renders it, or a JSON report written earlier, as Markdown.
+//
+// The test output is copied to stdout as it is read, so the run can be followed:
+//
+//	go test -json -run TestE2E -timeout 50m | go run ./cmd/reporter -junit report.xml -json report.json
+//	go run ./cmd/reporter -from report.json -markdown summary.md
+//
+// Failures are only told apart from logs by Go 1.25 and later, older versions leave
+// them out of the report.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	input := flag.String("input", "-", "`go test -json` output to read, - for stdin")
+	from := flag.String("from", "", "read a JSON report written by -json instead of test output")
+	junitFile := flag.String("junit", "", "write the report as JUnit XML to this file")
+	jsonFile := flag.String("json", "", "write the report as JSON to this file")
+	markdownFile := flag.String("markdown", "", "write a Markdown summary to this file, - for stdout")
+	quiet := flag.Bool("quiet", false, "do not copy the test output to stdout")
+	flag.Parse()
+
+	if err := run(*input, *from, *junitFile, *jsonFile, *markdownFile, *quiet); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(input, from, junitFile, jsonFile, markdownFile string, quiet bool) error {
+	var report *Report
+	var err error
+	if from != "" {
+		report, err = ReadJSON(from)
+	} else {
+		report, err = parseInput(input, quiet)
+	}
+	if err != nil {
+		return err
+	}
+
+	outputs := []struct {
+		file  string
+		write func(io.Writer) error
+	}{
+		{junitFile, report.WriteJUnit},
+		{jsonFile, report.WriteJSON},
+		{markdownFile, report.WriteMarkdown},
+	}
+	for _, output := range outputs {
+		if err := writeFile(output.file, output.write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseInput(input string, quiet bool) (*Report, error) {
+	var r io.Reader = os.Stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	var echo io.Writer = os.Stdout
+	if quiet {
+		echo = nil
+	}
+	return Parse(r, echo)
+}
+
+// writeFile writes to the file, or stdout for -, and does nothing without a file
+func writeFile(file string, write func(io.Writer) error) error {
+	switch file {
+	case "":
+		return nil
+	case "-":
+		return write(os.Stdout)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var statusIcons = map[string]string{
+	StatusPass:       "✅",
+	StatusFail:       "❌",
+	StatusSkip:       "⏭️",
+	StatusIncomplete: "⌛",
+}
+
+// WriteMarkdown renders a summary of the report: counts, a table of the tests
+// without subtests, their failures and the resources they created. Parent tests
+// are left out as their subtests cover them.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	counts := map[string]int{}
+	var tests []*Test
+	var packageFailures []string
+	for _, pkg := range r.Packages {
+		for _, test := range pkg.Tests {
+			if pkg.IsParent(test) {
+				continue
+			}
+			counts[test.Status]++
+			tests = append(tests, test)
+		}
+		for _, failure := range pkg.Failures {
+			packageFailures = append(packageFailures, fmt.Sprintf("%s: %s", pkg.Name, failure))
+		}
+	}
+
+	fmt.Fprintf(&b, "### Terratest %s %d passed, %d failed, %d skipped", statusIcon(r), counts[StatusPass], counts[StatusFail], counts[StatusSkip])
+	if counts[StatusIncomplete] > 0 {
+		fmt.Fprintf(&b, ", %d did not finish", counts[StatusIncomplete])
+	}
+	b.WriteString("\n\n")
+	if len(tests) == 0 {
+		b.WriteString("No tests ran.\n")
+	} else {
+		b.WriteString("| Test | Status | Duration | Stages | Resources |\n")
+		b.WriteString("| --- | --- | --- | --- | --- |\n")
+		for _, test := range tests {
+			fmt.Fprintf(&b, "| `%s` | %s %s | %s | %s | %d |\n",
+				test.Name, statusIcons[test.Status], test.Status, duration(test.Time), stages(test.Stages), len(test.Resources))
+		}
+	}
+
+	var failed []*Test
+	for _, test := range tests {
+		if len(test.Failures) > 0 {
+			failed = append(failed, test)
+		}
+	}
+	if len(failed) > 0 || len(packageFailures) > 0 {
+		b.WriteString("\n#### Failures\n")
+		for _, test := range failed {
+			fmt.Fprintf(&b, "\n<details><summary><code>%s</code>: %d failures</summary>\n\n```\n%s\n```\n</details>\n",
+				test.Name, len(test.Failures), strings.Join(test.Failures, "\n\n"))
+		}
+		if len(packageFailures) > 0 {
+			fmt.Fprintf(&b, "\n```\n%s\n```\n", strings.Join(packageFailures, "\n\n"))
+		}
+	}
+
+	var created []*Test
+	for _, test := range tests {
+		if len(test.Resources) > 0 {
+			created = append(created, test)
+		}
+	}
+	if len(created) > 0 {
+		b.WriteString("\n#### Resources created\n")
+		for _, test := range created {
+			var resources []string
+			for _, resource := range test.Resources {
+				resources = append(resources, resource.String())
+			}
+			fmt.Fprintf(&b, "\n<details><summary><code>%s</code>: %d resources</summary>\n\n```\n%s\n```\n</details>\n",
+				test.Name, len(test.Resources), strings.Join(resources, "\n"))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func statusIcon(r *Report) string {
+	if r.Failed() {
+		return statusIcons[StatusFail]
+	}
+	return statusIcons[StatusPass]
+}
+
+func duration(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(100 * time.Millisecond).String()
+}
+
+// stages lists the stages that ran with their durations, skipped ones struck through
+func stages(stages []Stage) string {
+	if len(stages) == 0 {
+		return "-"
+	}
+	var names []string
+	for _, stage := range stages {
+		if stage.Skipped {
+			names = append(names, fmt.Sprintf("~~%s~~", stage.Name))
+		} else {
+			names = append(names, fmt.Sprintf("%s (%s)", stage.Name, duration(stage.Time)))
+		}
+	}
+	return strings.Join(names, ", ")
+}
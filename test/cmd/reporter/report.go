@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Statuses of a test or package
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+	// StatusIncomplete is a test that never finished, e.g. because the run timed out
+	StatusIncomplete = "incomplete"
+)
+
+// Report is the outcome of a `go test -json` run
+type Report struct {
+	Packages []*Package `json:"packages"`
+}
+
+// Package holds the tests of one package, in the order they started
+type Package struct {
+	Name   string  `json:"name"`
+	Status string  `json:"status"`
+	Time   float64 `json:"time"`
+	Tests  []*Test `json:"tests"`
+	// Failures is output reported as an error outside any test, e.g. from TestMain
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Test is a test or subtest, named like `go test -run` expects
+type Test struct {
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	Time      float64    `json:"time"`
+	Stages    []Stage    `json:"stages,omitempty"`
+	Resources []Resource `json:"resources,omitempty"`
+	// Failures are the messages of t.Error and t.Fatal, testify's reduced to their
+	// error and messages
+	Failures []string `json:"failures,omitempty"`
+
+	// stage is the index of the stage still running, -1 if there is none
+	stage int
+}
+
+// Stage is a terratest stage the test ran or skipped
+type Stage struct {
+	Name    string    `json:"name"`
+	Skipped bool      `json:"skipped,omitempty"`
+	Started time.Time `json:"started"`
+	// Time is measured until the next stage starts or the test ends
+	Time float64 `json:"time"`
+}
+
+// Resource is a resource terraform created during the test
+type Resource struct {
+	Address string `json:"address"`
+	ID      string `json:"id,omitempty"`
+}
+
+// testEvent is an event of `go test -json`, see `go doc cmd/test2json`
+type testEvent struct {
+	Time       time.Time
+	Action     string
+	Package    string
+	Test       string
+	Elapsed    float64
+	Output     string
+	OutputType string
+}
+
+var (
+	// terratestLine is a line of terratest's logger, which writes to stdout with the
+	// name of the test instead of through t.Log, so `go test -json` can attribute it
+	// to another test running in parallel
+	terratestLine = regexp.MustCompile(`^(Test\S*) \d{4}-\d\d-\d\dT\S+ \S+:\d+: (.*)$`)
+	stageLine     = regexp.MustCompile(`^The 'SKIP_\S+' environment variable is (not )?set, so (?:executing|skipping) stage '([^']+)'\.$`)
+	createdLine   = regexp.MustCompile(`^(\S+): Creation complete after \S+(?: \[id=([^\]]+)\])?$`)
+	ansiEscape    = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// parser builds a Report from a stream of test events
+type parser struct {
+	report   Report
+	packages map[string]*Package
+	tests    map[string]*Test
+	// failure collects the lines of the failure each test is reporting
+	failure map[string][]string
+}
+
+// Parse reads the output of `go test -json`, copying the plain test output to echo
+// when it is not nil. Lines that are not test events, such as build errors, are
+// only echoed.
+func Parse(r io.Reader, echo io.Writer) (*Report, error) {
+	p := &parser{
+		packages: map[string]*Package{},
+		tests:    map[string]*Test{},
+		failure:  map[string][]string{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var event testEvent
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &event) != nil {
+			if echo != nil {
+				fmt.Fprintln(echo, string(line))
+			}
+			continue
+		}
+		if echo != nil && event.Action == "output" {
+			io.WriteString(echo, event.Output)
+		}
+		p.handle(event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	p.finish()
+	return &p.report, nil
+}
+
+func (p *parser) pkg(name string) *Package {
+	pkg, ok := p.packages[name]
+	if !ok {
+		pkg = &Package{Name: name, Status: StatusIncomplete}
+		p.packages[name] = pkg
+		p.report.Packages = append(p.report.Packages, pkg)
+	}
+	return pkg
+}
+
+func (p *parser) test(pkgName, name string) *Test {
+	key := pkgName + " " + name
+	test, ok := p.tests[key]
+	if !ok {
+		test = &Test{Name: name, Status: StatusIncomplete, stage: -1}
+		p.tests[key] = test
+		pkg := p.pkg(pkgName)
+		pkg.Tests = append(pkg.Tests, test)
+	}
+	return test
+}
+
+func (p *parser) handle(event testEvent) {
+	pkg := p.pkg(event.Package)
+
+	switch event.Action {
+	case "run":
+		p.test(event.Package, event.Test)
+	case "pass", "fail", "skip":
+		if event.Test == "" {
+			p.flushFailure(event.Package, "")
+			pkg.Status = event.Action
+			pkg.Time = event.Elapsed
+			return
+		}
+		p.flushFailure(event.Package, event.Test)
+		test := p.test(event.Package, event.Test)
+		test.Status = event.Action
+		test.Time = event.Elapsed
+		test.endStage(event.Time)
+	case "output":
+		p.output(event)
+	}
+}
+
+func (p *parser) output(event testEvent) {
+	key := event.Package + " " + event.Test
+	switch event.OutputType {
+	case "error":
+		p.flushFailure(event.Package, event.Test)
+		p.failure[key] = []string{strings.TrimRight(event.Output, "\n")}
+		return
+	case "error-continue":
+		p.failure[key] = append(p.failure[key], strings.TrimRight(event.Output, "\n"))
+		return
+	}
+	p.flushFailure(event.Package, event.Test)
+	if event.OutputType == "frame" {
+		return
+	}
+
+	match := terratestLine.FindStringSubmatch(strings.TrimRight(ansiEscape.ReplaceAllString(event.Output, ""), "\r\n"))
+	if match == nil {
+		return
+	}
+	test := p.test(event.Package, match[1])
+	message := match[2]
+
+	if stage := stageLine.FindStringSubmatch(message); stage != nil {
+		test.endStage(event.Time)
+		test.Stages = append(test.Stages, Stage{Name: stage[2], Skipped: stage[1] == "", Started: event.Time})
+		if stage[1] != "" {
+			test.stage = len(test.Stages) - 1
+		}
+		return
+	}
+	if created := createdLine.FindStringSubmatch(message); created != nil {
+		test.Resources = append(test.Resources, Resource{Address: created[1], ID: created[2]})
+	}
+}
+
+// flushFailure records the failure the test was reporting, if any
+func (p *parser) flushFailure(pkgName, testName string) {
+	key := pkgName + " " + testName
+	lines, ok := p.failure[key]
+	if !ok {
+		return
+	}
+	delete(p.failure, key)
+
+	failure := condenseFailure(lines)
+	if testName == "" {
+		pkg := p.pkg(pkgName)
+		pkg.Failures = append(pkg.Failures, failure)
+		return
+	}
+	test := p.test(pkgName, testName)
+	test.Failures = append(test.Failures, failure)
+}
+
+// finish records the failures still being reported when the stream ended
+func (p *parser) finish() {
+	for key := range p.failure {
+		pkgName, testName, _ := strings.Cut(key, " ")
+		p.flushFailure(pkgName, testName)
+	}
+}
+
+func (t *Test) endStage(at time.Time) {
+	if t.stage < 0 {
+		return
+	}
+	stage := &t.Stages[t.stage]
+	if !at.IsZero() && at.After(stage.Started) {
+		stage.Time = at.Sub(stage.Started).Seconds()
+	}
+	t.stage = -1
+}
+
+// testifyField starts a field of a testify failure, e.g. "Error Trace:\t..."
+var testifyField = regexp.MustCompile(`^\s*(Error Trace|Error|Test|Messages):\s*(.*)$`)
+
+// condenseFailure joins the lines of a failure, stripping the indentation go test
+// adds. A testify failure is reduced to its location, error and messages.
+func condenseFailure(lines []string) string {
+	var location string
+	fields := map[string][]string{}
+	field := ""
+	for i, line := range lines {
+		if i == 0 {
+			location = strings.TrimSpace(line)
+			continue
+		}
+		if match := testifyField.FindStringSubmatch(line); match != nil {
+			field = match[1]
+			fields[field] = append(fields[field], strings.TrimSpace(match[2]))
+			continue
+		}
+		if field != "" {
+			fields[field] = append(fields[field], strings.TrimSpace(line))
+		}
+	}
+	if _, ok := fields["Error Trace"]; !ok {
+		trimmed := make([]string, 0, len(lines))
+		for _, line := range lines {
+			trimmed = append(trimmed, strings.TrimSpace(line))
+		}
+		return strings.Join(trimmed, "\n")
+	}
+
+	failure := strings.TrimSpace(location + " " + strings.Join(fields["Error"], "\n"))
+	if messages := fields["Messages"]; len(messages) > 0 {
+		failure += "\n" + strings.Join(messages, "\n")
+	}
+	return failure
+}
+
+// IsParent reports whether the test has subtests in the package
+func (pkg *Package) IsParent(test *Test) bool {
+	for _, other := range pkg.Tests {
+		if strings.HasPrefix(other.Name, test.Name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Failed reports whether any package or test failed or did not finish
+func (r *Report) Failed() bool {
+	for _, pkg := range r.Packages {
+		if pkg.Status != StatusPass && pkg.Status != StatusSkip {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// ReadJSON reads a report written by WriteJSON
+func ReadJSON(file string) (*Report, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	return &report, nil
+}
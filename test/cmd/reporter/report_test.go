@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOutput is `go test -json` output of a run with a failing subtest that went
+// through two stages, a skipped subtest and a parallel test whose terratest log
+// line was attributed to the other one
+const testOutput = `{"Time":"2026-10-17T06:30:38.615797143Z","Action":"start","Package":"test"}
+{"Time":"2026-10-17T06:30:38.640426209Z","Action":"run","Package":"test","Test":"TestE2E"}
+{"Time":"2026-10-17T06:30:38.640535809Z","Action":"output","Package":"test","Test":"TestE2E","Output":"=== RUN   TestE2E\n","OutputType":"frame"}
+{"Time":"2026-10-17T06:30:38.642159988Z","Action":"run","Package":"test","Test":"TestE2E/Complete_Example"}
+{"Time":"2026-10-17T06:30:38.642179188Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"=== RUN   TestE2E/Complete_Example\n","OutputType":"frame"}
+{"Time":"2026-10-17T06:30:38.643054699Z","Action":"run","Package":"test","Test":"TestE2E/skipped"}
+{"Time":"2026-10-17T06:30:38.643075027Z","Action":"output","Package":"test","Test":"TestE2E/skipped","Output":"    e2e_test.go:23: nothing\n"}
+{"Time":"2026-10-17T06:30:38.643100538Z","Action":"skip","Package":"test","Test":"TestE2E/skipped","Elapsed":0}
+{"Time":"2026-10-17T06:30:38.643118969Z","Action":"run","Package":"test","Test":"TestVPCModule"}
+{"Time":"2026-10-17T06:31:00Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"TestE2E/Complete_Example 2026-10-17T06:31:00Z test_structure.go:29: The 'SKIP_deploy' environment variable is not set, so executing stage 'deploy'.\n"}
+{"Time":"2026-10-17T06:31:02Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"TestVPCModule 2026-10-17T06:31:02Z logger.go:66: \u001b[0m\u001b[1maws_vpc.this: Creation complete after 1s [id=vpc-0abc]\u001b[0m\n"}
+{"Time":"2026-10-17T06:31:05Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"TestE2E/Complete_Example 2026-10-17T06:31:05Z logger.go:66: module.vpc.aws_nat_gateway.this[0]: Creation complete after 2s [id=nat-0123]\n"}
+{"Time":"2026-10-17T06:31:10Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"TestE2E/Complete_Example 2026-10-17T06:31:10Z test_structure.go:32: The 'SKIP_redeploy' environment variable is set, so skipping stage 'redeploy'.\n"}
+{"Time":"2026-10-17T06:31:10Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"TestE2E/Complete_Example 2026-10-17T06:31:10Z test_structure.go:29: The 'SKIP_validate' environment variable is not set, so executing stage 'validate'.\n"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"    e2e_test.go:18: \n","OutputType":"error"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"        \tError Trace:\t/root/module/test/e2e_test.go:18\n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"        \t            \t\t\t\t/root/module/test/e2e_test.go:17\n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"        \tError:      \tNot equal: \n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"        \t            \texpected: 1\n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"        \t            \tactual  : 2\n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"        \tTest:       \tTestE2E/Complete_Example\n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"        \tMessages:   \tNAT gateways\n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"    routes.go:260: 2 route topology problems:\n","OutputType":"error"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"          a\n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"          b\n","OutputType":"error-continue"}
+{"Time":"2026-10-17T06:31:11Z","Action":"output","Package":"test","Test":"TestE2E/Complete_Example","Output":"    routes.go:252: Egress path: subnet-1 (us-east-1a) -> rtb-1 -> NAT gateway nat-0123\n"}
+{"Time":"2026-10-17T06:31:14Z","Action":"fail","Package":"test","Test":"TestE2E/Complete_Example","Elapsed":35.5}
+{"Time":"2026-10-17T06:31:14Z","Action":"fail","Package":"test","Test":"TestE2E","Elapsed":35.6}
+{"Time":"2026-10-17T06:31:20Z","Action":"pass","Package":"test","Test":"TestVPCModule","Elapsed":41}
+{"Time":"2026-10-17T06:31:20Z","Action":"output","Package":"test","Output":"FAIL\ttest\t42.029s\n","OutputType":"frame"}
+{"Time":"2026-10-17T06:31:20Z","Action":"fail","Package":"test","Elapsed":42.029}
+`
+
+func parseTestOutput(t *testing.T) *Report {
+	report, err := Parse(strings.NewReader(testOutput), nil)
+	require.NoError(t, err)
+	return report
+}
+
+func TestParse(t *testing.T) {
+	report := parseTestOutput(t)
+	require.Len(t, report.Packages, 1)
+	pkg := report.Packages[0]
+	assert.Equal(t, StatusFail, pkg.Status)
+	assert.True(t, report.Failed())
+
+	var names []string
+	for _, test := range pkg.Tests {
+		names = append(names, test.Name)
+	}
+	require.Equal(t, []string{"TestE2E", "TestE2E/Complete_Example", "TestE2E/skipped", "TestVPCModule"}, names)
+
+	e2e := pkg.Tests[1]
+	assert.Equal(t, StatusFail, e2e.Status)
+	assert.Equal(t, 35.5, e2e.Time)
+	require.Len(t, e2e.Stages, 3)
+	assert.Equal(t, Stage{Name: "deploy", Started: e2e.Stages[0].Started, Time: 10}, e2e.Stages[0])
+	assert.Equal(t, "redeploy", e2e.Stages[1].Name)
+	assert.True(t, e2e.Stages[1].Skipped)
+	// The last stage runs until the test ends
+	assert.Equal(t, "validate", e2e.Stages[2].Name)
+	assert.Equal(t, 4.0, e2e.Stages[2].Time)
+	assert.Equal(t, []Resource{{Address: "module.vpc.aws_nat_gateway.this[0]", ID: "nat-0123"}}, e2e.Resources)
+	// Logs are not failures, testify failures lose their trace
+	assert.Equal(t, []string{
+		"e2e_test.go:18: Not equal:\nexpected: 1\nactual  : 2\nNAT gateways",
+		"routes.go:260: 2 route topology problems:\na\nb",
+	}, e2e.Failures)
+
+	assert.Equal(t, StatusSkip, pkg.Tests[2].Status)
+
+	// The terratest line names the test it belongs to
+	vpc := pkg.Tests[3]
+	assert.Equal(t, StatusPass, vpc.Status)
+	assert.Equal(t, []Resource{{Address: "aws_vpc.this", ID: "vpc-0abc"}}, vpc.Resources)
+}
+
+func TestParseIncomplete(t *testing.T) {
+	// A run killed by the timeout ends without the results of the running tests
+	output := strings.Join(strings.Split(testOutput, "\n")[:21], "\n")
+	report, err := Parse(strings.NewReader(output), nil)
+	require.NoError(t, err)
+
+	pkg := report.Packages[0]
+	assert.Equal(t, StatusIncomplete, pkg.Status)
+	assert.True(t, report.Failed())
+	e2e := pkg.Tests[1]
+	assert.Equal(t, StatusIncomplete, e2e.Status)
+	// The failure being reported when the output stopped is kept
+	assert.Equal(t, []string{"e2e_test.go:18: Not equal:\nexpected: 1\nactual  : 2"}, e2e.Failures)
+}
+
+func TestParseEchoesOutput(t *testing.T) {
+	var echo bytes.Buffer
+	_, err := Parse(strings.NewReader("# test [build failed]\n"+testOutput), &echo)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(echo.String(), "# test [build failed]\n=== RUN   TestE2E\n"))
+	assert.Contains(t, echo.String(), "FAIL\ttest\t42.029s\n")
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, parseTestOutput(t).WriteJUnit(&out))
+
+	var suites junitSuites
+	require.NoError(t, xml.Unmarshal(out.Bytes(), &suites))
+	require.Len(t, suites.Suites, 1)
+	suite := suites.Suites[0]
+	assert.Equal(t, 4, suite.Tests)
+	assert.Equal(t, 2, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	assert.Equal(t, "42.029", suite.Time)
+
+	e2e := suite.Cases[1]
+	assert.Equal(t, "TestE2E/Complete_Example", e2e.Name)
+	assert.Equal(t, "35.500", e2e.Time)
+	require.NotNil(t, e2e.Failure)
+	assert.Equal(t, "e2e_test.go:18: Not equal:", e2e.Failure.Message)
+	assert.Contains(t, e2e.Failure.Text, "2 route topology problems")
+	assert.Equal(t, "stage deploy: 10.000s\nstage redeploy: skipped\nstage validate: 4.000s\n"+
+		"created module.vpc.aws_nat_gateway.this[0] [id=nat-0123]", e2e.SystemOut)
+	assert.NotNil(t, suite.Cases[2].Skipped)
+	assert.Nil(t, suite.Cases[3].Failure)
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, parseTestOutput(t).WriteMarkdown(&out))
+	markdown := out.String()
+
+	assert.True(t, strings.HasPrefix(markdown, "### Terratest ❌ 1 passed, 1 failed, 1 skipped\n"), markdown)
+	assert.Contains(t, markdown, "| `TestE2E/Complete_Example` | ❌ fail | 35.5s | deploy (10s), ~~redeploy~~, validate (4s) | 1 |")
+	assert.Contains(t, markdown, "| `TestVPCModule` | ✅ pass | 41s | - | 1 |")
+	// The parent test is covered by its subtests
+	assert.NotContains(t, markdown, "| `TestE2E` |")
+	assert.Contains(t, markdown, "<summary><code>TestE2E/Complete_Example</code>: 2 failures</summary>")
+	assert.Contains(t, markdown, "<summary><code>TestVPCModule</code>: 1 resources</summary>\n\n```\naws_vpc.this [id=vpc-0abc]\n```")
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	report := parseTestOutput(t)
+	file := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, writeFile(file, report.WriteJSON))
+
+	read, err := ReadJSON(file)
+	require.NoError(t, err)
+	var before, after bytes.Buffer
+	require.NoError(t, report.WriteMarkdown(&before))
+	require.NoError(t, read.WriteMarkdown(&after))
+	assert.Equal(t, before.String(), after.String())
+
+	_, err = ReadJSON(filepath.Join(t.TempDir(), "missing.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+
+	"test/utils"
+)
+
+// The sweeper is the only code deleting what terraform created, so its deletes
+// are kept out of the read-only interfaces the tests use
+
+// EC2API adds the paginated listings of the security groups, NAT gateways and
+// VPCs of every project and the deletes of leftover VPC resources to the EC2 calls
+// of the tests
+type EC2API interface {
+	utils.EC2API
+	DescribeSecurityGroupsPages(*ec2.DescribeSecurityGroupsInput, func(*ec2.DescribeSecurityGroupsOutput, bool) bool) error
+	DescribeNatGatewaysPages(*ec2.DescribeNatGatewaysInput, func(*ec2.DescribeNatGatewaysOutput, bool) bool) error
+	DescribeVpcsPages(*ec2.DescribeVpcsInput, func(*ec2.DescribeVpcsOutput, bool) bool) error
+	DeleteLaunchTemplate(*ec2.DeleteLaunchTemplateInput) (*ec2.DeleteLaunchTemplateOutput, error)
+	DeleteSecurityGroup(*ec2.DeleteSecurityGroupInput) (*ec2.DeleteSecurityGroupOutput, error)
+	DeleteNatGateway(*ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error)
+	ReleaseAddress(*ec2.ReleaseAddressInput) (*ec2.ReleaseAddressOutput, error)
+	DetachInternetGateway(*ec2.DetachInternetGatewayInput) (*ec2.DetachInternetGatewayOutput, error)
+	DeleteInternetGateway(*ec2.DeleteInternetGatewayInput) (*ec2.DeleteInternetGatewayOutput, error)
+	DeleteRouteTable(*ec2.DeleteRouteTableInput) (*ec2.DeleteRouteTableOutput, error)
+	DeleteSubnet(*ec2.DeleteSubnetInput) (*ec2.DeleteSubnetOutput, error)
+	DeleteVpc(*ec2.DeleteVpcInput) (*ec2.DeleteVpcOutput, error)
+}
+
+// ELBv2API adds turning off deletion protection and the deletes of leftover load
+// balancers and target groups to the ELBv2 calls of the tests
+type ELBv2API interface {
+	utils.ELBv2API
+	utils.DeletionProtectionAPI
+	DeleteLoadBalancer(*elbv2.DeleteLoadBalancerInput) (*elbv2.DeleteLoadBalancerOutput, error)
+	DeleteTargetGroup(*elbv2.DeleteTargetGroupInput) (*elbv2.DeleteTargetGroupOutput, error)
+}
+
+// AutoScalingAPI adds the delete of leftover groups to the AutoScaling calls of the tests
+type AutoScalingAPI interface {
+	utils.AutoScalingAPI
+	DeleteAutoScalingGroup(*autoscaling.DeleteAutoScalingGroupInput) (*autoscaling.DeleteAutoScalingGroupOutput, error)
+}
+
+// IAMAPI adds listing the roles and policies with their tags and deleting them,
+// their instance profiles and policy attachments to the IAM calls of the tests
+type IAMAPI interface {
+	utils.IAMAPI
+	ListRolesPages(*iam.ListRolesInput, func(*iam.ListRolesOutput, bool) bool) error
+	ListRoleTags(*iam.ListRoleTagsInput) (*iam.ListRoleTagsOutput, error)
+	ListInstanceProfilesForRole(*iam.ListInstanceProfilesForRoleInput) (*iam.ListInstanceProfilesForRoleOutput, error)
+	ListPoliciesPages(*iam.ListPoliciesInput, func(*iam.ListPoliciesOutput, bool) bool) error
+	ListPolicyTags(*iam.ListPolicyTagsInput) (*iam.ListPolicyTagsOutput, error)
+	RemoveRoleFromInstanceProfile(*iam.RemoveRoleFromInstanceProfileInput) (*iam.RemoveRoleFromInstanceProfileOutput, error)
+	DeleteInstanceProfile(*iam.DeleteInstanceProfileInput) (*iam.DeleteInstanceProfileOutput, error)
+	DetachRolePolicy(*iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error)
+	DeleteRole(*iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error)
+	DeletePolicy(*iam.DeletePolicyInput) (*iam.DeletePolicyOutput, error)
+}
+
+// LogsAPI is the subset of the CloudWatch Logs client used to sweep the log
+// groups of the VPC flow logs, which the tests never read
+type LogsAPI interface {
+	DescribeLogGroupsPages(*cloudwatchlogs.DescribeLogGroupsInput, func(*cloudwatchlogs.DescribeLogGroupsOutput, bool) bool) error
+	ListTagsLogGroup(*cloudwatchlogs.ListTagsLogGroupInput) (*cloudwatchlogs.ListTagsLogGroupOutput, error)
+	DeleteLogGroup(*cloudwatchlogs.DeleteLogGroupInput) (*cloudwatchlogs.DeleteLogGroupOutput, error)
+}
+
+var (
+	_ EC2API         = (*ec2.EC2)(nil)
+	_ ELBv2API       = (*elbv2.ELBV2)(nil)
+	_ AutoScalingAPI = (*autoscaling.AutoScaling)(nil)
+	_ IAMAPI         = (*iam.IAM)(nil)
+	_ LogsAPI        = (*cloudwatchlogs.CloudWatchLogs)(nil)
+)
+
+// Clients bundles the AWS clients the sweeper lists and deletes with
+type Clients struct {
+	EC2         EC2API
+	ELBv2       ELBv2API
+	AutoScaling AutoScalingAPI
+	IAM         IAMAPI
+	Logs        LogsAPI
+}
+
+// NewClients creates all clients from a single session
+func NewClients(sess *session.Session) *Clients {
+	return &Clients{
+		EC2:         ec2.New(sess),
+		ELBv2:       elbv2.New(sess),
+		AutoScaling: autoscaling.New(sess),
+		IAM:         iam.New(sess),
+		Logs:        cloudwatchlogs.New(sess),
+	}
+}
@@ -0,0 +1,74 @@
+// Command sweeper deletes the AWS resources of test runs that never got to their
+// teardown, e.g. after a panic or a cancelled CI job. It only touches resources
+// tagged ManagedBy=terraform whose Project tag matches the names the tests generate.
+// IAM is global, so the IAM roles, instance profiles and policies of matching
+// projects are swept whichever region is given.
+//
+// It makes no changes unless -dry-run=false is passed:
+//
+//	go run ./cmd/sweeper -region us-east-1 -min-age 6h
+//	go run ./cmd/sweeper -region us-east-1 -min-age 6h -dry-run=false
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"test/utils"
+)
+
+// patternsFlag collects the repeatable -project-pattern flag
+type patternsFlag []*regexp.Regexp
+
+func (p *patternsFlag) String() string {
+	var patterns []string
+	for _, pattern := range *p {
+		patterns = append(patterns, pattern.String())
+	}
+	return strings.Join(patterns, ", ")
+}
+
+func (p *patternsFlag) Set(value string) error {
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, pattern)
+	return nil
+}
+
+func main() {
+	region := flag.String("region", "us-east-1", "AWS region to sweep")
+	minAge := flag.Duration("min-age", 6*time.Hour, "only sweep projects created at least this long ago")
+	dryRun := flag.Bool("dry-run", true, "only print what would be deleted")
+	timeout := flag.Duration("timeout", 15*time.Minute, "how long to wait for each delete to complete")
+	var patterns patternsFlag
+	flag.Var(&patterns, "project-pattern",
+		"regular expression for the Project tags to sweep, repeatable (default: the test naming patterns)")
+	flag.Parse()
+
+	if len(patterns) == 0 {
+		for _, pattern := range DefaultProjectPatterns {
+			patterns = append(patterns, regexp.MustCompile(pattern))
+		}
+	}
+
+	wait := utils.DefaultWaitOptions()
+	wait.Timeout = *timeout
+	sweeper := &Sweeper{
+		Clients:  NewClients(utils.CreateSession(*region)),
+		Patterns: patterns,
+		MinAge:   *minAge,
+		DryRun:   *dryRun,
+		Wait:     wait,
+		Out:      os.Stdout,
+	}
+	if err := sweeper.Sweep(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
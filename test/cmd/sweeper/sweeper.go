@@ -0,0 +1,919 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+
+	"test/utils"
+)
+
+// Every module tags its resources with ManagedBy=terraform and the project name
+const (
+	managedByTag   = "ManagedBy"
+	managedByValue = "terraform"
+	projectTag     = "Project"
+)
+
+// The IAM and CloudWatch Logs resources of the modules are recognised by name
+// before their tags are fetched, one call each: the instance role of the compute
+// module, and the role, policy and log group of the VPC flow logs
+const (
+	computeRoleSuffix     = "-ec2-role"
+	flowLogRolePrefix     = "vpc-flow-log-role-"
+	flowLogPolicyPrefix   = "vpc-flow-log-to-cloudwatch-"
+	flowLogLogGroupPrefix = "/aws/vpc-flow-log/"
+)
+
+// DefaultProjectPatterns match the project names the tests generate from
+// random.UniqueId with the prefix of the VPC, ALB, compute and upgrade tests or
+// of the shared fixtures
+var DefaultProjectPatterns = []string{
+	`^vpc-test-[A-Za-z0-9]{6}$`,
+	`^alb[a-z0-9]{6}$`,
+	`^comp[a-z0-9]{6}$`,
+	`^upg[a-z0-9]{6}$`,
+	`^shared[a-z0-9]{6}$`,
+}
+
+// Sweeper finds the resources of test projects that were never torn down and
+// deletes them, dependents first
+type Sweeper struct {
+	Clients *Clients
+	// Patterns select the projects to sweep by their Project tag
+	Patterns []*regexp.Regexp
+	// MinAge spares projects created more recently, which may still be under test.
+	// The age of a project is that of its oldest ASG, launch template, load
+	// balancer, NAT gateway, VPC flow log, log group, IAM role or IAM policy.
+	// Projects with none of them, e.g. only a security group left, are listed as
+	// of unknown age and only swept when MinAge is zero.
+	MinAge time.Duration
+	// DryRun only prints what would be deleted
+	DryRun bool
+	// Wait bounds the waits for asynchronous deletes and the retries of deletes
+	// that fail on dependencies which are still going away
+	Wait utils.WaitOptions
+	Out  io.Writer
+}
+
+// project collects the swept resources of one test project
+type project struct {
+	name string
+	// created is the oldest creation time seen, zero if no resource reports one
+	created time.Time
+
+	autoScalingGroups []string
+	launchTemplates   []string
+	loadBalancers     []string
+	targetGroups      []string
+	securityGroups    []string
+	natGateways       []*ec2.NatGateway
+	vpcs              []string
+	logGroups         []string
+	instanceProfiles  []instanceProfile
+	roles             []string
+	policies          []string
+}
+
+// instanceProfile is an instance profile holding one of the swept roles
+type instanceProfile struct {
+	name string
+	role string
+}
+
+func (p *project) seen(created *time.Time) {
+	if created != nil && (p.created.IsZero() || created.Before(p.created)) {
+		p.created = *created
+	}
+}
+
+// Sweep deletes the resources of every old enough project matching the patterns.
+// Each step goes through all projects before the next one starts, as resources of
+// one project can depend on another's, e.g. a compute security group on the
+// shared ALB's. A failing step stops the sweep; running it again picks up from there.
+func (s *Sweeper) Sweep() error {
+	projects, err := s.find()
+	if err != nil {
+		return err
+	}
+	projects = s.selectOld(projects)
+	if len(projects) == 0 {
+		fmt.Fprintln(s.Out, "nothing to sweep")
+		return nil
+	}
+
+	steps := []func([]*project) error{
+		s.deleteAutoScalingGroups,
+		s.deleteLaunchTemplates,
+		s.deleteLoadBalancers,
+		s.deleteTargetGroups,
+		s.deleteSecurityGroups,
+		s.deleteNatGateways,
+		s.deleteVpcs,
+		s.deleteLogGroups,
+		s.deleteInstanceProfiles,
+		s.deleteRoles,
+		s.deletePolicies,
+	}
+	for _, step := range steps {
+		if err := step(projects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sweeper) matches(name string) bool {
+	for _, pattern := range s.Patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectOld drops the projects younger than MinAge, reporting why
+func (s *Sweeper) selectOld(projects []*project) []*project {
+	var selected []*project
+	for _, p := range projects {
+		switch {
+		case p.created.IsZero() && s.MinAge > 0:
+			fmt.Fprintf(s.Out, "skipping project %s: age unknown, sweep it with -min-age 0\n", p.name)
+		case !p.created.IsZero() && time.Since(p.created) < s.MinAge:
+			fmt.Fprintf(s.Out, "skipping project %s: created %s ago\n", p.name, time.Since(p.created).Round(time.Minute))
+		default:
+			fmt.Fprintf(s.Out, "sweeping project %s\n", p.name)
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// find lists the resources tagged ManagedBy=terraform by project
+func (s *Sweeper) find() ([]*project, error) {
+	projects := make(map[string]*project)
+	lookup := func(tags map[string]string) *project {
+		name := tags[projectTag]
+		if tags[managedByTag] != managedByValue || !s.matches(name) {
+			return nil
+		}
+		if projects[name] == nil {
+			projects[name] = &project{name: name}
+		}
+		return projects[name]
+	}
+
+	finders := []func(func(map[string]string) *project) error{
+		s.findAutoScalingGroups,
+		s.findLaunchTemplates,
+		s.findELBResources,
+		s.findSecurityGroups,
+		s.findNatGateways,
+		s.findVpcs,
+		s.findLogGroups,
+		s.findRoles,
+		s.findPolicies,
+	}
+	for _, finder := range finders {
+		if err := finder(lookup); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*project, 0, len(projects))
+	for _, p := range projects {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result, nil
+}
+
+var managedByFilter = &ec2.Filter{
+	Name:   aws.String("tag:" + managedByTag),
+	Values: []*string{aws.String(managedByValue)},
+}
+
+func ec2Tags(tags []*ec2.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return m
+}
+
+func (s *Sweeper) findAutoScalingGroups(lookup func(map[string]string) *project) error {
+	input := &autoscaling.DescribeAutoScalingGroupsInput{}
+	for {
+		output, err := s.Clients.AutoScaling.DescribeAutoScalingGroups(input)
+		if err != nil {
+			return fmt.Errorf("listing auto scaling groups: %w", err)
+		}
+		for _, group := range output.AutoScalingGroups {
+			tags := make(map[string]string, len(group.Tags))
+			for _, tag := range group.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			if p := lookup(tags); p != nil {
+				p.autoScalingGroups = append(p.autoScalingGroups, aws.StringValue(group.AutoScalingGroupName))
+				p.seen(group.CreatedTime)
+			}
+		}
+		if aws.StringValue(output.NextToken) == "" {
+			return nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+func (s *Sweeper) findLaunchTemplates(lookup func(map[string]string) *project) error {
+	input := &ec2.DescribeLaunchTemplatesInput{Filters: []*ec2.Filter{managedByFilter}}
+	for {
+		output, err := s.Clients.EC2.DescribeLaunchTemplates(input)
+		if err != nil {
+			return fmt.Errorf("listing launch templates: %w", err)
+		}
+		for _, lt := range output.LaunchTemplates {
+			if p := lookup(ec2Tags(lt.Tags)); p != nil {
+				p.launchTemplates = append(p.launchTemplates, aws.StringValue(lt.LaunchTemplateId))
+				p.seen(lt.CreateTime)
+			}
+		}
+		if aws.StringValue(output.NextToken) == "" {
+			return nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// findELBResources finds the load balancers and target groups, whose tags have to
+// be fetched separately
+func (s *Sweeper) findELBResources(lookup func(map[string]string) *project) error {
+	created := make(map[string]*time.Time)
+	var lbArns []string
+	lbInput := &elbv2.DescribeLoadBalancersInput{}
+	for {
+		output, err := s.Clients.ELBv2.DescribeLoadBalancers(lbInput)
+		if err != nil {
+			return fmt.Errorf("listing load balancers: %w", err)
+		}
+		for _, lb := range output.LoadBalancers {
+			lbArns = append(lbArns, aws.StringValue(lb.LoadBalancerArn))
+			created[aws.StringValue(lb.LoadBalancerArn)] = lb.CreatedTime
+		}
+		if aws.StringValue(output.NextMarker) == "" {
+			break
+		}
+		lbInput.Marker = output.NextMarker
+	}
+
+	var tgArns []string
+	tgInput := &elbv2.DescribeTargetGroupsInput{}
+	for {
+		output, err := s.Clients.ELBv2.DescribeTargetGroups(tgInput)
+		if err != nil {
+			return fmt.Errorf("listing target groups: %w", err)
+		}
+		for _, tg := range output.TargetGroups {
+			tgArns = append(tgArns, aws.StringValue(tg.TargetGroupArn))
+		}
+		if aws.StringValue(output.NextMarker) == "" {
+			break
+		}
+		tgInput.Marker = output.NextMarker
+	}
+
+	tags, err := s.elbTags(append(append([]string(nil), lbArns...), tgArns...))
+	if err != nil {
+		return err
+	}
+	for _, arn := range lbArns {
+		if p := lookup(tags[arn]); p != nil {
+			p.loadBalancers = append(p.loadBalancers, arn)
+			p.seen(created[arn])
+		}
+	}
+	for _, arn := range tgArns {
+		if p := lookup(tags[arn]); p != nil {
+			p.targetGroups = append(p.targetGroups, arn)
+		}
+	}
+	return nil
+}
+
+// elbTags fetches the tags of the given ELBv2 resources, 20 at a time as the API allows
+func (s *Sweeper) elbTags(arns []string) (map[string]map[string]string, error) {
+	const batchSize = 20
+	result := make(map[string]map[string]string, len(arns))
+	for start := 0; start < len(arns); start += batchSize {
+		end := start + batchSize
+		if end > len(arns) {
+			end = len(arns)
+		}
+		output, err := s.Clients.ELBv2.DescribeTags(&elbv2.DescribeTagsInput{
+			ResourceArns: aws.StringSlice(arns[start:end]),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describing load balancer tags: %w", err)
+		}
+		for _, description := range output.TagDescriptions {
+			tags := make(map[string]string, len(description.Tags))
+			for _, tag := range description.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			result[aws.StringValue(description.ResourceArn)] = tags
+		}
+	}
+	return result, nil
+}
+
+func (s *Sweeper) findSecurityGroups(lookup func(map[string]string) *project) error {
+	err := s.Clients.EC2.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{managedByFilter},
+	}, func(output *ec2.DescribeSecurityGroupsOutput, lastPage bool) bool {
+		for _, sg := range output.SecurityGroups {
+			if p := lookup(ec2Tags(sg.Tags)); p != nil {
+				p.securityGroups = append(p.securityGroups, aws.StringValue(sg.GroupId))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("listing security groups: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) findNatGateways(lookup func(map[string]string) *project) error {
+	err := s.Clients.EC2.DescribeNatGatewaysPages(&ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{
+			managedByFilter,
+			{
+				Name:   aws.String("state"),
+				Values: aws.StringSlice([]string{ec2.NatGatewayStatePending, ec2.NatGatewayStateAvailable, ec2.NatGatewayStateFailed}),
+			},
+		},
+	}, func(output *ec2.DescribeNatGatewaysOutput, lastPage bool) bool {
+		for _, nat := range output.NatGateways {
+			if p := lookup(ec2Tags(nat.Tags)); p != nil {
+				p.natGateways = append(p.natGateways, nat)
+				p.seen(nat.CreateTime)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("listing NAT gateways: %w", err)
+	}
+	return nil
+}
+
+func (s *Sweeper) findVpcs(lookup func(map[string]string) *project) error {
+	owners := make(map[string]*project)
+	err := s.Clients.EC2.DescribeVpcsPages(&ec2.DescribeVpcsInput{
+		Filters: []*ec2.Filter{managedByFilter},
+	}, func(output *ec2.DescribeVpcsOutput, lastPage bool) bool {
+		for _, vpc := range output.Vpcs {
+			if p := lookup(ec2Tags(vpc.Tags)); p != nil {
+				p.vpcs = append(p.vpcs, aws.StringValue(vpc.VpcId))
+				owners[aws.StringValue(vpc.VpcId)] = p
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("listing VPCs: %w", err)
+	}
+	if len(owners) == 0 {
+		return nil
+	}
+
+	// VPCs report no creation time, but the VPC module creates a flow log along
+	// with each of them, which does
+	var ids []string
+	for id := range owners {
+		ids = append(ids, id)
+	}
+	input := &ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{{Name: aws.String("resource-id"), Values: aws.StringSlice(ids)}},
+	}
+	for {
+		flowLogs, err := s.Clients.EC2.DescribeFlowLogs(input)
+		if err != nil {
+			return fmt.Errorf("listing VPC flow logs: %w", err)
+		}
+		for _, flowLog := range flowLogs.FlowLogs {
+			if p := owners[aws.StringValue(flowLog.ResourceId)]; p != nil {
+				p.seen(flowLog.CreationTime)
+			}
+		}
+		if aws.StringValue(flowLogs.NextToken) == "" {
+			return nil
+		}
+		input.NextToken = flowLogs.NextToken
+	}
+}
+
+func (s *Sweeper) findLogGroups(lookup func(map[string]string) *project) error {
+	var groups []*cloudwatchlogs.LogGroup
+	err := s.Clients.Logs.DescribeLogGroupsPages(&cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(flowLogLogGroupPrefix),
+	}, func(output *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+		groups = append(groups, output.LogGroups...)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("listing log groups: %w", err)
+	}
+
+	for _, group := range groups {
+		name := aws.StringValue(group.LogGroupName)
+		tags, err := s.Clients.Logs.ListTagsLogGroup(&cloudwatchlogs.ListTagsLogGroupInput{LogGroupName: group.LogGroupName})
+		if err != nil {
+			return fmt.Errorf("listing tags of log group %s: %w", name, err)
+		}
+		if p := lookup(aws.StringValueMap(tags.Tags)); p != nil {
+			p.logGroups = append(p.logGroups, name)
+			if group.CreationTime != nil {
+				p.seen(aws.Time(time.UnixMilli(aws.Int64Value(group.CreationTime))))
+			}
+		}
+	}
+	return nil
+}
+
+func iamTags(tags []*iam.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return m
+}
+
+// findRoles finds the roles of the modules with the instance profiles holding
+// them. IAM is global, so they are found whichever region their project ran in.
+func (s *Sweeper) findRoles(lookup func(map[string]string) *project) error {
+	var roles []*iam.Role
+	err := s.Clients.IAM.ListRolesPages(&iam.ListRolesInput{}, func(output *iam.ListRolesOutput, lastPage bool) bool {
+		for _, role := range output.Roles {
+			name := aws.StringValue(role.RoleName)
+			if strings.HasSuffix(name, computeRoleSuffix) || strings.HasPrefix(name, flowLogRolePrefix) {
+				roles = append(roles, role)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("listing IAM roles: %w", err)
+	}
+
+	for _, role := range roles {
+		name := aws.StringValue(role.RoleName)
+		tags, err := s.Clients.IAM.ListRoleTags(&iam.ListRoleTagsInput{RoleName: role.RoleName})
+		if err != nil {
+			return fmt.Errorf("listing tags of IAM role %s: %w", name, err)
+		}
+		p := lookup(iamTags(tags.Tags))
+		if p == nil {
+			continue
+		}
+		p.roles = append(p.roles, name)
+		p.seen(role.CreateDate)
+
+		profiles, err := s.Clients.IAM.ListInstanceProfilesForRole(&iam.ListInstanceProfilesForRoleInput{RoleName: role.RoleName})
+		if err != nil {
+			return fmt.Errorf("listing instance profiles of IAM role %s: %w", name, err)
+		}
+		for _, profile := range profiles.InstanceProfiles {
+			p.instanceProfiles = append(p.instanceProfiles, instanceProfile{name: aws.StringValue(profile.InstanceProfileName), role: name})
+		}
+	}
+	return nil
+}
+
+// findPolicies finds the customer managed policies of the modules, which like
+// the roles are global
+func (s *Sweeper) findPolicies(lookup func(map[string]string) *project) error {
+	var policies []*iam.Policy
+	err := s.Clients.IAM.ListPoliciesPages(&iam.ListPoliciesInput{
+		Scope: aws.String(iam.PolicyScopeTypeLocal),
+	}, func(output *iam.ListPoliciesOutput, lastPage bool) bool {
+		for _, policy := range output.Policies {
+			if strings.HasPrefix(aws.StringValue(policy.PolicyName), flowLogPolicyPrefix) {
+				policies = append(policies, policy)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("listing IAM policies: %w", err)
+	}
+
+	for _, policy := range policies {
+		arn := aws.StringValue(policy.Arn)
+		tags, err := s.Clients.IAM.ListPolicyTags(&iam.ListPolicyTagsInput{PolicyArn: policy.Arn})
+		if err != nil {
+			return fmt.Errorf("listing tags of IAM policy %s: %w", arn, err)
+		}
+		if p := lookup(iamTags(tags.Tags)); p != nil {
+			p.policies = append(p.policies, arn)
+			p.seen(policy.CreateDate)
+		}
+	}
+	return nil
+}
+
+// report prints a delete before it is made, or instead of it in a dry run
+func (s *Sweeper) report(kind, id string) {
+	if s.DryRun {
+		fmt.Fprintf(s.Out, "would delete %s %s\n", kind, id)
+	} else {
+		fmt.Fprintf(s.Out, "deleting %s %s\n", kind, id)
+	}
+}
+
+// remove reports the delete and runs it unless this is a dry run
+func (s *Sweeper) remove(kind, id string, del func() error) error {
+	s.report(kind, id)
+	if s.DryRun {
+		return nil
+	}
+	if err := del(); err != nil {
+		return fmt.Errorf("deleting %s %s: %w", kind, id, err)
+	}
+	return nil
+}
+
+// isDependencyError reports whether a delete failed on something that still
+// depends on the resource, which may just be on its way out
+func isDependencyError(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	// ELBv2 and AutoScaling share the ResourceInUse code
+	switch awsErr.Code() {
+	case "DependencyViolation", "InvalidIPAddress.InUse", elbv2.ErrCodeResourceInUseException:
+		return true
+	}
+	return false
+}
+
+// retry runs del until it stops failing on dependencies
+func (s *Sweeper) retry(description string, del func() error) error {
+	return utils.Poll(description, s.Wait, func() (bool, string, error) {
+		err := del()
+		if isDependencyError(err) {
+			return false, "  " + err.Error(), nil
+		}
+		return err == nil, "", err
+	})
+}
+
+func (s *Sweeper) deleteAutoScalingGroups(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, name := range p.autoScalingGroups {
+			err := s.remove("auto scaling group", name, func() error {
+				// ForceDelete terminates the instances along with the group
+				if _, err := s.Clients.AutoScaling.DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{
+					AutoScalingGroupName: aws.String(name),
+					ForceDelete:          aws.Bool(true),
+				}); err != nil {
+					return err
+				}
+				return s.waitForASGDeleted(name)
+			})
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// waitForASGDeleted waits until the group and its instances are gone, as the
+// launch template and security groups cannot go before them
+func (s *Sweeper) waitForASGDeleted(name string) error {
+	return utils.Poll(fmt.Sprintf("auto scaling group %s to be deleted", name), s.Wait, func() (bool, string, error) {
+		output, err := s.Clients.AutoScaling.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []*string{aws.String(name)},
+		})
+		if err != nil {
+			return false, "", err
+		}
+		if len(output.AutoScalingGroups) == 0 {
+			return true, "", nil
+		}
+		group := output.AutoScalingGroups[0]
+		return false, fmt.Sprintf("  status %q, %d instances", aws.StringValue(group.Status), len(group.Instances)), nil
+	})
+}
+
+func (s *Sweeper) deleteLaunchTemplates(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, id := range p.launchTemplates {
+			errs = append(errs, s.remove("launch template", id, func() error {
+				_, err := s.Clients.EC2.DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{LaunchTemplateId: aws.String(id)})
+				return err
+			}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Sweeper) deleteLoadBalancers(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, arn := range p.loadBalancers {
+			errs = append(errs, s.remove("load balancer", arn, func() error {
+				// Prod load balancers have deletion protection on
+				if err := utils.DisableDeletionProtectionE(s.Clients.ELBv2, arn); err != nil {
+					return err
+				}
+				_, err := s.Clients.ELBv2.DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{LoadBalancerArn: aws.String(arn)})
+				return err
+			}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Sweeper) deleteTargetGroups(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, arn := range p.targetGroups {
+			errs = append(errs, s.remove("target group", arn, func() error {
+				// Stays in use for a moment after its load balancer is deleted
+				return s.retry(fmt.Sprintf("target group %s to be released", arn), func() error {
+					_, err := s.Clients.ELBv2.DeleteTargetGroup(&elbv2.DeleteTargetGroupInput{TargetGroupArn: aws.String(arn)})
+					return err
+				})
+			}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteSecurityGroups deletes all groups together, retrying those still referenced
+// by another group or by network interfaces that are going away, in whatever
+// order the references allow
+func (s *Sweeper) deleteSecurityGroups(projects []*project) error {
+	var remaining []string
+	for _, p := range projects {
+		for _, id := range p.securityGroups {
+			s.report("security group", id)
+			remaining = append(remaining, id)
+		}
+	}
+	if s.DryRun || len(remaining) == 0 {
+		return nil
+	}
+
+	return utils.Poll("security groups to be released", s.Wait, func() (bool, string, error) {
+		var blocked []string
+		var state strings.Builder
+		for _, id := range remaining {
+			_, err := s.Clients.EC2.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String(id)})
+			switch {
+			case isDependencyError(err):
+				blocked = append(blocked, id)
+				fmt.Fprintf(&state, "  %s: %v\n", id, err)
+			case err != nil:
+				return false, "", fmt.Errorf("deleting security group %s: %w", id, err)
+			}
+		}
+		remaining = blocked
+		return len(remaining) == 0, state.String(), nil
+	})
+}
+
+// deleteNatGateways deletes the gateways, waits for them to be gone and then
+// releases their Elastic IPs. The addresses of a gateway that failed to delete
+// stay, as they are still attached to it.
+func (s *Sweeper) deleteNatGateways(projects []*project) error {
+	var ids, allocations []string
+	var errs []error
+	for _, p := range projects {
+		for _, nat := range p.natGateways {
+			id := aws.StringValue(nat.NatGatewayId)
+			if err := s.remove("NAT gateway", id, func() error {
+				_, err := s.Clients.EC2.DeleteNatGateway(&ec2.DeleteNatGatewayInput{NatGatewayId: aws.String(id)})
+				return err
+			}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			ids = append(ids, id)
+			for _, address := range nat.NatGatewayAddresses {
+				if address.AllocationId != nil {
+					allocations = append(allocations, aws.StringValue(address.AllocationId))
+				}
+			}
+		}
+	}
+	if !s.DryRun && len(ids) > 0 {
+		if err := s.waitForNatGatewaysDeleted(ids); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+
+	for _, allocation := range allocations {
+		errs = append(errs, s.remove("elastic IP", allocation, func() error {
+			return s.retry(fmt.Sprintf("elastic IP %s to be released", allocation), func() error {
+				_, err := s.Clients.EC2.ReleaseAddress(&ec2.ReleaseAddressInput{AllocationId: aws.String(allocation)})
+				return err
+			})
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Sweeper) waitForNatGatewaysDeleted(ids []string) error {
+	return utils.Poll("NAT gateways to be deleted", s.Wait, func() (bool, string, error) {
+		output, err := s.Clients.EC2.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+			NatGatewayIds: aws.StringSlice(ids),
+		})
+		if err != nil {
+			return false, "", err
+		}
+		done := true
+		var state strings.Builder
+		for _, nat := range output.NatGateways {
+			if aws.StringValue(nat.State) != ec2.NatGatewayStateDeleted {
+				done = false
+			}
+			fmt.Fprintf(&state, "  %s: %s\n", aws.StringValue(nat.NatGatewayId), aws.StringValue(nat.State))
+		}
+		return done, state.String(), nil
+	})
+}
+
+// deleteVpcs deletes each VPC along with the internet gateways, subnets and route
+// tables in it. The default security group and main route table go with the VPC.
+func (s *Sweeper) deleteVpcs(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, vpcID := range p.vpcs {
+			errs = append(errs, s.deleteVpc(vpcID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Sweeper) deleteVpc(vpcID string) error {
+	vpcFilter := func(name string) []*ec2.Filter {
+		return []*ec2.Filter{{Name: aws.String(name), Values: []*string{aws.String(vpcID)}}}
+	}
+
+	igws, err := s.Clients.EC2.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{Filters: vpcFilter("attachment.vpc-id")})
+	if err != nil {
+		return fmt.Errorf("listing internet gateways of %s: %w", vpcID, err)
+	}
+	for _, igw := range igws.InternetGateways {
+		id := igw.InternetGatewayId
+		if err := s.remove("internet gateway", aws.StringValue(id), func() error {
+			if _, err := s.Clients.EC2.DetachInternetGateway(&ec2.DetachInternetGatewayInput{InternetGatewayId: id, VpcId: aws.String(vpcID)}); err != nil {
+				return err
+			}
+			_, err := s.Clients.EC2.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: id})
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	subnets, err := s.Clients.EC2.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: vpcFilter("vpc-id")})
+	if err != nil {
+		return fmt.Errorf("listing subnets of %s: %w", vpcID, err)
+	}
+	for _, subnet := range subnets.Subnets {
+		id := subnet.SubnetId
+		if err := s.remove("subnet", aws.StringValue(id), func() error {
+			// Network interfaces of deleted load balancers and instances take a while to go
+			return s.retry(fmt.Sprintf("subnet %s to be released", aws.StringValue(id)), func() error {
+				_, err := s.Clients.EC2.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: id})
+				return err
+			})
+		}); err != nil {
+			return err
+		}
+	}
+
+	tables, err := s.Clients.EC2.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: vpcFilter("vpc-id")})
+	if err != nil {
+		return fmt.Errorf("listing route tables of %s: %w", vpcID, err)
+	}
+	for _, table := range tables.RouteTables {
+		if isMainRouteTable(table) {
+			continue
+		}
+		id := table.RouteTableId
+		if err := s.remove("route table", aws.StringValue(id), func() error {
+			_, err := s.Clients.EC2.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: id})
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return s.remove("VPC", vpcID, func() error {
+		return s.retry(fmt.Sprintf("VPC %s to be released", vpcID), func() error {
+			_, err := s.Clients.EC2.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String(vpcID)})
+			return err
+		})
+	})
+}
+
+func isMainRouteTable(table *ec2.RouteTable) bool {
+	for _, association := range table.Associations {
+		if aws.BoolValue(association.Main) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Sweeper) deleteLogGroups(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, name := range p.logGroups {
+			errs = append(errs, s.remove("log group", name, func() error {
+				_, err := s.Clients.Logs.DeleteLogGroup(&cloudwatchlogs.DeleteLogGroupInput{LogGroupName: aws.String(name)})
+				return err
+			}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteInstanceProfiles removes the swept roles from their instance profiles and
+// deletes the profiles, as a role cannot go while a profile holds it
+func (s *Sweeper) deleteInstanceProfiles(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, profile := range p.instanceProfiles {
+			errs = append(errs, s.remove("instance profile", profile.name, func() error {
+				if _, err := s.Clients.IAM.RemoveRoleFromInstanceProfile(&iam.RemoveRoleFromInstanceProfileInput{
+					InstanceProfileName: aws.String(profile.name),
+					RoleName:            aws.String(profile.role),
+				}); err != nil {
+					return err
+				}
+				_, err := s.Clients.IAM.DeleteInstanceProfile(&iam.DeleteInstanceProfileInput{InstanceProfileName: aws.String(profile.name)})
+				return err
+			}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteRoles detaches the managed policies of each role before deleting it
+func (s *Sweeper) deleteRoles(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, name := range p.roles {
+			errs = append(errs, s.remove("IAM role", name, func() error {
+				attached, err := s.Clients.IAM.ListAttachedRolePolicies(&iam.ListAttachedRolePoliciesInput{RoleName: aws.String(name)})
+				if err != nil {
+					return err
+				}
+				for _, policy := range attached.AttachedPolicies {
+					if _, err := s.Clients.IAM.DetachRolePolicy(&iam.DetachRolePolicyInput{
+						RoleName:  aws.String(name),
+						PolicyArn: policy.PolicyArn,
+					}); err != nil {
+						return err
+					}
+				}
+				_, err = s.Clients.IAM.DeleteRole(&iam.DeleteRoleInput{RoleName: aws.String(name)})
+				return err
+			}))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deletePolicies deletes the policies, which the role deletes have detached
+func (s *Sweeper) deletePolicies(projects []*project) error {
+	var errs []error
+	for _, p := range projects {
+		for _, arn := range p.policies {
+			errs = append(errs, s.remove("IAM policy", arn, func() error {
+				_, err := s.Clients.IAM.DeletePolicy(&iam.DeletePolicyInput{PolicyArn: aws.String(arn)})
+				return err
+			}))
+		}
+	}
+	return errors.Join(errs...)
+}
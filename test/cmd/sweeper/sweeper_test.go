@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/fakeaws"
+	"test/utils"
+)
+
+const (
+	albArn        = "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/sharedaaa111-ci-alb/1"
+	tgArn         = "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/sharedaaa111-ci-app1/1"
+	flowLogArn    = "arn:aws:iam::123456789012:policy/vpc-flow-log-to-cloudwatch-20240101"
+	s3ReadOnlyArn = "arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"
+)
+
+func managedTags(project string) []*ec2.Tag {
+	return []*ec2.Tag{
+		{Key: aws.String("Project"), Value: aws.String(project)},
+		{Key: aws.String("ManagedBy"), Value: aws.String("terraform")},
+	}
+}
+
+func managedIAMTags(project string) []*iam.Tag {
+	return []*iam.Tag{
+		{Key: aws.String("Project"), Value: aws.String(project)},
+		{Key: aws.String("ManagedBy"), Value: aws.String("terraform")},
+	}
+}
+
+func asgTags(project string) []*autoscaling.TagDescription {
+	return []*autoscaling.TagDescription{
+		{Key: aws.String("Project"), Value: aws.String(project)},
+		{Key: aws.String("ManagedBy"), Value: aws.String("terraform")},
+	}
+}
+
+// sweeperFixtures holds two old projects sharing a VPC like the module tests do
+// (sharedaaa111 with the VPC and ALB, compaaa111 with the compute resources), a
+// project that is too young, one that does not match the test naming patterns
+// and a security group of an old project that terraform does not manage. The IAM
+// roles and policy and the log group are those of the compute module and of the
+// VPC flow logs, next to a role of the account that is none of the tests'.
+func sweeperFixtures() *fakeaws.Fixtures {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	young := time.Now().UTC()
+
+	return &fakeaws.Fixtures{
+		Vpcs: []*ec2.Vpc{
+			{VpcId: aws.String("vpc-shared"), Tags: managedTags("sharedaaa111")},
+			{VpcId: aws.String("vpc-prod"), Tags: managedTags("production")},
+		},
+		Subnets: []*ec2.Subnet{
+			{SubnetId: aws.String("subnet-public"), VpcId: aws.String("vpc-shared"), Tags: managedTags("sharedaaa111")},
+			{SubnetId: aws.String("subnet-private"), VpcId: aws.String("vpc-shared"), Tags: managedTags("sharedaaa111")},
+		},
+		InternetGateways: []*ec2.InternetGateway{{
+			InternetGatewayId: aws.String("igw-shared"),
+			Attachments:       []*ec2.InternetGatewayAttachment{{VpcId: aws.String("vpc-shared"), State: aws.String("available")}},
+			Tags:              managedTags("sharedaaa111"),
+		}},
+		RouteTables: []*ec2.RouteTable{
+			{
+				RouteTableId: aws.String("rtb-main"),
+				VpcId:        aws.String("vpc-shared"),
+				Associations: []*ec2.RouteTableAssociation{{Main: aws.Bool(true)}},
+			},
+			{RouteTableId: aws.String("rtb-public"), VpcId: aws.String("vpc-shared"), Tags: managedTags("sharedaaa111")},
+		},
+		NatGateways: []*ec2.NatGateway{{
+			NatGatewayId:        aws.String("nat-shared"),
+			VpcId:               aws.String("vpc-shared"),
+			SubnetId:            aws.String("subnet-public"),
+			State:               aws.String(ec2.NatGatewayStateAvailable),
+			CreateTime:          aws.Time(old),
+			NatGatewayAddresses: []*ec2.NatGatewayAddress{{AllocationId: aws.String("eipalloc-shared")}},
+			Tags:                managedTags("sharedaaa111"),
+		}},
+		Addresses: []*ec2.Address{{AllocationId: aws.String("eipalloc-shared"), Tags: managedTags("sharedaaa111")}},
+		SecurityGroups: []*ec2.SecurityGroup{
+			{GroupId: aws.String("sg-default"), GroupName: aws.String("default"), VpcId: aws.String("vpc-shared")},
+			{
+				GroupId: aws.String("sg-alb"), GroupName: aws.String("sharedaaa111-ci-alb"), VpcId: aws.String("vpc-shared"),
+				// The ALB's egress to the instances keeps the compute group from going first
+				IpPermissionsEgress: []*ec2.IpPermission{{UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-app")}}}},
+				Tags:                managedTags("sharedaaa111"),
+			},
+			{GroupId: aws.String("sg-app"), GroupName: aws.String("compaaa111-ci-ec2"), VpcId: aws.String("vpc-shared"), Tags: managedTags("compaaa111")},
+			{GroupId: aws.String("sg-young"), GroupName: aws.String("compyng222-ci-ec2"), VpcId: aws.String("vpc-prod"), Tags: managedTags("compyng222")},
+			{
+				GroupId: aws.String("sg-manual"), GroupName: aws.String("debugging"), VpcId: aws.String("vpc-prod"),
+				Tags: []*ec2.Tag{{Key: aws.String("Project"), Value: aws.String("compaaa111")}},
+			},
+		},
+		LaunchTemplates: []*ec2.LaunchTemplate{
+			{LaunchTemplateId: aws.String("lt-app"), LaunchTemplateName: aws.String("compaaa111-ci-"), CreateTime: aws.Time(old), Tags: managedTags("compaaa111")},
+			{LaunchTemplateId: aws.String("lt-young"), LaunchTemplateName: aws.String("compyng222-ci-"), CreateTime: aws.Time(young), Tags: managedTags("compyng222")},
+		},
+		Instances: []*ec2.Instance{{
+			InstanceId: aws.String("i-app"),
+			SubnetId:   aws.String("subnet-private"),
+			State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+		}},
+		AutoScalingGroups: []*autoscaling.Group{
+			{
+				AutoScalingGroupName: aws.String("compaaa111-ci-asg"),
+				CreatedTime:          aws.Time(old),
+				Instances:            []*autoscaling.Instance{{InstanceId: aws.String("i-app")}},
+				Tags:                 asgTags("compaaa111"),
+			},
+			{
+				AutoScalingGroupName: aws.String("compyng222-ci-asg"),
+				CreatedTime:          aws.Time(young),
+				Tags:                 asgTags("compyng222"),
+			},
+		},
+		LoadBalancers: []*elbv2.LoadBalancer{{
+			LoadBalancerArn:  aws.String(albArn),
+			LoadBalancerName: aws.String("sharedaaa111-ci-alb"),
+			CreatedTime:      aws.Time(old),
+			SecurityGroups:   aws.StringSlice([]string{"sg-alb"}),
+		}},
+		// Left behind by a prod-like run
+		LoadBalancerAttributes: map[string][]*elbv2.LoadBalancerAttribute{
+			albArn: {{Key: aws.String(utils.DeletionProtectionAttribute), Value: aws.String("true")}},
+		},
+		TargetGroups: []*elbv2.TargetGroup{{
+			TargetGroupArn:   aws.String(tgArn),
+			LoadBalancerArns: aws.StringSlice([]string{albArn}),
+		}},
+		ELBTags: map[string][]*elbv2.Tag{
+			albArn: {{Key: aws.String("Project"), Value: aws.String("sharedaaa111")}, {Key: aws.String("ManagedBy"), Value: aws.String("terraform")}},
+			tgArn:  {{Key: aws.String("Project"), Value: aws.String("sharedaaa111")}, {Key: aws.String("ManagedBy"), Value: aws.String("terraform")}},
+		},
+		LogGroups: []*cloudwatchlogs.LogGroup{{
+			LogGroupName: aws.String("/aws/vpc-flow-log/vpc-shared"),
+			CreationTime: aws.Int64(old.UnixMilli()),
+		}},
+		LogGroupTags: map[string]map[string]*string{
+			"/aws/vpc-flow-log/vpc-shared": {"Project": aws.String("sharedaaa111"), "ManagedBy": aws.String("terraform")},
+		},
+		Roles: []*iam.Role{
+			{RoleName: aws.String("compaaa111-ci-ec2-role"), CreateDate: aws.Time(old), Tags: managedIAMTags("compaaa111")},
+			{RoleName: aws.String("compyng222-ci-ec2-role"), CreateDate: aws.Time(young), Tags: managedIAMTags("compyng222")},
+			{RoleName: aws.String("vpc-flow-log-role-20240101"), CreateDate: aws.Time(old), Tags: managedIAMTags("sharedaaa111")},
+			{RoleName: aws.String("OrganizationAccountAccessRole"), CreateDate: aws.Time(old)},
+		},
+		AttachedRolePolicies: map[string][]*iam.AttachedPolicy{
+			"compaaa111-ci-ec2-role":     {{PolicyArn: aws.String(s3ReadOnlyArn)}},
+			"vpc-flow-log-role-20240101": {{PolicyArn: aws.String(flowLogArn)}},
+		},
+		InstanceProfiles: []*iam.InstanceProfile{
+			{InstanceProfileName: aws.String("compaaa111-ci-ec2-profile"), Roles: []*iam.Role{{RoleName: aws.String("compaaa111-ci-ec2-role")}}},
+			{InstanceProfileName: aws.String("compyng222-ci-ec2-profile"), Roles: []*iam.Role{{RoleName: aws.String("compyng222-ci-ec2-role")}}},
+		},
+		Policies: []*iam.Policy{{
+			PolicyName: aws.String("vpc-flow-log-to-cloudwatch-20240101"),
+			Arn:        aws.String(flowLogArn),
+			CreateDate: aws.Time(old),
+			Tags:       managedIAMTags("sharedaaa111"),
+		}},
+	}
+}
+
+func newTestSweeper(dryRun bool, out *bytes.Buffer) *Sweeper {
+	var patterns []*regexp.Regexp
+	for _, pattern := range DefaultProjectPatterns {
+		patterns = append(patterns, regexp.MustCompile(pattern))
+	}
+	return &Sweeper{
+		Clients:  NewClients(utils.CreateSession("us-east-1")),
+		Patterns: patterns,
+		MinAge:   6 * time.Hour,
+		DryRun:   dryRun,
+		Wait:     utils.WaitOptions{Timeout: 2 * time.Second, Interval: 10 * time.Millisecond},
+		Out:      out,
+	}
+}
+
+// linesWithPrefix returns the output lines starting with prefix, without it
+func linesWithPrefix(out *bytes.Buffer, prefix string) []string {
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			lines = append(lines, strings.TrimPrefix(line, prefix))
+		}
+	}
+	return lines
+}
+
+var expectedDeletes = []string{
+	"auto scaling group compaaa111-ci-asg",
+	"launch template lt-app",
+	"load balancer " + albArn,
+	"target group " + tgArn,
+	"security group sg-app",
+	"security group sg-alb",
+	"NAT gateway nat-shared",
+	"elastic IP eipalloc-shared",
+	"internet gateway igw-shared",
+	"subnet subnet-public",
+	"subnet subnet-private",
+	"route table rtb-public",
+	"VPC vpc-shared",
+	"log group /aws/vpc-flow-log/vpc-shared",
+	"instance profile compaaa111-ci-ec2-profile",
+	"IAM role compaaa111-ci-ec2-role",
+	"IAM role vpc-flow-log-role-20240101",
+	"IAM policy " + flowLogArn,
+}
+
+func TestSweepDryRun(t *testing.T) {
+	// One resource per page, so only a sweep that reads every page finds them all
+	fixtures := sweeperFixtures()
+	fixtures.EC2PageSize = 1
+	server := fakeaws.Start(t, fixtures)
+	var out bytes.Buffer
+
+	require.NoError(t, newTestSweeper(true, &out).Sweep())
+
+	assert.Equal(t, expectedDeletes, linesWithPrefix(&out, "would delete "))
+	for _, call := range server.Calls() {
+		action := call[strings.Index(call, ":")+1:]
+		assert.True(t, strings.HasPrefix(action, "Describe") || strings.HasPrefix(action, "List"), "dry run made a %s call", call)
+	}
+}
+
+func TestSweepDeletesInDependencyOrder(t *testing.T) {
+	server := fakeaws.Start(t, sweeperFixtures())
+	var out bytes.Buffer
+
+	require.NoError(t, newTestSweeper(false, &out).Sweep())
+
+	assert.Equal(t, []string{"compaaa111", "sharedaaa111"}, linesWithPrefix(&out, "sweeping project "))
+	assert.Len(t, linesWithPrefix(&out, "skipping project compyng222: created "), 1)
+	assert.Equal(t, expectedDeletes, linesWithPrefix(&out, "deleting "))
+
+	// sg-app is retried once sg-alb no longer references it
+	var sgDeletes int
+	for _, call := range server.Calls() {
+		if call == "ec2:DeleteSecurityGroup" {
+			sgDeletes++
+		}
+	}
+	assert.Equal(t, 3, sgDeletes)
+
+	server.Update(func(f *fakeaws.Fixtures) {
+		// Only the young, unmatched and unmanaged resources are left
+		var vpcs, groups, templates, asgs []string
+		for _, vpc := range f.Vpcs {
+			vpcs = append(vpcs, aws.StringValue(vpc.VpcId))
+		}
+		for _, sg := range f.SecurityGroups {
+			groups = append(groups, aws.StringValue(sg.GroupId))
+		}
+		for _, lt := range f.LaunchTemplates {
+			templates = append(templates, aws.StringValue(lt.LaunchTemplateId))
+		}
+		for _, group := range f.AutoScalingGroups {
+			asgs = append(asgs, aws.StringValue(group.AutoScalingGroupName))
+		}
+		assert.Equal(t, []string{"vpc-prod"}, vpcs)
+		assert.Equal(t, []string{"sg-young", "sg-manual"}, groups)
+		assert.Equal(t, []string{"lt-young"}, templates)
+		assert.Equal(t, []string{"compyng222-ci-asg"}, asgs)
+		assert.Empty(t, f.Subnets)
+		assert.Empty(t, f.InternetGateways)
+		assert.Empty(t, f.RouteTables)
+		assert.Empty(t, f.Addresses)
+		assert.Empty(t, f.LoadBalancers)
+		assert.Empty(t, f.TargetGroups)
+		assert.Empty(t, f.LogGroups)
+		assert.Empty(t, f.Policies)
+
+		var roles, profiles []string
+		for _, role := range f.Roles {
+			roles = append(roles, aws.StringValue(role.RoleName))
+		}
+		for _, profile := range f.InstanceProfiles {
+			profiles = append(profiles, aws.StringValue(profile.InstanceProfileName))
+		}
+		assert.Equal(t, []string{"compyng222-ci-ec2-role", "OrganizationAccountAccessRole"}, roles)
+		assert.Equal(t, []string{"compyng222-ci-ec2-profile"}, profiles)
+	})
+}
+
+// stuckNatGatewayEC2 fails the delete of one NAT gateway
+type stuckNatGatewayEC2 struct {
+	EC2API
+	stuck string
+}
+
+func (c stuckNatGatewayEC2) DeleteNatGateway(input *ec2.DeleteNatGatewayInput) (*ec2.DeleteNatGatewayOutput, error) {
+	if aws.StringValue(input.NatGatewayId) == c.stuck {
+		return nil, errors.New("throttled")
+	}
+	return c.EC2API.DeleteNatGateway(input)
+}
+
+func TestSweepDeletesTheOtherNatGatewaysWhenOneFails(t *testing.T) {
+	old := aws.Time(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	nat := func(id, allocation string) *ec2.NatGateway {
+		return &ec2.NatGateway{
+			NatGatewayId:        aws.String(id),
+			State:               aws.String(ec2.NatGatewayStateAvailable),
+			CreateTime:          old,
+			NatGatewayAddresses: []*ec2.NatGatewayAddress{{AllocationId: aws.String(allocation)}},
+			Tags:                managedTags("sharedaaa111"),
+		}
+	}
+	server := fakeaws.Start(t, &fakeaws.Fixtures{
+		NatGateways: []*ec2.NatGateway{nat("nat-stuck", "eipalloc-stuck"), nat("nat-a", "eipalloc-a")},
+		Addresses:   []*ec2.Address{{AllocationId: aws.String("eipalloc-stuck")}, {AllocationId: aws.String("eipalloc-a")}},
+	})
+	var out bytes.Buffer
+	sweeper := newTestSweeper(false, &out)
+	sweeper.Clients.EC2 = stuckNatGatewayEC2{EC2API: sweeper.Clients.EC2, stuck: "nat-stuck"}
+
+	err := sweeper.Sweep()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "deleting NAT gateway nat-stuck: throttled")
+
+	// The address of the stuck gateway stays attached to it
+	assert.Equal(t, []string{"NAT gateway nat-stuck", "NAT gateway nat-a", "elastic IP eipalloc-a"}, linesWithPrefix(&out, "deleting "))
+	server.Update(func(f *fakeaws.Fixtures) {
+		require.Len(t, f.Addresses, 1)
+		assert.Equal(t, "eipalloc-stuck", aws.StringValue(f.Addresses[0].AllocationId))
+	})
+}
+
+func TestSweepDatesVpcsByTheirFlowLogs(t *testing.T) {
+	fakeaws.Start(t, &fakeaws.Fixtures{
+		Vpcs: []*ec2.Vpc{
+			{VpcId: aws.String("vpc-old"), Tags: managedTags("vpc-test-Old123")},
+			{VpcId: aws.String("vpc-young"), Tags: managedTags("vpc-test-Yng123")},
+		},
+		FlowLogs: []*ec2.FlowLog{
+			{FlowLogId: aws.String("fl-old"), ResourceId: aws.String("vpc-old"), CreationTime: aws.Time(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))},
+			{FlowLogId: aws.String("fl-young"), ResourceId: aws.String("vpc-young"), CreationTime: aws.Time(time.Now().UTC())},
+		},
+	})
+	var out bytes.Buffer
+
+	require.NoError(t, newTestSweeper(true, &out).Sweep())
+	assert.Equal(t, []string{"vpc-test-Old123"}, linesWithPrefix(&out, "sweeping project "))
+	assert.Len(t, linesWithPrefix(&out, "skipping project vpc-test-Yng123: created "), 1)
+	assert.Equal(t, []string{"VPC vpc-old"}, linesWithPrefix(&out, "would delete "))
+}
+
+func TestSweepListsProjectsOfUnknownAge(t *testing.T) {
+	fakeaws.Start(t, &fakeaws.Fixtures{
+		SecurityGroups: []*ec2.SecurityGroup{{GroupId: aws.String("sg-app"), Tags: managedTags("compabc123")}},
+	})
+	var out bytes.Buffer
+
+	require.NoError(t, newTestSweeper(false, &out).Sweep())
+	assert.Equal(t, []string{"compabc123: age unknown, sweep it with -min-age 0"}, linesWithPrefix(&out, "skipping project "))
+	assert.Empty(t, linesWithPrefix(&out, "deleting "))
+
+	out.Reset()
+	sweeper := newTestSweeper(false, &out)
+	sweeper.MinAge = 0
+	require.NoError(t, sweeper.Sweep())
+	assert.Equal(t, []string{"security group sg-app"}, linesWithPrefix(&out, "deleting "))
+}
+
+func TestDefaultProjectPatterns(t *testing.T) {
+	sweeper := newTestSweeper(true, &bytes.Buffer{})
+	for _, name := range []string{"vpc-test-AbC123", "albabc123", "compabc123", "upgabc123", "sharedabc123"} {
+		assert.True(t, sweeper.matches(name), name)
+	}
+	// Six characters alone could be anybody's project
+	for _, name := range []string{"abc123", "webapp", "production", "albabc1234", "vpc-test-abc"} {
+		assert.False(t, sweeper.matches(name), name)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/gruntwork-io/terratest/modules/random"
@@ -21,211 +20,149 @@ import (
 func TestComputeModule(t *testing.T) {
 	t.Parallel()
 
-	workingDir := test_structure.CopyTerraformFolderToTemp(t, "../", "modules/compute")
-	uniqueID := strings.ToLower(random.UniqueId())
-	projectName := fmt.Sprintf("comp%s", uniqueID)
-
-	testCases := []struct {
-		name          string
-		region        string
-		environment   string
-		instanceType  string
-		instanceCount int
-		apps         map[string]interface{}
-	}{
-		{
-			name:          "us-east-1-ci",
-			region:        "us-east-1",
-			environment:   "ci",
-			instanceType:  "t3.micro",
-			instanceCount: 2,
-			apps: map[string]interface{}{
-				"app1": map[string]interface{}{
-					"port":             8085,
-					"path":             "/app1/*",
-					"health_check_url": "/app1/status",
-					"domain":           []string{"merkata.cloudns.be"},
-					"priority":         100,
-				},
-				"app2": map[string]interface{}{
-					"port":             8086,
-					"path":             "/app2/*",
-					"health_check_url": "/app2/status",
-					"domain":           []string{"merkata.cloudns.be"},
-					"priority":         200,
-				},
-			},
-		},
-	}
-
-	for _, testCase := range testCases {
-		tc := testCase
-
-		t.Run(tc.name, func(t *testing.T) {
-			t.Parallel()
-
-			// Create VPC first as compute depends on it
-			vpcOpts := utils.CreateVPC(t, tc.region, tc.environment, projectName)
-			defer terraform.Destroy(t, vpcOpts)
-
-			terraform.InitAndApply(t, vpcOpts)
+	loadTestMatrix(t).Run(t, utils.MatrixTestCompute, func(t *testing.T, tc utils.MatrixCase) {
+		workingDir := test_structure.CopyTerraformFolderToTemp(t, "../", "modules/compute")
+		uniqueID := strings.ToLower(random.UniqueId())
+		projectName := fmt.Sprintf("comp%s", uniqueID)
 
-			vpcID := terraform.Output(t, vpcOpts, "vpc_id")
-			privateSubnets := terraform.OutputList(t, vpcOpts, "private_subnets")
-			publicSubnets := terraform.OutputList(t, vpcOpts, "public_subnets")
-
-			// Create ALB using the ALB module
-			albOpts := utils.CreateALB(t, tc.region, tc.environment, projectName, vpcID, publicSubnets)
-			defer terraform.Destroy(t, albOpts)
-
-			terraform.InitAndApply(t, albOpts)
-
-			albSecurityGroupID := terraform.Output(t, albOpts, "alb_security_group_id")
-			targetGroupArns := terraform.OutputMap(t, albOpts, "target_group_arns")
-			tgARNs := []string{
-				targetGroupArns["app1"],
-				targetGroupArns["app2"],
-			}
-
-			// Setup compute module
-			computeOpts := &terraform.Options{
+		computeOptions := func(vpcID string, privateSubnets []string, albSecurityGroupID string, tgARNs []string) *terraform.Options {
+			return &terraform.Options{
 				TerraformDir: workingDir,
 				Vars: map[string]interface{}{
-					"environment":           tc.environment,
+					"environment":           tc.Environment,
 					"project_name":          projectName,
 					"vpc_id":                vpcID,
 					"private_subnets":       privateSubnets,
-					"instance_type":         tc.instanceType,
-					"instance_count":        tc.instanceCount,
-					"apps":                  tc.apps,
+					"instance_type":         tc.InstanceType,
+					"instance_count":        tc.InstanceCount,
+					"apps":                  tc.Apps.ToVars(),
 					"target_group_arns":     tgARNs,
 					"alb_security_group_id": albSecurityGroupID,
 				},
 				EnvVars: map[string]string{
-					"AWS_DEFAULT_REGION": tc.region,
+					"AWS_DEFAULT_REGION": tc.Region,
 				},
 			}
+		}
 
-			defer terraform.Destroy(t, computeOpts)
+		// In plan mode only validate the planned values, using placeholder inputs
+		// instead of a deployed VPC and ALB
+		if utils.IsPlanMode() {
+			computeOpts := computeOptions(utils.PlanVPCID, utils.PlanPrivateSubnets(), utils.PlanALBSecurityGroupID,
+				utils.PlanTargetGroupArns(tc.Region, tc.Apps.Names()))
+			plan := utils.InitAndPlanOffline(t, computeOpts, t.TempDir())
+			validateComputePlan(t, plan, tc.Environment, projectName, tc.InstanceType, tc.InstanceCount,
+				tc.Apps, utils.PlanALBSecurityGroupID)
+			return
+		}
 
+		defer test_structure.RunTestStage(t, utils.StageTeardown, func() {
+			// A deploy that failed before saving its options left no instances behind
+			if test_structure.IsTestDataPresent(t, test_structure.FormatTestDataPath(workingDir, "TerraformOptions.json")) {
+				terraform.Destroy(t, test_structure.LoadTerraformOptions(t, workingDir))
+			}
+		})
+
+		// The VPC and ALB are shared with the other module tests
+		alb := sharedFixtures.ALBStage(t, workingDir, tc.Region, tc.Environment, tc.VPCCIDR, tc.Apps)
+
+		var tgARNs []string
+		for _, appName := range tc.Apps.Names() {
+			tgARNs = append(tgARNs, alb.TargetGroupArns[appName])
+		}
+
+		test_structure.RunTestStage(t, utils.StageDeployCompute, func() {
+			computeOpts := computeOptions(alb.VPC.ID, alb.VPC.PrivateSubnets, alb.SecurityGroupID, tgARNs)
+			test_structure.SaveTerraformOptions(t, workingDir, computeOpts)
 			terraform.InitAndApply(t, computeOpts)
+			utils.AssertIdempotent(t, computeOpts, t.TempDir())
+			utils.SaveOutputs(t, workingDir, computeOpts)
+		})
+
+		test_structure.RunTestStage(t, utils.StageValidate, func() {
+			// Saved options lose their Go types in JSON, so rebuild them and only take
+			// the project name the module was deployed with from the saved copy
+			computeOpts := computeOptions(alb.VPC.ID, alb.VPC.PrivateSubnets, alb.SecurityGroupID, tgARNs)
+			computeOpts.Vars["project_name"] = test_structure.LoadTerraformOptions(t, workingDir).Vars["project_name"]
+			outputs := utils.LoadOutputs(t, workingDir)
 
 			// Create AWS clients
-			ec2Client := utils.CreateEC2Client(tc.region)
-			asgClient := utils.CreateASGClient(tc.region) 
-			iamClient := utils.CreateIAMClient(tc.region)
+			clients := utils.CreateClients(tc.Region)
+			ec2Client := clients.EC2
+			asgClient := clients.AutoScaling
+			iamClient := clients.IAM
 
 			// Test Launch Template
-			testLaunchTemplate(t, ec2Client, computeOpts)
+			testLaunchTemplate(t, ec2Client, outputs.String("launch_template_id"), computeOpts.Vars)
 
-			// Test Auto Scaling Group  
-			testAutoScalingGroup(t, asgClient, computeOpts)
+			// Test Auto Scaling Group
+			testAutoScalingGroup(t, asgClient, outputs.String("autoscaling_group_name"), computeOpts.Vars)
 
 			// Test IAM Role and Instance Profile
-			testIAMConfiguration(t, iamClient, computeOpts)
+			tagPolicy := utils.RequiredTags(tc.Environment, computeOpts.Vars["project_name"].(string))
+			testIAMConfiguration(t, iamClient, outputs.String("iam_role_name"), tagPolicy)
 
 			// Test Security Group
-			testSecurityGroup(t, ec2Client, computeOpts)
+			testSecurityGroup(t, ec2Client, outputs.String("security_group_id"), tc.Apps, tagPolicy)
+			testSecurityGroupReachability(t, ec2Client, alb.SecurityGroupID, outputs.String("security_group_id"), tc.Apps)
 		})
-	}
+	})
 }
 
 
-func testLaunchTemplate(t *testing.T, ec2Client *ec2.EC2, terraformOptions *terraform.Options) {
-	ltID := terraform.Output(t, terraformOptions, "launch_template_id")
-
-	input := &ec2.DescribeLaunchTemplatesInput{
-		LaunchTemplateIds: []*string{aws.String(ltID)},
-	}
-
-	result, err := ec2Client.DescribeLaunchTemplates(input)
+func testLaunchTemplate(t utils.AssertT, ec2Client utils.EC2API, ltID string, vars map[string]interface{}) {
+	lt, err := utils.DescribeLaunchTemplateE(ec2Client, ltID)
 	require.NoError(t, err)
-	require.Len(t, result.LaunchTemplates, 1)
-
-	// Get latest version details
-	versionInput := &ec2.DescribeLaunchTemplateVersionsInput{
-		LaunchTemplateId: aws.String(ltID),
-		Versions:         []*string{aws.String("$Latest")},
-	}
-
-	versionResult, err := ec2Client.DescribeLaunchTemplateVersions(versionInput)
-	require.NoError(t, err)
-	require.Len(t, versionResult.LaunchTemplateVersions, 1)
-
-	lt := versionResult.LaunchTemplateVersions[0]
 
 	// Verify instance type
-	assert.Equal(t, terraformOptions.Vars["instance_type"], *lt.LaunchTemplateData.InstanceType)
+	assert.Equal(t, vars["instance_type"], lt.InstanceType)
 
 	// Verify EBS volume
-	require.Len(t, lt.LaunchTemplateData.BlockDeviceMappings, 1)
-	volume := lt.LaunchTemplateData.BlockDeviceMappings[0].Ebs
-	assert.Equal(t, int64(30), *volume.VolumeSize)
-	assert.Equal(t, "gp3", *volume.VolumeType)
+	require.Len(t, lt.Volumes, 1)
+	assert.Equal(t, 30, lt.Volumes[0].VolumeSize)
+	assert.Equal(t, "gp3", lt.Volumes[0].VolumeType)
 
 	// Verify tags
-	require.NotNil(t, lt.LaunchTemplateData.TagSpecifications, "TagSpecifications should not be nil")
-	require.Greater(t, len(lt.LaunchTemplateData.TagSpecifications), 0, "TagSpecifications should not be empty")
-	require.NotNil(t, lt.LaunchTemplateData.TagSpecifications[0].Tags, "Tags should not be nil")
-	
-	hasExpectedTags := utils.HasRequiredTags(
-		utils.ConvertEC2TagsToTags(lt.LaunchTemplateData.TagSpecifications[0].Tags),
-		map[string]string{
-			"Environment": terraformOptions.Vars["environment"].(string),
-			"Project":     terraformOptions.Vars["project_name"].(string),
-		},
+	instanceTags, ok := lt.TagSpecifications[ec2.ResourceTypeInstance]
+	require.True(t, ok, "the launch template should tag its instances")
+
+	utils.AssertTagPolicy(t, utils.RequiredTags(vars["environment"].(string), vars["project_name"].(string)),
+		utils.TaggedResource{Kind: "launch template", ID: ltID, Tags: lt.Tags},
+		utils.TaggedResource{Kind: "launch template instance tags", ID: ltID, Tags: instanceTags},
 	)
-	assert.True(t, hasExpectedTags)
 }
 
-func testAutoScalingGroup(t *testing.T, asgClient *autoscaling.AutoScaling, terraformOptions *terraform.Options) {
-	asgName := terraform.Output(t, terraformOptions, "autoscaling_group_name")
-
-	input := &autoscaling.DescribeAutoScalingGroupsInput{
-		AutoScalingGroupNames: []*string{aws.String(asgName)},
-	}
-
-	result, err := asgClient.DescribeAutoScalingGroups(input)
+func testAutoScalingGroup(t utils.AssertT, asgClient utils.AutoScalingAPI, asgName string, vars map[string]interface{}) {
+	asg, err := utils.DescribeAutoScalingGroupE(asgClient, asgName)
 	require.NoError(t, err)
-	require.Len(t, result.AutoScalingGroups, 1)
-
-	asg := result.AutoScalingGroups[0]
 
-	// Verify ASG is not nil and has expected properties
-	require.NotNil(t, asg.DesiredCapacity, "DesiredCapacity should not be nil")
-	require.NotNil(t, asg.MinSize, "MinSize should not be nil")
-	require.NotNil(t, asg.MaxSize, "MaxSize should not be nil")
-	require.NotNil(t, asg.VPCZoneIdentifier, "VPCZoneIdentifier should not be nil")
-
-	instanceCount, ok := terraformOptions.Vars["instance_count"].(int)
+	instanceCount, ok := vars["instance_count"].(int)
 	require.True(t, ok, "instance_count should be an integer")
 
 	// Verify instance count
-	assert.Equal(t, int64(instanceCount), *asg.DesiredCapacity)
-	assert.Equal(t, int64(instanceCount), *asg.MinSize)
-	assert.Equal(t, int64(instanceCount*2), *asg.MaxSize)
+	assert.Equal(t, instanceCount, asg.DesiredCapacity)
+	assert.Equal(t, instanceCount, asg.MinSize)
+	assert.Equal(t, instanceCount*2, asg.MaxSize)
 
 	// Verify subnets
-	privateSubnets, ok := terraformOptions.Vars["private_subnets"].([]string)
+	privateSubnets, ok := vars["private_subnets"].([]string)
 	require.True(t, ok, "private_subnets should be a string slice")
 	require.NotEmpty(t, privateSubnets, "private_subnets should not be empty")
-	
-	actualSubnets := strings.Split(*asg.VPCZoneIdentifier, ",")
-	require.NotEmpty(t, actualSubnets, "actual subnets should not be empty")
-	assert.ElementsMatch(t, privateSubnets, actualSubnets)
+	require.NotEmpty(t, asg.Subnets, "actual subnets should not be empty")
+	assert.ElementsMatch(t, privateSubnets, asg.Subnets)
 
 	// Verify target groups
-	targetGroupArns, ok := terraformOptions.Vars["target_group_arns"].([]string)
+	targetGroupArns, ok := vars["target_group_arns"].([]string)
 	require.True(t, ok, "target_group_arns should be a string slice")
 	require.NotEmpty(t, targetGroupArns, "target_group_arns should not be empty")
-	require.NotNil(t, asg.TargetGroupARNs, "TargetGroupARNs should not be nil")
-	
-	assert.ElementsMatch(t, targetGroupArns, aws.StringValueSlice(asg.TargetGroupARNs))
-}
+	assert.ElementsMatch(t, targetGroupArns, asg.TargetGroupARNs)
 
-func testIAMConfiguration(t *testing.T, iamClient *iam.IAM, terraformOptions *terraform.Options) {
-	roleName := terraform.Output(t, terraformOptions, "iam_role_name")
+	// Verify tags
+	utils.AssertTagPolicy(t, utils.RequiredTags(vars["environment"].(string), vars["project_name"].(string)),
+		utils.TaggedResource{Kind: "auto scaling group", ID: asgName, Tags: asg.Tags})
+}
 
+func testIAMConfiguration(t utils.AssertT, iamClient utils.IAMAPI, roleName string, policy utils.TagPolicy) {
 	// Check role
 	roleInput := &iam.GetRoleInput{
 		RoleName: aws.String(roleName),
@@ -237,6 +174,9 @@ func testIAMConfiguration(t *testing.T, iamClient *iam.IAM, terraformOptions *te
 	// Verify role trust policy
 	assert.Contains(t, *roleResult.Role.AssumeRolePolicyDocument, "ec2.amazonaws.com")
 
+	// Verify tags
+	utils.AssertTagPolicy(t, policy, utils.TaggedResource{Kind: "IAM role", ID: roleName, Tags: utils.IAMTags(roleResult.Role.Tags)})
+
 	// Check attached policies
 	policiesInput := &iam.ListAttachedRolePoliciesInput{
 		RoleName: aws.String(roleName),
@@ -256,57 +196,47 @@ func testIAMConfiguration(t *testing.T, iamClient *iam.IAM, terraformOptions *te
 	assert.True(t, foundS3Policy, "S3 read only policy should be attached to the role")
 }
 
-func testSecurityGroup(t *testing.T, ec2Client *ec2.EC2, terraformOptions *terraform.Options) {
-	sgID := terraform.Output(t, terraformOptions, "security_group_id")
-
-	input := &ec2.DescribeSecurityGroupsInput{
-		GroupIds: []*string{aws.String(sgID)},
-	}
-
-	result, err := ec2Client.DescribeSecurityGroups(input)
+func testSecurityGroup(t utils.AssertT, ec2Client utils.EC2API, sgID string, apps utils.Apps, policy utils.TagPolicy) {
+	groups, err := utils.DescribeSecurityGroupsE(ec2Client, sgID)
 	require.NoError(t, err)
-	require.Len(t, result.SecurityGroups, 1)
 
-	sg := result.SecurityGroups[0]
+	sg := groups[0]
 
 	// Verify inbound rules (one for each app port)
-	apps := terraformOptions.Vars["apps"].(map[string]interface{})
 	assert.Len(t, sg.IpPermissions, len(apps))
 
 	for _, rule := range sg.IpPermissions {
 		port := *rule.FromPort
 		foundMatchingApp := false
 		for _, app := range apps {
-			if app.(map[string]interface{})["port"].(int) == int(port) {
+			if app.Port == int(port) {
 				foundMatchingApp = true
 				break
 			}
 		}
 		assert.True(t, foundMatchingApp, fmt.Sprintf("Found unexpected port %d in security group", port))
 	}
-}
 
-func createMockALBSecurityGroup(t *testing.T, ec2Client *ec2.EC2, vpcID, projectName, environment string) string {
-	input := &ec2.CreateSecurityGroupInput{
-		GroupName:   aws.String(fmt.Sprintf("%s-%s-mock-alb-sg", projectName, environment)),
-		Description: aws.String("Mock ALB Security Group for testing"),
-		VpcId:       aws.String(vpcID),
-	}
+	// Verify tags
+	utils.AssertTagPolicy(t, policy, utils.TaggedResource{Kind: "security group", ID: sgID, Tags: utils.EC2Tags(sg.Tags)})
+}
 
-	result, err := ec2Client.CreateSecurityGroup(input)
+// testSecurityGroupReachability checks what the ALB and EC2 security groups let
+// through together: only the ALB is reachable from the internet, and only on
+// 80 and 443, while the instances accept the ALB on the app ports alone
+func testSecurityGroupReachability(t utils.AssertT, ec2Client utils.EC2API, albSGID, ec2SGID string, apps utils.Apps) {
+	groups, err := utils.DescribeSecurityGroupsE(ec2Client, albSGID, ec2SGID)
 	require.NoError(t, err)
 
-	// Add tags
-	_, err = ec2Client.CreateTags(&ec2.CreateTagsInput{
-		Resources: []*string{result.GroupId},
-		Tags: []*ec2.Tag{
-			{
-				Key:   aws.String("Name"),
-				Value: aws.String(fmt.Sprintf("%s-%s-mock-alb-sg", projectName, environment)),
-			},
-		},
-	})
-	require.NoError(t, err)
+	graph := utils.NewSecurityGraph(utils.SecurityGroupsFromEC2(groups)...)
+	internet := utils.FromCIDR(utils.Internet)
+	appPorts := apps.Ports()
 
-	return *result.GroupId
+	utils.AssertReachability(t, graph,
+		utils.Reach(internet, albSGID, 80, 443),
+		utils.NoReach(internet, albSGID, 22),
+		utils.NoReach(internet, ec2SGID, append(appPorts, 22)...),
+		utils.Reach(utils.FromGroup(albSGID), ec2SGID, appPorts...),
+		utils.NoReach(utils.FromGroup(albSGID), ec2SGID, 22),
+	)
 }
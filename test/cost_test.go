@@ -0,0 +1,64 @@
+package test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/require"
+
+	"test/utils"
+)
+
+// TestCostEstimate plans the complete example for every environment of the
+// matrix, which LoadMatrix makes sure all have a budget, fails an environment
+// whose monthly cost is over its budget and logs what each one costs next to the
+// others. The cost comes from the plan alone, so nothing is deployed even in
+// apply mode. COST_PRICE_TABLE overrides the embedded prices.
+func TestCostEstimate(t *testing.T) {
+	t.Parallel()
+
+	matrix := loadTestMatrix(t)
+	if len(matrix.Budgets) == 0 {
+		t.Skipf("%s sets no budgets", utils.MatrixFile())
+	}
+	prices, err := utils.PriceTableFromEnvE()
+	require.NoError(t, err)
+
+	var environments []string
+	for environment := range matrix.Budgets {
+		environments = append(environments, environment)
+	}
+	sort.Strings(environments)
+
+	var costs []utils.EnvironmentCost
+	for _, environment := range environments {
+		environment := environment
+
+		t.Run(environment, func(t *testing.T) {
+			// The example's own terraform.tfvars are the other inputs
+			options := &terraform.Options{
+				TerraformDir: test_structure.CopyTerraformFolderToTemp(t, "../", "examples/complete"),
+				Vars: map[string]interface{}{
+					"environment":  environment,
+					"project_name": "cost",
+				},
+				EnvVars: map[string]string{
+					"AWS_DEFAULT_REGION": prices.Region,
+				},
+			}
+			plan := utils.InitAndPlanOffline(t, options, t.TempDir())
+
+			estimate, err := utils.EstimateCostE(plan, prices)
+			require.NoError(t, err)
+			t.Logf("Monthly cost of %s in %s:\n%s", environment, estimate.Currency, estimate)
+			utils.AssertWithinBudget(t, environment, estimate, matrix.Budgets[environment])
+			costs = append(costs, utils.EnvironmentCost{Environment: environment, Estimate: estimate})
+		})
+	}
+
+	if len(costs) > 1 {
+		t.Logf("Monthly cost by environment in %s:\n%s", prices.Currency, utils.FormatCostComparison(costs))
+	}
+}
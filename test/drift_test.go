@@ -0,0 +1,144 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/fakeaws"
+	"test/utils"
+)
+
+func TestDriftCheckNoDrift(t *testing.T) {
+	for _, environment := range []string{"ci", "prod"} {
+		d := newFakeDeployment(environment, "demo")
+		fakeaws.Start(t, d.Fixtures())
+
+		report, err := utils.CheckDriftE(utils.CreateClients(d.Region), d.outputs(), d.StateJSON())
+		require.NoError(t, err, environment)
+		assert.Empty(t, report, environment)
+		assert.Equal(t, "security: no drift\ncapacity: no drift\nrouting: no drift\ntagging: no drift\n", report.String(), environment)
+	}
+}
+
+func TestDriftCheckDetectsDrift(t *testing.T) {
+	testCases := []struct {
+		name string
+		// environment of the deployment, ci if empty
+		environment string
+		mutate      func(d *fakeDeployment, f *fakeaws.Fixtures)
+		expected    utils.Drift
+	}{
+		{
+			name: "ssh opened on the alb",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.SecurityGroups[0].IpPermissions = append(f.SecurityGroups[0].IpPermissions, tcpFromCIDR(22, "0.0.0.0/0"))
+			},
+			expected: utils.Drift{Category: utils.DriftSecurity, Address: "module.alb.aws_security_group.alb",
+				Attribute: "ingress", Actual: "tcp 22 from 0.0.0.0/0"},
+		},
+		{
+			name: "app port removed from the instances",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.SecurityGroups[1].IpPermissions = f.SecurityGroups[1].IpPermissions[1:]
+			},
+			expected: utils.Drift{Category: utils.DriftSecurity, Address: "module.compute.aws_security_group.ec2",
+				Attribute: "ingress", Expected: "tcp 8085 from sg-0a1b00000000000aa"},
+		},
+		{
+			name:        "deletion protection turned off in prod",
+			environment: "prod",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				delete(f.LoadBalancerAttributes, d.ALBArn)
+			},
+			expected: utils.Drift{Category: utils.DriftSecurity, Address: "module.alb.aws_lb.main",
+				Attribute: "enable_deletion_protection", Expected: "true", Actual: "false"},
+		},
+		{
+			name: "imdsv1 enabled again",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.LaunchTemplateVersions[0].LaunchTemplateData.MetadataOptions.HttpTokens = aws.String(ec2.LaunchTemplateHttpTokensStateOptional)
+			},
+			expected: utils.Drift{Category: utils.DriftSecurity, Address: "module.compute.aws_launch_template.app",
+				Attribute: "metadata_options.http_tokens", Expected: "required", Actual: "optional"},
+		},
+		{
+			name: "asg scaled in the console",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.AutoScalingGroups[0].DesiredCapacity = aws.Int64(4)
+			},
+			expected: utils.Drift{Category: utils.DriftCapacity, Address: "module.compute.aws_autoscaling_group.app",
+				Attribute: "desired_capacity", Expected: "2", Actual: "4"},
+		},
+		{
+			name: "instance type changed in the console",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.LaunchTemplateVersions[0].LaunchTemplateData.InstanceType = aws.String("t3.large")
+			},
+			expected: utils.Drift{Category: utils.DriftCapacity, Address: "module.compute.aws_launch_template.app",
+				Attribute: "instance_type", Expected: "t3.micro", Actual: "t3.large"},
+		},
+		{
+			name: "health check path changed",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.TargetGroups[0].HealthCheckPath = aws.String("/")
+			},
+			expected: utils.Drift{Category: utils.DriftRouting, Address: `module.alb.aws_lb_target_group.apps["app1"]`,
+				Attribute: "health_check.path", Expected: "/app1/status", Actual: "/"},
+		},
+		{
+			name: "listener rule added in the console",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.Rules[d.HTTPSListenerArn] = append(f.Rules[d.HTTPSListenerArn], &elbv2.Rule{
+					Priority: aws.String("1"),
+					Conditions: []*elbv2.RuleCondition{{
+						Field:             aws.String("path-pattern"),
+						PathPatternConfig: &elbv2.PathPatternConditionConfig{Values: aws.StringSlice([]string{"/*"})},
+					}},
+				})
+			},
+			expected: utils.Drift{Category: utils.DriftRouting, Address: "module.alb.aws_lb_listener.https",
+				Attribute: "rule", Actual: "priority 1: path /*"},
+		},
+		{
+			name: "alb lost its ManagedBy tag",
+			mutate: func(d *fakeDeployment, f *fakeaws.Fixtures) {
+				f.ELBTags[d.ALBArn] = elbTags(map[string]string{"Environment": d.Environment, "Project": d.ProjectName})
+			},
+			expected: utils.Drift{Category: utils.DriftTagging, Address: "module.alb.aws_lb.main",
+				Attribute: "tags.ManagedBy", Expected: "terraform"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+		t.Run(tc.name, func(t *testing.T) {
+			environment := tc.environment
+			if environment == "" {
+				environment = "ci"
+			}
+			d := newFakeDeployment(environment, "demo")
+			fixtures := d.Fixtures()
+			tc.mutate(d, fixtures)
+			fakeaws.Start(t, fixtures)
+
+			report, err := utils.CheckDriftE(utils.CreateClients(d.Region), d.outputs(), d.StateJSON())
+			require.NoError(t, err)
+			require.NotEmpty(t, report)
+			t.Logf("Reported:\n%s", report)
+
+			// The ID is the resource's AWS identifier, which the cases leave out
+			for i := range report {
+				report[i].ID = ""
+			}
+			assert.Contains(t, report, tc.expected)
+			for _, category := range utils.DriftCategories {
+				assert.Equal(t, category == tc.expected.Category, report.Has(category), "drift in %s", category)
+			}
+		})
+	}
+}
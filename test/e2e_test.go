@@ -1,105 +1,137 @@
 package test
 
 import (
+	"strconv"
 	"testing"
-	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	"github.com/stretchr/testify/require"
 
+	"test/routing"
 	"test/utils"
 )
 
 func TestE2E(t *testing.T) {
 	t.Parallel()
 
-	testCases := []struct {
-		name        string
-		region      string
-		environment string
-		projectName string
-	}{
-		{
-			name:        "Complete Example",
-			region:      "us-east-1",
-			environment: "test",
-			projectName: "e2e",
-		},
-	}
-
-	for _, testCase := range testCases {
-		testCase := testCase
-
-		t.Run(testCase.name, func(t *testing.T) {
-			t.Parallel()
-
-			terraformOptions := &terraform.Options{
-				TerraformDir: "../examples/complete",
-				Vars: map[string]interface{}{
-					"environment":  testCase.environment,
-					"project_name": testCase.projectName,
-				},
-				EnvVars: map[string]string{
-					"AWS_DEFAULT_REGION": testCase.region,
+	loadTestMatrix(t).Run(t, utils.MatrixTestE2E, func(t *testing.T, testCase utils.MatrixCase) {
+		if testCase.ProjectName == "" {
+			testCase.ProjectName = "e2e"
+		}
+
+		terraformOptions := &terraform.Options{
+			TerraformDir: "../examples/complete",
+			Vars: map[string]interface{}{
+				"environment":  testCase.Environment,
+				"project_name": testCase.ProjectName,
+			},
+			EnvVars: map[string]string{
+				"AWS_DEFAULT_REGION": testCase.Region,
+			},
+		}
+
+		// In plan mode validate every module of the complete example from the plan, of a
+		// copy as planning offline adds a provider configuration
+		if utils.IsPlanMode() {
+			terraformOptions.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, "../", "examples/complete")
+			plan := utils.InitAndPlanOffline(t, terraformOptions, t.TempDir())
+			validateVPCPlan(t, plan, testCase.Environment, testCase.ProjectName, planVariable(t, plan, "vpc_cidr").(string))
+			validateALBPlan(t, plan, testCase.Environment, testCase.ProjectName, planApps(t, plan))
+			validateComputePlan(t, plan, testCase.Environment, testCase.ProjectName,
+				planVariable(t, plan, "instance_type").(string), int(planVariable(t, plan, "instance_count").(float64)), planApps(t, plan), "")
+			return
+		}
+
+		// Replace the example's certificate with a self-signed one for its apps, deleted
+		// after the destroy below
+		apps, err := utils.AppsFromVarFile(t, "../examples/complete/terraform.tfvars")
+		require.NoError(t, err)
+		terraformOptions.Vars["certificate_arn"] = utils.ImportTestCertificate(t, utils.CreateClients(testCase.Region).ACM,
+			apps.Domains(), map[string]string{"Environment": testCase.Environment, "Project": testCase.ProjectName})
+
+		defer utils.Destroy(t, terraformOptions)
+
+		terraform.InitAndApply(t, terraformOptions)
+		utils.AssertIdempotent(t, terraformOptions, t.TempDir())
+
+		// Create AWS clients
+		clients := utils.CreateClients(testCase.Region)
+		ec2Client := clients.EC2
+		asgClient := clients.AutoScaling
+
+		// Get outputs
+		vpcID := terraform.Output(t, terraformOptions, "vpc_id")
+		launchTemplateID := terraform.Output(t, terraformOptions, "launch_template_id")
+		asgName := terraform.Output(t, terraformOptions, "autoscaling_group_name")
+
+		// Test VPC
+		vpc, err := ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{
+			VpcIds: []*string{&vpcID},
+		})
+		require.NoError(t, err)
+		require.Len(t, vpc.Vpcs, 1)
+
+		// Test Launch Template
+		lt, err := ec2Client.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{
+			LaunchTemplateIds: []*string{&launchTemplateID},
+		})
+		require.NoError(t, err)
+		require.Len(t, lt.LaunchTemplates, 1)
+
+		// Test Auto Scaling Group
+		asg, err := asgClient.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []*string{&asgName},
+		})
+		require.NoError(t, err)
+		require.Len(t, asg.AutoScalingGroups, 1)
+
+		// Wait for the group to fill up and every app to have healthy targets
+		utils.WaitForASGCapacity(t, asgClient, asgName, utils.DefaultWaitOptions())
+
+		targetGroupArns := terraform.OutputMap(t, terraformOptions, "target_group_arns")
+		require.NotEmpty(t, targetGroupArns)
+		var arns []string
+		for _, arn := range targetGroupArns {
+			arns = append(arns, arn)
+		}
+		utils.WaitForHealthyTargets(t, clients.ELBv2, arns, utils.DefaultWaitOptions())
+
+		// Send requests through the ALB with each app's Host header: plain HTTP must be
+		// redirected, app paths must reach a healthy target and anything else the 404
+		albDNSName := terraform.Output(t, terraformOptions, "alb_dns_name")
+		require.NoError(t, routing.WaitForDNSE(albDNSName, utils.DefaultWaitOptions()))
+		routing.AssertRouting(t, routing.NewProber(albDNSName, apps))
+
+		// Verify instances are running
+		instances, err := ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String("vpc-id"),
+					Values: []*string{&vpcID},
 				},
-			}
-
-			defer terraform.Destroy(t, terraformOptions)
-
-			terraform.InitAndApply(t, terraformOptions)
-
-			// Create AWS clients
-			ec2Client := utils.CreateEC2Client(testCase.region)
-			asgClient := utils.CreateASGClient(testCase.region)
-			//iamClient := utils.CreateIAMClient(testCase.region)
-
-			// Get outputs
-			vpcID := terraform.Output(t, terraformOptions, "vpc_id")
-			launchTemplateID := terraform.Output(t, terraformOptions, "launch_template_id")
-			asgName := terraform.Output(t, terraformOptions, "autoscaling_group_name")
-
-			// Test VPC
-			vpc, err := ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{
-				VpcIds: []*string{&vpcID},
-			})
-			require.NoError(t, err)
-			require.Len(t, vpc.Vpcs, 1)
-
-			// Test Launch Template
-			lt, err := ec2Client.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{
-				LaunchTemplateIds: []*string{&launchTemplateID},
-			})
-			require.NoError(t, err)
-			require.Len(t, lt.LaunchTemplates, 1)
-
-			// Test Auto Scaling Group
-			asg, err := asgClient.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
-				AutoScalingGroupNames: []*string{&asgName},
-			})
-			require.NoError(t, err)
-			require.Len(t, asg.AutoScalingGroups, 1)
-
-			// Wait for instances to be running
-			time.Sleep(2 * time.Minute)
-
-			// Verify instances are running
-			instances, err := ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{
-				Filters: []*ec2.Filter{
-					{
-						Name:   aws.String("vpc-id"),
-						Values: []*string{&vpcID},
-					},
-					{
-						Name:   aws.String("instance-state-name"),
-						Values: []*string{aws.String("running")},
-					},
+				{
+					Name:   aws.String("instance-state-name"),
+					Values: []*string{aws.String("running")},
 				},
-			})
-			require.NoError(t, err)
-			require.NotEmpty(t, instances.Reservations)
+			},
 		})
-	}
+		require.NoError(t, err)
+		require.NotEmpty(t, instances.Reservations)
+
+		// Terminate a random instance: the group must launch a replacement that
+		// registers with every app's target group and get back to instance_count
+		instanceCount, err := strconv.Atoi(terraform.GetVariableAsStringFromVarFile(t, "../examples/complete/terraform.tfvars", "instance_count"))
+		require.NoError(t, err)
+		chaos := autoscaling.New(utils.CreateSession(testCase.Region))
+		report := utils.RunChaos(t, clients, chaos, utils.ChaosTarget{
+			AutoScalingGroupName: asgName,
+			TargetGroupArns:      arns,
+			Capacity:             instanceCount,
+		}, utils.DefaultWaitOptions())
+		t.Logf("Self-healing: %s", report)
+	})
 }
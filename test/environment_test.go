@@ -0,0 +1,62 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+
+	"test/utils"
+)
+
+// TestEnvironmentBranches plans the VPC and ALB modules as prod and as a
+// non-prod environment, covering both sides of their `environment == "prod"`
+// conditions. It only plans, whatever TERRATEST_MODE is, so it never deploys
+// a protected load balancer or a NAT gateway per AZ.
+func TestEnvironmentBranches(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		environment        string
+		natGateways        int
+		deletionProtection bool
+	}{
+		{"prod", 3, true},
+		{"staging", 1, false},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+
+		t.Run(tc.environment, func(t *testing.T) {
+			t.Parallel()
+
+			region := "us-east-1"
+			projectName := fmt.Sprintf("env-test-%s", random.UniqueId())
+
+			t.Run("vpc", func(t *testing.T) {
+				t.Parallel()
+
+				vpcOptions := utils.CreateVPC(t, region, tc.environment, projectName, "10.0.0.0/16")
+				vpcOptions.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, "../", "modules/vpc")
+				vpc := utils.ParseVPCPlan(utils.InitAndPlanOffline(t, vpcOptions, t.TempDir()))
+
+				assert.Equal(t, tc.natGateways, vpc.NATGateways, "NAT gateways in %s", tc.environment)
+				assert.Equal(t, tc.natGateways, vpc.PrivateRouteTables, "Each NAT gateway should have its own private route table")
+			})
+
+			t.Run("alb", func(t *testing.T) {
+				t.Parallel()
+
+				albOptions := utils.CreateALB(t, region, tc.environment, projectName,
+					utils.PlanVPCID, utils.PlanPublicSubnets(), utils.DefaultApps(), utils.PlanCertificateArn)
+				albOptions.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, "../", "modules/alb")
+				alb := utils.ParseALBPlan(utils.InitAndPlanOffline(t, albOptions, t.TempDir()))
+
+				assert.Equal(t, tc.deletionProtection, alb.EnableDeletionProtection, "ALB deletion protection in %s", tc.environment)
+			})
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package fakeaws
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+)
+
+// ACM speaks the JSON protocol, with the action in the X-Amz-Target header
+const acmTargetPrefix = "CertificateManager."
+
+// jsonHandlerFunc serves one JSON protocol action. decode fills the SDK input
+// struct from the request body.
+type jsonHandlerFunc func(s *Server, decode func(input interface{}) error) (interface{}, error)
+
+var acmHandlers = map[string]jsonHandlerFunc{
+	"ImportCertificate":   importCertificate,
+	"DescribeCertificate": describeCertificate,
+	"DeleteCertificate":   deleteCertificate,
+}
+
+func findCertificate(f *Fixtures, arn string) *acm.CertificateDetail {
+	for _, certificate := range f.Certificates {
+		if aws.StringValue(certificate.CertificateArn) == arn {
+			return certificate
+		}
+	}
+	return nil
+}
+
+func certificateNotFound(arn string) error {
+	return &apiError{Status: http.StatusBadRequest, Code: acm.ErrCodeResourceNotFoundException, Message: fmt.Sprintf("Could not find certificate %s.", arn)}
+}
+
+// certificateUsers returns the listeners serving the certificate
+func certificateUsers(f *Fixtures, arn string) []*string {
+	var users []*string
+	for _, listener := range f.Listeners {
+		for _, certificate := range listener.Certificates {
+			if aws.StringValue(certificate.CertificateArn) == arn {
+				users = append(users, listener.LoadBalancerArn)
+			}
+		}
+	}
+	return users
+}
+
+func importCertificate(s *Server, decode func(interface{}) error) (interface{}, error) {
+	var input acm.ImportCertificateInput
+	if err := decode(&input); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(input.Certificate)
+	if block == nil {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: acm.ErrCodeValidationException, Message: "The certificate field contains more than one certificate or is not PEM encoded."}
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: acm.ErrCodeValidationException, Message: "Could not parse the certificate: " + err.Error()}
+	}
+	if keyBlock, _ := pem.Decode(input.PrivateKey); keyBlock == nil {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: acm.ErrCodeValidationException, Message: "The private key is not PEM encoded."}
+	}
+
+	f := s.fixtures
+	s.imports++
+	arn := fmt.Sprintf("arn:aws:acm:us-east-1:123456789012:certificate/00000000-0000-0000-0000-%012d", s.imports)
+	f.Certificates = append(f.Certificates, &acm.CertificateDetail{
+		CertificateArn:          aws.String(arn),
+		DomainName:              aws.String(certificate.Subject.CommonName),
+		SubjectAlternativeNames: aws.StringSlice(certificate.DNSNames),
+		Serial:                  aws.String(certificate.SerialNumber.String()),
+		Issuer:                  aws.String(certificate.Issuer.CommonName),
+		NotBefore:               aws.Time(certificate.NotBefore),
+		NotAfter:                aws.Time(certificate.NotAfter),
+		ImportedAt:              aws.Time(time.Now().UTC()),
+		Status:                  aws.String(acm.CertificateStatusIssued),
+		Type:                    aws.String(acm.CertificateTypeImported),
+	})
+	if len(input.Tags) > 0 {
+		if f.CertificateTags == nil {
+			f.CertificateTags = map[string][]*acm.Tag{}
+		}
+		f.CertificateTags[arn] = input.Tags
+	}
+	return &acm.ImportCertificateOutput{CertificateArn: aws.String(arn)}, nil
+}
+
+func describeCertificate(s *Server, decode func(interface{}) error) (interface{}, error) {
+	var input acm.DescribeCertificateInput
+	if err := decode(&input); err != nil {
+		return nil, err
+	}
+	arn := aws.StringValue(input.CertificateArn)
+	certificate := findCertificate(s.fixtures, arn)
+	if certificate == nil {
+		return nil, certificateNotFound(arn)
+	}
+
+	detail := *certificate
+	detail.InUseBy = certificateUsers(s.fixtures, arn)
+	return &acm.DescribeCertificateOutput{Certificate: &detail}, nil
+}
+
+func deleteCertificate(s *Server, decode func(interface{}) error) (interface{}, error) {
+	var input acm.DeleteCertificateInput
+	if err := decode(&input); err != nil {
+		return nil, err
+	}
+	arn := aws.StringValue(input.CertificateArn)
+	f := s.fixtures
+	if findCertificate(f, arn) == nil {
+		return nil, certificateNotFound(arn)
+	}
+	if users := certificateUsers(f, arn); len(users) > 0 {
+		return nil, inUse(acm.ErrCodeResourceInUseException, "Certificate %s is in use by %s", arn, aws.StringValue(users[0]))
+	}
+
+	var certificates []*acm.CertificateDetail
+	for _, certificate := range f.Certificates {
+		if aws.StringValue(certificate.CertificateArn) != arn {
+			certificates = append(certificates, certificate)
+		}
+	}
+	f.Certificates = certificates
+	delete(f.CertificateTags, arn)
+	return &acm.DeleteCertificateOutput{}, nil
+}
@@ -0,0 +1,224 @@
+package fakeaws
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+var autoscalingHandlers = map[string]handlerFunc{
+	"DescribeAutoScalingGroups":           describeAutoScalingGroups,
+	"DeleteAutoScalingGroup":              deleteAutoScalingGroup,
+	"TerminateInstanceInAutoScalingGroup": terminateInstanceInAutoScalingGroup,
+}
+
+// EC2 instance state codes
+const (
+	instancePending      = 0
+	instanceRunning      = 16
+	instanceShuttingDown = 32
+	instanceTerminated   = 48
+)
+
+func describeAutoScalingGroups(s *Server, form url.Values) (interface{}, error) {
+	if s.fixtures.SelfHealing {
+		for _, group := range s.fixtures.AutoScalingGroups {
+			s.heal(group)
+		}
+	}
+	names := memberList(form, "AutoScalingGroupNames")
+	output := &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: []*autoscaling.Group{}}
+	for _, group := range s.fixtures.AutoScalingGroups {
+		if len(names) > 0 && !contains(names, aws.StringValue(group.AutoScalingGroupName)) {
+			continue
+		}
+		output.AutoScalingGroups = append(output.AutoScalingGroups, group)
+	}
+	// Like the real API, unknown names are silently left out of the result
+	return output, nil
+}
+
+// deleteAutoScalingGroup removes the group right away and terminates its instances,
+// where the real API keeps it around in Delete in progress for a while
+func deleteAutoScalingGroup(s *Server, form url.Values) (interface{}, error) {
+	name := form.Get("AutoScalingGroupName")
+	index := slices.IndexFunc(s.fixtures.AutoScalingGroups, func(group *autoscaling.Group) bool {
+		return aws.StringValue(group.AutoScalingGroupName) == name
+	})
+	if index < 0 {
+		return nil, invalidParameter("AutoScalingGroup name not found - AutoScalingGroup '%s' not found", name)
+	}
+	group := s.fixtures.AutoScalingGroups[index]
+	if len(group.Instances) > 0 && form.Get("ForceDelete") != "true" {
+		return nil, inUse(autoscaling.ErrCodeResourceInUseFault, "You cannot delete an AutoScalingGroup while there are instances still in the group.")
+	}
+	for _, member := range group.Instances {
+		for _, instance := range s.fixtures.Instances {
+			if aws.StringValue(instance.InstanceId) == aws.StringValue(member.InstanceId) {
+				instance.State = &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameTerminated)}
+			}
+		}
+	}
+	s.fixtures.AutoScalingGroups = slices.Delete(s.fixtures.AutoScalingGroups, index, index+1)
+	return &autoscaling.DeleteAutoScalingGroupOutput{}, nil
+}
+
+// terminateInstanceInAutoScalingGroup starts terminating the instance. It stays in
+// the group as Terminating, draining from the target groups, until the group heals.
+func terminateInstanceInAutoScalingGroup(s *Server, form url.Values) (interface{}, error) {
+	instanceID := form.Get("InstanceId")
+	group, member := findGroupMember(s.fixtures, instanceID)
+	if member == nil {
+		return nil, invalidParameter("Instance Id not found - No managed instance found for instance ID: %s", instanceID)
+	}
+	member.LifecycleState = aws.String(autoscaling.LifecycleStateTerminating)
+	if form.Get("ShouldDecrementDesiredCapacity") == "true" {
+		group.DesiredCapacity = aws.Int64(aws.Int64Value(group.DesiredCapacity) - 1)
+	}
+	setInstanceState(s.fixtures, instanceID, instanceShuttingDown, ec2.InstanceStateNameShuttingDown)
+	for _, arn := range group.TargetGroupARNs {
+		for _, description := range s.fixtures.TargetHealth[aws.StringValue(arn)] {
+			if aws.StringValue(description.Target.Id) == instanceID {
+				description.TargetHealth = &elbv2.TargetHealth{State: aws.String(elbv2.TargetHealthStateEnumDraining)}
+			}
+		}
+	}
+
+	return &autoscaling.TerminateInstanceInAutoScalingGroupOutput{Activity: &autoscaling.Activity{
+		ActivityId:           aws.String(fmt.Sprintf("00000000-0000-0000-0000-%012d", len(s.calls))),
+		AutoScalingGroupName: group.AutoScalingGroupName,
+		Description:          aws.String("Terminating EC2 instance: " + instanceID),
+		Cause:                aws.String("an instance was taken out of service in response to a user request"),
+		StatusCode:           aws.String(autoscaling.ScalingActivityStatusCodeInProgress),
+	}}, nil
+}
+
+// StopApp stands in for the app on the instance crashing: its targets fail their
+// health checks and, if the group uses ELB health checks, Auto Scaling marks the
+// instance unhealthy so a self-healing group replaces it
+func (s *Server) StopApp(instanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, descriptions := range s.fixtures.TargetHealth {
+		for _, description := range descriptions {
+			if aws.StringValue(description.Target.Id) == instanceID {
+				description.TargetHealth = &elbv2.TargetHealth{
+					State:       aws.String(elbv2.TargetHealthStateEnumUnhealthy),
+					Reason:      aws.String(elbv2.TargetHealthReasonEnumTargetFailedHealthChecks),
+					Description: aws.String("Health checks failed"),
+				}
+			}
+		}
+	}
+	if group, member := findGroupMember(s.fixtures, instanceID); member != nil && aws.StringValue(group.HealthCheckType) == "ELB" {
+		member.HealthStatus = aws.String("Unhealthy")
+	}
+}
+
+func findGroupMember(f *Fixtures, instanceID string) (*autoscaling.Group, *autoscaling.Instance) {
+	for _, group := range f.AutoScalingGroups {
+		for _, member := range group.Instances {
+			if aws.StringValue(member.InstanceId) == instanceID {
+				return group, member
+			}
+		}
+	}
+	return nil, nil
+}
+
+func findInstance(f *Fixtures, instanceID string) *ec2.Instance {
+	for _, instance := range f.Instances {
+		if aws.StringValue(instance.InstanceId) == instanceID {
+			return instance
+		}
+	}
+	return nil
+}
+
+func setInstanceState(f *Fixtures, instanceID string, code int64, name string) {
+	if instance := findInstance(f, instanceID); instance != nil {
+		instance.State = &ec2.InstanceState{Code: aws.Int64(code), Name: aws.String(name)}
+	}
+}
+
+// heal moves the group one step towards its desired capacity. Instances launched
+// in one step only go InService in the next, and replacements copy the EC2
+// instance of a member.
+func (s *Server) heal(group *autoscaling.Group) {
+	var template *ec2.Instance
+	for _, member := range group.Instances {
+		if template = findInstance(s.fixtures, aws.StringValue(member.InstanceId)); template != nil {
+			break
+		}
+	}
+
+	// Bring up the instances launched by the last step
+	for _, member := range group.Instances {
+		if aws.StringValue(member.LifecycleState) != autoscaling.LifecycleStatePending {
+			continue
+		}
+		instanceID := aws.StringValue(member.InstanceId)
+		member.LifecycleState = aws.String(autoscaling.LifecycleStateInService)
+		setInstanceState(s.fixtures, instanceID, instanceRunning, ec2.InstanceStateNameRunning)
+		for _, arn := range aws.StringValueSlice(group.TargetGroupARNs) {
+			if s.fixtures.TargetHealth == nil {
+				s.fixtures.TargetHealth = map[string][]*elbv2.TargetHealthDescription{}
+			}
+			s.fixtures.TargetHealth[arn] = append(s.fixtures.TargetHealth[arn], &elbv2.TargetHealthDescription{
+				Target:       &elbv2.TargetDescription{Id: aws.String(instanceID)},
+				TargetHealth: &elbv2.TargetHealth{State: aws.String(elbv2.TargetHealthStateEnumHealthy)},
+			})
+		}
+	}
+
+	// Remove the instances terminated by the last step and start terminating unhealthy ones
+	group.Instances = slices.DeleteFunc(group.Instances, func(member *autoscaling.Instance) bool {
+		if aws.StringValue(member.LifecycleState) != autoscaling.LifecycleStateTerminating {
+			return false
+		}
+		instanceID := aws.StringValue(member.InstanceId)
+		setInstanceState(s.fixtures, instanceID, instanceTerminated, ec2.InstanceStateNameTerminated)
+		for _, arn := range aws.StringValueSlice(group.TargetGroupARNs) {
+			s.fixtures.TargetHealth[arn] = slices.DeleteFunc(s.fixtures.TargetHealth[arn], func(description *elbv2.TargetHealthDescription) bool {
+				return aws.StringValue(description.Target.Id) == instanceID
+			})
+		}
+		return true
+	})
+	active := 0
+	for _, member := range group.Instances {
+		if aws.StringValue(member.HealthStatus) == "Unhealthy" {
+			member.LifecycleState = aws.String(autoscaling.LifecycleStateTerminating)
+			setInstanceState(s.fixtures, aws.StringValue(member.InstanceId), instanceShuttingDown, ec2.InstanceStateNameShuttingDown)
+			continue
+		}
+		active++
+	}
+
+	// Launch replacements
+	for ; active < int(aws.Int64Value(group.DesiredCapacity)); active++ {
+		s.launches++
+		instanceID := fmt.Sprintf("i-0e%015x", s.launches)
+		member := &autoscaling.Instance{
+			InstanceId:     aws.String(instanceID),
+			LifecycleState: aws.String(autoscaling.LifecycleStatePending),
+			HealthStatus:   aws.String("Healthy"),
+		}
+		if template != nil {
+			instance := *template
+			instance.InstanceId = aws.String(instanceID)
+			instance.State = &ec2.InstanceState{Code: aws.Int64(instancePending), Name: aws.String(ec2.InstanceStateNamePending)}
+			s.fixtures.Instances = append(s.fixtures.Instances, &instance)
+		}
+		if len(group.Instances) > 0 {
+			member.AvailabilityZone = group.Instances[0].AvailabilityZone
+		}
+		group.Instances = append(group.Instances, member)
+	}
+}
@@ -0,0 +1,597 @@
+package fakeaws
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+var ec2Handlers = map[string]handlerFunc{
+	"DescribeVpcs":                   describeVpcs,
+	"DescribeVpcAttribute":           describeVpcAttribute,
+	"DescribeSubnets":                describeSubnets,
+	"DescribeNatGateways":            describeNatGateways,
+	"DescribeFlowLogs":               describeFlowLogs,
+	"DescribeSecurityGroups":         describeSecurityGroups,
+	"DescribeLaunchTemplates":        describeLaunchTemplates,
+	"DescribeLaunchTemplateVersions": describeLaunchTemplateVersions,
+	"DescribeInstances":              describeInstances,
+	"DescribeInternetGateways":       describeInternetGateways,
+	"DescribeRouteTables":            describeRouteTables,
+	"DescribeImages":                 describeImages,
+	"DescribeAvailabilityZones":      describeAvailabilityZones,
+	"DeleteLaunchTemplate":           deleteLaunchTemplate,
+	"DeleteSecurityGroup":            deleteSecurityGroup,
+	"DeleteNatGateway":               deleteNatGateway,
+	"ReleaseAddress":                 releaseAddress,
+	"DetachInternetGateway":          detachInternetGateway,
+	"DeleteInternetGateway":          deleteInternetGateway,
+	"DeleteRouteTable":               deleteRouteTable,
+	"DeleteSubnet":                   deleteSubnet,
+	"DeleteVpc":                      deleteVpc,
+}
+
+func ec2TagMap(tags []*ec2.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return m
+}
+
+func describeVpcs(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "VpcId")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeVpcsOutput{Vpcs: []*ec2.Vpc{}}
+	for _, id := range ids {
+		if findVpc(s.fixtures, id) == nil {
+			return nil, notFound("InvalidVpcID.NotFound", "The vpc ID '%s' does not exist", id)
+		}
+	}
+	for _, vpc := range s.fixtures.Vpcs {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(vpc.VpcId)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"vpc-id":     {aws.StringValue(vpc.VpcId)},
+			"cidr-block": {aws.StringValue(vpc.CidrBlock)},
+			"state":      {aws.StringValue(vpc.State)},
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(vpc.Tags)) {
+			output.Vpcs = append(output.Vpcs, vpc)
+		}
+	}
+	start, end, next, err := s.ec2Page(form, len(output.Vpcs))
+	if err != nil {
+		return nil, err
+	}
+	output.Vpcs, output.NextToken = output.Vpcs[start:end], next
+	return output, nil
+}
+
+func findVpc(f *Fixtures, id string) *ec2.Vpc {
+	for _, vpc := range f.Vpcs {
+		if aws.StringValue(vpc.VpcId) == id {
+			return vpc
+		}
+	}
+	return nil
+}
+
+func describeVpcAttribute(s *Server, form url.Values) (interface{}, error) {
+	vpcID := form.Get("VpcId")
+	if findVpc(s.fixtures, vpcID) == nil {
+		return nil, notFound("InvalidVpcID.NotFound", "The vpc ID '%s' does not exist", vpcID)
+	}
+	attributes := s.fixtures.VpcAttributes[vpcID]
+	output := &ec2.DescribeVpcAttributeOutput{VpcId: aws.String(vpcID)}
+	switch attribute := form.Get("Attribute"); attribute {
+	case ec2.VpcAttributeNameEnableDnsHostnames:
+		output.EnableDnsHostnames = &ec2.AttributeBooleanValue{Value: aws.Bool(attributes.EnableDnsHostnames)}
+	case ec2.VpcAttributeNameEnableDnsSupport:
+		output.EnableDnsSupport = &ec2.AttributeBooleanValue{Value: aws.Bool(attributes.EnableDnsSupport)}
+	default:
+		return nil, invalidParameter("unsupported VPC attribute %q", attribute)
+	}
+	return output, nil
+}
+
+func describeSubnets(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "SubnetId")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{}}
+	for _, subnet := range s.fixtures.Subnets {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(subnet.SubnetId)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"subnet-id":         {aws.StringValue(subnet.SubnetId)},
+			"vpc-id":            {aws.StringValue(subnet.VpcId)},
+			"availability-zone": {aws.StringValue(subnet.AvailabilityZone)},
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(subnet.Tags)) {
+			output.Subnets = append(output.Subnets, subnet)
+		}
+	}
+	if len(output.Subnets) < len(ids) {
+		return nil, notFound("InvalidSubnetID.NotFound", "One or more subnets in %v do not exist", ids)
+	}
+	return output, nil
+}
+
+func describeNatGateways(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "NatGatewayId")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeNatGatewaysOutput{NatGateways: []*ec2.NatGateway{}}
+	for _, nat := range s.fixtures.NatGateways {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(nat.NatGatewayId)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"nat-gateway-id": {aws.StringValue(nat.NatGatewayId)},
+			"vpc-id":         {aws.StringValue(nat.VpcId)},
+			"subnet-id":      {aws.StringValue(nat.SubnetId)},
+			"state":          {aws.StringValue(nat.State)},
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(nat.Tags)) {
+			output.NatGateways = append(output.NatGateways, nat)
+		}
+	}
+	start, end, next, err := s.ec2Page(form, len(output.NatGateways))
+	if err != nil {
+		return nil, err
+	}
+	output.NatGateways, output.NextToken = output.NatGateways[start:end], next
+	return output, nil
+}
+
+func describeFlowLogs(s *Server, form url.Values) (interface{}, error) {
+	filters := ec2Filters(form)
+	output := &ec2.DescribeFlowLogsOutput{FlowLogs: []*ec2.FlowLog{}}
+	for _, flowLog := range s.fixtures.FlowLogs {
+		attrs := map[string][]string{
+			"flow-log-id": {aws.StringValue(flowLog.FlowLogId)},
+			"resource-id": {aws.StringValue(flowLog.ResourceId)},
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(flowLog.Tags)) {
+			output.FlowLogs = append(output.FlowLogs, flowLog)
+		}
+	}
+	return output, nil
+}
+
+func describeSecurityGroups(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "GroupId")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeSecurityGroupsOutput{SecurityGroups: []*ec2.SecurityGroup{}}
+	for _, sg := range s.fixtures.SecurityGroups {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(sg.GroupId)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"group-id":   {aws.StringValue(sg.GroupId)},
+			"group-name": {aws.StringValue(sg.GroupName)},
+			"vpc-id":     {aws.StringValue(sg.VpcId)},
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(sg.Tags)) {
+			output.SecurityGroups = append(output.SecurityGroups, sg)
+		}
+	}
+	if len(output.SecurityGroups) < len(ids) {
+		return nil, notFound("InvalidGroup.NotFound", "One or more security groups in %v do not exist", ids)
+	}
+	start, end, next, err := s.ec2Page(form, len(output.SecurityGroups))
+	if err != nil {
+		return nil, err
+	}
+	output.SecurityGroups, output.NextToken = output.SecurityGroups[start:end], next
+	return output, nil
+}
+
+func describeLaunchTemplates(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "LaunchTemplateId")
+	names := ec2List(form, "LaunchTemplateName")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeLaunchTemplatesOutput{LaunchTemplates: []*ec2.LaunchTemplate{}}
+	for _, lt := range s.fixtures.LaunchTemplates {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(lt.LaunchTemplateId)) {
+			continue
+		}
+		if len(names) > 0 && !contains(names, aws.StringValue(lt.LaunchTemplateName)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"launch-template-name": {aws.StringValue(lt.LaunchTemplateName)},
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(lt.Tags)) {
+			output.LaunchTemplates = append(output.LaunchTemplates, lt)
+		}
+	}
+	if len(output.LaunchTemplates) < len(ids) {
+		return nil, notFound("InvalidLaunchTemplateId.NotFound", "One or more launch templates in %v do not exist", ids)
+	}
+	return output, nil
+}
+
+func describeLaunchTemplateVersions(s *Server, form url.Values) (interface{}, error) {
+	ltID := form.Get("LaunchTemplateId")
+	versions := ec2List(form, "LaunchTemplateVersion")
+
+	var candidates []*ec2.LaunchTemplateVersion
+	var latest *ec2.LaunchTemplateVersion
+	for _, version := range s.fixtures.LaunchTemplateVersions {
+		if aws.StringValue(version.LaunchTemplateId) != ltID {
+			continue
+		}
+		candidates = append(candidates, version)
+		if latest == nil || aws.Int64Value(version.VersionNumber) > aws.Int64Value(latest.VersionNumber) {
+			latest = version
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, notFound("InvalidLaunchTemplateId.NotFound", "The launch template ID '%s' does not exist", ltID)
+	}
+
+	output := &ec2.DescribeLaunchTemplateVersionsOutput{LaunchTemplateVersions: []*ec2.LaunchTemplateVersion{}}
+	for _, version := range candidates {
+		selected := len(versions) == 0
+		for _, wanted := range versions {
+			switch wanted {
+			case "$Latest":
+				selected = selected || version == latest
+			case "$Default":
+				selected = selected || aws.BoolValue(version.DefaultVersion)
+			default:
+				selected = selected || wanted == strconv.FormatInt(aws.Int64Value(version.VersionNumber), 10)
+			}
+		}
+		if selected {
+			output.LaunchTemplateVersions = append(output.LaunchTemplateVersions, version)
+		}
+	}
+	return output, nil
+}
+
+func describeInstances(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "InstanceId")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{}}
+	for _, instance := range s.fixtures.Instances {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(instance.InstanceId)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"instance-id":   {aws.StringValue(instance.InstanceId)},
+			"vpc-id":        {aws.StringValue(instance.VpcId)},
+			"subnet-id":     {aws.StringValue(instance.SubnetId)},
+			"instance-type": {aws.StringValue(instance.InstanceType)},
+		}
+		if instance.State != nil {
+			attrs["instance-state-name"] = []string{aws.StringValue(instance.State.Name)}
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(instance.Tags)) {
+			output.Reservations = append(output.Reservations, &ec2.Reservation{
+				ReservationId: aws.String("r-" + aws.StringValue(instance.InstanceId)),
+				Instances:     []*ec2.Instance{instance},
+			})
+		}
+	}
+	return output, nil
+}
+
+func describeInternetGateways(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "InternetGatewayId")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeInternetGatewaysOutput{InternetGateways: []*ec2.InternetGateway{}}
+	for _, igw := range s.fixtures.InternetGateways {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(igw.InternetGatewayId)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"internet-gateway-id": {aws.StringValue(igw.InternetGatewayId)},
+		}
+		for _, attachment := range igw.Attachments {
+			attrs["attachment.vpc-id"] = append(attrs["attachment.vpc-id"], aws.StringValue(attachment.VpcId))
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(igw.Tags)) {
+			output.InternetGateways = append(output.InternetGateways, igw)
+		}
+	}
+	if len(output.InternetGateways) < len(ids) {
+		return nil, notFound("InvalidInternetGatewayID.NotFound", "One or more internet gateways in %v do not exist", ids)
+	}
+	return output, nil
+}
+
+func describeRouteTables(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "RouteTableId")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeRouteTablesOutput{RouteTables: []*ec2.RouteTable{}}
+	for _, table := range s.fixtures.RouteTables {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(table.RouteTableId)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"route-table-id":   {aws.StringValue(table.RouteTableId)},
+			"vpc-id":           {aws.StringValue(table.VpcId)},
+			"association.main": {strconv.FormatBool(isMainRouteTable(table))},
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(table.Tags)) {
+			output.RouteTables = append(output.RouteTables, table)
+		}
+	}
+	if len(output.RouteTables) < len(ids) {
+		return nil, notFound("InvalidRouteTableID.NotFound", "One or more route tables in %v do not exist", ids)
+	}
+	return output, nil
+}
+
+func describeImages(s *Server, form url.Values) (interface{}, error) {
+	ids := ec2List(form, "ImageId")
+	owners := ec2List(form, "Owner")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeImagesOutput{Images: []*ec2.Image{}}
+	for _, image := range s.fixtures.Images {
+		if len(ids) > 0 && !contains(ids, aws.StringValue(image.ImageId)) {
+			continue
+		}
+		// An owner is given as an account ID or an alias such as amazon
+		if len(owners) > 0 && !contains(owners, aws.StringValue(image.OwnerId)) && !contains(owners, aws.StringValue(image.ImageOwnerAlias)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"image-id":     {aws.StringValue(image.ImageId)},
+			"name":         {aws.StringValue(image.Name)},
+			"state":        {aws.StringValue(image.State)},
+			"architecture": {aws.StringValue(image.Architecture)},
+			"owner-id":     {aws.StringValue(image.OwnerId)},
+			"owner-alias":  {aws.StringValue(image.ImageOwnerAlias)},
+		}
+		if matchesFilters(filters, attrs, ec2TagMap(image.Tags)) {
+			output.Images = append(output.Images, image)
+		}
+	}
+	return output, nil
+}
+
+func describeAvailabilityZones(s *Server, form url.Values) (interface{}, error) {
+	names := ec2List(form, "ZoneName")
+	filters := ec2Filters(form)
+	output := &ec2.DescribeAvailabilityZonesOutput{AvailabilityZones: []*ec2.AvailabilityZone{}}
+	for _, zone := range s.fixtures.AvailabilityZones {
+		if len(names) > 0 && !contains(names, aws.StringValue(zone.ZoneName)) {
+			continue
+		}
+		attrs := map[string][]string{
+			"zone-name":   {aws.StringValue(zone.ZoneName)},
+			"zone-id":     {aws.StringValue(zone.ZoneId)},
+			"region-name": {aws.StringValue(zone.RegionName)},
+			"state":       {aws.StringValue(zone.State)},
+		}
+		if matchesFilters(filters, attrs, nil) {
+			output.AvailabilityZones = append(output.AvailabilityZones, zone)
+		}
+	}
+	return output, nil
+}
+
+func isMainRouteTable(table *ec2.RouteTable) bool {
+	for _, association := range table.Associations {
+		if aws.BoolValue(association.Main) {
+			return true
+		}
+	}
+	return false
+}
+
+func deleteLaunchTemplate(s *Server, form url.Values) (interface{}, error) {
+	id, name := form.Get("LaunchTemplateId"), form.Get("LaunchTemplateName")
+	for i, lt := range s.fixtures.LaunchTemplates {
+		if aws.StringValue(lt.LaunchTemplateId) != id && aws.StringValue(lt.LaunchTemplateName) != name {
+			continue
+		}
+		s.fixtures.LaunchTemplates = slices.Delete(s.fixtures.LaunchTemplates, i, i+1)
+		s.fixtures.LaunchTemplateVersions = slices.DeleteFunc(s.fixtures.LaunchTemplateVersions, func(version *ec2.LaunchTemplateVersion) bool {
+			return aws.StringValue(version.LaunchTemplateId) == aws.StringValue(lt.LaunchTemplateId)
+		})
+		return &ec2.DeleteLaunchTemplateOutput{LaunchTemplate: lt}, nil
+	}
+	return nil, notFound("InvalidLaunchTemplateId.NotFound", "The launch template '%s%s' does not exist", id, name)
+}
+
+func deleteSecurityGroup(s *Server, form url.Values) (interface{}, error) {
+	groupID := form.Get("GroupId")
+	index := slices.IndexFunc(s.fixtures.SecurityGroups, func(sg *ec2.SecurityGroup) bool {
+		return aws.StringValue(sg.GroupId) == groupID
+	})
+	if index < 0 {
+		return nil, notFound("InvalidGroup.NotFound", "The security group '%s' does not exist", groupID)
+	}
+	for _, sg := range s.fixtures.SecurityGroups {
+		for _, permission := range append(sg.IpPermissions, sg.IpPermissionsEgress...) {
+			for _, pair := range permission.UserIdGroupPairs {
+				if aws.StringValue(pair.GroupId) == groupID && aws.StringValue(sg.GroupId) != groupID {
+					return nil, inUse("DependencyViolation", "resource %s has a dependent object", groupID)
+				}
+			}
+		}
+	}
+	for _, lb := range s.fixtures.LoadBalancers {
+		if contains(aws.StringValueSlice(lb.SecurityGroups), groupID) {
+			return nil, inUse("DependencyViolation", "resource %s has a dependent object", groupID)
+		}
+	}
+	s.fixtures.SecurityGroups = slices.Delete(s.fixtures.SecurityGroups, index, index+1)
+	return &ec2.DeleteSecurityGroupOutput{}, nil
+}
+
+func findNatGateway(f *Fixtures, id string) *ec2.NatGateway {
+	for _, nat := range f.NatGateways {
+		if aws.StringValue(nat.NatGatewayId) == id {
+			return nat
+		}
+	}
+	return nil
+}
+
+// deleteNatGateway only moves the gateway to deleted, like the real API which
+// keeps returning it for a while afterwards
+func deleteNatGateway(s *Server, form url.Values) (interface{}, error) {
+	natID := form.Get("NatGatewayId")
+	nat := findNatGateway(s.fixtures, natID)
+	if nat == nil || aws.StringValue(nat.State) == ec2.NatGatewayStateDeleted {
+		return nil, notFound("NatGatewayNotFound", "The NAT gateway '%s' does not exist", natID)
+	}
+	nat.State = aws.String(ec2.NatGatewayStateDeleted)
+	return &ec2.DeleteNatGatewayOutput{NatGatewayId: aws.String(natID)}, nil
+}
+
+func releaseAddress(s *Server, form url.Values) (interface{}, error) {
+	allocationID := form.Get("AllocationId")
+	index := slices.IndexFunc(s.fixtures.Addresses, func(address *ec2.Address) bool {
+		return aws.StringValue(address.AllocationId) == allocationID
+	})
+	if index < 0 {
+		return nil, notFound("InvalidAllocationID.NotFound", "The allocation ID '%s' does not exist", allocationID)
+	}
+	for _, nat := range s.fixtures.NatGateways {
+		if aws.StringValue(nat.State) == ec2.NatGatewayStateDeleted {
+			continue
+		}
+		for _, address := range nat.NatGatewayAddresses {
+			if aws.StringValue(address.AllocationId) == allocationID {
+				return nil, inUse("InvalidIPAddress.InUse", "Address %s is in use", allocationID)
+			}
+		}
+	}
+	s.fixtures.Addresses = slices.Delete(s.fixtures.Addresses, index, index+1)
+	return &ec2.ReleaseAddressOutput{}, nil
+}
+
+func findInternetGateway(f *Fixtures, id string) *ec2.InternetGateway {
+	for _, igw := range f.InternetGateways {
+		if aws.StringValue(igw.InternetGatewayId) == id {
+			return igw
+		}
+	}
+	return nil
+}
+
+func detachInternetGateway(s *Server, form url.Values) (interface{}, error) {
+	igwID, vpcID := form.Get("InternetGatewayId"), form.Get("VpcId")
+	igw := findInternetGateway(s.fixtures, igwID)
+	if igw == nil {
+		return nil, notFound("InvalidInternetGatewayID.NotFound", "The internet gateway '%s' does not exist", igwID)
+	}
+	index := slices.IndexFunc(igw.Attachments, func(attachment *ec2.InternetGatewayAttachment) bool {
+		return aws.StringValue(attachment.VpcId) == vpcID
+	})
+	if index < 0 {
+		return nil, notFound("Gateway.NotAttached", "resource %s is not attached to network %s", igwID, vpcID)
+	}
+	igw.Attachments = slices.Delete(igw.Attachments, index, index+1)
+	return &ec2.DetachInternetGatewayOutput{}, nil
+}
+
+func deleteInternetGateway(s *Server, form url.Values) (interface{}, error) {
+	igwID := form.Get("InternetGatewayId")
+	igw := findInternetGateway(s.fixtures, igwID)
+	if igw == nil {
+		return nil, notFound("InvalidInternetGatewayID.NotFound", "The internet gateway '%s' does not exist", igwID)
+	}
+	if len(igw.Attachments) > 0 {
+		return nil, inUse("DependencyViolation", "The internet gateway '%s' has dependencies and cannot be deleted", igwID)
+	}
+	s.fixtures.InternetGateways = slices.DeleteFunc(s.fixtures.InternetGateways, func(other *ec2.InternetGateway) bool {
+		return other == igw
+	})
+	return &ec2.DeleteInternetGatewayOutput{}, nil
+}
+
+func deleteRouteTable(s *Server, form url.Values) (interface{}, error) {
+	tableID := form.Get("RouteTableId")
+	index := slices.IndexFunc(s.fixtures.RouteTables, func(table *ec2.RouteTable) bool {
+		return aws.StringValue(table.RouteTableId) == tableID
+	})
+	if index < 0 {
+		return nil, notFound("InvalidRouteTableID.NotFound", "The route table '%s' does not exist", tableID)
+	}
+	if isMainRouteTable(s.fixtures.RouteTables[index]) {
+		return nil, inUse("DependencyViolation", "The routeTable '%s' has dependencies and cannot be deleted", tableID)
+	}
+	s.fixtures.RouteTables = slices.Delete(s.fixtures.RouteTables, index, index+1)
+	return &ec2.DeleteRouteTableOutput{}, nil
+}
+
+func deleteSubnet(s *Server, form url.Values) (interface{}, error) {
+	subnetID := form.Get("SubnetId")
+	index := slices.IndexFunc(s.fixtures.Subnets, func(subnet *ec2.Subnet) bool {
+		return aws.StringValue(subnet.SubnetId) == subnetID
+	})
+	if index < 0 {
+		return nil, notFound("InvalidSubnetID.NotFound", "The subnet ID '%s' does not exist", subnetID)
+	}
+	for _, nat := range s.fixtures.NatGateways {
+		if aws.StringValue(nat.SubnetId) == subnetID && aws.StringValue(nat.State) != ec2.NatGatewayStateDeleted {
+			return nil, inUse("DependencyViolation", "The subnet '%s' has dependencies and cannot be deleted", subnetID)
+		}
+	}
+	for _, instance := range s.fixtures.Instances {
+		if aws.StringValue(instance.SubnetId) == subnetID && !isTerminated(instance) {
+			return nil, inUse("DependencyViolation", "The subnet '%s' has dependencies and cannot be deleted", subnetID)
+		}
+	}
+	s.fixtures.Subnets = slices.Delete(s.fixtures.Subnets, index, index+1)
+	return &ec2.DeleteSubnetOutput{}, nil
+}
+
+func isTerminated(instance *ec2.Instance) bool {
+	return instance.State != nil && aws.StringValue(instance.State.Name) == ec2.InstanceStateNameTerminated
+}
+
+// deleteVpc fails while anything but the default security group and the main
+// route table is left in the VPC, which are deleted along with it
+func deleteVpc(s *Server, form url.Values) (interface{}, error) {
+	vpcID := form.Get("VpcId")
+	if findVpc(s.fixtures, vpcID) == nil {
+		return nil, notFound("InvalidVpcID.NotFound", "The vpc ID '%s' does not exist", vpcID)
+	}
+	dependencyViolation := inUse("DependencyViolation", "The vpc '%s' has dependencies and cannot be deleted", vpcID)
+	for _, subnet := range s.fixtures.Subnets {
+		if aws.StringValue(subnet.VpcId) == vpcID {
+			return nil, dependencyViolation
+		}
+	}
+	for _, igw := range s.fixtures.InternetGateways {
+		for _, attachment := range igw.Attachments {
+			if aws.StringValue(attachment.VpcId) == vpcID {
+				return nil, dependencyViolation
+			}
+		}
+	}
+	for _, sg := range s.fixtures.SecurityGroups {
+		if aws.StringValue(sg.VpcId) == vpcID && aws.StringValue(sg.GroupName) != "default" {
+			return nil, dependencyViolation
+		}
+	}
+	for _, table := range s.fixtures.RouteTables {
+		if aws.StringValue(table.VpcId) == vpcID && !isMainRouteTable(table) {
+			return nil, dependencyViolation
+		}
+	}
+
+	s.fixtures.Vpcs = slices.DeleteFunc(s.fixtures.Vpcs, func(vpc *ec2.Vpc) bool {
+		return aws.StringValue(vpc.VpcId) == vpcID
+	})
+	s.fixtures.SecurityGroups = slices.DeleteFunc(s.fixtures.SecurityGroups, func(sg *ec2.SecurityGroup) bool {
+		return aws.StringValue(sg.VpcId) == vpcID
+	})
+	s.fixtures.RouteTables = slices.DeleteFunc(s.fixtures.RouteTables, func(table *ec2.RouteTable) bool {
+		return aws.StringValue(table.VpcId) == vpcID
+	})
+	delete(s.fixtures.VpcAttributes, vpcID)
+	return &ec2.DeleteVpcOutput{}, nil
+}
@@ -0,0 +1,226 @@
+package fakeaws
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+var elbv2Handlers = map[string]handlerFunc{
+	"DescribeLoadBalancers": describeLoadBalancers,
+	"DescribeTags":          describeELBTags,
+	"DescribeTargetGroups":  describeTargetGroups,
+	"DescribeListeners":     describeListeners,
+	"DescribeRules":         describeRules,
+	"DescribeTargetHealth":  describeTargetHealth,
+	"DeleteLoadBalancer":    deleteLoadBalancer,
+	"DeleteTargetGroup":     deleteTargetGroup,
+
+	"DescribeLoadBalancerAttributes": describeLoadBalancerAttributes,
+	"ModifyLoadBalancerAttributes":   modifyLoadBalancerAttributes,
+}
+
+func describeLoadBalancers(s *Server, form url.Values) (interface{}, error) {
+	names := memberList(form, "Names")
+	arns := memberList(form, "LoadBalancerArns")
+	output := &elbv2.DescribeLoadBalancersOutput{LoadBalancers: []*elbv2.LoadBalancer{}}
+	for _, lb := range s.fixtures.LoadBalancers {
+		if len(names) > 0 && !contains(names, aws.StringValue(lb.LoadBalancerName)) {
+			continue
+		}
+		if len(arns) > 0 && !contains(arns, aws.StringValue(lb.LoadBalancerArn)) {
+			continue
+		}
+		output.LoadBalancers = append(output.LoadBalancers, lb)
+	}
+	if len(output.LoadBalancers) < len(names)+len(arns) {
+		return nil, notFound(elbv2.ErrCodeLoadBalancerNotFoundException, "One or more load balancers not found")
+	}
+	return output, nil
+}
+
+func describeELBTags(s *Server, form url.Values) (interface{}, error) {
+	output := &elbv2.DescribeTagsOutput{TagDescriptions: []*elbv2.TagDescription{}}
+	for _, arn := range memberList(form, "ResourceArns") {
+		tags, ok := s.fixtures.ELBTags[arn]
+		if !ok {
+			tags = []*elbv2.Tag{}
+		}
+		output.TagDescriptions = append(output.TagDescriptions, &elbv2.TagDescription{
+			ResourceArn: aws.String(arn),
+			Tags:        tags,
+		})
+	}
+	return output, nil
+}
+
+func describeTargetGroups(s *Server, form url.Values) (interface{}, error) {
+	arns := memberList(form, "TargetGroupArns")
+	names := memberList(form, "Names")
+	lbArn := form.Get("LoadBalancerArn")
+	output := &elbv2.DescribeTargetGroupsOutput{TargetGroups: []*elbv2.TargetGroup{}}
+	for _, tg := range s.fixtures.TargetGroups {
+		if len(arns) > 0 && !contains(arns, aws.StringValue(tg.TargetGroupArn)) {
+			continue
+		}
+		if len(names) > 0 && !contains(names, aws.StringValue(tg.TargetGroupName)) {
+			continue
+		}
+		if lbArn != "" && !contains(aws.StringValueSlice(tg.LoadBalancerArns), lbArn) {
+			continue
+		}
+		output.TargetGroups = append(output.TargetGroups, tg)
+	}
+	if len(output.TargetGroups) < len(arns)+len(names) {
+		return nil, notFound(elbv2.ErrCodeTargetGroupNotFoundException, "One or more target groups not found")
+	}
+	return output, nil
+}
+
+func describeListeners(s *Server, form url.Values) (interface{}, error) {
+	lbArn := form.Get("LoadBalancerArn")
+	arns := memberList(form, "ListenerArns")
+	output := &elbv2.DescribeListenersOutput{Listeners: []*elbv2.Listener{}}
+	for _, listener := range s.fixtures.Listeners {
+		if lbArn != "" && aws.StringValue(listener.LoadBalancerArn) != lbArn {
+			continue
+		}
+		if len(arns) > 0 && !contains(arns, aws.StringValue(listener.ListenerArn)) {
+			continue
+		}
+		output.Listeners = append(output.Listeners, listener)
+	}
+	return output, nil
+}
+
+func describeRules(s *Server, form url.Values) (interface{}, error) {
+	listenerArn := form.Get("ListenerArn")
+	rules, ok := s.fixtures.Rules[listenerArn]
+	if !ok {
+		return nil, notFound(elbv2.ErrCodeListenerNotFoundException, "Listener '%s' not found", listenerArn)
+	}
+	return &elbv2.DescribeRulesOutput{Rules: rules}, nil
+}
+
+func describeTargetHealth(s *Server, form url.Values) (interface{}, error) {
+	tgArn := form.Get("TargetGroupArn")
+	found := false
+	for _, tg := range s.fixtures.TargetGroups {
+		if aws.StringValue(tg.TargetGroupArn) == tgArn {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, notFound(elbv2.ErrCodeTargetGroupNotFoundException, "Target group '%s' not found", tgArn)
+	}
+	descriptions, ok := s.fixtures.TargetHealth[tgArn]
+	if !ok {
+		descriptions = []*elbv2.TargetHealthDescription{}
+	}
+	return &elbv2.DescribeTargetHealthOutput{TargetHealthDescriptions: descriptions}, nil
+}
+
+func findLoadBalancer(f *Fixtures, arn string) *elbv2.LoadBalancer {
+	for _, lb := range f.LoadBalancers {
+		if aws.StringValue(lb.LoadBalancerArn) == arn {
+			return lb
+		}
+	}
+	return nil
+}
+
+// loadBalancerAttribute returns the value of the attribute, empty if it is not set
+func loadBalancerAttribute(f *Fixtures, arn, key string) string {
+	for _, attribute := range f.LoadBalancerAttributes[arn] {
+		if aws.StringValue(attribute.Key) == key {
+			return aws.StringValue(attribute.Value)
+		}
+	}
+	return ""
+}
+
+func describeLoadBalancerAttributes(s *Server, form url.Values) (interface{}, error) {
+	lbArn := form.Get("LoadBalancerArn")
+	if findLoadBalancer(s.fixtures, lbArn) == nil {
+		return nil, notFound(elbv2.ErrCodeLoadBalancerNotFoundException, "Load balancer '%s' not found", lbArn)
+	}
+	attributes, ok := s.fixtures.LoadBalancerAttributes[lbArn]
+	if !ok {
+		attributes = []*elbv2.LoadBalancerAttribute{}
+	}
+	return &elbv2.DescribeLoadBalancerAttributesOutput{Attributes: attributes}, nil
+}
+
+// modifyLoadBalancerAttributes sets the given attributes, leaving the others as they are
+func modifyLoadBalancerAttributes(s *Server, form url.Values) (interface{}, error) {
+	lbArn := form.Get("LoadBalancerArn")
+	if findLoadBalancer(s.fixtures, lbArn) == nil {
+		return nil, notFound(elbv2.ErrCodeLoadBalancerNotFoundException, "Load balancer '%s' not found", lbArn)
+	}
+	if s.fixtures.LoadBalancerAttributes == nil {
+		s.fixtures.LoadBalancerAttributes = map[string][]*elbv2.LoadBalancerAttribute{}
+	}
+	for i := 1; form.Has(fmt.Sprintf("Attributes.member.%d.Key", i)); i++ {
+		key := form.Get(fmt.Sprintf("Attributes.member.%d.Key", i))
+		value := form.Get(fmt.Sprintf("Attributes.member.%d.Value", i))
+		attributes := slices.DeleteFunc(s.fixtures.LoadBalancerAttributes[lbArn], func(attribute *elbv2.LoadBalancerAttribute) bool {
+			return aws.StringValue(attribute.Key) == key
+		})
+		s.fixtures.LoadBalancerAttributes[lbArn] = append(attributes, &elbv2.LoadBalancerAttribute{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return &elbv2.ModifyLoadBalancerAttributesOutput{Attributes: s.fixtures.LoadBalancerAttributes[lbArn]}, nil
+}
+
+// deleteLoadBalancer also deletes its listeners and rules and deregisters it from
+// its target groups
+func deleteLoadBalancer(s *Server, form url.Values) (interface{}, error) {
+	lbArn := form.Get("LoadBalancerArn")
+	index := slices.IndexFunc(s.fixtures.LoadBalancers, func(lb *elbv2.LoadBalancer) bool {
+		return aws.StringValue(lb.LoadBalancerArn) == lbArn
+	})
+	if index < 0 {
+		return nil, notFound(elbv2.ErrCodeLoadBalancerNotFoundException, "Load balancer '%s' not found", lbArn)
+	}
+	if loadBalancerAttribute(s.fixtures, lbArn, "deletion_protection.enabled") == "true" {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: elbv2.ErrCodeOperationNotPermittedException,
+			Message: fmt.Sprintf("Load balancer '%s' cannot be deleted because deletion protection is enabled", lbArn)}
+	}
+	s.fixtures.LoadBalancers = slices.Delete(s.fixtures.LoadBalancers, index, index+1)
+	s.fixtures.Listeners = slices.DeleteFunc(s.fixtures.Listeners, func(listener *elbv2.Listener) bool {
+		if aws.StringValue(listener.LoadBalancerArn) != lbArn {
+			return false
+		}
+		delete(s.fixtures.Rules, aws.StringValue(listener.ListenerArn))
+		return true
+	})
+	for _, tg := range s.fixtures.TargetGroups {
+		tg.LoadBalancerArns = aws.StringSlice(slices.DeleteFunc(aws.StringValueSlice(tg.LoadBalancerArns), func(arn string) bool {
+			return arn == lbArn
+		}))
+	}
+	delete(s.fixtures.ELBTags, lbArn)
+	delete(s.fixtures.LoadBalancerAttributes, lbArn)
+	return &elbv2.DeleteLoadBalancerOutput{}, nil
+}
+
+func deleteTargetGroup(s *Server, form url.Values) (interface{}, error) {
+	tgArn := form.Get("TargetGroupArn")
+	index := slices.IndexFunc(s.fixtures.TargetGroups, func(tg *elbv2.TargetGroup) bool {
+		return aws.StringValue(tg.TargetGroupArn) == tgArn
+	})
+	if index < 0 {
+		return nil, notFound(elbv2.ErrCodeTargetGroupNotFoundException, "Target group '%s' not found", tgArn)
+	}
+	if len(s.fixtures.TargetGroups[index].LoadBalancerArns) > 0 {
+		return nil, inUse(elbv2.ErrCodeResourceInUseException, "Target group '%s' is currently in use by a listener or a rule", tgArn)
+	}
+	s.fixtures.TargetGroups = slices.Delete(s.fixtures.TargetGroups, index, index+1)
+	delete(s.fixtures.TargetHealth, tgArn)
+	delete(s.fixtures.ELBTags, tgArn)
+	return &elbv2.DeleteTargetGroupOutput{}, nil
+}
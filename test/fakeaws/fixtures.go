@@ -0,0 +1,78 @@
+package fakeaws
+
+import (
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// Fixtures is the state served by the fake endpoint. Resources use the SDK types
+// so fixtures read like the Describe* output the helpers consume.
+type Fixtures struct {
+	// EC2
+	Vpcs                   []*ec2.Vpc
+	VpcAttributes          map[string]VpcAttributes
+	Subnets                []*ec2.Subnet
+	NatGateways            []*ec2.NatGateway
+	FlowLogs               []*ec2.FlowLog
+	SecurityGroups         []*ec2.SecurityGroup
+	LaunchTemplates        []*ec2.LaunchTemplate
+	LaunchTemplateVersions []*ec2.LaunchTemplateVersion
+	Instances              []*ec2.Instance
+	InternetGateways       []*ec2.InternetGateway
+	RouteTables            []*ec2.RouteTable
+	Addresses              []*ec2.Address
+	Images                 []*ec2.Image
+	AvailabilityZones      []*ec2.AvailabilityZone
+	// EC2PageSize splits the VPCs, security groups and NAT gateways listed into
+	// pages of that many, linked by NextToken
+	EC2PageSize int
+
+	// ELBv2, with listener rules, target health and tags keyed by listener,
+	// target group and resource ARN respectively, and load balancer attributes by
+	// load balancer ARN. A load balancer with deletion_protection.enabled set to
+	// true cannot be deleted.
+	LoadBalancers          []*elbv2.LoadBalancer
+	LoadBalancerAttributes map[string][]*elbv2.LoadBalancerAttribute
+	Listeners              []*elbv2.Listener
+	Rules                  map[string][]*elbv2.Rule
+	TargetGroups           []*elbv2.TargetGroup
+	TargetHealth           map[string][]*elbv2.TargetHealthDescription
+	ELBTags                map[string][]*elbv2.Tag
+
+	// AutoScaling. With SelfHealing set, every DescribeAutoScalingGroups call moves
+	// each group one step towards its desired capacity, like the real service
+	// between two polls: Pending instances go InService and register in the group's
+	// target groups, Terminating and unhealthy ones go away, and replacements launch.
+	AutoScalingGroups []*autoscaling.Group
+	SelfHealing       bool
+
+	// IAM, with attached policies keyed by role name. A role cannot be deleted
+	// while it has policies attached or is in an instance profile, nor a policy
+	// while it is attached to a role.
+	Roles                []*iam.Role
+	AttachedRolePolicies map[string][]*iam.AttachedPolicy
+	InstanceProfiles     []*iam.InstanceProfile
+	Policies             []*iam.Policy
+
+	// ACM, with tags keyed by certificate ARN. A certificate is in use while an
+	// HTTPS listener lists it.
+	Certificates    []*acm.CertificateDetail
+	CertificateTags map[string][]*acm.Tag
+
+	// CloudWatch Logs, with tags keyed by log group name
+	LogGroups    []*cloudwatchlogs.LogGroup
+	LogGroupTags map[string]map[string]*string
+
+	// STS, the account returned by GetCallerIdentity, DefaultAccountID when empty
+	AccountID string
+}
+
+// VpcAttributes holds the attributes returned by DescribeVpcAttribute
+type VpcAttributes struct {
+	EnableDnsHostnames bool
+	EnableDnsSupport   bool
+}
@@ -0,0 +1,236 @@
+package fakeaws
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+var iamHandlers = map[string]handlerFunc{
+	"GetRole":                       getRole,
+	"ListAttachedRolePolicies":      listAttachedRolePolicies,
+	"ListRoles":                     listRoles,
+	"ListRoleTags":                  listRoleTags,
+	"ListInstanceProfilesForRole":   listInstanceProfilesForRole,
+	"ListPolicies":                  listPolicies,
+	"ListPolicyTags":                listPolicyTags,
+	"RemoveRoleFromInstanceProfile": removeRoleFromInstanceProfile,
+	"DeleteInstanceProfile":         deleteInstanceProfile,
+	"DetachRolePolicy":              detachRolePolicy,
+	"DeleteRole":                    deleteRole,
+	"DeletePolicy":                  deletePolicy,
+}
+
+func findRole(f *Fixtures, name string) *iam.Role {
+	for _, role := range f.Roles {
+		if aws.StringValue(role.RoleName) == name {
+			return role
+		}
+	}
+	return nil
+}
+
+func noSuchRole(name string) error {
+	return &apiError{Status: http.StatusNotFound, Code: iam.ErrCodeNoSuchEntityException, Message: "The role with name " + name + " cannot be found."}
+}
+
+func noSuchEntity(format string, args ...interface{}) error {
+	return &apiError{Status: http.StatusNotFound, Code: iam.ErrCodeNoSuchEntityException, Message: fmt.Sprintf(format, args...)}
+}
+
+// deleteConflict is returned when an IAM entity cannot be deleted while something is attached to it
+func deleteConflict(message string) error {
+	return &apiError{Status: http.StatusConflict, Code: iam.ErrCodeDeleteConflictException, Message: message}
+}
+
+func findInstanceProfile(f *Fixtures, name string) *iam.InstanceProfile {
+	for _, profile := range f.InstanceProfiles {
+		if aws.StringValue(profile.InstanceProfileName) == name {
+			return profile
+		}
+	}
+	return nil
+}
+
+func findPolicy(f *Fixtures, arn string) *iam.Policy {
+	for _, policy := range f.Policies {
+		if aws.StringValue(policy.Arn) == arn {
+			return policy
+		}
+	}
+	return nil
+}
+
+// hasRole reports whether the instance profile holds the role
+func hasRole(profile *iam.InstanceProfile, name string) bool {
+	return slices.ContainsFunc(profile.Roles, func(role *iam.Role) bool {
+		return aws.StringValue(role.RoleName) == name
+	})
+}
+
+func getRole(s *Server, form url.Values) (interface{}, error) {
+	name := form.Get("RoleName")
+	role := findRole(s.fixtures, name)
+	if role == nil {
+		return nil, noSuchRole(name)
+	}
+	return &iam.GetRoleOutput{Role: role}, nil
+}
+
+func listAttachedRolePolicies(s *Server, form url.Values) (interface{}, error) {
+	name := form.Get("RoleName")
+	if findRole(s.fixtures, name) == nil {
+		return nil, noSuchRole(name)
+	}
+	policies, ok := s.fixtures.AttachedRolePolicies[name]
+	if !ok {
+		policies = []*iam.AttachedPolicy{}
+	}
+	return &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: policies, IsTruncated: aws.Bool(false)}, nil
+}
+
+// listRoles lists every role. Like the real API it leaves out the tags, which
+// ListRoleTags returns.
+func listRoles(s *Server, form url.Values) (interface{}, error) {
+	output := &iam.ListRolesOutput{Roles: []*iam.Role{}, IsTruncated: aws.Bool(false)}
+	for _, role := range s.fixtures.Roles {
+		listed := *role
+		listed.Tags = nil
+		output.Roles = append(output.Roles, &listed)
+	}
+	return output, nil
+}
+
+func listRoleTags(s *Server, form url.Values) (interface{}, error) {
+	name := form.Get("RoleName")
+	role := findRole(s.fixtures, name)
+	if role == nil {
+		return nil, noSuchRole(name)
+	}
+	tags := role.Tags
+	if tags == nil {
+		tags = []*iam.Tag{}
+	}
+	return &iam.ListRoleTagsOutput{Tags: tags, IsTruncated: aws.Bool(false)}, nil
+}
+
+func listInstanceProfilesForRole(s *Server, form url.Values) (interface{}, error) {
+	name := form.Get("RoleName")
+	if findRole(s.fixtures, name) == nil {
+		return nil, noSuchRole(name)
+	}
+	output := &iam.ListInstanceProfilesForRoleOutput{InstanceProfiles: []*iam.InstanceProfile{}, IsTruncated: aws.Bool(false)}
+	for _, profile := range s.fixtures.InstanceProfiles {
+		if hasRole(profile, name) {
+			output.InstanceProfiles = append(output.InstanceProfiles, profile)
+		}
+	}
+	return output, nil
+}
+
+// listPolicies lists the customer managed policies, which are all the fixtures
+// hold, without their tags like the real API
+func listPolicies(s *Server, form url.Values) (interface{}, error) {
+	output := &iam.ListPoliciesOutput{Policies: []*iam.Policy{}, IsTruncated: aws.Bool(false)}
+	if form.Get("Scope") == iam.PolicyScopeTypeAws {
+		return output, nil
+	}
+	for _, policy := range s.fixtures.Policies {
+		listed := *policy
+		listed.Tags = nil
+		output.Policies = append(output.Policies, &listed)
+	}
+	return output, nil
+}
+
+func listPolicyTags(s *Server, form url.Values) (interface{}, error) {
+	arn := form.Get("PolicyArn")
+	policy := findPolicy(s.fixtures, arn)
+	if policy == nil {
+		return nil, noSuchEntity("Policy %s does not exist or is not attachable.", arn)
+	}
+	tags := policy.Tags
+	if tags == nil {
+		tags = []*iam.Tag{}
+	}
+	return &iam.ListPolicyTagsOutput{Tags: tags, IsTruncated: aws.Bool(false)}, nil
+}
+
+func removeRoleFromInstanceProfile(s *Server, form url.Values) (interface{}, error) {
+	profileName, roleName := form.Get("InstanceProfileName"), form.Get("RoleName")
+	profile := findInstanceProfile(s.fixtures, profileName)
+	if profile == nil || !hasRole(profile, roleName) {
+		return nil, noSuchEntity("The role with name %s cannot be found in instance profile %s.", roleName, profileName)
+	}
+	profile.Roles = slices.DeleteFunc(profile.Roles, func(role *iam.Role) bool {
+		return aws.StringValue(role.RoleName) == roleName
+	})
+	return &iam.RemoveRoleFromInstanceProfileOutput{}, nil
+}
+
+func deleteInstanceProfile(s *Server, form url.Values) (interface{}, error) {
+	name := form.Get("InstanceProfileName")
+	profile := findInstanceProfile(s.fixtures, name)
+	if profile == nil {
+		return nil, noSuchEntity("Instance Profile %s cannot be found.", name)
+	}
+	if len(profile.Roles) > 0 {
+		return nil, deleteConflict("Cannot delete entity, must remove roles from instance profile first.")
+	}
+	s.fixtures.InstanceProfiles = slices.DeleteFunc(s.fixtures.InstanceProfiles, func(p *iam.InstanceProfile) bool { return p == profile })
+	return &iam.DeleteInstanceProfileOutput{}, nil
+}
+
+func detachRolePolicy(s *Server, form url.Values) (interface{}, error) {
+	name, arn := form.Get("RoleName"), form.Get("PolicyArn")
+	if findRole(s.fixtures, name) == nil {
+		return nil, noSuchRole(name)
+	}
+	policies := s.fixtures.AttachedRolePolicies[name]
+	index := slices.IndexFunc(policies, func(policy *iam.AttachedPolicy) bool { return aws.StringValue(policy.PolicyArn) == arn })
+	if index < 0 {
+		return nil, noSuchEntity("Policy %s was not found.", arn)
+	}
+	s.fixtures.AttachedRolePolicies[name] = slices.Delete(policies, index, index+1)
+	return &iam.DetachRolePolicyOutput{}, nil
+}
+
+func deleteRole(s *Server, form url.Values) (interface{}, error) {
+	name := form.Get("RoleName")
+	role := findRole(s.fixtures, name)
+	if role == nil {
+		return nil, noSuchRole(name)
+	}
+	if len(s.fixtures.AttachedRolePolicies[name]) > 0 {
+		return nil, deleteConflict("Cannot delete entity, must detach all policies first.")
+	}
+	for _, profile := range s.fixtures.InstanceProfiles {
+		if hasRole(profile, name) {
+			return nil, deleteConflict("Cannot delete entity, must remove roles from instance profile first.")
+		}
+	}
+	s.fixtures.Roles = slices.DeleteFunc(s.fixtures.Roles, func(r *iam.Role) bool { return r == role })
+	delete(s.fixtures.AttachedRolePolicies, name)
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+func deletePolicy(s *Server, form url.Values) (interface{}, error) {
+	arn := form.Get("PolicyArn")
+	policy := findPolicy(s.fixtures, arn)
+	if policy == nil {
+		return nil, noSuchEntity("Policy %s was not found.", arn)
+	}
+	for _, attached := range s.fixtures.AttachedRolePolicies {
+		for _, a := range attached {
+			if aws.StringValue(a.PolicyArn) == arn {
+				return nil, deleteConflict("Cannot delete a policy attached to entities.")
+			}
+		}
+	}
+	s.fixtures.Policies = slices.DeleteFunc(s.fixtures.Policies, func(p *iam.Policy) bool { return p == policy })
+	return &iam.DeletePolicyOutput{}, nil
+}
@@ -0,0 +1,83 @@
+package fakeaws
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// CloudWatch Logs speaks the JSON protocol, with the action in the X-Amz-Target header
+const logsTargetPrefix = "Logs_20140328."
+
+var logsHandlers = map[string]jsonHandlerFunc{
+	"DescribeLogGroups": describeLogGroups,
+	"ListTagsLogGroup":  listTagsLogGroup,
+	"DeleteLogGroup":    deleteLogGroup,
+}
+
+func findLogGroup(f *Fixtures, name string) *cloudwatchlogs.LogGroup {
+	for _, group := range f.LogGroups {
+		if aws.StringValue(group.LogGroupName) == name {
+			return group
+		}
+	}
+	return nil
+}
+
+func logGroupNotFound(name string) error {
+	return &apiError{Status: http.StatusBadRequest, Code: cloudwatchlogs.ErrCodeResourceNotFoundException, Message: "The specified log group " + name + " does not exist."}
+}
+
+func describeLogGroups(s *Server, decode func(interface{}) error) (interface{}, error) {
+	var input cloudwatchlogs.DescribeLogGroupsInput
+	if err := decode(&input); err != nil {
+		return nil, err
+	}
+	output := &cloudwatchlogs.DescribeLogGroupsOutput{LogGroups: []*cloudwatchlogs.LogGroup{}}
+	for _, group := range s.fixtures.LogGroups {
+		if strings.HasPrefix(aws.StringValue(group.LogGroupName), aws.StringValue(input.LogGroupNamePrefix)) {
+			output.LogGroups = append(output.LogGroups, group)
+		}
+	}
+	return output, nil
+}
+
+func listTagsLogGroup(s *Server, decode func(interface{}) error) (interface{}, error) {
+	var input cloudwatchlogs.ListTagsLogGroupInput
+	if err := decode(&input); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.LogGroupName)
+	if findLogGroup(s.fixtures, name) == nil {
+		return nil, logGroupNotFound(name)
+	}
+	tags, ok := s.fixtures.LogGroupTags[name]
+	if !ok {
+		tags = map[string]*string{}
+	}
+	return &cloudwatchlogs.ListTagsLogGroupOutput{Tags: tags}, nil
+}
+
+func deleteLogGroup(s *Server, decode func(interface{}) error) (interface{}, error) {
+	var input cloudwatchlogs.DeleteLogGroupInput
+	if err := decode(&input); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.LogGroupName)
+	f := s.fixtures
+	if findLogGroup(f, name) == nil {
+		return nil, logGroupNotFound(name)
+	}
+
+	var groups []*cloudwatchlogs.LogGroup
+	for _, group := range f.LogGroups {
+		if aws.StringValue(group.LogGroupName) != name {
+			groups = append(groups, group)
+		}
+	}
+	f.LogGroups = groups
+	delete(f.LogGroupTags, name)
+	return &cloudwatchlogs.DeleteLogGroupOutput{}, nil
+}
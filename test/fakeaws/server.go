@@ -0,0 +1,403 @@
+// Package fakeaws provides an in-process stand-in for the AWS APIs used by the
+// test suite (the EC2, ELBv2, AutoScaling, IAM and STS query APIs and the ACM
+// and CloudWatch Logs JSON APIs). It serves responses from Go fixtures so the
+// assertion helpers can be exercised, and the modules planned, without an AWS
+// account.
+package fakeaws
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
+)
+
+// API versions sent by the SDK in the Version form parameter, used to route requests
+const (
+	ec2Version         = "2016-11-15"
+	elbv2Version       = "2015-12-01"
+	autoscalingVersion = "2011-01-01"
+	iamVersion         = "2010-05-08"
+	stsVersion         = "2011-06-15"
+)
+
+// handlerFunc serves one API action from the current fixtures
+type handlerFunc func(s *Server, form url.Values) (interface{}, error)
+
+// Server is a fake AWS endpoint serving the fixtures it was seeded with
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fixtures *Fixtures
+	calls    []string
+	// imports numbers the certificates imported so far, so their ARNs are unique
+	imports int
+	// launches numbers the instances Auto Scaling launched, so their IDs are unique
+	launches int
+}
+
+// NewServer starts a fake endpoint seeded with the given fixtures. Callers must Close it.
+func NewServer(fixtures *Fixtures) *Server {
+	if fixtures == nil {
+		fixtures = &Fixtures{}
+	}
+	s := &Server{fixtures: fixtures}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Start starts a fake endpoint for the duration of the test and points the SDK at it
+// through the AWS_ENDPOINT_URL environment variable, with static dummy credentials.
+func Start(t *testing.T, fixtures *Fixtures) *Server {
+	s := NewServer(fixtures)
+	t.Cleanup(s.Close)
+
+	t.Setenv("AWS_ENDPOINT_URL", s.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAFAKEAWS000000000")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "fake-secret-access-key")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+	return s
+}
+
+// Calls returns the "<service>:<Action>" of every request served so far
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// Update runs fn with exclusive access to the fixtures, e.g. to change state mid-test
+func (s *Server) Update(fn func(f *Fixtures)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.fixtures)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		s.serveJSON(w, r, target)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeQueryError(w, &apiError{Status: http.StatusBadRequest, Code: "MalformedQueryString", Message: err.Error()})
+		return
+	}
+	action := r.Form.Get("Action")
+	version := r.Form.Get("Version")
+
+	var handlers map[string]handlerFunc
+	var service string
+	switch version {
+	case ec2Version:
+		service, handlers = "ec2", ec2Handlers
+	case elbv2Version:
+		service, handlers = "elasticloadbalancing", elbv2Handlers
+	case autoscalingVersion:
+		service, handlers = "autoscaling", autoscalingHandlers
+	case iamVersion:
+		service, handlers = "iam", iamHandlers
+	case stsVersion:
+		service, handlers = "sts", stsHandlers
+	default:
+		writeQueryError(w, &apiError{Status: http.StatusBadRequest, Code: "InvalidAction", Message: fmt.Sprintf("unsupported API version %q", version)})
+		return
+	}
+
+	handler, ok := handlers[action]
+	if !ok {
+		err := &apiError{Status: http.StatusBadRequest, Code: "InvalidAction", Message: fmt.Sprintf("%s does not support %s", service, action)}
+		if service == "ec2" {
+			writeEC2Error(w, err)
+		} else {
+			writeQueryError(w, err)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, service+":"+action)
+	output, err := handler(s, r.Form)
+	s.mu.Unlock()
+
+	if service == "ec2" {
+		writeEC2Response(w, action, output, err)
+	} else {
+		writeQueryResponse(w, action, output, err)
+	}
+}
+
+// serveJSON serves a JSON protocol request, whose action is named by the target header
+func (s *Server) serveJSON(w http.ResponseWriter, r *http.Request, target string) {
+	var handler jsonHandlerFunc
+	var service, action string
+	switch {
+	case strings.HasPrefix(target, acmTargetPrefix):
+		service, action = "acm", strings.TrimPrefix(target, acmTargetPrefix)
+		handler = acmHandlers[action]
+	case strings.HasPrefix(target, logsTargetPrefix):
+		service, action = "logs", strings.TrimPrefix(target, logsTargetPrefix)
+		handler = logsHandlers[action]
+	}
+	if handler == nil {
+		writeJSONError(w, &apiError{Status: http.StatusBadRequest, Code: "UnknownOperationException", Message: fmt.Sprintf("unsupported target %q", target)})
+		return
+	}
+
+	decode := func(input interface{}) error {
+		if err := jsonutil.UnmarshalJSON(input, r.Body); err != nil {
+			return &apiError{Status: http.StatusBadRequest, Code: "SerializationException", Message: err.Error()}
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, service+":"+action)
+	output, err := handler(s, decode)
+	s.mu.Unlock()
+
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	body, err := jsonutil.BuildJSON(output)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Write(body)
+}
+
+// apiError is returned by handlers and rendered in the protocol's error format
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func notFound(code, format string, args ...interface{}) error {
+	return &apiError{Status: http.StatusBadRequest, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// inUse is returned when a resource cannot be deleted while something still depends on it
+func inUse(code, format string, args ...interface{}) error {
+	return &apiError{Status: http.StatusBadRequest, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidParameter(format string, args ...interface{}) error {
+	return &apiError{Status: http.StatusBadRequest, Code: "ValidationError", Message: fmt.Sprintf(format, args...)}
+}
+
+const requestID = "00000000-0000-0000-0000-000000000000"
+
+// encodeShape renders an SDK output struct as XML. xmlutil skips the unnamed root
+// element, which leaves just the members for the caller to wrap.
+func encodeShape(output interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if output != nil {
+		if err := xmlutil.BuildXML(output, xml.NewEncoder(&buf)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeEC2Response(w http.ResponseWriter, action string, output interface{}, err error) {
+	if err != nil {
+		writeEC2Error(w, err)
+		return
+	}
+	body, err := encodeShape(output)
+	if err != nil {
+		writeEC2Error(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<%sResponse xmlns="http://ec2.amazonaws.com/doc/%s/"><requestId>%s</requestId>%s</%sResponse>`,
+		action, ec2Version, requestID, body, action)
+}
+
+func writeQueryResponse(w http.ResponseWriter, action string, output interface{}, err error) {
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	body, err := encodeShape(output)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<%sResponse><%sResult>%s</%sResult><ResponseMetadata><RequestId>%s</RequestId></ResponseMetadata></%sResponse>`,
+		action, action, body, action, requestID, action)
+}
+
+func asAPIError(err error) *apiError {
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr
+	}
+	return &apiError{Status: http.StatusInternalServerError, Code: "InternalFailure", Message: err.Error()}
+}
+
+func writeEC2Error(w http.ResponseWriter, err error) {
+	apiErr := asAPIError(err)
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(apiErr.Status)
+	fmt.Fprintf(w, `<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors><RequestID>%s</RequestID></Response>`,
+		xmlEscape(apiErr.Code), xmlEscape(apiErr.Message), requestID)
+}
+
+func writeQueryError(w http.ResponseWriter, err error) {
+	apiErr := asAPIError(err)
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(apiErr.Status)
+	fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>%s</RequestId></ErrorResponse>`,
+		xmlEscape(apiErr.Code), xmlEscape(apiErr.Message), requestID)
+}
+
+func writeJSONError(w http.ResponseWriter, err error) {
+	apiErr := asAPIError(err)
+	body, _ := json.Marshal(map[string]string{"__type": apiErr.Code, "message": apiErr.Message})
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(apiErr.Status)
+	w.Write(body)
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// ec2List reads an EC2 query list parameter (Name.1, Name.2, ...)
+func ec2List(form url.Values, name string) []string {
+	return indexedValues(form, name+".")
+}
+
+// memberList reads a query protocol list parameter (Name.member.1, Name.member.2, ...)
+func memberList(form url.Values, name string) []string {
+	return indexedValues(form, name+".member.")
+}
+
+func indexedValues(form url.Values, prefix string) []string {
+	type indexed struct {
+		index int
+		value string
+	}
+	var items []indexed
+	for key, values := range form {
+		if !strings.HasPrefix(key, prefix) || len(values) == 0 {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(key, prefix))
+		if err != nil {
+			continue
+		}
+		items = append(items, indexed{index, values[0]})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].index < items[j].index })
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.value)
+	}
+	return result
+}
+
+// ec2Filters reads EC2 filters (Filter.N.Name, Filter.N.Value.M) into a map of name to values
+func ec2Filters(form url.Values) map[string][]string {
+	filters := make(map[string][]string)
+	for i := 1; ; i++ {
+		name := form.Get(fmt.Sprintf("Filter.%d.Name", i))
+		if name == "" {
+			return filters
+		}
+		filters[name] = append(filters[name], ec2List(form, fmt.Sprintf("Filter.%d.Value", i))...)
+	}
+}
+
+// matchesFilters reports whether a resource satisfies every filter. attrs returns the
+// resource's values for a filter name, and tags are used for tag:<key> and tag-key filters.
+func matchesFilters(filters map[string][]string, attrs map[string][]string, tags map[string]string) bool {
+	for name, wanted := range filters {
+		var actual []string
+		switch {
+		case strings.HasPrefix(name, "tag:"):
+			if value, ok := tags[strings.TrimPrefix(name, "tag:")]; ok {
+				actual = []string{value}
+			}
+		case name == "tag-key":
+			for key := range tags {
+				actual = append(actual, key)
+			}
+		default:
+			values, ok := attrs[name]
+			if !ok {
+				// Unknown filters are ignored rather than failing the request
+				continue
+			}
+			actual = values
+		}
+		if !anyMatch(wanted, actual) {
+			return false
+		}
+	}
+	return true
+}
+
+// anyMatch reports whether a value matches any wanted one. Like EC2, wanted values
+// may use the * and ? wildcards.
+func anyMatch(wanted, actual []string) bool {
+	for _, w := range wanted {
+		for _, a := range actual {
+			if matched, err := path.Match(w, a); w == a || (err == nil && matched) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ec2Page returns the range of the n results that the page asked for by the
+// NextToken of the request covers, and the token of the next page if any. Without
+// EC2PageSize in the fixtures every result is on the first page.
+func (s *Server) ec2Page(form url.Values, n int) (start, end int, next *string, err error) {
+	if token := form.Get("NextToken"); token != "" {
+		if start, err = strconv.Atoi(token); err != nil || start < 0 || start > n {
+			return 0, 0, nil, &apiError{Status: http.StatusBadRequest, Code: "InvalidNextToken", Message: fmt.Sprintf("the token %q is invalid", token)}
+		}
+	}
+	end = n
+	if size := s.fixtures.EC2PageSize; size > 0 && start+size < n {
+		end = start + size
+		next = aws.String(strconv.Itoa(end))
+	}
+	return start, end, next, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
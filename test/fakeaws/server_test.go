@@ -0,0 +1,142 @@
+package fakeaws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSession(t *testing.T, fixtures *Fixtures) *session.Session {
+	server := NewServer(fixtures)
+	t.Cleanup(server.Close)
+	return session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+}
+
+func TestEC2FiltersAndErrors(t *testing.T) {
+	client := ec2.New(newTestSession(t, &Fixtures{
+		Vpcs: []*ec2.Vpc{{VpcId: aws.String("vpc-1"), CidrBlock: aws.String("10.0.0.0/16")}},
+		NatGateways: []*ec2.NatGateway{
+			{NatGatewayId: aws.String("nat-1"), VpcId: aws.String("vpc-1")},
+			{NatGatewayId: aws.String("nat-2"), VpcId: aws.String("vpc-2")},
+		},
+	}))
+
+	nats, err := client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{"vpc-1"})}},
+	})
+	require.NoError(t, err)
+	require.Len(t, nats.NatGateways, 1)
+	assert.Equal(t, "nat-1", aws.StringValue(nats.NatGateways[0].NatGatewayId))
+
+	_, err = client.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: aws.StringSlice([]string{"vpc-404"})})
+	require.Error(t, err)
+	assert.Equal(t, "InvalidVpcID.NotFound", err.(awserr.Error).Code())
+}
+
+func TestQueryErrors(t *testing.T) {
+	client := iam.New(newTestSession(t, &Fixtures{}))
+
+	_, err := client.GetRole(&iam.GetRoleInput{RoleName: aws.String("missing")})
+	require.Error(t, err)
+	assert.Equal(t, iam.ErrCodeNoSuchEntityException, err.(awserr.Error).Code())
+}
+
+func TestEC2DeleteDependencies(t *testing.T) {
+	client := ec2.New(newTestSession(t, &Fixtures{
+		Vpcs:    []*ec2.Vpc{{VpcId: aws.String("vpc-1")}},
+		Subnets: []*ec2.Subnet{{SubnetId: aws.String("subnet-1"), VpcId: aws.String("vpc-1")}},
+		SecurityGroups: []*ec2.SecurityGroup{
+			{GroupId: aws.String("sg-default"), GroupName: aws.String("default"), VpcId: aws.String("vpc-1")},
+		},
+	}))
+
+	_, err := client.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String("vpc-1")})
+	require.Error(t, err)
+	assert.Equal(t, "DependencyViolation", err.(awserr.Error).Code())
+
+	_, err = client.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: aws.String("subnet-1")})
+	require.NoError(t, err)
+	_, err = client.DeleteVpc(&ec2.DeleteVpcInput{VpcId: aws.String("vpc-1")})
+	require.NoError(t, err)
+
+	// The default security group goes with the VPC
+	groups, err := client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{})
+	require.NoError(t, err)
+	assert.Empty(t, groups.SecurityGroups)
+}
+
+func TestACMJSONProtocol(t *testing.T) {
+	client := acm.New(newTestSession(t, &Fixtures{
+		Listeners: []*elbv2.Listener{{
+			LoadBalancerArn: aws.String("arn:alb"),
+			Certificates:    []*elbv2.Certificate{{CertificateArn: aws.String("arn:aws:acm:us-east-1:123456789012:certificate/in-use")}},
+		}},
+		Certificates: []*acm.CertificateDetail{{CertificateArn: aws.String("arn:aws:acm:us-east-1:123456789012:certificate/in-use")}},
+	}))
+
+	_, err := client.ImportCertificate(&acm.ImportCertificateInput{
+		Certificate: []byte("not a certificate"),
+		PrivateKey:  []byte("not a key"),
+	})
+	require.Error(t, err)
+	assert.Equal(t, acm.ErrCodeValidationException, err.(awserr.Error).Code())
+
+	output, err := client.DescribeCertificate(&acm.DescribeCertificateInput{CertificateArn: aws.String("arn:aws:acm:us-east-1:123456789012:certificate/in-use")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"arn:alb"}, aws.StringValueSlice(output.Certificate.InUseBy))
+
+	_, err = client.DeleteCertificate(&acm.DeleteCertificateInput{CertificateArn: aws.String("arn:aws:acm:us-east-1:123456789012:certificate/in-use")})
+	require.Error(t, err)
+	assert.Equal(t, acm.ErrCodeResourceInUseException, err.(awserr.Error).Code())
+
+	_, err = client.DeleteCertificate(&acm.DeleteCertificateInput{CertificateArn: aws.String("arn:aws:acm:us-east-1:123456789012:certificate/missing")})
+	require.Error(t, err)
+	assert.Equal(t, acm.ErrCodeResourceNotFoundException, err.(awserr.Error).Code())
+}
+
+func TestPlanLookups(t *testing.T) {
+	sess := newTestSession(t, &Fixtures{
+		Images: []*ec2.Image{
+			{ImageId: aws.String("ami-1"), Name: aws.String("amzn2-ami-hvm-2.0.1-x86_64-gp2"), ImageOwnerAlias: aws.String("amazon")},
+			{ImageId: aws.String("ami-2"), Name: aws.String("amzn2-ami-hvm-2.0.1-arm64-gp2"), ImageOwnerAlias: aws.String("amazon")},
+			{ImageId: aws.String("ami-3"), Name: aws.String("amzn2-ami-hvm-2.0.1-x86_64-gp2"), OwnerId: aws.String("210987654321")},
+		},
+		AvailabilityZones: []*ec2.AvailabilityZone{
+			{ZoneName: aws.String("us-east-1a"), State: aws.String("available")},
+			{ZoneName: aws.String("us-east-1b"), State: aws.String("impaired")},
+		},
+	})
+
+	images, err := ec2.New(sess).DescribeImages(&ec2.DescribeImagesInput{
+		Owners:  aws.StringSlice([]string{"amazon"}),
+		Filters: []*ec2.Filter{{Name: aws.String("name"), Values: aws.StringSlice([]string{"amzn2-ami-hvm-*-x86_64-gp2"})}},
+	})
+	require.NoError(t, err)
+	require.Len(t, images.Images, 1)
+	assert.Equal(t, "ami-1", aws.StringValue(images.Images[0].ImageId))
+
+	zones, err := ec2.New(sess).DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("state"), Values: aws.StringSlice([]string{"available"})}},
+	})
+	require.NoError(t, err)
+	require.Len(t, zones.AvailabilityZones, 1)
+	assert.Equal(t, "us-east-1a", aws.StringValue(zones.AvailabilityZones[0].ZoneName))
+
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultAccountID, aws.StringValue(identity.Account))
+}
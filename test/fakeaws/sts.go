@@ -0,0 +1,27 @@
+package fakeaws
+
+import (
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// DefaultAccountID is the account of the fake endpoint when the fixtures set none
+const DefaultAccountID = "123456789012"
+
+var stsHandlers = map[string]handlerFunc{
+	"GetCallerIdentity": getCallerIdentity,
+}
+
+func getCallerIdentity(s *Server, form url.Values) (interface{}, error) {
+	account := s.fixtures.AccountID
+	if account == "" {
+		account = DefaultAccountID
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(account),
+		Arn:     aws.String("arn:aws:iam::" + account + ":user/fakeaws"),
+		UserId:  aws.String("AIDAFAKEAWS000000000"),
+	}, nil
+}
@@ -0,0 +1,607 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+
+	"test/fakeaws"
+	"test/utils"
+)
+
+// fakeDeployment describes the resources seeded into the fake AWS endpoint,
+// shaped like a successful apply of the complete example
+type fakeDeployment struct {
+	Region        string
+	Environment   string
+	ProjectName   string
+	VPCCIDR       string
+	InstanceType  string
+	InstanceCount int
+	Apps          utils.Apps
+
+	VPCID              string
+	PrivateSubnets     []string
+	PublicSubnets      []string
+	ALBName            string
+	ALBArn             string
+	ALBDNSName         string
+	ALBSecurityGroupID string
+	HTTPSListenerArn   string
+	TargetGroupArns    map[string]string
+	LaunchTemplateID   string
+	ASGName            string
+	RoleName           string
+	EC2SecurityGroupID string
+}
+
+// newFakeDeployment returns a deployment for the default app set in us-east-1
+func newFakeDeployment(environment, projectName string) *fakeDeployment {
+	d := &fakeDeployment{
+		Region:             "us-east-1",
+		Environment:        environment,
+		ProjectName:        projectName,
+		VPCCIDR:            "10.0.0.0/16",
+		InstanceType:       "t3.micro",
+		InstanceCount:      2,
+		Apps:               utils.DefaultApps(),
+		VPCID:              "vpc-0f00000000000000a",
+		ALBSecurityGroupID: "sg-0a1b00000000000aa",
+		EC2SecurityGroupID: "sg-0ec200000000000ec",
+		LaunchTemplateID:   "lt-0f00000000000000a",
+		TargetGroupArns:    map[string]string{},
+	}
+	d.ALBName = fmt.Sprintf("%s-%s-alb", projectName, environment)
+	d.ALBArn = fmt.Sprintf("arn:aws:elasticloadbalancing:%s:123456789012:loadbalancer/app/%s/50dc6c495c0c9188", d.Region, d.ALBName)
+	d.ALBDNSName = fmt.Sprintf("%s-1234567890.%s.elb.amazonaws.com", d.ALBName, d.Region)
+	d.HTTPSListenerArn = fmt.Sprintf("arn:aws:elasticloadbalancing:%s:123456789012:listener/app/%s/50dc6c495c0c9188/f2f7dc8efc522ab2", d.Region, d.ALBName)
+	d.ASGName = fmt.Sprintf("%s-%s-asg", projectName, environment)
+	d.RoleName = fmt.Sprintf("%s-%s-ec2-role", projectName, environment)
+	for i := 0; i < 3; i++ {
+		d.PrivateSubnets = append(d.PrivateSubnets, fmt.Sprintf("subnet-0b00000000000000%d", i))
+		d.PublicSubnets = append(d.PublicSubnets, fmt.Sprintf("subnet-0a00000000000000%d", i))
+	}
+	for i, name := range d.Apps.Names() {
+		d.TargetGroupArns[name] = fmt.Sprintf("arn:aws:elasticloadbalancing:%s:123456789012:targetgroup/%s-%s-%s/%016x",
+			d.Region, projectName, environment, name, i+1)
+	}
+	return d
+}
+
+// computeVars returns the compute module variables the deployment was created with
+func (d *fakeDeployment) computeVars() map[string]interface{} {
+	var tgARNs []string
+	for _, name := range d.Apps.Names() {
+		tgARNs = append(tgARNs, d.TargetGroupArns[name])
+	}
+	return map[string]interface{}{
+		"environment":           d.Environment,
+		"project_name":          d.ProjectName,
+		"vpc_id":                d.VPCID,
+		"private_subnets":       d.PrivateSubnets,
+		"instance_type":         d.InstanceType,
+		"instance_count":        d.InstanceCount,
+		"apps":                  d.Apps.ToVars(),
+		"target_group_arns":     tgARNs,
+		"alb_security_group_id": d.ALBSecurityGroupID,
+	}
+}
+
+func (d *fakeDeployment) commonTags() map[string]string {
+	return map[string]string{
+		"Environment": d.Environment,
+		"Project":     d.ProjectName,
+		"ManagedBy":   "terraform",
+	}
+}
+
+func (d *fakeDeployment) tagPolicy() utils.TagPolicy {
+	return utils.RequiredTags(d.Environment, d.ProjectName)
+}
+
+func ec2Tags(tags map[string]string) []*ec2.Tag {
+	var result []*ec2.Tag
+	for key, value := range tags {
+		result = append(result, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return result
+}
+
+func asgTags(asgName string, tags map[string]string) []*autoscaling.TagDescription {
+	var result []*autoscaling.TagDescription
+	for key, value := range tags {
+		result = append(result, &autoscaling.TagDescription{
+			ResourceId:        aws.String(asgName),
+			ResourceType:      aws.String("auto-scaling-group"),
+			Key:               aws.String(key),
+			Value:             aws.String(value),
+			PropagateAtLaunch: aws.Bool(true),
+		})
+	}
+	return result
+}
+
+func iamTags(tags map[string]string) []*iam.Tag {
+	var result []*iam.Tag
+	for key, value := range tags {
+		result = append(result, &iam.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return result
+}
+
+func elbTags(tags map[string]string) []*elbv2.Tag {
+	var result []*elbv2.Tag
+	for key, value := range tags {
+		result = append(result, &elbv2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return result
+}
+
+// Fixtures renders the deployment as fake endpoint state
+func (d *fakeDeployment) Fixtures() *fakeaws.Fixtures {
+	azs := []string{d.Region + "a", d.Region + "b", d.Region + "c"}
+	f := &fakeaws.Fixtures{
+		Vpcs: []*ec2.Vpc{{
+			VpcId:     aws.String(d.VPCID),
+			CidrBlock: aws.String(d.VPCCIDR),
+			State:     aws.String(ec2.VpcStateAvailable),
+			Tags:      ec2Tags(d.commonTags()),
+		}},
+		VpcAttributes: map[string]fakeaws.VpcAttributes{
+			d.VPCID: {EnableDnsHostnames: true, EnableDnsSupport: true},
+		},
+		FlowLogs: []*ec2.FlowLog{{
+			FlowLogId:  aws.String("fl-0f00000000000000a"),
+			ResourceId: aws.String(d.VPCID),
+		}},
+		Rules:                map[string][]*elbv2.Rule{},
+		TargetHealth:         map[string][]*elbv2.TargetHealthDescription{},
+		ELBTags:              map[string][]*elbv2.Tag{},
+		AttachedRolePolicies: map[string][]*iam.AttachedPolicy{},
+	}
+
+	for i := range azs {
+		f.Subnets = append(f.Subnets,
+			&ec2.Subnet{
+				SubnetId:            aws.String(d.PrivateSubnets[i]),
+				VpcId:               aws.String(d.VPCID),
+				AvailabilityZone:    aws.String(azs[i]),
+				MapPublicIpOnLaunch: aws.Bool(false),
+				Tags:                ec2Tags(d.commonTags()),
+			},
+			&ec2.Subnet{
+				SubnetId:            aws.String(d.PublicSubnets[i]),
+				VpcId:               aws.String(d.VPCID),
+				AvailabilityZone:    aws.String(azs[i]),
+				MapPublicIpOnLaunch: aws.Bool(true),
+				Tags:                ec2Tags(d.commonTags()),
+			})
+	}
+
+	natCount := 1
+	if d.Environment == "prod" {
+		natCount = 3
+	}
+	for i := 0; i < natCount; i++ {
+		f.NatGateways = append(f.NatGateways, &ec2.NatGateway{
+			NatGatewayId: aws.String(fmt.Sprintf("nat-0f0000000000000%d", i)),
+			VpcId:        aws.String(d.VPCID),
+			SubnetId:     aws.String(d.PublicSubnets[i]),
+			State:        aws.String(ec2.NatGatewayStateAvailable),
+			Tags:         ec2Tags(d.commonTags()),
+		})
+	}
+
+	// Route tables as the VPC module creates them: the main one with only the local
+	// route, one for the public subnets and one per NAT gateway for the private ones
+	igwID := "igw-0f00000000000000a"
+	f.InternetGateways = []*ec2.InternetGateway{{
+		InternetGatewayId: aws.String(igwID),
+		Attachments:       []*ec2.InternetGatewayAttachment{{VpcId: aws.String(d.VPCID), State: aws.String("available")}},
+		Tags:              ec2Tags(d.commonTags()),
+	}}
+	localRoute := &ec2.Route{DestinationCidrBlock: aws.String(d.VPCCIDR), GatewayId: aws.String("local"), State: aws.String(ec2.RouteStateActive)}
+	f.RouteTables = []*ec2.RouteTable{
+		{
+			RouteTableId: aws.String("rtb-0c00000000000000c"),
+			VpcId:        aws.String(d.VPCID),
+			Associations: []*ec2.RouteTableAssociation{{Main: aws.Bool(true)}},
+			Routes:       []*ec2.Route{localRoute},
+		},
+		{
+			RouteTableId: aws.String("rtb-0a00000000000000a"),
+			VpcId:        aws.String(d.VPCID),
+			Routes: []*ec2.Route{localRoute, {
+				DestinationCidrBlock: aws.String("0.0.0.0/0"),
+				GatewayId:            aws.String(igwID),
+				State:                aws.String(ec2.RouteStateActive),
+			}},
+			Tags: ec2Tags(d.commonTags()),
+		},
+	}
+	for _, subnetID := range d.PublicSubnets {
+		f.RouteTables[1].Associations = append(f.RouteTables[1].Associations, &ec2.RouteTableAssociation{SubnetId: aws.String(subnetID)})
+	}
+	for i, nat := range f.NatGateways {
+		table := &ec2.RouteTable{
+			RouteTableId: aws.String(fmt.Sprintf("rtb-0b0000000000000%d", i)),
+			VpcId:        aws.String(d.VPCID),
+			Routes: []*ec2.Route{localRoute, {
+				DestinationCidrBlock: aws.String("0.0.0.0/0"),
+				NatGatewayId:         nat.NatGatewayId,
+				State:                aws.String(ec2.RouteStateActive),
+			}},
+			Tags: ec2Tags(d.commonTags()),
+		}
+		for j, subnetID := range d.PrivateSubnets {
+			if j%len(f.NatGateways) == i {
+				table.Associations = append(table.Associations, &ec2.RouteTableAssociation{SubnetId: aws.String(subnetID)})
+			}
+		}
+		f.RouteTables = append(f.RouteTables, table)
+	}
+
+	// ALB, listeners, target groups and rules
+	f.LoadBalancers = []*elbv2.LoadBalancer{{
+		LoadBalancerName: aws.String(d.ALBName),
+		LoadBalancerArn:  aws.String(d.ALBArn),
+		DNSName:          aws.String(d.ALBDNSName),
+		Type:             aws.String(elbv2.LoadBalancerTypeEnumApplication),
+		Scheme:           aws.String(elbv2.LoadBalancerSchemeEnumInternetFacing),
+		VpcId:            aws.String(d.VPCID),
+		SecurityGroups:   aws.StringSlice([]string{d.ALBSecurityGroupID}),
+	}}
+	f.ELBTags[d.ALBArn] = elbTags(d.commonTags())
+	f.LoadBalancerAttributes = map[string][]*elbv2.LoadBalancerAttribute{
+		d.ALBArn: {{Key: aws.String(utils.DeletionProtectionAttribute), Value: aws.String(strconv.FormatBool(d.Environment == "prod"))}},
+	}
+	f.Listeners = []*elbv2.Listener{
+		{
+			ListenerArn:     aws.String(strings.Replace(d.HTTPSListenerArn, "f2f7dc8efc522ab2", "0000000000000080", 1)),
+			LoadBalancerArn: aws.String(d.ALBArn),
+			Port:            aws.Int64(80),
+			Protocol:        aws.String(elbv2.ProtocolEnumHttp),
+			DefaultActions: []*elbv2.Action{{
+				Type: aws.String(elbv2.ActionTypeEnumRedirect),
+				RedirectConfig: &elbv2.RedirectActionConfig{
+					Port:       aws.String("443"),
+					Protocol:   aws.String("HTTPS"),
+					StatusCode: aws.String(elbv2.RedirectActionStatusCodeEnumHttp301),
+				},
+			}},
+		},
+		{
+			ListenerArn:     aws.String(d.HTTPSListenerArn),
+			LoadBalancerArn: aws.String(d.ALBArn),
+			Port:            aws.Int64(443),
+			Protocol:        aws.String(elbv2.ProtocolEnumHttps),
+			DefaultActions: []*elbv2.Action{{
+				Type: aws.String(elbv2.ActionTypeEnumFixedResponse),
+				FixedResponseConfig: &elbv2.FixedResponseActionConfig{
+					ContentType: aws.String("text/plain"),
+					MessageBody: aws.String("No routes matched"),
+					StatusCode:  aws.String("404"),
+				},
+			}},
+		},
+	}
+
+	rules := []*elbv2.Rule{{
+		Priority:  aws.String("default"),
+		IsDefault: aws.Bool(true),
+	}}
+	for _, name := range d.Apps.Names() {
+		app := d.Apps[name]
+		tgArn := d.TargetGroupArns[name]
+		f.TargetGroups = append(f.TargetGroups, &elbv2.TargetGroup{
+			TargetGroupArn:          aws.String(tgArn),
+			TargetGroupName:         aws.String(fmt.Sprintf("%s-%s-%s", d.ProjectName, d.Environment, name)),
+			Port:                    aws.Int64(int64(app.Port)),
+			Protocol:                aws.String(elbv2.ProtocolEnumHttp),
+			VpcId:                   aws.String(d.VPCID),
+			HealthCheckPath:         aws.String(app.HealthCheckURL),
+			HealthyThresholdCount:   aws.Int64(3),
+			UnhealthyThresholdCount: aws.Int64(3),
+			LoadBalancerArns:        aws.StringSlice([]string{d.ALBArn}),
+		})
+		f.ELBTags[tgArn] = elbTags(d.commonTags())
+		rules = append(rules, &elbv2.Rule{
+			RuleArn:  aws.String(fmt.Sprintf("%s/rule-%s", d.HTTPSListenerArn, name)),
+			Priority: aws.String(fmt.Sprint(app.Priority)),
+			Conditions: []*elbv2.RuleCondition{
+				{
+					Field:             aws.String("path-pattern"),
+					PathPatternConfig: &elbv2.PathPatternConditionConfig{Values: aws.StringSlice([]string{app.Path})},
+				},
+				{
+					Field:            aws.String("host-header"),
+					HostHeaderConfig: &elbv2.HostHeaderConditionConfig{Values: aws.StringSlice(app.Domain)},
+				},
+			},
+			Actions: []*elbv2.Action{{
+				Type:           aws.String(elbv2.ActionTypeEnumForward),
+				TargetGroupArn: aws.String(tgArn),
+			}},
+		})
+	}
+	f.Rules[d.HTTPSListenerArn] = rules
+
+	// Security groups
+	f.SecurityGroups = []*ec2.SecurityGroup{
+		{
+			GroupId:   aws.String(d.ALBSecurityGroupID),
+			GroupName: aws.String(d.ALBName),
+			VpcId:     aws.String(d.VPCID),
+			IpPermissions: []*ec2.IpPermission{
+				tcpFromCIDR(80, "0.0.0.0/0"),
+				tcpFromCIDR(443, "0.0.0.0/0"),
+			},
+			IpPermissionsEgress: []*ec2.IpPermission{allTrafficTo("0.0.0.0/0")},
+			Tags:                ec2Tags(d.commonTags()),
+		},
+	}
+	ec2SG := &ec2.SecurityGroup{
+		GroupId:             aws.String(d.EC2SecurityGroupID),
+		GroupName:           aws.String(fmt.Sprintf("%s-%s-ec2-sg", d.ProjectName, d.Environment)),
+		VpcId:               aws.String(d.VPCID),
+		IpPermissionsEgress: []*ec2.IpPermission{allTrafficTo("0.0.0.0/0")},
+		Tags: ec2Tags(map[string]string{
+			"Name":        fmt.Sprintf("%s-%s-ec2-sg", d.ProjectName, d.Environment),
+			"Environment": d.Environment,
+			"Project":     d.ProjectName,
+			"ManagedBy":   "terraform",
+		}),
+	}
+	for _, name := range d.Apps.Names() {
+		port := int64(d.Apps[name].Port)
+		ec2SG.IpPermissions = append(ec2SG.IpPermissions, &ec2.IpPermission{
+			FromPort:         aws.Int64(port),
+			ToPort:           aws.Int64(port),
+			IpProtocol:       aws.String("tcp"),
+			UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String(d.ALBSecurityGroupID)}},
+		})
+	}
+	f.SecurityGroups = append(f.SecurityGroups, ec2SG)
+
+	// Launch template and autoscaling group
+	instanceTags := d.commonTags()
+	f.LaunchTemplates = []*ec2.LaunchTemplate{{
+		LaunchTemplateId:     aws.String(d.LaunchTemplateID),
+		LaunchTemplateName:   aws.String(fmt.Sprintf("%s-%s20240101000000000000000001", d.ProjectName, d.Environment)),
+		LatestVersionNumber:  aws.Int64(1),
+		DefaultVersionNumber: aws.Int64(1),
+		Tags:                 ec2Tags(instanceTags),
+	}}
+	f.LaunchTemplateVersions = []*ec2.LaunchTemplateVersion{{
+		LaunchTemplateId: aws.String(d.LaunchTemplateID),
+		VersionNumber:    aws.Int64(1),
+		DefaultVersion:   aws.Bool(true),
+		LaunchTemplateData: &ec2.ResponseLaunchTemplateData{
+			InstanceType: aws.String(d.InstanceType),
+			BlockDeviceMappings: []*ec2.LaunchTemplateBlockDeviceMapping{{
+				DeviceName: aws.String("/dev/xvda"),
+				Ebs: &ec2.LaunchTemplateEbsBlockDevice{
+					VolumeSize: aws.Int64(30),
+					VolumeType: aws.String(ec2.VolumeTypeGp3),
+				},
+			}},
+			NetworkInterfaces: []*ec2.LaunchTemplateInstanceNetworkInterfaceSpecification{{
+				AssociatePublicIpAddress: aws.Bool(false),
+				Groups:                   aws.StringSlice([]string{d.EC2SecurityGroupID}),
+			}},
+			MetadataOptions: &ec2.LaunchTemplateInstanceMetadataOptions{HttpTokens: aws.String(ec2.LaunchTemplateHttpTokensStateRequired)},
+			TagSpecifications: []*ec2.LaunchTemplateTagSpecification{{
+				ResourceType: aws.String(ec2.ResourceTypeInstance),
+				Tags:         ec2Tags(instanceTags),
+			}},
+		},
+	}}
+
+	var tgARNs []string
+	for _, name := range d.Apps.Names() {
+		tgARNs = append(tgARNs, d.TargetGroupArns[name])
+	}
+	group := &autoscaling.Group{
+		AutoScalingGroupName: aws.String(d.ASGName),
+		DesiredCapacity:      aws.Int64(int64(d.InstanceCount)),
+		MinSize:              aws.Int64(int64(d.InstanceCount)),
+		MaxSize:              aws.Int64(int64(d.InstanceCount * 2)),
+		VPCZoneIdentifier:    aws.String(strings.Join(d.PrivateSubnets, ",")),
+		TargetGroupARNs:      aws.StringSlice(tgARNs),
+		CreatedTime:          aws.Time(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Tags:                 asgTags(d.ASGName, instanceTags),
+		LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+			LaunchTemplateId: aws.String(d.LaunchTemplateID),
+			Version:          aws.String("$Latest"),
+		},
+	}
+	for i := 0; i < d.InstanceCount; i++ {
+		instanceID := fmt.Sprintf("i-0f0000000000000%d", i)
+		subnet := d.PrivateSubnets[i%len(d.PrivateSubnets)]
+		f.Instances = append(f.Instances, &ec2.Instance{
+			InstanceId:   aws.String(instanceID),
+			InstanceType: aws.String(d.InstanceType),
+			VpcId:        aws.String(d.VPCID),
+			SubnetId:     aws.String(subnet),
+			LaunchTime:   aws.Time(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+			State:        &ec2.InstanceState{Code: aws.Int64(16), Name: aws.String(ec2.InstanceStateNameRunning)},
+			Tags:         ec2Tags(instanceTags),
+		})
+		group.Instances = append(group.Instances, &autoscaling.Instance{
+			InstanceId:       aws.String(instanceID),
+			AvailabilityZone: aws.String(azs[i%len(azs)]),
+			LifecycleState:   aws.String(autoscaling.LifecycleStateInService),
+			HealthStatus:     aws.String("Healthy"),
+		})
+		for _, tgArn := range tgARNs {
+			f.TargetHealth[tgArn] = append(f.TargetHealth[tgArn], &elbv2.TargetHealthDescription{
+				Target:       &elbv2.TargetDescription{Id: aws.String(instanceID)},
+				TargetHealth: &elbv2.TargetHealth{State: aws.String(elbv2.TargetHealthStateEnumHealthy)},
+			})
+		}
+	}
+	f.AutoScalingGroups = []*autoscaling.Group{group}
+
+	// IAM
+	f.Roles = []*iam.Role{{
+		RoleName:                 aws.String(d.RoleName),
+		Arn:                      aws.String("arn:aws:iam::123456789012:role/" + d.RoleName),
+		AssumeRolePolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[{"Action":"sts:AssumeRole","Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"}}]}`),
+		Tags:                     iamTags(d.commonTags()),
+	}}
+	f.AttachedRolePolicies[d.RoleName] = []*iam.AttachedPolicy{{
+		PolicyName: aws.String("AmazonS3ReadOnlyAccess"),
+		PolicyArn:  aws.String("arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"),
+	}}
+
+	return f
+}
+
+// stateResource renders a resource as `terraform show -json` does
+func stateResource(module, resourceType, name string, index interface{}, values map[string]interface{}) map[string]interface{} {
+	address := fmt.Sprintf("module.%s.%s.%s", module, resourceType, name)
+	if index != nil {
+		address += fmt.Sprintf("[%q]", index)
+	}
+	resource := map[string]interface{}{"address": address, "mode": "managed", "type": resourceType, "name": name, "values": values}
+	if index != nil {
+		resource["index"] = index
+	}
+	return resource
+}
+
+// StateJSON renders the state terraform recorded for the deployment's ALB and
+// compute resources, matching Fixtures
+func (d *fakeDeployment) StateJSON() string {
+	tags := d.commonTags()
+	alb := []interface{}{
+		stateResource("alb", "aws_lb", "main", nil, map[string]interface{}{
+			"name": d.ALBName, "arn": d.ALBArn, "internal": false, "enable_deletion_protection": d.Environment == "prod",
+			"security_groups": []string{d.ALBSecurityGroupID}, "vpc_id": d.VPCID, "tags_all": tags,
+		}),
+		stateResource("alb", "aws_lb_listener", "https", nil, map[string]interface{}{
+			"arn": d.HTTPSListenerArn, "protocol": "HTTPS", "port": 443,
+		}),
+		stateResource("alb", "aws_security_group", "alb", nil, map[string]interface{}{
+			"id": d.ALBSecurityGroupID,
+			"ingress": []interface{}{
+				map[string]interface{}{"from_port": 80, "to_port": 80, "protocol": "tcp", "cidr_blocks": []string{"0.0.0.0/0"}, "self": false},
+				map[string]interface{}{"from_port": 443, "to_port": 443, "protocol": "tcp", "cidr_blocks": []string{"0.0.0.0/0"}, "self": false},
+			},
+			"egress": []interface{}{
+				map[string]interface{}{"from_port": 0, "to_port": 0, "protocol": "-1", "cidr_blocks": []string{"0.0.0.0/0"}, "self": false},
+			},
+			"tags_all": tags,
+		}),
+	}
+	ec2Ingress := []interface{}{}
+	for _, name := range d.Apps.Names() {
+		app := d.Apps[name]
+		tgArn := d.TargetGroupArns[name]
+		ec2Ingress = append(ec2Ingress, map[string]interface{}{
+			"from_port": app.Port, "to_port": app.Port, "protocol": "tcp", "security_groups": []string{d.ALBSecurityGroupID}, "self": false,
+		})
+		alb = append(alb,
+			stateResource("alb", "aws_lb_target_group", "apps", name, map[string]interface{}{
+				"arn": tgArn, "port": app.Port, "protocol": "HTTP", "vpc_id": d.VPCID,
+				"health_check": []interface{}{map[string]interface{}{"path": app.HealthCheckURL, "healthy_threshold": 3, "unhealthy_threshold": 3}},
+				"tags_all":     tags,
+			}),
+			stateResource("alb", "aws_lb_listener_rule", "apps", name, map[string]interface{}{
+				"arn": fmt.Sprintf("%s/rule-%s", d.HTTPSListenerArn, name), "listener_arn": d.HTTPSListenerArn, "priority": app.Priority,
+				"action": []interface{}{map[string]interface{}{"type": "forward", "target_group_arn": tgArn}},
+				"condition": []interface{}{
+					map[string]interface{}{"path_pattern": []interface{}{map[string]interface{}{"values": []string{app.Path}}}, "host_header": []interface{}{}},
+					map[string]interface{}{"host_header": []interface{}{map[string]interface{}{"values": app.Domain}}, "path_pattern": []interface{}{}},
+				},
+			}))
+	}
+
+	var tgARNs []string
+	for _, name := range d.Apps.Names() {
+		tgARNs = append(tgARNs, d.TargetGroupArns[name])
+	}
+	var asgTags []interface{}
+	for key, value := range tags {
+		asgTags = append(asgTags, map[string]interface{}{"key": key, "value": value, "propagate_at_launch": true})
+	}
+	ec2SGName := fmt.Sprintf("%s-%s-ec2-sg", d.ProjectName, d.Environment)
+	compute := []interface{}{
+		stateResource("compute", "aws_security_group", "ec2", nil, map[string]interface{}{
+			"id":      d.EC2SecurityGroupID,
+			"ingress": ec2Ingress,
+			"egress": []interface{}{
+				map[string]interface{}{"from_port": 0, "to_port": 0, "protocol": "-1", "cidr_blocks": []string{"0.0.0.0/0"}, "self": false},
+			},
+			"tags_all": map[string]string{"Name": ec2SGName, "Environment": d.Environment, "Project": d.ProjectName, "ManagedBy": "terraform"},
+		}),
+		stateResource("compute", "aws_launch_template", "app", nil, map[string]interface{}{
+			"id": d.LaunchTemplateID, "latest_version": 1, "instance_type": d.InstanceType,
+			"block_device_mappings": []interface{}{map[string]interface{}{
+				"device_name": "/dev/xvda", "ebs": []interface{}{map[string]interface{}{"volume_size": 30, "volume_type": "gp3"}},
+			}},
+			// The provider stores associate_public_ip_address as a string
+			"network_interfaces": []interface{}{map[string]interface{}{
+				"associate_public_ip_address": "false", "security_groups": []string{d.EC2SecurityGroupID},
+			}},
+			"metadata_options":   []interface{}{map[string]interface{}{"http_tokens": "required"}},
+			"tag_specifications": []interface{}{map[string]interface{}{"resource_type": "instance", "tags": tags}},
+			"tags_all":           tags,
+		}),
+		stateResource("compute", "aws_autoscaling_group", "app", nil, map[string]interface{}{
+			"name": d.ASGName, "desired_capacity": d.InstanceCount, "min_size": d.InstanceCount, "max_size": d.InstanceCount * 2,
+			"vpc_zone_identifier": d.PrivateSubnets, "target_group_arns": tgARNs,
+			"launch_template": []interface{}{map[string]interface{}{"id": d.LaunchTemplateID, "version": "$Latest"}},
+			"tag":             asgTags,
+		}),
+	}
+
+	state, err := json.Marshal(map[string]interface{}{
+		"format_version": "1.0",
+		"values": map[string]interface{}{"root_module": map[string]interface{}{"child_modules": []interface{}{
+			map[string]interface{}{"address": "module.alb", "resources": alb},
+			map[string]interface{}{"address": "module.compute", "resources": compute},
+		}}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return string(state)
+}
+
+// outputs returns the outputs of the complete example for the deployment
+func (d *fakeDeployment) outputs() utils.DeploymentOutputs {
+	return utils.DeploymentOutputs{
+		VPCID:                d.VPCID,
+		ALBName:              d.ALBName,
+		TargetGroupArns:      d.TargetGroupArns,
+		AutoScalingGroupName: d.ASGName,
+		LaunchTemplateID:     d.LaunchTemplateID,
+	}
+}
+
+func tcpFromCIDR(port int64, cidr string) *ec2.IpPermission {
+	return &ec2.IpPermission{
+		FromPort:   aws.Int64(port),
+		ToPort:     aws.Int64(port),
+		IpProtocol: aws.String("tcp"),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(cidr)}},
+	}
+}
+
+func allTrafficTo(cidr string) *ec2.IpPermission {
+	return &ec2.IpPermission{
+		FromPort:   aws.Int64(0),
+		ToPort:     aws.Int64(0),
+		IpProtocol: aws.String("-1"),
+		IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(cidr)}},
+	}
+}
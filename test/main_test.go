@@ -0,0 +1,44 @@
+package test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+
+	"test/utils"
+)
+
+var keepSharedFixtures = flag.Bool("keep-shared-fixtures", false,
+	"leave the shared VPC and ALB deployed after the tests, for debugging")
+
+var updateSnapshots = flag.Bool("update", false,
+	"rewrite the plan snapshots in testdata/snapshots instead of comparing against them")
+
+// sharedFixtures deploys the VPC, and the ALB for tests that need one, once per
+// region and environment instead of once per test
+var sharedFixtures = utils.NewSharedFixtures()
+
+// loadTestMatrix loads the cases the module tests run, see utils.MatrixFile
+func loadTestMatrix(t *testing.T) *utils.Matrix {
+	matrix, err := utils.LoadMatrix(utils.MatrixFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matrix
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if _, err := utils.TestModeE(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	// Skipping the teardown stage keeps everything for the next run to validate
+	sharedFixtures.Keep = *keepSharedFixtures || utils.StageSkipped(utils.StageTeardown)
+
+	code := m.Run()
+
+	sharedFixtures.Close(os.Stdout)
+	os.Exit(code)
+}
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/routing"
+	"test/utils"
+)
+
+// The checks in this file mirror the apply-mode assertions of each module test,
+// but run against the output of `terraform show -json` so nothing is deployed.
+// They are used when TERRATEST_MODE=plan or the suite is built with `-tags plan`.
+
+func validateVPCPlan(t *testing.T, plan *terraform.PlanStruct, environment, projectName, vpcCidr string) {
+	vpc := utils.ParseVPCPlan(plan)
+
+	assert.Equal(t, vpcCidr, vpc.CIDR)
+	assert.True(t, vpc.EnableDNSHostnames, "VPC should have DNS hostnames enabled")
+	assert.True(t, vpc.EnableDNSSupport, "VPC should have DNS support enabled")
+
+	// Verify number of subnets
+	require.Len(t, vpc.PrivateSubnets, 3, "Should have 3 private subnets")
+	require.Len(t, vpc.PublicSubnets, 3, "Should have 3 public subnets")
+
+	utils.AssertTagPolicy(t, utils.RequiredTags(environment, projectName), utils.PlanTaggedResources(plan,
+		"aws_vpc", "aws_subnet", "aws_internet_gateway", "aws_nat_gateway", "aws_eip", "aws_route_table", "aws_flow_log")...)
+
+	privateAZs := make(map[string]bool)
+	for _, subnet := range vpc.PrivateSubnets {
+		assert.False(t, subnet.MapPublicIPOnLaunch, "Private subnet %s should not map public IPs", subnet.Address)
+		privateAZs[subnet.AvailabilityZone] = true
+	}
+
+	publicAZs := make(map[string]bool)
+	for _, subnet := range vpc.PublicSubnets {
+		assert.True(t, subnet.MapPublicIPOnLaunch, "Public subnet %s should map public IPs", subnet.Address)
+		publicAZs[subnet.AvailabilityZone] = true
+	}
+
+	// Verify subnets are in different AZs
+	assert.Equal(t, 3, len(privateAZs), "Private subnets should be in different AZs")
+	assert.Equal(t, 3, len(publicAZs), "Public subnets should be in different AZs")
+
+	if environment == "prod" {
+		assert.Equal(t, 3, vpc.NATGateways, "Production should have one NAT Gateway per AZ")
+	} else {
+		assert.Equal(t, 1, vpc.NATGateways, "Non-production should have a single NAT Gateway")
+	}
+
+	assert.NotZero(t, vpc.FlowLogs, "VPC should have flow logs enabled")
+}
+
+func validateALBPlan(t *testing.T, plan *terraform.PlanStruct, environment, projectName string, apps utils.Apps) {
+	alb := utils.ParseALBPlan(plan)
+
+	assert.Equal(t, "application", alb.LoadBalancerType)
+	assert.False(t, alb.Internal, "ALB should be internet facing")
+	assert.Equal(t, environment == "prod", alb.EnableDeletionProtection)
+	utils.AssertTagPolicy(t, utils.RequiredTags(environment, projectName), utils.PlanTaggedResources(plan,
+		"aws_lb", "aws_lb_target_group", "aws_lb_listener", "aws_lb_listener_rule", "aws_security_group")...)
+
+	require.Len(t, alb.TargetGroups, len(apps), "Should have one target group per app")
+	require.Len(t, alb.ListenerRules, len(apps), "Should have one listener rule per app")
+	utils.AssertNoRuleConflicts(t, utils.RulesFromApps(apps))
+	router := routing.New(apps)
+
+	albSG := planSecurityGroup(t, plan, "alb")
+	internet := utils.FromCIDR(utils.Internet)
+	utils.AssertReachability(t, utils.NewSecurityGraph(albSG),
+		utils.Reach(internet, albSG.ID, 80, 443),
+		utils.NoReach(internet, albSG.ID, 22),
+	)
+
+	for appName, app := range apps {
+		tg, ok := alb.TargetGroups[appName]
+		if assert.True(t, ok, "No target group planned for app %s", appName) {
+			assert.Equal(t, "HTTP", tg.Protocol)
+			assert.Equal(t, app.Port, tg.Port)
+			assert.Equal(t, app.HealthCheckURL, tg.HealthCheckPath)
+			assert.Equal(t, 3, tg.HealthyThreshold)
+			assert.Equal(t, 3, tg.UnhealthyThreshold)
+		}
+
+		rule, ok := alb.ListenerRules[appName]
+		if !assert.True(t, ok, "No listener rule planned for app %s", appName) {
+			continue
+		}
+		assert.Equal(t, app.Priority, rule.Priority, "Priority mismatch for app %s", appName)
+		require.NotEmpty(t, rule.PathPatterns, "Path pattern condition not found for app %s", appName)
+		assert.Equal(t, app.Path, rule.PathPatterns[0], "Path pattern mismatch for app %s", appName)
+		require.NotEmpty(t, rule.HostHeaders, "Host header condition not found for app %s", appName)
+		assert.Equal(t, app.Domain, rule.HostHeaders, "Host header mismatch for app %s", appName)
+
+		// Health checks go straight to the instances, but the endpoint should also be
+		// reachable through the ALB on every domain of the app
+		for _, domain := range app.Domain {
+			if strings.ContainsAny(domain, "*?") {
+				continue
+			}
+			result, err := router.Route("https://" + domain + app.HealthCheckURL)
+			require.NoError(t, err)
+			assert.Equal(t, appName, result.App, "https://%s%s should be served by app %s, got %s",
+				domain, app.HealthCheckURL, appName, result)
+		}
+	}
+}
+
+// validateComputePlan checks the compute module's plan. albSecurityGroupID is the
+// ALB security group passed to the module, empty when it is only known after apply.
+func validateComputePlan(t *testing.T, plan *terraform.PlanStruct, environment, projectName, instanceType string, instanceCount int,
+	apps utils.Apps, albSecurityGroupID string) {
+	compute := utils.ParseComputePlan(plan)
+
+	// Verify launch template
+	lt := compute.LaunchTemplate
+	assert.Equal(t, instanceType, lt.InstanceType)
+	require.Len(t, lt.Volumes, 1)
+	assert.Equal(t, 30, lt.Volumes[0].VolumeSize)
+	assert.Equal(t, "gp3", lt.Volumes[0].VolumeType)
+	utils.AssertTagPolicy(t, utils.RequiredTags(environment, projectName), utils.PlanTaggedResources(plan,
+		"aws_launch_template", "aws_autoscaling_group", "aws_iam_role", "aws_iam_instance_profile", "aws_security_group")...)
+
+	// Verify instance count
+	asg := compute.AutoScalingGroup
+	assert.Equal(t, instanceCount, asg.DesiredCapacity)
+	assert.Equal(t, instanceCount, asg.MinSize)
+	assert.Equal(t, instanceCount*2, asg.MaxSize)
+
+	// Verify only the ALB can reach the instances, on the app ports. The ALB group
+	// is outside the plan, so it is assumed to allow all egress like the ALB module.
+	ec2SG := planSecurityGroup(t, plan, "ec2")
+	internet := utils.FromCIDR(utils.Internet)
+	expectations := [][]utils.Reachability{utils.NoReach(internet, ec2SG.ID, append(apps.Ports(), 22)...)}
+	if albSecurityGroupID != "" {
+		alb := utils.SecurityGroupModel{
+			ID:     albSecurityGroupID,
+			Egress: []utils.SecurityGroupRule{{Protocol: "-1", CIDRs: []string{utils.Internet}}},
+		}
+		source := utils.FromGroup(albSecurityGroupID)
+		expectations = append(expectations, utils.Reach(source, ec2SG.ID, apps.Ports()...), utils.NoReach(source, ec2SG.ID, 22))
+		utils.AssertReachability(t, utils.NewSecurityGraph(ec2SG, alb), expectations...)
+		return
+	}
+	utils.AssertReachability(t, utils.NewSecurityGraph(ec2SG), expectations...)
+}
+
+// planSecurityGroup returns the planned aws_security_group with the given name
+func planSecurityGroup(t *testing.T, plan *terraform.PlanStruct, name string) utils.SecurityGroupModel {
+	for _, group := range utils.SecurityGroupsFromPlan(plan) {
+		if group.Address == "aws_security_group."+name || strings.HasSuffix(group.Address, ".aws_security_group."+name) {
+			return group
+		}
+	}
+	require.FailNow(t, "Security group not found in plan", "aws_security_group.%s", name)
+	return utils.SecurityGroupModel{}
+}
+
+// planVariable returns the value of an input variable recorded in the plan
+func planVariable(t *testing.T, plan *terraform.PlanStruct, name string) interface{} {
+	variable, ok := plan.RawPlan.Variables[name]
+	require.True(t, ok, "Variable %s not found in plan", name)
+	return variable.Value
+}
+
+// planApps returns the `apps` input variable recorded in the plan
+func planApps(t *testing.T, plan *terraform.PlanStruct) utils.Apps {
+	apps, err := utils.AppsFromValue(planVariable(t, plan, "apps"))
+	require.NoError(t, err)
+	return apps
+}
@@ -0,0 +1,236 @@
+package routing
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"test/utils"
+)
+
+// unmatchedPath is requested on every domain to check the listener's default action
+const unmatchedPath = "/terratest-no-such-route"
+
+// Probe is a request sent through the ALB and the result the router predicts for it
+type Probe struct {
+	// Description names the probe in reports, e.g. "app1 health check on merkata.cloudns.be"
+	Description string
+	Scheme      string
+	Host        string
+	Path        string
+	Expected    Result
+	// RequireOK demands a 200 from the target rather than any response it produced
+	RequireOK bool
+}
+
+// Prober sends probes to the HTTP and HTTPS listeners of an ALB, with the Host
+// header of the app under test
+type Prober struct {
+	// HTTPURL and HTTPSURL are the base URLs of the listeners, e.g. http://<alb_dns_name>
+	HTTPURL  string
+	HTTPSURL string
+	// Client sends the probes. It must not follow redirects.
+	Client *http.Client
+	Router *Router
+	Apps   utils.Apps
+}
+
+// NewProber probes the ALB with the given DNS name. The certificate is not verified,
+// as the probes are sent to the ALB's name rather than the apps' domains.
+func NewProber(albDNSName string, apps utils.Apps) *Prober {
+	return &Prober{
+		HTTPURL:  "http://" + albDNSName,
+		HTTPSURL: "https://" + albDNSName,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		Router: New(apps),
+		Apps:   apps,
+	}
+}
+
+// Probes returns, for every app and each of its domains, a plain HTTP request that
+// must be redirected, requests for the app's path and health check that must reach
+// its targets and a request for a path no rule matches
+func (p *Prober) Probes() ([]Probe, error) {
+	var probes []Probe
+	add := func(description, scheme, host, path string, requireOK bool) error {
+		expected, err := p.Router.Route(scheme + "://" + host + path)
+		if err != nil {
+			return err
+		}
+		probes = append(probes, Probe{
+			Description: description,
+			Scheme:      scheme,
+			Host:        host,
+			Path:        path,
+			Expected:    expected,
+			RequireOK:   requireOK,
+		})
+		return nil
+	}
+
+	unmatched := make(map[string]bool)
+	for _, name := range p.Apps.Names() {
+		app := p.Apps[name]
+		path := SamplePath(app.Path)
+		for _, domain := range app.Domain {
+			// A wildcard domain has no single host to send
+			if strings.ContainsAny(domain, "*?") {
+				continue
+			}
+			if err := add(fmt.Sprintf("%s over http on %s", name, domain), "http", domain, path, false); err != nil {
+				return nil, err
+			}
+			if err := add(fmt.Sprintf("%s path on %s", name, domain), "https", domain, path, false); err != nil {
+				return nil, err
+			}
+			if err := add(fmt.Sprintf("%s health check on %s", name, domain), "https", domain, app.HealthCheckURL, true); err != nil {
+				return nil, err
+			}
+			unmatched[domain] = true
+		}
+	}
+	for _, domain := range sortedKeys(unmatched) {
+		if err := add("unmatched path on "+domain, "https", domain, unmatchedPath, false); err != nil {
+			return nil, err
+		}
+	}
+	return probes, nil
+}
+
+// Send sends the probe and checks the response against the expected result
+func (p *Prober) Send(probe Probe) error {
+	base := p.HTTPSURL
+	if probe.Scheme == "http" {
+		base = p.HTTPURL
+	}
+	req, err := http.NewRequest(http.MethodGet, base+probe.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = probe.Host
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	got := fmt.Sprintf("got %d %q", resp.StatusCode, strings.TrimSpace(string(body)))
+
+	expected := probe.Expected
+	switch expected.Action {
+	case ActionRedirect:
+		location := resp.Header.Get("Location")
+		if resp.StatusCode != expected.StatusCode || !sameLocation(location, expected.Location) {
+			return fmt.Errorf("expected %s, got %d redirect to %q", expected, resp.StatusCode, location)
+		}
+	case ActionFixedResponse:
+		if resp.StatusCode != expected.StatusCode || strings.TrimSpace(string(body)) != expected.Body {
+			return fmt.Errorf("expected %s, %s", expected, got)
+		}
+	default:
+		// The ALB answers 502, 503 or 504 itself when no healthy target responded
+		switch {
+		case resp.StatusCode >= 500:
+			return fmt.Errorf("expected a healthy target of %s to respond, %s", expected.App, got)
+		case strings.TrimSpace(string(body)) == DefaultBody:
+			return fmt.Errorf("expected %s, got the listener's default response", expected)
+		case probe.RequireOK && resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("expected 200 from %s, %s", expected.App, got)
+		}
+	}
+	return nil
+}
+
+// sameLocation compares redirect targets, ignoring an explicit default port
+func sameLocation(actual, expected string) bool {
+	a, err := url.Parse(actual)
+	if err != nil {
+		return false
+	}
+	e, err := url.Parse(expected)
+	if err != nil {
+		return false
+	}
+	return a.Scheme == e.Scheme && a.Hostname() == e.Hostname() && a.Path == e.Path && a.RawQuery == e.RawQuery &&
+		portOrDefault(a) == portOrDefault(e)
+}
+
+// portOrDefault returns the port of u, the scheme's default when it has none
+func portOrDefault(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch u.Scheme {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	}
+	return ""
+}
+
+// AssertRouting sends every probe and reports all the ones that failed at once
+func AssertRouting(t utils.AssertT, prober *Prober) bool {
+	probes, err := prober.Probes()
+	if err != nil {
+		t.Errorf("cannot plan the routing probes: %v", err)
+		return false
+	}
+
+	var failures []string
+	for _, probe := range probes {
+		if err := prober.Send(probe); err != nil {
+			failures = append(failures, fmt.Sprintf("  %s (%s://%s%s): %v", probe.Description, probe.Scheme, probe.Host, probe.Path, err))
+		}
+	}
+	if len(failures) > 0 {
+		t.Errorf("%d of %d routing probes failed:\n%s", len(failures), len(probes), strings.Join(failures, "\n"))
+		return false
+	}
+	return true
+}
+
+// WaitForDNSE waits until the ALB's DNS name resolves, which takes a few minutes
+// after it is created
+func WaitForDNSE(albDNSName string, options utils.WaitOptions) error {
+	return utils.Poll(fmt.Sprintf("%s to resolve", albDNSName), options, func() (bool, string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		addresses, err := net.DefaultResolver.LookupHost(ctx, albDNSName)
+		if err != nil {
+			return false, "  " + err.Error(), nil
+		}
+		return len(addresses) > 0, "  no addresses", nil
+	})
+}
+
+// SamplePath returns a path matched by the path pattern, e.g. /app1/ for /app1/*
+func SamplePath(pattern string) string {
+	return strings.NewReplacer("*", "", "?", "x").Replace(pattern)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,173 @@
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/utils"
+)
+
+// recordingT collects the failures reported by AssertRouting
+type recordingT struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) FailNow()                                {}
+func (r *recordingT) Logf(format string, args ...interface{}) {}
+
+// fakeALB answers like the ALB module's listeners, with every app's targets
+// responding 200 unless broken lists the app
+func fakeALB(apps utils.Apps, broken map[string]int) http.Handler {
+	router := New(apps)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		result, err := router.RouteHTTPRequest(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch result.Action {
+		case ActionRedirect:
+			http.Redirect(w, req, result.Location, result.StatusCode)
+		case ActionFixedResponse:
+			w.Header().Set("Content-Type", result.ContentType)
+			w.WriteHeader(result.StatusCode)
+			fmt.Fprint(w, result.Body)
+		default:
+			if status, ok := broken[result.App]; ok {
+				w.WriteHeader(status)
+				return
+			}
+			fmt.Fprintf(w, "hello from %s", result.App)
+		}
+	})
+}
+
+// newTestProber points a prober at local HTTP and TLS servers
+func newTestProber(t *testing.T, apps utils.Apps, handler http.Handler) *Prober {
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+	httpsServer := httptest.NewTLSServer(handler)
+	t.Cleanup(httpsServer.Close)
+
+	prober := NewProber("unused", apps)
+	prober.HTTPURL = httpServer.URL
+	prober.HTTPSURL = httpsServer.URL
+	prober.Client = httpsServer.Client()
+	prober.Client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return prober
+}
+
+func TestProbes(t *testing.T) {
+	prober := NewProber("demo-ci-alb.elb.amazonaws.com", utils.DefaultApps())
+	probes, err := prober.Probes()
+	require.NoError(t, err)
+
+	var described []string
+	for _, probe := range probes {
+		described = append(described, fmt.Sprintf("%s://%s%s: %s", probe.Scheme, probe.Host, probe.Path, probe.Expected))
+	}
+	assert.Equal(t, []string{
+		"http://merkata.cloudns.be/app1/: 301 redirect to https://merkata.cloudns.be:443/app1/",
+		"https://merkata.cloudns.be/app1/: forward to app1 (priority 100)",
+		"https://merkata.cloudns.be/app1/status: forward to app1 (priority 100)",
+		"http://merkata.cloudns.be/app2/: 301 redirect to https://merkata.cloudns.be:443/app2/",
+		"https://merkata.cloudns.be/app2/: forward to app2 (priority 200)",
+		"https://merkata.cloudns.be/app2/status: forward to app2 (priority 200)",
+		"https://merkata.cloudns.be/terratest-no-such-route: 404 No routes matched",
+	}, described)
+}
+
+func TestAssertRoutingPasses(t *testing.T) {
+	apps := utils.DefaultApps()
+	prober := newTestProber(t, apps, fakeALB(apps, nil))
+
+	recorder := &recordingT{}
+	assert.True(t, AssertRouting(recorder, prober), "%v", recorder.errors)
+}
+
+func TestAssertRoutingReportsFailures(t *testing.T) {
+	apps := utils.DefaultApps()
+
+	testCases := []struct {
+		name     string
+		handler  http.Handler
+		reported []string
+	}{
+		{
+			name:    "no healthy targets",
+			handler: fakeALB(apps, map[string]int{"app2": http.StatusServiceUnavailable}),
+			reported: []string{
+				"app2 path on merkata.cloudns.be (https://merkata.cloudns.be/app2/): expected a healthy target of app2 to respond, got 503",
+				"app2 health check on merkata.cloudns.be (https://merkata.cloudns.be/app2/status): expected a healthy target of app2 to respond, got 503",
+			},
+		},
+		{
+			name:    "rule missing on the alb",
+			handler: fakeALB(utils.Apps{"app1": apps["app1"]}, nil),
+			reported: []string{
+				"app2 path on merkata.cloudns.be (https://merkata.cloudns.be/app2/): expected forward to app2 (priority 200), got the listener's default response",
+			},
+		},
+		{
+			name: "http served without redirect",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.TLS == nil {
+					fmt.Fprint(w, "plain")
+					return
+				}
+				fakeALB(apps, nil).ServeHTTP(w, req)
+			}),
+			reported: []string{
+				`app1 over http on merkata.cloudns.be (http://merkata.cloudns.be/app1/): expected 301 redirect to https://merkata.cloudns.be:443/app1/, got 200 redirect to ""`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+
+		t.Run(tc.name, func(t *testing.T) {
+			prober := newTestProber(t, apps, tc.handler)
+			recorder := &recordingT{}
+			require.False(t, AssertRouting(recorder, prober))
+			require.Len(t, recorder.errors, 1)
+			for _, failure := range tc.reported {
+				assert.True(t, strings.Contains(recorder.errors[0], failure), "%q not in:\n%s", failure, recorder.errors[0])
+			}
+		})
+	}
+}
+
+func TestSameLocation(t *testing.T) {
+	testCases := []struct {
+		actual, expected string
+		same             bool
+	}{
+		{"https://merkata.cloudns.be/app1/", "https://merkata.cloudns.be:443/app1/", true},
+		{"http://merkata.cloudns.be:80/app1/", "http://merkata.cloudns.be/app1/", true},
+		{"https://merkata.cloudns.be:8443/app1/", "https://merkata.cloudns.be:8443/app1/", true},
+		{"https://merkata.cloudns.be:8443/app1/", "https://merkata.cloudns.be:8/app1/", false},
+		{"https://merkata.cloudns.be:8443/app1/", "https://merkata.cloudns.be/app1/", false},
+		{"https://merkata.cloudns.be:80/app1/", "https://merkata.cloudns.be/app1/", false},
+		{"http://merkata.cloudns.be/app1/", "https://merkata.cloudns.be/app1/", false},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+		assert.Equal(t, tc.same, sameLocation(tc.actual, tc.expected), "%s and %s", tc.actual, tc.expected)
+	}
+}
@@ -0,0 +1,190 @@
+// Package routing replays the listeners of the ALB module in memory, so the
+// routing of an `apps` configuration can be checked without deploying it. It
+// follows the ALB's semantics: HTTP requests are redirected to HTTPS with a 301,
+// HTTPS requests go through the listener rules in priority order, matching the
+// host header case-insensitively and the path case-sensitively with the * and ?
+// wildcards, and requests no rule matches get the listener's 404 fixed response.
+//
+// A Prober sends the same requests through a deployed ALB, or any server standing
+// in for one, and checks each response against the router's prediction.
+package routing
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"test/utils"
+)
+
+// Actions a listener takes for a request
+const (
+	ActionForward       = "forward"
+	ActionRedirect      = "redirect"
+	ActionFixedResponse = "fixed-response"
+)
+
+// The default action of the HTTPS listener
+const (
+	DefaultStatusCode  = http.StatusNotFound
+	DefaultContentType = "text/plain"
+	DefaultBody        = "No routes matched"
+)
+
+// Result is what the ALB does with a request
+type Result struct {
+	Action string
+	// App is the app whose target group the request is forwarded to
+	App string
+	// Priority is the priority of the matching listener rule, 0 for a listener's default action
+	Priority int
+	// StatusCode, Location, ContentType and Body describe a redirect or fixed response
+	StatusCode  int
+	Location    string
+	ContentType string
+	Body        string
+}
+
+func (r Result) String() string {
+	switch r.Action {
+	case ActionForward:
+		return fmt.Sprintf("forward to %s (priority %d)", r.App, r.Priority)
+	case ActionRedirect:
+		return fmt.Sprintf("%d redirect to %s", r.StatusCode, r.Location)
+	default:
+		return fmt.Sprintf("%d %s", r.StatusCode, r.Body)
+	}
+}
+
+// Router routes requests like the listeners of the ALB module
+type Router struct {
+	rules []utils.ListenerRule
+}
+
+// New builds the router for the apps, as the ALB module would create their listener rules
+func New(apps utils.Apps) *Router {
+	rules := utils.RulesFromApps(apps)
+	// Rules sharing a priority are rejected by the ALB, the order between them is arbitrary
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+	return &Router{rules: rules}
+}
+
+// Route routes a request for the URL, e.g. https://merkata.cloudns.be/app2/foo
+func (r *Router) Route(rawURL string) (Result, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Result{}, err
+	}
+	if u.Host == "" {
+		return Result{}, fmt.Errorf("%s is not an absolute URL", rawURL)
+	}
+	return r.route(u.Scheme, u.Host, u)
+}
+
+// RouteHTTPRequest routes an incoming request, taking the host from its Host header
+func (r *Router) RouteHTTPRequest(req *http.Request) (Result, error) {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return r.route(scheme, req.Host, req.URL)
+}
+
+// route routes a request with the scheme and Host header for the URL's path and query
+func (r *Router) route(scheme, hostHeader string, u *url.URL) (Result, error) {
+	host, port := splitHostPort(hostHeader)
+	switch {
+	case scheme == "http" && (port == "" || port == "80"):
+		return redirectToHTTPS(host, u), nil
+	case scheme == "https" && (port == "" || port == "443"):
+		return r.match(host, pathOf(u)), nil
+	default:
+		return Result{}, fmt.Errorf("the ALB has no %s listener on port %s", scheme, port)
+	}
+}
+
+// redirectToHTTPS is the default action of the HTTP listener, which keeps the
+// host, path and query and only changes the protocol and port
+func redirectToHTTPS(host string, u *url.URL) Result {
+	location := url.URL{
+		Scheme:   "https",
+		Host:     net.JoinHostPort(host, "443"),
+		Path:     pathOf(u),
+		RawQuery: u.RawQuery,
+	}
+	return Result{Action: ActionRedirect, StatusCode: http.StatusMovedPermanently, Location: location.String()}
+}
+
+func (r *Router) match(host, path string) Result {
+	for _, rule := range r.rules {
+		if matchesAny(rule.Hosts, strings.ToLower(host), true) && matchesAny(rule.Paths, path, false) {
+			return Result{Action: ActionForward, App: rule.Name, Priority: rule.Priority}
+		}
+	}
+	return Result{
+		Action:      ActionFixedResponse,
+		StatusCode:  DefaultStatusCode,
+		ContentType: DefaultContentType,
+		Body:        DefaultBody,
+	}
+}
+
+// matchesAny reports whether value matches one of the patterns, or there are none
+func matchesAny(patterns []string, value string, foldCase bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if foldCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if Match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether value matches the ALB condition pattern, where * matches
+// any number of characters and ? exactly one
+func Match(pattern, value string) bool {
+	// Backtrack to the last * when a literal stops matching
+	p, v := 0, 0
+	star, resume := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, resume = p, v
+			p++
+		case star >= 0:
+			resume++
+			p, v = star+1, resume
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func splitHostPort(hostHeader string) (string, string) {
+	if host, port, err := net.SplitHostPort(hostHeader); err == nil {
+		return host, port
+	}
+	return hostHeader, ""
+}
+
+func pathOf(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
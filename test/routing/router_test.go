@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/utils"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern, value string
+		matches        bool
+	}{
+		{"/app1/*", "/app1/", true},
+		{"/app1/*", "/app1/foo/bar", true},
+		{"/app1/*", "/app1", false},
+		{"/app?/*", "/app2/foo", true},
+		{"/app?/*", "/app22/foo", false},
+		{"*.cloudns.be", "merkata.cloudns.be", true},
+		{"*.cloudns.be", "cloudns.be", false},
+		{"/*/status", "/app1/v2/status", true},
+		{"/app1/status", "/app1/Status", false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.matches, Match(tc.pattern, tc.value), "%q matches %q", tc.pattern, tc.value)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	apps := utils.DefaultApps()
+	apps["catchall"] = utils.AppConfig{Path: "/*", Domain: []string{"*.cloudns.be"}, Priority: 300}
+	router := New(apps)
+
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://merkata.cloudns.be/app1/", "forward to app1 (priority 100)"},
+		{"https://merkata.cloudns.be/app2/foo", "forward to app2 (priority 200)"},
+		{"https://MERKATA.cloudns.be:443/app2/foo?x=1", "forward to app2 (priority 200)"},
+		{"https://merkata.cloudns.be/app3/foo", "forward to catchall (priority 300)"},
+		{"https://merkata.cloudns.be/App1/", "forward to catchall (priority 300)"},
+		{"https://other.cloudns.be/app1/", "forward to catchall (priority 300)"},
+		{"https://example.com/app1/", "404 No routes matched"},
+		{"http://merkata.cloudns.be/app2/foo?x=1", "301 redirect to https://merkata.cloudns.be:443/app2/foo?x=1"},
+		{"http://merkata.cloudns.be", "301 redirect to https://merkata.cloudns.be:443/"},
+	}
+
+	for _, tc := range testCases {
+		result, err := router.Route(tc.url)
+		require.NoError(t, err, tc.url)
+		assert.Equal(t, tc.expected, result.String(), tc.url)
+	}
+
+	_, err := router.Route("https://merkata.cloudns.be:8443/app1/")
+	assert.EqualError(t, err, "the ALB has no https listener on port 8443")
+}
+
+func TestRouteHTTPRequest(t *testing.T) {
+	router := New(utils.DefaultApps())
+
+	req := httptest.NewRequest("GET", "/app1/status", nil)
+	req.Host = "merkata.cloudns.be"
+	result, err := router.RouteHTTPRequest(req)
+	require.NoError(t, err)
+	assert.Equal(t, ActionRedirect, result.Action)
+
+	req.TLS = &tls.ConnectionState{}
+	result, err = router.RouteHTTPRequest(req)
+	require.NoError(t, err)
+	assert.Equal(t, "app1", result.App)
+}
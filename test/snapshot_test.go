@@ -0,0 +1,75 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+
+	"test/utils"
+)
+
+// snapshotDir holds a plan snapshot per fixture of TestPlanSnapshots
+const snapshotDir = "testdata/snapshots"
+
+// TestPlanSnapshots plans every module and the complete example with fixed inputs
+// and compares what they would create with the snapshots checked in next to the
+// tests, so any change to a module shows up as a diff to review. It only plans,
+// whatever TERRATEST_MODE is. Accept a change by rewriting the snapshots:
+//
+//	go test -run TestPlanSnapshots -update
+func TestPlanSnapshots(t *testing.T) {
+	t.Parallel()
+
+	const (
+		region      = "us-east-1"
+		environment = "ci"
+		projectName = "snapshot"
+	)
+	apps := utils.DefaultApps()
+
+	fixtures := []struct {
+		name    string
+		dir     string
+		options *terraform.Options
+	}{
+		{"vpc", "modules/vpc", utils.CreateVPC(t, region, environment, projectName, "10.0.0.0/16")},
+		{"alb", "modules/alb", utils.CreateALB(t, region, environment, projectName,
+			utils.PlanVPCID, utils.PlanPublicSubnets(), apps, utils.PlanCertificateArn)},
+		{"compute", "modules/compute", &terraform.Options{
+			Vars: map[string]interface{}{
+				"environment":           environment,
+				"project_name":          projectName,
+				"vpc_id":                utils.PlanVPCID,
+				"private_subnets":       utils.PlanPrivateSubnets(),
+				"instance_type":         "t3.micro",
+				"instance_count":        2,
+				"apps":                  apps.ToVars(),
+				"target_group_arns":     utils.PlanTargetGroupArns(region, apps.Names()),
+				"alb_security_group_id": utils.PlanALBSecurityGroupID,
+			},
+			EnvVars: map[string]string{
+				"AWS_DEFAULT_REGION": region,
+			},
+		}},
+		// The example's own terraform.tfvars are the inputs
+		{"complete", "examples/complete", &terraform.Options{
+			EnvVars: map[string]string{
+				"AWS_DEFAULT_REGION": region,
+			},
+		}},
+	}
+
+	for _, testFixture := range fixtures {
+		fixture := testFixture
+
+		t.Run(fixture.name, func(t *testing.T) {
+			t.Parallel()
+
+			fixture.options.TerraformDir = test_structure.CopyTerraformFolderToTemp(t, "../", fixture.dir)
+			plan := utils.InitAndPlanOffline(t, fixture.options, t.TempDir())
+			utils.AssertPlanSnapshot(t, plan, filepath.Join(snapshotDir, fixture.name+".json"), *updateSnapshots)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/require"
+
+	"test/utils"
+)
+
+// TestUpgradePath deploys the complete example as it is on the base branch, then
+// plans the working tree against the same state: upgrading an environment must
+// not destroy or replace its network, load balancer or target groups.
+func TestUpgradePath(t *testing.T) {
+	t.Parallel()
+
+	loadTestMatrix(t).Run(t, utils.MatrixTestUpgrade, func(t *testing.T, testCase utils.MatrixCase) {
+		if utils.IsPlanMode() {
+			t.Skip("the upgrade path needs the base branch deployed")
+		}
+
+		baseRef := utils.UpgradeBaseRef()
+		if !utils.GitRefExists(".", baseRef) {
+			t.Skipf("base ref %s not found: fetch it, or set %s to a ref that exists", baseRef, utils.UpgradeBaseRefEnvVar)
+		}
+		changed, err := utils.ChangedSinceE(".", baseRef, "modules", "examples/complete")
+		require.NoError(t, err)
+		if !changed {
+			t.Skipf("modules unchanged since %s", baseRef)
+		}
+
+		// Export the base branch's modules next to its example, so its relative
+		// module sources resolve
+		baseRoot := t.TempDir()
+		require.NoError(t, utils.ExportGitRefE(".", baseRef, baseRoot, "modules", "examples/complete"))
+		baseDir := filepath.Join(baseRoot, "examples", "complete")
+		workingDir := test_structure.CopyTerraformFolderToTemp(t, "../", "examples/complete")
+
+		if testCase.ProjectName == "" {
+			testCase.ProjectName = "upg" + strings.ToLower(random.UniqueId())
+		}
+		apps, err := utils.AppsFromVarFile(t, filepath.Join(baseDir, "terraform.tfvars"))
+		require.NoError(t, err)
+		vars := map[string]interface{}{
+			"environment":  testCase.Environment,
+			"project_name": testCase.ProjectName,
+			"certificate_arn": utils.ImportTestCertificate(t, utils.CreateClients(testCase.Region).ACM,
+				apps.Domains(), map[string]string{"Environment": testCase.Environment, "Project": testCase.ProjectName}),
+		}
+		envVars := map[string]string{"AWS_DEFAULT_REGION": testCase.Region}
+
+		baseOptions := &terraform.Options{TerraformDir: baseDir, Vars: vars, EnvVars: envVars}
+		upgradeOptions := &terraform.Options{TerraformDir: workingDir, Vars: vars, EnvVars: envVars}
+
+		// Destroy from whichever configuration holds the state by then
+		stateOptions := baseOptions
+		defer func() {
+			utils.Destroy(t, stateOptions)
+		}()
+
+		terraform.InitAndApply(t, baseOptions)
+
+		state, err := os.ReadFile(filepath.Join(baseDir, "terraform.tfstate"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(workingDir, "terraform.tfstate"), state, 0o600))
+		terraform.Init(t, upgradeOptions)
+		stateOptions = upgradeOptions
+
+		plan := utils.InitAndPlan(t, upgradeOptions, t.TempDir())
+		t.Logf("Upgrading from %s:\n%s", baseRef, utils.FormatPendingChanges(utils.PendingChanges(plan)))
+		utils.AssertNoDestructiveChanges(t, plan, utils.ProtectedResourceTypes...)
+	})
+}
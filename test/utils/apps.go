@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// AppConfig mirrors one entry of the `apps` variable of the ALB and compute modules
+type AppConfig struct {
+	Port           int      `json:"port"`
+	Path           string   `json:"path"`
+	HealthCheckURL string   `json:"health_check_url"`
+	Domain         []string `json:"domain"`
+	Priority       int      `json:"priority"`
+}
+
+// Apps maps app names to their configuration, like the `apps` variable
+type Apps map[string]AppConfig
+
+// DefaultApps returns the app set used throughout the test suite
+func DefaultApps() Apps {
+	return Apps{
+		"app1": {
+			Port:           8085,
+			Path:           "/app1/*",
+			HealthCheckURL: "/app1/status",
+			Domain:         []string{"merkata.cloudns.be"},
+			Priority:       100,
+		},
+		"app2": {
+			Port:           8086,
+			Path:           "/app2/*",
+			HealthCheckURL: "/app2/status",
+			Domain:         []string{"merkata.cloudns.be"},
+			Priority:       200,
+		},
+	}
+}
+
+// ToVar converts the app to the object shape expected by terraform
+func (a AppConfig) ToVar() map[string]interface{} {
+	return map[string]interface{}{
+		"port":             a.Port,
+		"path":             a.Path,
+		"health_check_url": a.HealthCheckURL,
+		"domain":           a.Domain,
+		"priority":         a.Priority,
+	}
+}
+
+// Validate checks the app against the constraints enforced by the ALB and compute modules
+func (a AppConfig) Validate() error {
+	var problems []string
+	if a.Port < 1 || a.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %d is out of range 1-65535", a.Port))
+	}
+	if !strings.HasPrefix(a.Path, "/") {
+		problems = append(problems, fmt.Sprintf("path %q must start with /", a.Path))
+	}
+	if !strings.HasPrefix(a.HealthCheckURL, "/") {
+		problems = append(problems, fmt.Sprintf("health_check_url %q must start with /", a.HealthCheckURL))
+	}
+	if len(a.Domain) == 0 {
+		problems = append(problems, "domain must contain at least one host")
+	}
+	for _, domain := range a.Domain {
+		if strings.TrimSpace(domain) == "" {
+			problems = append(problems, "domain contains an empty host")
+		}
+	}
+	// Listener rule priorities are limited to 1-50000 by the ALB API
+	if a.Priority < 1 || a.Priority > 50000 {
+		problems = append(problems, fmt.Sprintf("priority %d is out of range 1-50000", a.Priority))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Names returns the app names in sorted order
+func (apps Apps) Names() []string {
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Domains returns the distinct domains of the apps, sorted
+func (apps Apps) Domains() []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, app := range apps {
+		for _, domain := range app.Domain {
+			if !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// Ports returns the distinct ports of the apps, sorted
+func (apps Apps) Ports() []int {
+	seen := make(map[int]bool)
+	var ports []int
+	for _, app := range apps {
+		if !seen[app.Port] {
+			seen[app.Port] = true
+			ports = append(ports, app.Port)
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// ToVars converts the apps to the map expected by the `apps` terraform variable
+func (apps Apps) ToVars() map[string]interface{} {
+	vars := make(map[string]interface{}, len(apps))
+	for name, app := range apps {
+		vars[name] = app.ToVar()
+	}
+	return vars
+}
+
+// Validate checks every app and that no two apps share a listener rule priority
+func (apps Apps) Validate() error {
+	if len(apps) == 0 {
+		return fmt.Errorf("apps must contain at least one app")
+	}
+	var problems []string
+	priorities := make(map[int]string)
+	for _, name := range apps.Names() {
+		app := apps[name]
+		if err := app.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("app %s: %v", name, err))
+		}
+		if other, ok := priorities[app.Priority]; ok {
+			problems = append(problems, fmt.Sprintf("app %s: priority %d is already used by app %s", name, app.Priority, other))
+		}
+		priorities[app.Priority] = name
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid apps: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// AppsFromValue converts a decoded `apps` value, such as a plan variable or
+// module output, into Apps
+func AppsFromValue(value interface{}) (Apps, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var apps Apps
+	if err := json.Unmarshal(raw, &apps); err != nil {
+		return nil, fmt.Errorf("apps value has an unexpected shape: %v", err)
+	}
+	return apps, nil
+}
+
+// AppsFromVarFile reads the `apps` variable from a .tfvars or .tfvars.json file
+func AppsFromVarFile(t testing.TestingT, path string) (Apps, error) {
+	var vars map[string]interface{}
+	if err := terraform.GetAllVariablesFromVarFileE(t, path, &vars); err != nil {
+		return nil, err
+	}
+	value, ok := vars["apps"]
+	if !ok {
+		return nil, fmt.Errorf("%s does not set apps", path)
+	}
+	return AppsFromValue(value)
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppsValidate(t *testing.T) {
+	require.NoError(t, DefaultApps().Validate())
+
+	apps := DefaultApps()
+	app2 := apps["app2"]
+	app2.Priority = apps["app1"].Priority
+	app2.Path = "app2/*"
+	app2.Domain = nil
+	apps["app2"] = app2
+
+	err := apps.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `path "app2/*" must start with /`)
+	assert.Contains(t, err.Error(), "domain must contain at least one host")
+	assert.Contains(t, err.Error(), "priority 100 is already used by app app1")
+}
+
+func TestAppsFromValue(t *testing.T) {
+	// Plan JSON and terraform outputs decode numbers as float64 and lists as []interface{}
+	value := map[string]interface{}{
+		"app1": map[string]interface{}{
+			"port":             float64(8085),
+			"path":             "/app1/*",
+			"health_check_url": "/app1/status",
+			"domain":           []interface{}{"merkata.cloudns.be"},
+			"priority":         float64(100),
+		},
+	}
+
+	apps, err := AppsFromValue(value)
+	require.NoError(t, err)
+	assert.Equal(t, Apps{"app1": DefaultApps()["app1"]}, apps)
+	assert.Equal(t, 8085, apps.ToVars()["app1"].(map[string]interface{})["port"])
+}
@@ -2,82 +2,43 @@
 package utils
 
 import (
+	"os"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 )
 
-// CreateSession creates an AWS session for the specified region
-func CreateSession(region string) *session.Session {
-	return session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(region),
-	}))
-}
+// EndpointEnvVar overrides the endpoint of every client created by CreateSession,
+// e.g. to point the helpers at a local fake instead of AWS
+const EndpointEnvVar = "AWS_ENDPOINT_URL"
 
-// CreateEC2Client creates an EC2 client
-func CreateEC2Client(region string) *ec2.EC2 {
-	return ec2.New(CreateSession(region))
-}
-
-// CreateASGClient creates an AutoScaling client
-func CreateASGClient(region string) *autoscaling.AutoScaling {
-	return autoscaling.New(CreateSession(region))
-}
-
-// CreateIAMClient creates an IAM client
-func CreateIAMClient(region string) *iam.IAM {
-	return iam.New(CreateSession(region))
-}
-
-// Tag represents a key-value pair tag
-type Tag struct {
-	Key   string
-	Value string
-}
-
-// EC2Tag represents an EC2 tag
-type EC2Tag struct {
-	Tag *ec2.Tag
-}
-
-// ConvertEC2TagsToTags converts EC2 tags to our Tag structure
-func ConvertEC2TagsToTags(ec2Tags []*ec2.Tag) []Tag {
-	var tags []Tag
-	for _, tag := range ec2Tags {
-		tags = append(tags, Tag{
-			Key:   aws.StringValue(tag.Key),
-			Value: aws.StringValue(tag.Value),
-		})
-	}
-	return tags
+// CreateSession creates an AWS session for the specified region. If AWS_ENDPOINT_URL
+// is set, all clients built from the session send their requests there.
+func CreateSession(region string) *session.Session {
+	return CreateSessionWithEndpoint(region, os.Getenv(EndpointEnvVar))
 }
 
-// HasRequiredTags checks if all required tags are present in the given tags
-func HasRequiredTags(actual []Tag, required map[string]string) bool {
-	foundTags := make(map[string]bool)
-	for _, tag := range actual {
-		if expectedValue, ok := required[tag.Key]; ok {
-			if expectedValue == tag.Value {
-				foundTags[tag.Key] = true
-			}
-		}
+// CreateSessionWithEndpoint creates an AWS session for the specified region that
+// sends requests to a custom endpoint. An empty endpoint uses the AWS defaults.
+func CreateSessionWithEndpoint(region, endpoint string) *session.Session {
+	config := &aws.Config{
+		Region: aws.String(region),
 	}
-
-	// Check if all required tags were found with correct values
-	for key := range required {
-		if !foundTags[key] {
-			return false
-		}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
 	}
+	return session.Must(session.NewSession(config))
+}
 
-	return true
+// CreateEC2Client creates an EC2 client
+func CreateEC2Client(region string) EC2API {
+	return ec2.New(CreateSession(region))
 }
 
-// CreateALB creates a test ALB configuration
-func CreateALB(t TestingT, region, environment, projectName string, vpcID string, publicSubnets []string) *terraform.Options {
+// CreateALB creates a test ALB configuration serving the given certificate
+func CreateALB(t TestingT, region, environment, projectName string, vpcID string, publicSubnets []string, apps Apps, certificateArn string) *terraform.Options {
 	return &terraform.Options{
 		TerraformDir: "../modules/alb",
 		Vars: map[string]interface{}{
@@ -85,23 +46,8 @@ func CreateALB(t TestingT, region, environment, projectName string, vpcID string
 			"project_name":    projectName,
 			"vpc_id":          vpcID,
 			"public_subnets":  publicSubnets,
-			"certificate_arn": "arn:aws:acm:us-east-1:683721267198:certificate/aa67a8ae-f2fe-4cef-95e6-a676fd11f5be", // Replace with a valid certificate ARN for testing
-			"apps": map[string]interface{}{
-				"app1": map[string]interface{}{
-					"port":             8085,
-					"path":             "/app1/*",
-					"health_check_url": "/app1/status",
-					"domain":           []string{"merkata.cloudns.be"},
-					"priority":         100,
-				},
-				"app2": map[string]interface{}{
-					"port":             8086,
-					"path":             "/app2/*",
-					"health_check_url": "/app2/status",
-					"domain":           []string{"merkata.cloudns.be"},
-					"priority":         200,
-				},
-			},
+			"certificate_arn": certificateArn,
+			"apps":            apps.ToVars(),
 		},
 		EnvVars: map[string]string{
 			"AWS_DEFAULT_REGION": region,
@@ -110,13 +56,13 @@ func CreateALB(t TestingT, region, environment, projectName string, vpcID string
 }
 
 // CreateVPCTestConfig creates a test VPC configuration
-func CreateVPC(t TestingT, region, environment, projectName string) *terraform.Options {
+func CreateVPC(t TestingT, region, environment, projectName, vpcCIDR string) *terraform.Options {
 	return &terraform.Options{
 		TerraformDir: "../modules/vpc",
 		Vars: map[string]interface{}{
 			"environment":  environment,
 			"project_name": projectName,
-			"vpc_cidr":     "10.0.0.0/16",
+			"vpc_cidr":     vpcCIDR,
 		},
 		EnvVars: map[string]string{
 			"AWS_DEFAULT_REGION": region,
@@ -129,3 +75,11 @@ type TestingT interface {
 	Fatal(args ...interface{})
 	Fatalf(format string, args ...interface{})
 }
+
+// AssertT is the subset of testing.T used by the assertion helpers, so they can
+// also be run against a recording stand-in in unit tests
+type AssertT interface {
+	Errorf(format string, args ...interface{})
+	FailNow()
+	Logf(format string, args ...interface{})
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/acm"
+)
+
+// CertificateChain is a self-signed CA and a server certificate it issued, PEM encoded
+type CertificateChain struct {
+	Certificate []byte
+	PrivateKey  []byte
+	// Chain holds the CA certificate
+	Chain []byte
+}
+
+// GenerateCertificateChain creates a CA and a server certificate for the domains,
+// valid for the given duration. The first domain is the subject's common name.
+func GenerateCertificateChain(domains []string, validFor time.Duration) (*CertificateChain, error) {
+	if len(domains) == 0 {
+		return nil, errors.New("a certificate needs at least one domain")
+	}
+	// Backdated to tolerate clock skew
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(validFor)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "terratest CA", Organization: []string{"terratest"}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	// ACM accepts ECDSA P-256 keys, which are much faster to generate than RSA
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: domains[0], Organization: []string{"terratest"}},
+		DNSNames:     domains,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertificateChain{
+		Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		Chain:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+	}, nil
+}
+
+// ImportCertificateE imports the chain into ACM with the given tags and returns its ARN
+func ImportCertificateE(client ACMAPI, chain *CertificateChain, tags map[string]string) (string, error) {
+	input := &acm.ImportCertificateInput{
+		Certificate:      chain.Certificate,
+		PrivateKey:       chain.PrivateKey,
+		CertificateChain: chain.Chain,
+	}
+	for _, tag := range MapTags(tags) {
+		input.Tags = append(input.Tags, &acm.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+	}
+	output, err := client.ImportCertificate(input)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.CertificateArn), nil
+}
+
+// ImportSelfSignedCertificateE generates a certificate chain for the domains and
+// imports it into ACM, returning its ARN
+func ImportSelfSignedCertificateE(client ACMAPI, domains []string, validFor time.Duration, tags map[string]string) (string, error) {
+	chain, err := GenerateCertificateChain(domains, validFor)
+	if err != nil {
+		return "", err
+	}
+	return ImportCertificateE(client, chain, tags)
+}
+
+// DeleteCertificateE deletes the certificate, waiting for a load balancer that was
+// just destroyed to let go of it. A certificate that is already gone is not an error.
+func DeleteCertificateE(client ACMAPI, arn string, options WaitOptions) error {
+	return Poll(fmt.Sprintf("certificate %s to be deleted", arn), options, func() (bool, string, error) {
+		_, err := client.DeleteCertificate(&acm.DeleteCertificateInput{CertificateArn: aws.String(arn)})
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) {
+			switch awsErr.Code() {
+			case acm.ErrCodeResourceNotFoundException:
+				return true, "", nil
+			case acm.ErrCodeResourceInUseException:
+				return false, "  " + awsErr.Message(), nil
+			}
+		}
+		return err == nil, "", err
+	})
+}
+
+// CertificateDeleteWaitOptions allows for the minutes ACM takes to notice a
+// deleted listener no longer uses the certificate
+func CertificateDeleteWaitOptions() WaitOptions {
+	return WaitOptions{
+		Timeout:     10 * time.Minute,
+		Interval:    10 * time.Second,
+		MaxInterval: 30 * time.Second,
+		Backoff:     1.5,
+	}
+}
+
+// ImportTestCertificate imports a self-signed certificate for the domains and
+// deletes it in a cleanup, which runs after the test's deferred teardown and any
+// cleanup registered later, i.e. once whatever uses it is destroyed
+func ImportTestCertificate(t FixtureT, client ACMAPI, domains []string, tags map[string]string) string {
+	arn, err := ImportSelfSignedCertificateE(client, domains, 24*time.Hour, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Imported self-signed certificate %s for %v", arn, domains)
+
+	t.Cleanup(func() {
+		if err := DeleteCertificateE(client, arn, CertificateDeleteWaitOptions()); err != nil {
+			t.Errorf("Failed to delete certificate %s: %v", arn, err)
+		}
+	})
+	return arn
+}
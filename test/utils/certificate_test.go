@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/fakeaws"
+)
+
+func TestGenerateCertificateChain(t *testing.T) {
+	chain, err := GenerateCertificateChain([]string{"merkata.cloudns.be", "www.merkata.cloudns.be"}, time.Hour)
+	require.NoError(t, err)
+
+	// The key pair must match, as ACM and the ALB check it
+	_, err = tls.X509KeyPair(chain.Certificate, chain.PrivateKey)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(chain.Chain))
+	block, _ := pem.Decode(chain.Certificate)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	assert.Equal(t, "merkata.cloudns.be", leaf.Subject.CommonName)
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "www.merkata.cloudns.be", Roots: roots})
+	assert.NoError(t, err)
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots})
+	assert.Error(t, err)
+}
+
+func TestImportTestCertificate(t *testing.T) {
+	server := fakeaws.Start(t, nil)
+	client := CreateClients("us-east-1").ACM
+
+	var arn string
+	t.Run("consumer", func(t *testing.T) {
+		arn = ImportTestCertificate(t, client, DefaultApps().Domains(), map[string]string{"Project": "demo"})
+
+		output, err := client.DescribeCertificate(&acm.DescribeCertificateInput{CertificateArn: aws.String(arn)})
+		require.NoError(t, err)
+		assert.Equal(t, "merkata.cloudns.be", aws.StringValue(output.Certificate.DomainName))
+		assert.Equal(t, acm.CertificateTypeImported, aws.StringValue(output.Certificate.Type))
+	})
+
+	// Deleted once the test is done
+	_, err := client.DescribeCertificate(&acm.DescribeCertificateInput{CertificateArn: aws.String(arn)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), acm.ErrCodeResourceNotFoundException)
+	assert.Contains(t, server.Calls(), "acm:DeleteCertificate")
+}
+
+func TestDeleteCertificateWaitsForListeners(t *testing.T) {
+	server := fakeaws.Start(t, nil)
+	client := CreateClients("us-east-1").ACM
+
+	chain, err := GenerateCertificateChain([]string{"merkata.cloudns.be"}, time.Hour)
+	require.NoError(t, err)
+	arn, err := ImportCertificateE(client, chain, nil)
+	require.NoError(t, err)
+
+	listener := &elbv2.Listener{
+		LoadBalancerArn: aws.String("arn:alb"),
+		Certificates:    []*elbv2.Certificate{{CertificateArn: aws.String(arn)}},
+	}
+	server.Update(func(f *fakeaws.Fixtures) { f.Listeners = []*elbv2.Listener{listener} })
+
+	quick := WaitOptions{Timeout: 50 * time.Millisecond, Interval: 10 * time.Millisecond}
+	err = DeleteCertificateE(client, arn, quick)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "in use by arn:alb")
+
+	// The listener goes away while the delete is retried
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		server.Update(func(f *fakeaws.Fixtures) { f.Listeners = nil })
+	}()
+	require.NoError(t, DeleteCertificateE(client, arn, WaitOptions{Timeout: 2 * time.Second, Interval: 10 * time.Millisecond}))
+
+	// Deleting it again is not an error
+	require.NoError(t, DeleteCertificateE(client, arn, quick))
+}
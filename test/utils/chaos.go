@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// ChaosTarget is the Auto Scaling group a chaos test disrupts and the state it
+// must heal back to
+type ChaosTarget struct {
+	AutoScalingGroupName string
+	// TargetGroupArns are the target groups every instance must be healthy in,
+	// the target_group_arns of the compute module
+	TargetGroupArns []string
+	// Capacity is the number of InService instances, the instance_count of the
+	// compute module
+	Capacity int
+}
+
+// Fault disrupts one instance of the group
+type Fault struct {
+	// Name describes the fault in reports, e.g. "terminate"
+	Name   string
+	Inject func(instanceID string) error
+}
+
+// ChaosAPI is the AutoScaling call that takes an instance out of service. It is
+// kept out of AutoScalingAPI so that only a chaos test can disrupt a group.
+type ChaosAPI interface {
+	TerminateInstanceInAutoScalingGroup(*autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error)
+}
+
+var _ ChaosAPI = (*autoscaling.AutoScaling)(nil)
+
+// TerminateInstance terminates the instance through Auto Scaling without lowering
+// the desired capacity, so the group has to launch a replacement
+func TerminateInstance(client ChaosAPI) Fault {
+	return Fault{
+		Name: "terminate",
+		Inject: func(instanceID string) error {
+			_, err := client.TerminateInstanceInAutoScalingGroup(&autoscaling.TerminateInstanceInAutoScalingGroupInput{
+				InstanceId:                     aws.String(instanceID),
+				ShouldDecrementDesiredCapacity: aws.Bool(false),
+			})
+			return err
+		},
+	}
+}
+
+// RecoveryReport is the outcome of a chaos test
+type RecoveryReport struct {
+	Fault        string
+	Instance     string
+	Replacements []string
+	// TimeToRecover runs from the fault to the poll that saw the group healed,
+	// so it overshoots by up to one poll interval
+	TimeToRecover time.Duration
+}
+
+func (r RecoveryReport) String() string {
+	return fmt.Sprintf("%s %s: replaced by %s, recovered in %s",
+		r.Fault, r.Instance, strings.Join(r.Replacements, ", "), r.TimeToRecover.Round(time.Second))
+}
+
+// inServiceInstancesE returns the sorted IDs of the group's InService instances
+// and a line per instance describing its state
+func inServiceInstancesE(client AutoScalingAPI, asgName string) ([]string, []string, error) {
+	output, err := client.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(asgName)},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(output.AutoScalingGroups) == 0 {
+		return nil, nil, fmt.Errorf("auto scaling group %s not found", asgName)
+	}
+
+	var inService, lines []string
+	for _, instance := range output.AutoScalingGroups[0].Instances {
+		id := aws.StringValue(instance.InstanceId)
+		state := aws.StringValue(instance.LifecycleState)
+		if state == autoscaling.LifecycleStateInService {
+			inService = append(inService, id)
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s (%s)", id, state, aws.StringValue(instance.HealthStatus)))
+	}
+	sort.Strings(inService)
+	sort.Strings(lines)
+	return inService, lines, nil
+}
+
+// PickInServiceInstanceE chooses a random InService instance of the group, and
+// returns it along with all of them
+func PickInServiceInstanceE(client AutoScalingAPI, asgName string, rng *rand.Rand) (string, []string, error) {
+	inService, _, err := inServiceInstancesE(client, asgName)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(inService) == 0 {
+		return "", nil, fmt.Errorf("auto scaling group %s has no InService instances", asgName)
+	}
+	return inService[rng.Intn(len(inService))], inService, nil
+}
+
+// WaitForRecoveryE waits until the group is back to its capacity without the
+// disrupted instance, with at least one instance that was not in service before
+// the fault, and every InService instance is healthy in every target group. It
+// returns the new instances.
+func WaitForRecoveryE(clients *Clients, target ChaosTarget, disrupted string, before []string, options WaitOptions) ([]string, error) {
+	var replacements []string
+	description := fmt.Sprintf("auto scaling group %s to replace %s", target.AutoScalingGroupName, disrupted)
+	err := Poll(description, options, func() (bool, string, error) {
+		inService, lines, err := inServiceInstancesE(clients.AutoScaling, target.AutoScalingGroupName)
+		if err != nil {
+			return false, "", err
+		}
+		replacements = nil
+		for _, id := range inService {
+			if !contains(before, id) {
+				replacements = append(replacements, id)
+			}
+		}
+		done := len(inService) == target.Capacity && !contains(inService, disrupted) && len(replacements) > 0
+		lines = append([]string{fmt.Sprintf("  %d of %d instances InService", len(inService), target.Capacity)}, lines...)
+
+		for _, arn := range target.TargetGroupArns {
+			output, err := clients.ELBv2.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+				TargetGroupArn: aws.String(arn),
+			})
+			if err != nil {
+				return false, "", err
+			}
+			healthy := map[string]bool{}
+			for _, description := range output.TargetHealthDescriptions {
+				if description.TargetHealth != nil && aws.StringValue(description.TargetHealth.State) == elbv2.TargetHealthStateEnumHealthy {
+					healthy[aws.StringValue(description.Target.Id)] = true
+				}
+			}
+			var unhealthy []string
+			for _, id := range inService {
+				if !healthy[id] {
+					unhealthy = append(unhealthy, id)
+				}
+			}
+			if len(unhealthy) > 0 {
+				done = false
+				lines = append(lines, fmt.Sprintf("  %s: %s not healthy", arn, strings.Join(unhealthy, ", ")))
+			}
+		}
+		return done, strings.Join(lines, "\n"), nil
+	})
+	return replacements, err
+}
+
+// RunChaosE injects the fault into a random InService instance of the group and
+// waits for the group to heal, see WaitForRecoveryE
+func RunChaosE(clients *Clients, target ChaosTarget, fault Fault, rng *rand.Rand, options WaitOptions) (RecoveryReport, error) {
+	report := RecoveryReport{Fault: fault.Name}
+	instanceID, before, err := PickInServiceInstanceE(clients.AutoScaling, target.AutoScalingGroupName, rng)
+	if err != nil {
+		return report, err
+	}
+	report.Instance = instanceID
+
+	start := time.Now()
+	if err := fault.Inject(instanceID); err != nil {
+		return report, fmt.Errorf("%s %s: %w", fault.Name, instanceID, err)
+	}
+	report.Replacements, err = WaitForRecoveryE(clients, target, instanceID, before, options)
+	report.TimeToRecover = time.Since(start)
+	return report, err
+}
+
+// RunChaos terminates a random InService instance of the group through chaos and
+// fails the test unless the group heals within the timeout of options
+func RunChaos(t TestingT, clients *Clients, chaos ChaosAPI, target ChaosTarget, options WaitOptions) RecoveryReport {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	report, err := RunChaosE(clients, target, TerminateInstance(chaos), rng, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
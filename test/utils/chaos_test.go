@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/fakeaws"
+)
+
+var chaosTarget = ChaosTarget{
+	AutoScalingGroupName: "demo-ci-asg",
+	TargetGroupArns: []string{
+		"arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/demo-ci-app1/1",
+		"arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/demo-ci-app2/2",
+	},
+	Capacity: 2,
+}
+
+// selfHealingGroup serves a group of two healthy instances that replaces the
+// instances it loses
+func selfHealingGroup(healthCheckType string) *fakeaws.Fixtures {
+	fixtures := &fakeaws.Fixtures{
+		SelfHealing:  true,
+		TargetHealth: map[string][]*elbv2.TargetHealthDescription{},
+	}
+	group := &autoscaling.Group{
+		AutoScalingGroupName: aws.String(chaosTarget.AutoScalingGroupName),
+		DesiredCapacity:      aws.Int64(2),
+		HealthCheckType:      aws.String(healthCheckType),
+		TargetGroupARNs:      aws.StringSlice(chaosTarget.TargetGroupArns),
+	}
+	for _, arn := range chaosTarget.TargetGroupArns {
+		fixtures.TargetGroups = append(fixtures.TargetGroups, &elbv2.TargetGroup{TargetGroupArn: aws.String(arn)})
+	}
+	for _, id := range []string{"i-0a", "i-0b"} {
+		fixtures.Instances = append(fixtures.Instances, &ec2.Instance{
+			InstanceId: aws.String(id),
+			State:      &ec2.InstanceState{Code: aws.Int64(16), Name: aws.String(ec2.InstanceStateNameRunning)},
+		})
+		group.Instances = append(group.Instances, &autoscaling.Instance{
+			InstanceId:     aws.String(id),
+			LifecycleState: aws.String(autoscaling.LifecycleStateInService),
+			HealthStatus:   aws.String("Healthy"),
+		})
+		for _, arn := range chaosTarget.TargetGroupArns {
+			fixtures.TargetHealth[arn] = append(fixtures.TargetHealth[arn], &elbv2.TargetHealthDescription{
+				Target:       &elbv2.TargetDescription{Id: aws.String(id)},
+				TargetHealth: &elbv2.TargetHealth{State: aws.String(elbv2.TargetHealthStateEnumHealthy)},
+			})
+		}
+	}
+	fixtures.AutoScalingGroups = []*autoscaling.Group{group}
+	return fixtures
+}
+
+func TestRunChaosTerminateInstance(t *testing.T) {
+	server := fakeaws.Start(t, selfHealingGroup("EC2"))
+	clients := CreateClients("us-east-1")
+
+	report, err := RunChaosE(clients, chaosTarget, TerminateInstance(autoscaling.New(CreateSession("us-east-1"))), rand.New(rand.NewSource(1)), fastWait)
+	require.NoError(t, err)
+	assert.Equal(t, "terminate", report.Fault)
+	assert.Contains(t, []string{"i-0a", "i-0b"}, report.Instance)
+	assert.Equal(t, []string{"i-0e000000000000001"}, report.Replacements)
+	assert.Positive(t, report.TimeToRecover)
+	assert.Regexp(t, `^terminate i-0[ab]: replaced by i-0e000000000000001, recovered in \d+s$`, report.String())
+
+	server.Update(func(f *fakeaws.Fixtures) {
+		for _, instance := range f.Instances {
+			if aws.StringValue(instance.InstanceId) == report.Instance {
+				assert.Equal(t, ec2.InstanceStateNameTerminated, aws.StringValue(instance.State.Name))
+			}
+		}
+		for _, arn := range chaosTarget.TargetGroupArns {
+			assert.Len(t, f.TargetHealth[arn], 2, "the replacement should take the place of the terminated instance in %s", arn)
+		}
+	})
+}
+
+func TestRunChaosStoppedApp(t *testing.T) {
+	testCases := []struct {
+		name            string
+		healthCheckType string
+		err             string
+	}{
+		{
+			name:            "ELB health checks replace the instance",
+			healthCheckType: "ELB",
+		},
+		{
+			name:            "EC2 health checks keep the instance",
+			healthCheckType: "EC2",
+			err:             "timed out",
+		},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+		t.Run(tc.name, func(t *testing.T) {
+			server := fakeaws.Start(t, selfHealingGroup(tc.healthCheckType))
+			stopApp := Fault{Name: "stop app on", Inject: func(instanceID string) error {
+				server.StopApp(instanceID)
+				return nil
+			}}
+
+			report, err := RunChaosE(CreateClients("us-east-1"), chaosTarget, stopApp, rand.New(rand.NewSource(1)), fastWait)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				assert.Contains(t, err.Error(), report.Instance+" not healthy")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"i-0e000000000000001"}, report.Replacements)
+		})
+	}
+}
+
+func TestPickInServiceInstance(t *testing.T) {
+	fakeaws.Start(t, selfHealingGroup("EC2"))
+	clients := CreateClients("us-east-1")
+
+	picked := map[string]bool{}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		instanceID, inService, err := PickInServiceInstanceE(clients.AutoScaling, chaosTarget.AutoScalingGroupName, rng)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"i-0a", "i-0b"}, inService)
+		picked[instanceID] = true
+	}
+	assert.Len(t, picked, 2, "every InService instance should be picked eventually")
+
+	_, _, err := PickInServiceInstanceE(clients.AutoScaling, "missing-asg", rng)
+	assert.EqualError(t, err, "auto scaling group missing-asg not found")
+}
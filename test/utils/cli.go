@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// CLIT lets terratest's terraform helpers run outside a test, in the command
+// called name. Only their E variants should be used, which report errors instead
+// of failing: a failure prints to stderr and exits with 1.
+func CLIT(name string) testing.TestingT {
+	return &cliT{name: name}
+}
+
+type cliT struct {
+	name string
+}
+
+func (*cliT) Fail() {}
+
+func (*cliT) FailNow() {
+	os.Exit(1)
+}
+
+func (t *cliT) Fatal(args ...interface{}) {
+	t.Error(args...)
+	t.FailNow()
+}
+
+func (t *cliT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.FailNow()
+}
+
+func (*cliT) Error(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+}
+
+func (*cliT) Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+func (t *cliT) Name() string {
+	return t.name
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// EC2API is the subset of the EC2 client used by the test suite
+type EC2API interface {
+	DescribeVpcs(*ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error)
+	DescribeVpcAttribute(*ec2.DescribeVpcAttributeInput) (*ec2.DescribeVpcAttributeOutput, error)
+	DescribeSubnets(*ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error)
+	DescribeNatGateways(*ec2.DescribeNatGatewaysInput) (*ec2.DescribeNatGatewaysOutput, error)
+	DescribeFlowLogs(*ec2.DescribeFlowLogsInput) (*ec2.DescribeFlowLogsOutput, error)
+	DescribeSecurityGroups(*ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error)
+	DescribeLaunchTemplates(*ec2.DescribeLaunchTemplatesInput) (*ec2.DescribeLaunchTemplatesOutput, error)
+	DescribeLaunchTemplateVersions(*ec2.DescribeLaunchTemplateVersionsInput) (*ec2.DescribeLaunchTemplateVersionsOutput, error)
+	DescribeInstances(*ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error)
+	DescribeInternetGateways(*ec2.DescribeInternetGatewaysInput) (*ec2.DescribeInternetGatewaysOutput, error)
+	DescribeRouteTables(*ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error)
+}
+
+// ELBv2API is the subset of the ELBv2 client used by the test suite
+type ELBv2API interface {
+	DescribeLoadBalancers(*elbv2.DescribeLoadBalancersInput) (*elbv2.DescribeLoadBalancersOutput, error)
+	DescribeTags(*elbv2.DescribeTagsInput) (*elbv2.DescribeTagsOutput, error)
+	DescribeTargetGroups(*elbv2.DescribeTargetGroupsInput) (*elbv2.DescribeTargetGroupsOutput, error)
+	DescribeListeners(*elbv2.DescribeListenersInput) (*elbv2.DescribeListenersOutput, error)
+	DescribeRules(*elbv2.DescribeRulesInput) (*elbv2.DescribeRulesOutput, error)
+	DescribeTargetHealth(*elbv2.DescribeTargetHealthInput) (*elbv2.DescribeTargetHealthOutput, error)
+	DescribeLoadBalancerAttributes(*elbv2.DescribeLoadBalancerAttributesInput) (*elbv2.DescribeLoadBalancerAttributesOutput, error)
+}
+
+// AutoScalingAPI is the subset of the AutoScaling client used by the test suite
+type AutoScalingAPI interface {
+	DescribeAutoScalingGroups(*autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error)
+}
+
+// IAMAPI is the subset of the IAM client used by the test suite
+type IAMAPI interface {
+	GetRole(*iam.GetRoleInput) (*iam.GetRoleOutput, error)
+	ListAttachedRolePolicies(*iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error)
+}
+
+// ACMAPI is the subset of the ACM client used to provide the ALB's certificate
+type ACMAPI interface {
+	ImportCertificate(*acm.ImportCertificateInput) (*acm.ImportCertificateOutput, error)
+	DescribeCertificate(*acm.DescribeCertificateInput) (*acm.DescribeCertificateOutput, error)
+	DeleteCertificate(*acm.DeleteCertificateInput) (*acm.DeleteCertificateOutput, error)
+}
+
+// The SDK clients must keep satisfying the interfaces above
+var (
+	_ EC2API         = (*ec2.EC2)(nil)
+	_ ELBv2API       = (*elbv2.ELBV2)(nil)
+	_ AutoScalingAPI = (*autoscaling.AutoScaling)(nil)
+	_ IAMAPI         = (*iam.IAM)(nil)
+	_ ACMAPI         = (*acm.ACM)(nil)
+)
+
+// Clients bundles the AWS clients used by the test suite. Tests can replace
+// any of them with a fake or recorded implementation.
+type Clients struct {
+	EC2         EC2API
+	ELBv2       ELBv2API
+	AutoScaling AutoScalingAPI
+	IAM         IAMAPI
+	ACM         ACMAPI
+}
+
+// NewClients creates all clients from a single session
+func NewClients(sess *session.Session) *Clients {
+	return &Clients{
+		EC2:         ec2.New(sess),
+		ELBv2:       elbv2.New(sess),
+		AutoScaling: autoscaling.New(sess),
+		IAM:         iam.New(sess),
+		ACM:         acm.New(sess),
+	}
+}
+
+// CreateClients creates all clients for the specified region
+func CreateClients(region string) *Clients {
+	return NewClients(CreateSession(region))
+}
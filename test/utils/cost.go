@@ -0,0 +1,302 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+// PriceTableEnvVar points at a JSON file whose prices override the defaults,
+// e.g. for another region or a new instance type
+const PriceTableEnvVar = "COST_PRICE_TABLE"
+
+// defaultPrices are on-demand us-east-1 prices, see prices.json
+//
+//go:embed prices.json
+var defaultPrices []byte
+
+// PriceTable holds the prices the cost estimate multiplies the planned resources by
+type PriceTable struct {
+	Region             string             `json:"region"`
+	Currency           string             `json:"currency"`
+	HoursPerMonth      float64            `json:"hours_per_month"`
+	NATGatewayHourly   float64            `json:"nat_gateway_hourly"`
+	LoadBalancerHourly float64            `json:"load_balancer_hourly"`
+	InstanceHourly     map[string]float64 `json:"instance_hourly"`
+	// EBSPerGBMonth is keyed by volume type
+	EBSPerGBMonth        map[string]float64 `json:"ebs_gb_month"`
+	LogIngestionPerGB    float64            `json:"log_ingestion_gb"`
+	LogStoragePerGBMonth float64            `json:"log_storage_gb_month"`
+	// LogGroupGBPerMonth is the volume assumed for every log group, which a plan
+	// cannot tell. The only log groups are the VPC flow logs'.
+	LogGroupGBPerMonth float64 `json:"log_group_gb_month"`
+}
+
+// DefaultPriceTable returns the prices embedded in the test suite
+func DefaultPriceTable() PriceTable {
+	var prices PriceTable
+	if err := json.Unmarshal(defaultPrices, &prices); err != nil {
+		panic(fmt.Sprintf("parsing the embedded prices.json: %v", err))
+	}
+	return prices
+}
+
+// LoadPriceTableE reads the prices in file over the defaults: scalars it sets
+// replace the default, instance and volume types it lists are added or replaced
+func LoadPriceTableE(file string) (PriceTable, error) {
+	prices := DefaultPriceTable()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return prices, err
+	}
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return prices, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	return prices, nil
+}
+
+// PriceTableFromEnvE returns the prices in the file PriceTableEnvVar points at
+// over the defaults, or just the defaults when it is not set
+func PriceTableFromEnvE() (PriceTable, error) {
+	if file := os.Getenv(PriceTableEnvVar); file != "" {
+		return LoadPriceTableE(file)
+	}
+	return DefaultPriceTable(), nil
+}
+
+// CostCategory groups the cost items of an estimate
+type CostCategory string
+
+// Categories of cost, in the order reports list them
+const (
+	CostNATGateways   CostCategory = "NAT gateways"
+	CostLoadBalancers CostCategory = "load balancers"
+	CostInstances     CostCategory = "instances"
+	CostVolumes       CostCategory = "EBS volumes"
+	CostLogs          CostCategory = "log groups"
+)
+
+// CostCategories lists every category in report order
+var CostCategories = []CostCategory{CostNATGateways, CostLoadBalancers, CostInstances, CostVolumes, CostLogs}
+
+// CostItem is the monthly cost of one priced resource
+type CostItem struct {
+	Category CostCategory
+	Address  string
+	// Description shows how the cost was worked out
+	Description string
+	Monthly     float64
+}
+
+// CostEstimate is the monthly cost of what a plan leaves deployed
+type CostEstimate struct {
+	Currency string
+	// Items are sorted by category and address
+	Items []CostItem
+}
+
+// Total is the monthly cost of every item
+func (e CostEstimate) Total() float64 {
+	total := 0.0
+	for _, item := range e.Items {
+		total += item.Monthly
+	}
+	return total
+}
+
+// Category is the monthly cost of the items in category
+func (e CostEstimate) Category(category CostCategory) float64 {
+	total := 0.0
+	for _, item := range e.Items {
+		if item.Category == category {
+			total += item.Monthly
+		}
+	}
+	return total
+}
+
+func (e CostEstimate) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, item := range e.Items {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", item.Address, item.Description, formatCost(item.Monthly))
+	}
+	fmt.Fprintf(w, "  total\t\t%s\n", formatCost(e.Total()))
+	w.Flush()
+	return b.String()
+}
+
+func formatCost(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// EstimateCostE prices the resources a plan creates, updates or keeps: NAT
+// gateways and load balancers by the hour, Auto Scaling groups at their max_size
+// with the instance type and volumes of the launch template in the same module,
+// and log groups at the volume the price table assumes. Other resources are free
+// or too small to matter.
+func EstimateCostE(plan *terraform.PlanStruct, prices PriceTable) (CostEstimate, error) {
+	estimate := CostEstimate{Currency: prices.Currency}
+	hourly := func(category CostCategory, address, what string, count int, price float64) {
+		estimate.Items = append(estimate.Items, CostItem{
+			Category:    category,
+			Address:     address,
+			Description: fmt.Sprintf("%s, %gh at %g", what, prices.HoursPerMonth, price),
+			Monthly:     float64(count) * prices.HoursPerMonth * price,
+		})
+	}
+
+	// Launch templates by module, for the Auto Scaling groups next to them
+	type moduleResource struct {
+		address, module string
+		values          map[string]interface{}
+	}
+	launchTemplates := map[string][]moduleResource{}
+	var groups []moduleResource
+	for address, resource := range plan.ResourceChangesMap {
+		if resource == nil || resource.Change == nil || resource.Mode != "managed" {
+			continue
+		}
+		actions := resource.Change.Actions
+		if actions.Delete() || actions.Read() {
+			continue
+		}
+		values, _ := resource.Change.After.(map[string]interface{})
+
+		switch resource.Type {
+		case "aws_nat_gateway":
+			hourly(CostNATGateways, address, "NAT gateway", 1, prices.NATGatewayHourly)
+		case "aws_lb":
+			hourly(CostLoadBalancers, address, attrString(values, "load_balancer_type")+" load balancer", 1, prices.LoadBalancerHourly)
+		case "aws_cloudwatch_log_group":
+			gb := prices.LogGroupGBPerMonth
+			estimate.Items = append(estimate.Items, CostItem{
+				Category:    CostLogs,
+				Address:     address,
+				Description: fmt.Sprintf("%s, %g GB ingested at %g and stored at %g", attrString(values, "name"), gb, prices.LogIngestionPerGB, prices.LogStoragePerGBMonth),
+				Monthly:     gb * (prices.LogIngestionPerGB + prices.LogStoragePerGBMonth),
+			})
+		case "aws_launch_template":
+			launchTemplates[resource.ModuleAddress] = append(launchTemplates[resource.ModuleAddress], moduleResource{address, resource.ModuleAddress, values})
+		case "aws_autoscaling_group":
+			groups = append(groups, moduleResource{address, resource.ModuleAddress, values})
+		}
+	}
+
+	for _, group := range groups {
+		templates := launchTemplates[group.module]
+		if len(templates) != 1 {
+			return estimate, fmt.Errorf("%s: expected one launch template next to the group, found %d", group.address, len(templates))
+		}
+		template := templates[0].values
+		instances := attrInt(group.values, "max_size")
+
+		instanceType := attrString(template, "instance_type")
+		price, ok := prices.InstanceHourly[instanceType]
+		if !ok {
+			return estimate, fmt.Errorf("%s: no price for instance type %q, add it to the price table", group.address, instanceType)
+		}
+		hourly(CostInstances, group.address, fmt.Sprintf("%d x %s (max_size)", instances, instanceType), instances, price)
+
+		for _, mapping := range attrBlocks(template, "block_device_mappings") {
+			ebs := firstBlock(mapping, "ebs")
+			volumeType := attrString(ebs, "volume_type")
+			size := attrInt(ebs, "volume_size")
+			price, ok := prices.EBSPerGBMonth[volumeType]
+			if !ok {
+				return estimate, fmt.Errorf("%s: no price for volume type %q, add it to the price table", templates[0].address, volumeType)
+			}
+			estimate.Items = append(estimate.Items, CostItem{
+				Category:    CostVolumes,
+				Address:     fmt.Sprintf("%s %s", group.address, attrString(mapping, "device_name")),
+				Description: fmt.Sprintf("%d x %d GB %s at %g", instances, size, volumeType, price),
+				Monthly:     float64(instances*size) * price,
+			})
+		}
+	}
+
+	order := map[CostCategory]int{}
+	for i, category := range CostCategories {
+		order[category] = i
+	}
+	sort.Slice(estimate.Items, func(i, j int) bool {
+		a, b := estimate.Items[i], estimate.Items[j]
+		if a.Category != b.Category {
+			return order[a.Category] < order[b.Category]
+		}
+		return a.Address < b.Address
+	})
+	return estimate, nil
+}
+
+// EnvironmentCost is the estimate of one environment
+type EnvironmentCost struct {
+	Environment string
+	Estimate    CostEstimate
+}
+
+// FormatCostComparison renders the monthly cost of each environment by category,
+// with the delta of every environment to the first one
+func FormatCostComparison(costs []EnvironmentCost) string {
+	if len(costs) == 0 {
+		return ""
+	}
+	rows := [][]string{{""}}
+	for _, cost := range costs {
+		rows[0] = append(rows[0], cost.Environment)
+	}
+	for _, cost := range costs[1:] {
+		rows[0] = append(rows[0], fmt.Sprintf("%s vs %s", cost.Environment, costs[0].Environment))
+	}
+
+	row := func(name string, amount func(CostEstimate) float64) {
+		cells := []string{name}
+		for _, cost := range costs {
+			cells = append(cells, formatCost(amount(cost.Estimate)))
+		}
+		base := amount(costs[0].Estimate)
+		for _, cost := range costs[1:] {
+			cells = append(cells, fmt.Sprintf("%+.2f", amount(cost.Estimate)-base))
+		}
+		rows = append(rows, cells)
+	}
+	for _, category := range CostCategories {
+		category := category
+		row(string(category), func(e CostEstimate) float64 { return e.Category(category) })
+	}
+	row("total", CostEstimate.Total)
+
+	// Names align left and amounts right
+	widths := make([]int, len(rows[0]))
+	for _, cells := range rows {
+		for i, cell := range cells {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	var b strings.Builder
+	for _, cells := range rows {
+		fmt.Fprintf(&b, "%-*s", widths[0], cells[0])
+		for i, cell := range cells[1:] {
+			fmt.Fprintf(&b, "  %*s", widths[i+1], cell)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// AssertWithinBudget fails when the monthly cost of the environment is over its
+// budget, listing what it is made of
+func AssertWithinBudget(t AssertT, environment string, estimate CostEstimate, budget float64) bool {
+	if total := estimate.Total(); total > budget {
+		t.Errorf("%s costs %s %s a month, over its budget of %s:\n%s",
+			environment, formatCost(total), estimate.Currency, formatCost(budget), estimate)
+		return false
+	}
+	return true
+}
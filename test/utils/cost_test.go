@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCostPlanJSON = `{
+  "format_version": "1.2",
+  "planned_values": {"root_module": {}},
+  "resource_changes": [
+    {
+      "address": "module.vpc.module.vpc.aws_nat_gateway.this[0]", "module_address": "module.vpc.module.vpc",
+      "mode": "managed", "type": "aws_nat_gateway", "name": "this", "index": 0,
+      "change": {"actions": ["create"], "before": null, "after": {"connectivity_type": "public"}}
+    },
+    {
+      "address": "module.vpc.module.vpc.aws_nat_gateway.this[1]", "module_address": "module.vpc.module.vpc",
+      "mode": "managed", "type": "aws_nat_gateway", "name": "this", "index": 1,
+      "change": {"actions": ["delete"], "before": {"connectivity_type": "public"}, "after": null}
+    },
+    {
+      "address": "module.vpc.module.vpc.aws_cloudwatch_log_group.flow_log[0]", "module_address": "module.vpc.module.vpc",
+      "mode": "managed", "type": "aws_cloudwatch_log_group", "name": "flow_log", "index": 0,
+      "change": {"actions": ["no-op"], "before": {"name": "/aws/vpc-flow-log/vpc-1"}, "after": {"name": "/aws/vpc-flow-log/vpc-1"}}
+    },
+    {
+      "address": "module.alb.aws_lb.this", "module_address": "module.alb",
+      "mode": "managed", "type": "aws_lb", "name": "this",
+      "change": {"actions": ["update"], "before": {"load_balancer_type": "application"}, "after": {"load_balancer_type": "application"}}
+    },
+    {
+      "address": "module.compute.aws_launch_template.app", "module_address": "module.compute",
+      "mode": "managed", "type": "aws_launch_template", "name": "app",
+      "change": {"actions": ["create"], "before": null, "after": {
+        "instance_type": "t3.micro",
+        "block_device_mappings": [{"device_name": "/dev/xvda", "ebs": [{"volume_size": 30, "volume_type": "gp3"}]}]
+      }}
+    },
+    {
+      "address": "module.compute.aws_autoscaling_group.app", "module_address": "module.compute",
+      "mode": "managed", "type": "aws_autoscaling_group", "name": "app",
+      "change": {"actions": ["create"], "before": null, "after": {"max_size": 4, "desired_capacity": 2}}
+    },
+    {
+      "address": "module.compute.aws_security_group.ec2", "module_address": "module.compute",
+      "mode": "managed", "type": "aws_security_group", "name": "ec2",
+      "change": {"actions": ["create"], "before": null, "after": {"name": "demo-ci-ec2"}}
+    }
+  ]
+}`
+
+func TestEstimateCost(t *testing.T) {
+	plan, err := terraform.ParsePlanJSON(testCostPlanJSON)
+	require.NoError(t, err)
+
+	estimate, err := EstimateCostE(plan, DefaultPriceTable())
+	require.NoError(t, err)
+
+	var addresses []string
+	for _, item := range estimate.Items {
+		addresses = append(addresses, item.Address)
+	}
+	assert.Equal(t, []string{
+		"module.vpc.module.vpc.aws_nat_gateway.this[0]",
+		"module.alb.aws_lb.this",
+		"module.compute.aws_autoscaling_group.app",
+		"module.compute.aws_autoscaling_group.app /dev/xvda",
+		"module.vpc.module.vpc.aws_cloudwatch_log_group.flow_log[0]",
+	}, addresses, "the deleted NAT gateway and the security group cost nothing")
+
+	assert.InDelta(t, 32.85, estimate.Category(CostNATGateways), 0.001)
+	assert.InDelta(t, 16.425, estimate.Category(CostLoadBalancers), 0.001)
+	assert.InDelta(t, 30.368, estimate.Category(CostInstances), 0.001)
+	assert.InDelta(t, 9.6, estimate.Category(CostVolumes), 0.001)
+	assert.InDelta(t, 5.3, estimate.Category(CostLogs), 0.001)
+	assert.InDelta(t, 94.543, estimate.Total(), 0.001)
+	assert.Equal(t, "4 x t3.micro (max_size), 730h at 0.0104", estimate.Items[2].Description)
+	assert.Equal(t, "4 x 30 GB gp3 at 0.08", estimate.Items[3].Description)
+
+	prices := DefaultPriceTable()
+	delete(prices.InstanceHourly, "t3.micro")
+	_, err = EstimateCostE(plan, prices)
+	assert.EqualError(t, err, `module.compute.aws_autoscaling_group.app: no price for instance type "t3.micro", add it to the price table`)
+}
+
+func TestLoadPriceTable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prices.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"region": "eu-west-1", "nat_gateway_hourly": 0.048, "instance_hourly": {"t3.micro": 0.0114, "t4g.micro": 0.0092}}`), 0o644))
+
+	t.Setenv(PriceTableEnvVar, file)
+	prices, err := PriceTableFromEnvE()
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", prices.Region)
+	assert.Equal(t, 0.048, prices.NATGatewayHourly)
+	assert.Equal(t, 0.0114, prices.InstanceHourly["t3.micro"])
+	assert.Equal(t, 0.0092, prices.InstanceHourly["t4g.micro"])
+	assert.Equal(t, 0.0208, prices.InstanceHourly["t3.small"], "types the file leaves out keep their default price")
+	assert.Equal(t, DefaultPriceTable().LoadBalancerHourly, prices.LoadBalancerHourly)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"nat_gateway_hourly": "cheap"}`), 0o644))
+	_, err = LoadPriceTableE(file)
+	assert.ErrorContains(t, err, "parsing "+file)
+}
+
+func TestFormatCostComparison(t *testing.T) {
+	plan, err := terraform.ParsePlanJSON(testCostPlanJSON)
+	require.NoError(t, err)
+	nonProd, err := EstimateCostE(plan, DefaultPriceTable())
+	require.NoError(t, err)
+
+	prod := CostEstimate{Currency: nonProd.Currency, Items: append([]CostItem{
+		{Category: CostNATGateways, Address: "module.vpc.module.vpc.aws_nat_gateway.this[1]", Monthly: 32.85},
+		{Category: CostNATGateways, Address: "module.vpc.module.vpc.aws_nat_gateway.this[2]", Monthly: 32.85},
+	}, nonProd.Items...)}
+
+	assert.Equal(t, `                   ci    prod  prod vs ci
+NAT gateways    32.85   98.55      +65.70
+load balancers  16.43   16.43       +0.00
+instances       30.37   30.37       +0.00
+EBS volumes      9.60    9.60       +0.00
+log groups       5.30    5.30       +0.00
+total           94.54  160.24      +65.70
+`, FormatCostComparison([]EnvironmentCost{{"ci", nonProd}, {"prod", prod}}))
+
+	recorder := &snapshotT{}
+	assert.True(t, AssertWithinBudget(recorder, "ci", nonProd, 100))
+	assert.False(t, AssertWithinBudget(recorder, "prod", prod, 100))
+	require.Len(t, recorder.errors, 1)
+	assert.Contains(t, recorder.errors[0], "prod costs 160.24 USD a month, over its budget of 100.00:\n")
+	assert.Contains(t, recorder.errors[0], "module.vpc.module.vpc.aws_nat_gateway.this[2]")
+}
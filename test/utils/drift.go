@@ -0,0 +1,490 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// DriftCategory groups drift by what it puts at risk
+type DriftCategory string
+
+const (
+	// DriftSecurity is drift in what can reach the deployment: security group
+	// rules, the groups attached to the ALB and instances, IMDS settings and
+	// deletion protection
+	DriftSecurity DriftCategory = "security"
+	// DriftCapacity is drift in what runs: instance type, volumes, the Auto
+	// Scaling group's sizes and its launch template
+	DriftCapacity DriftCategory = "capacity"
+	// DriftRouting is drift in where requests go: listener rules, target groups
+	// and the subnets and target groups of the Auto Scaling group
+	DriftRouting DriftCategory = "routing"
+	// DriftTagging is drift in the tags of any resource
+	DriftTagging DriftCategory = "tagging"
+)
+
+// DriftCategories lists the categories in the order reports show them
+var DriftCategories = []DriftCategory{DriftSecurity, DriftCapacity, DriftRouting, DriftTagging}
+
+// Drift is an attribute whose live value differs from the one in the state
+type Drift struct {
+	Category DriftCategory
+	// Address is the resource's address in the state, e.g. module.alb.aws_lb.main
+	Address string
+	// ID is the AWS identifier of the resource
+	ID        string
+	Attribute string
+	// Expected is the value in the state and Actual the live one. An empty value
+	// is a rule, tag or group that only exists on the other side.
+	Expected string
+	Actual   string
+}
+
+// DriftReport is the drift of a deployment, sorted by category and address
+type DriftReport []Drift
+
+// Category returns the drift of the category
+func (r DriftReport) Category(category DriftCategory) []Drift {
+	var drifts []Drift
+	for _, drift := range r {
+		if drift.Category == category {
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts
+}
+
+// Has reports whether there is drift of the category
+func (r DriftReport) Has(category DriftCategory) bool {
+	return len(r.Category(category)) > 0
+}
+
+func (r DriftReport) String() string {
+	var b strings.Builder
+	for _, category := range DriftCategories {
+		drifts := r.Category(category)
+		if len(drifts) == 0 {
+			fmt.Fprintf(&b, "%s: no drift\n", category)
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %d drifted attributes\n", category, len(drifts))
+		resource := ""
+		for _, drift := range drifts {
+			if heading := fmt.Sprintf("%s (%s)", drift.Address, drift.ID); heading != resource {
+				resource = heading
+				fmt.Fprintf(&b, "  %s\n", resource)
+			}
+			fmt.Fprintf(&b, "      %s: %s => %s\n", drift.Attribute, driftValue(drift.Expected), driftValue(drift.Actual))
+		}
+	}
+	return b.String()
+}
+
+func driftValue(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return strconv.Quote(value)
+}
+
+// DeploymentOutputs are the outputs of a deployment of the complete example that
+// the drift check starts from
+type DeploymentOutputs struct {
+	VPCID                string
+	ALBName              string
+	TargetGroupArns      map[string]string
+	AutoScalingGroupName string
+	LaunchTemplateID     string
+}
+
+// CheckDriftE compares the live ALB, target groups, listener rules, security
+// groups, launch template and Auto Scaling group of a deployment with the state
+// terraform recorded for them, the output of `terraform show -json`
+func CheckDriftE(clients *Clients, outputs DeploymentOutputs, stateJSON string) (DriftReport, error) {
+	resources, err := stateResources(stateJSON)
+	if err != nil {
+		return nil, err
+	}
+	c := &driftChecker{clients: clients, outputs: outputs, resources: resources}
+
+	for _, check := range []func() error{c.checkALB, c.checkListenerRules, c.checkTargetGroups, c.checkSecurityGroups,
+		c.checkLaunchTemplate, c.checkAutoScalingGroup} {
+		if err := check(); err != nil {
+			return nil, err
+		}
+	}
+
+	order := make(map[DriftCategory]int, len(DriftCategories))
+	for i, category := range DriftCategories {
+		order[category] = i
+	}
+	report := c.report
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].Category != report[j].Category {
+			return order[report[i].Category] < order[report[j].Category]
+		}
+		return report[i].Address < report[j].Address
+	})
+	return report, nil
+}
+
+// driftChecker collects the drift of the resources of a deployment
+type driftChecker struct {
+	clients   *Clients
+	outputs   DeploymentOutputs
+	resources []plannedResource
+	report    DriftReport
+	alb       *LiveALB
+}
+
+// find returns the resource of the type whose attribute has the value
+func (c *driftChecker) find(resourceType, attribute, value string) (plannedResource, error) {
+	for _, resource := range c.resources {
+		if resource.Type == resourceType && attrString(resource.Values, attribute) == value {
+			return resource, nil
+		}
+	}
+	return plannedResource{}, fmt.Errorf("no %s with %s %s in the state", resourceType, attribute, value)
+}
+
+func (c *driftChecker) all(resourceType string) []plannedResource {
+	var resources []plannedResource
+	for _, resource := range c.resources {
+		if resource.Type == resourceType {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+// compare records drift when the live value differs from the expected one
+func (c *driftChecker) compare(category DriftCategory, resource plannedResource, id, attribute, expected, actual string) {
+	if expected != actual {
+		c.report = append(c.report, Drift{
+			Category: category, Address: resource.Address, ID: id,
+			Attribute: attribute, Expected: expected, Actual: actual,
+		})
+	}
+}
+
+// compareSets records every value that is only expected or only live, ignoring order
+func (c *driftChecker) compareSets(category DriftCategory, resource plannedResource, id, attribute string, expected, actual []string) {
+	for _, value := range expected {
+		if !contains(actual, value) {
+			c.compare(category, resource, id, attribute, value, "")
+		}
+	}
+	for _, value := range actual {
+		if !contains(expected, value) {
+			c.compare(category, resource, id, attribute, "", value)
+		}
+	}
+}
+
+// compareTags records every tag that is missing, changed or added. AWS reserves
+// the aws: prefix for tags it manages itself, so those are not drift.
+func (c *driftChecker) compareTags(resource plannedResource, id, attribute string, expected map[string]string, actual []Tag) {
+	live := make(map[string]string, len(actual))
+	for _, tag := range actual {
+		if !strings.HasPrefix(tag.Key, "aws:") {
+			live[tag.Key] = tag.Value
+		}
+	}
+	keys := make(map[string]bool)
+	for key := range expected {
+		keys[key] = true
+	}
+	for key := range live {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		c.compare(DriftTagging, resource, id, attribute+"."+key, expected[key], live[key])
+	}
+}
+
+func (c *driftChecker) checkALB() error {
+	resource, err := c.find("aws_lb", "name", c.outputs.ALBName)
+	if err != nil {
+		return err
+	}
+	c.alb, err = DescribeALBE(c.clients.ELBv2, c.outputs.ALBName)
+	if err != nil {
+		return err
+	}
+	id := c.alb.ARN
+
+	c.compare(DriftSecurity, resource, id, "internal",
+		strconv.FormatBool(attrBool(resource.Values, "internal")), strconv.FormatBool(c.alb.Scheme == "internal"))
+	c.compare(DriftSecurity, resource, id, "enable_deletion_protection",
+		strconv.FormatBool(attrBool(resource.Values, "enable_deletion_protection")), strconv.FormatBool(c.alb.DeletionProtection))
+	c.compareSets(DriftSecurity, resource, id, "security_groups", attrStringList(resource.Values, "security_groups"), c.alb.SecurityGroups)
+	c.compare(DriftRouting, resource, id, "vpc_id", c.outputs.VPCID, c.alb.VpcID)
+	c.compareTags(resource, id, "tags", attrStringMap(resource.Values, "tags_all"), c.alb.Tags)
+	return nil
+}
+
+// checkListenerRules matches the rules of the HTTPS listener by priority, as a
+// rule moved to another priority is a different rule for the ALB
+func (c *driftChecker) checkListenerRules() error {
+	listener, err := c.find("aws_lb_listener", "protocol", "HTTPS")
+	if err != nil {
+		return err
+	}
+	rules, err := DescribeListenerRulesE(c.clients.ELBv2, c.alb.ARN, "HTTPS")
+	if err != nil {
+		return err
+	}
+	liveRules, err := RulesFromELBv2(rules)
+	if err != nil {
+		return err
+	}
+	live := make(map[int]ListenerRule, len(liveRules))
+	for _, rule := range liveRules {
+		live[rule.Priority] = rule
+	}
+	forwards := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		for _, action := range rule.Actions {
+			if aws.StringValue(action.Type) == "forward" {
+				forwards[aws.StringValue(rule.Priority)] = aws.StringValue(action.TargetGroupArn)
+			}
+		}
+	}
+
+	expected := make(map[int]bool)
+	for _, resource := range c.all("aws_lb_listener_rule") {
+		priority := attrInt(resource.Values, "priority")
+		expected[priority] = true
+		id := attrString(resource.Values, "arn")
+		var hosts, paths []string
+		for _, condition := range attrBlocks(resource.Values, "condition") {
+			if pathPattern := firstBlock(condition, "path_pattern"); pathPattern != nil {
+				paths = append(paths, attrStringList(pathPattern, "values")...)
+			}
+			if hostHeader := firstBlock(condition, "host_header"); hostHeader != nil {
+				hosts = append(hosts, attrStringList(hostHeader, "values")...)
+			}
+		}
+		var targetGroup string
+		for _, action := range attrBlocks(resource.Values, "action") {
+			if attrString(action, "type") == "forward" {
+				targetGroup = attrString(action, "target_group_arn")
+			}
+		}
+
+		rule, ok := live[priority]
+		if !ok {
+			c.compare(DriftRouting, resource, id, "priority", strconv.Itoa(priority), "")
+			continue
+		}
+		c.compareSets(DriftRouting, resource, id, "host_header", hosts, rule.Hosts)
+		c.compareSets(DriftRouting, resource, id, "path_pattern", paths, rule.Paths)
+		c.compare(DriftRouting, resource, id, "target_group_arn", targetGroup, forwards[strconv.Itoa(priority)])
+	}
+
+	// Rules added outside terraform show up on the listener
+	for _, rule := range liveRules {
+		if !expected[rule.Priority] {
+			c.compare(DriftRouting, listener, attrString(listener.Values, "arn"), "rule", "", listenerRuleString(rule))
+		}
+	}
+	return nil
+}
+
+// listenerRuleString describes a rule, e.g. "priority 1: host example.com path /*"
+func listenerRuleString(rule ListenerRule) string {
+	description := fmt.Sprintf("priority %d:", rule.Priority)
+	if len(rule.Hosts) > 0 {
+		description += " host " + strings.Join(rule.Hosts, ",")
+	}
+	if len(rule.Paths) > 0 {
+		description += " path " + strings.Join(rule.Paths, ",")
+	}
+	return description
+}
+
+func (c *driftChecker) checkTargetGroups() error {
+	var names, arns []string
+	for name := range c.outputs.TargetGroupArns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		arns = append(arns, c.outputs.TargetGroupArns[name])
+	}
+	targetGroups, err := DescribeTargetGroupsE(c.clients.ELBv2, arns)
+	if err != nil {
+		return err
+	}
+
+	for _, tg := range targetGroups {
+		resource, err := c.find("aws_lb_target_group", "arn", tg.ARN)
+		if err != nil {
+			return err
+		}
+		healthCheck := firstBlock(resource.Values, "health_check")
+		c.compare(DriftRouting, resource, tg.ARN, "vpc_id", c.outputs.VPCID, tg.VpcID)
+		c.compare(DriftRouting, resource, tg.ARN, "port", strconv.Itoa(attrInt(resource.Values, "port")), strconv.Itoa(tg.Port))
+		c.compare(DriftRouting, resource, tg.ARN, "protocol", attrString(resource.Values, "protocol"), tg.Protocol)
+		c.compare(DriftRouting, resource, tg.ARN, "health_check.path", attrString(healthCheck, "path"), tg.HealthCheckPath)
+		c.compare(DriftRouting, resource, tg.ARN, "health_check.healthy_threshold",
+			strconv.Itoa(attrInt(healthCheck, "healthy_threshold")), strconv.Itoa(tg.HealthyThreshold))
+		c.compare(DriftRouting, resource, tg.ARN, "health_check.unhealthy_threshold",
+			strconv.Itoa(attrInt(healthCheck, "unhealthy_threshold")), strconv.Itoa(tg.UnhealthyThreshold))
+		c.compareTags(resource, tg.ARN, "tags", attrStringMap(resource.Values, "tags_all"), tg.Tags)
+	}
+	return nil
+}
+
+func (c *driftChecker) checkSecurityGroups() error {
+	resources := c.all("aws_security_group")
+	if len(resources) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		ids = append(ids, attrString(resource.Values, "id"))
+	}
+	groups, err := DescribeSecurityGroupsE(c.clients.EC2, ids...)
+	if err != nil {
+		return err
+	}
+
+	for i, live := range SecurityGroupsFromEC2(groups) {
+		resource := resources[i]
+		c.compareSets(DriftSecurity, resource, live.ID, "ingress",
+			ruleStrings(planRules(resource.Values, "ingress", live.ID), "from"), ruleStrings(live.Ingress, "from"))
+		c.compareSets(DriftSecurity, resource, live.ID, "egress",
+			ruleStrings(planRules(resource.Values, "egress", live.ID), "to"), ruleStrings(live.Egress, "to"))
+		c.compareTags(resource, live.ID, "tags", attrStringMap(resource.Values, "tags_all"), EC2Tags(groups[i].Tags))
+	}
+	return nil
+}
+
+// ruleStrings describes each peer of the rules on its own, e.g. "tcp 443 from
+// 0.0.0.0/0", so rules compare the same however they are grouped
+func ruleStrings(rules []SecurityGroupRule, direction string) []string {
+	var descriptions []string
+	for _, rule := range rules {
+		traffic := "all traffic"
+		if protocol := normalizeProtocol(rule.Protocol); protocol != "-1" {
+			traffic = fmt.Sprintf("%s %d", protocol, rule.FromPort)
+			if rule.ToPort != rule.FromPort {
+				traffic = fmt.Sprintf("%s %d-%d", protocol, rule.FromPort, rule.ToPort)
+			}
+		}
+		peers := append(append([]string{}, rule.CIDRs...), rule.Groups...)
+		if len(peers) == 0 {
+			descriptions = append(descriptions, traffic)
+		}
+		for _, peer := range peers {
+			descriptions = append(descriptions, fmt.Sprintf("%s %s %s", traffic, direction, peer))
+		}
+	}
+	sort.Strings(descriptions)
+	return descriptions
+}
+
+func (c *driftChecker) checkLaunchTemplate() error {
+	resource, err := c.find("aws_launch_template", "id", c.outputs.LaunchTemplateID)
+	if err != nil {
+		return err
+	}
+	lt, err := DescribeLaunchTemplateE(c.clients.EC2, c.outputs.LaunchTemplateID)
+	if err != nil {
+		return err
+	}
+	id := lt.ID
+
+	// Instances launch from the latest version, so a version created outside
+	// terraform changes what runs
+	c.compare(DriftCapacity, resource, id, "latest_version",
+		strconv.Itoa(attrInt(resource.Values, "latest_version")), strconv.Itoa(lt.LatestVersion))
+	c.compare(DriftCapacity, resource, id, "instance_type", attrString(resource.Values, "instance_type"), lt.InstanceType)
+	mappings := attrBlocks(resource.Values, "block_device_mappings")
+	for i := 0; i < len(mappings) || i < len(lt.Volumes); i++ {
+		var expected, actual LiveVolume
+		if i < len(mappings) {
+			ebs := firstBlock(mappings[i], "ebs")
+			expected = LiveVolume{
+				DeviceName: attrString(mappings[i], "device_name"),
+				VolumeSize: attrInt(ebs, "volume_size"),
+				VolumeType: attrString(ebs, "volume_type"),
+			}
+		}
+		if i < len(lt.Volumes) {
+			actual = lt.Volumes[i]
+		}
+		c.compare(DriftCapacity, resource, id, fmt.Sprintf("block_device_mappings[%d]", i), volumeString(expected), volumeString(actual))
+	}
+
+	networkInterface := firstBlock(resource.Values, "network_interfaces")
+	securityGroups := append(attrStringList(resource.Values, "vpc_security_group_ids"), attrStringList(networkInterface, "security_groups")...)
+	c.compareSets(DriftSecurity, resource, id, "security_groups", securityGroups, lt.SecurityGroups)
+	c.compare(DriftSecurity, resource, id, "network_interfaces.associate_public_ip_address",
+		strconv.FormatBool(attrFlag(networkInterface, "associate_public_ip_address")), strconv.FormatBool(lt.AssociatePublicIP))
+	c.compare(DriftSecurity, resource, id, "metadata_options.http_tokens",
+		attrString(firstBlock(resource.Values, "metadata_options"), "http_tokens"), lt.HTTPTokens)
+
+	c.compareTags(resource, id, "tags", attrStringMap(resource.Values, "tags_all"), lt.Tags)
+	for _, specification := range attrBlocks(resource.Values, "tag_specifications") {
+		resourceType := attrString(specification, "resource_type")
+		c.compareTags(resource, id, "tag_specifications."+resourceType, attrStringMap(specification, "tags"), lt.TagSpecifications[resourceType])
+	}
+	return nil
+}
+
+func volumeString(volume LiveVolume) string {
+	if volume.DeviceName == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s %s %dGiB", volume.DeviceName, volume.VolumeType, volume.VolumeSize)
+}
+
+// attrFlag reads a boolean attribute that the provider may store as a string,
+// like associate_public_ip_address of a launch template's network interface
+func attrFlag(values map[string]interface{}, key string) bool {
+	if s, ok := values[key].(string); ok {
+		b, _ := strconv.ParseBool(s)
+		return b
+	}
+	return attrBool(values, key)
+}
+
+func (c *driftChecker) checkAutoScalingGroup() error {
+	resource, err := c.find("aws_autoscaling_group", "name", c.outputs.AutoScalingGroupName)
+	if err != nil {
+		return err
+	}
+	asg, err := DescribeAutoScalingGroupE(c.clients.AutoScaling, c.outputs.AutoScalingGroupName)
+	if err != nil {
+		return err
+	}
+	id := asg.Name
+
+	c.compare(DriftCapacity, resource, id, "desired_capacity", strconv.Itoa(attrInt(resource.Values, "desired_capacity")), strconv.Itoa(asg.DesiredCapacity))
+	c.compare(DriftCapacity, resource, id, "min_size", strconv.Itoa(attrInt(resource.Values, "min_size")), strconv.Itoa(asg.MinSize))
+	c.compare(DriftCapacity, resource, id, "max_size", strconv.Itoa(attrInt(resource.Values, "max_size")), strconv.Itoa(asg.MaxSize))
+	launchTemplate := firstBlock(resource.Values, "launch_template")
+	c.compare(DriftCapacity, resource, id, "launch_template.id", attrString(launchTemplate, "id"), asg.LaunchTemplateID)
+	c.compare(DriftCapacity, resource, id, "launch_template.version", attrString(launchTemplate, "version"), asg.LaunchTemplateVersion)
+
+	c.compareSets(DriftRouting, resource, id, "vpc_zone_identifier", attrStringList(resource.Values, "vpc_zone_identifier"), asg.Subnets)
+	c.compareSets(DriftRouting, resource, id, "target_group_arns", attrStringList(resource.Values, "target_group_arns"), asg.TargetGroupARNs)
+
+	tags := map[string]string{}
+	for _, block := range attrBlocks(resource.Values, "tag") {
+		tags[attrString(block, "key")] = attrString(block, "value")
+	}
+	c.compareTags(resource, id, "tag", tags, asg.Tags)
+	return nil
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// Exit codes of `terraform plan -detailed-exitcode`
+const (
+	planExitCodeNoChanges = 0
+	planExitCodeChanges   = 2
+)
+
+// AttributeChange is an attribute a plan would change
+type AttributeChange struct {
+	// Path is the attribute path, e.g. tags.Name or block_device_mappings[0].ebs[0].volume_size
+	Path   string
+	Before interface{}
+	After  interface{}
+	// Unknown is set when the new value is only known after apply
+	Unknown bool
+}
+
+// PendingChange is a resource a plan would change
+type PendingChange struct {
+	Address string
+	// Action is create, update, delete or replace, or added, removed or changed
+	// for the differences to a plan snapshot
+	Action string
+	// Attributes lists the changed attributes of updated and replaced resources
+	Attributes []AttributeChange
+}
+
+// PendingChanges returns the resources a plan would change, sorted by address
+func PendingChanges(plan *terraform.PlanStruct) []PendingChange {
+	var changes []PendingChange
+	for address, resource := range plan.ResourceChangesMap {
+		if resource == nil || resource.Change == nil {
+			continue
+		}
+		actions := resource.Change.Actions
+		if actions.NoOp() || actions.Read() {
+			continue
+		}
+
+		change := PendingChange{Address: address}
+		switch {
+		case actions.Replace():
+			change.Action = "replace"
+		case actions.Create():
+			change.Action = "create"
+		case actions.Delete():
+			change.Action = "delete"
+		default:
+			change.Action = "update"
+		}
+		if change.Action == "update" || change.Action == "replace" {
+			change.Attributes = diffAttributes("", resource.Change.Before, resource.Change.After, resource.Change.AfterUnknown)
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+	return changes
+}
+
+// diffAttributes walks before and after in step and returns the leaves that differ.
+// unknown mirrors after, with true where a value is only known after apply.
+func diffAttributes(path string, before, after, unknown interface{}) []AttributeChange {
+	if isUnknown, _ := unknown.(bool); isUnknown {
+		return []AttributeChange{{Path: path, Before: before, Unknown: true}}
+	}
+
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		unknownMap, _ := unknown.(map[string]interface{})
+		keys := make(map[string]bool)
+		for key := range beforeMap {
+			keys[key] = true
+		}
+		for key := range afterMap {
+			keys[key] = true
+		}
+		for key := range unknownMap {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		var changes []AttributeChange
+		for _, key := range sorted {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			changes = append(changes, diffAttributes(childPath, beforeMap[key], afterMap[key], unknownMap[key])...)
+		}
+		return changes
+	}
+
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList && len(beforeList) == len(afterList) {
+		unknownList, _ := unknown.([]interface{})
+		var changes []AttributeChange
+		for i := range beforeList {
+			var childUnknown interface{}
+			if i < len(unknownList) {
+				childUnknown = unknownList[i]
+			}
+			changes = append(changes, diffAttributes(fmt.Sprintf("%s[%d]", path, i), beforeList[i], afterList[i], childUnknown)...)
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	return []AttributeChange{{Path: path, Before: before, After: after}}
+}
+
+// FormatPendingChanges renders the changes as one resource per line, followed by
+// the attributes that would change
+func FormatPendingChanges(changes []PendingChange) string {
+	var b strings.Builder
+	for _, change := range changes {
+		fmt.Fprintf(&b, "  %s (%s)\n", change.Address, change.Action)
+		for _, attribute := range change.Attributes {
+			after := "(known after apply)"
+			if !attribute.Unknown {
+				after = formatPlanValue(attribute.After)
+			}
+			fmt.Fprintf(&b, "      %s: %s => %s\n", attribute.Path, formatPlanValue(attribute.Before), after)
+		}
+	}
+	return b.String()
+}
+
+// formatPlanValue renders a value as JSON, shortened so long values such as
+// user data or policies do not drown the report
+func formatPlanValue(value interface{}) string {
+	const maxLength = 60
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	if s := string(encoded); len(s) <= maxLength {
+		return s
+	} else {
+		return s[:maxLength] + "..."
+	}
+}
+
+// PlanChangesE runs `terraform plan -detailed-exitcode` against an applied module
+// and returns the changes a second apply would make, if any. The plan file is
+// written to planDir.
+func PlanChangesE(t testing.TestingT, options *terraform.Options, planDir string) ([]PendingChange, error) {
+	planOptions, err := options.Clone()
+	if err != nil {
+		return nil, err
+	}
+	planOptions.PlanFilePath = filepath.Join(planDir, "idempotency.tfplan")
+
+	args := terraform.FormatArgs(planOptions, "plan", "-input=false", "-detailed-exitcode")
+	exitCode, err := terraform.GetExitCodeForTerraformCommandE(t, planOptions, args...)
+	if err != nil {
+		return nil, err
+	}
+	switch exitCode {
+	case planExitCodeNoChanges:
+		return nil, nil
+	case planExitCodeChanges:
+		plan, err := terraform.ShowWithStructE(t, planOptions)
+		if err != nil {
+			return nil, err
+		}
+		return PendingChanges(plan), nil
+	default:
+		return nil, fmt.Errorf("terraform plan failed with exit code %d", exitCode)
+	}
+}
+
+// AssertIdempotent fails the test if planning the applied module again is not
+// empty, listing the resources and attributes that would change
+func AssertIdempotent(t testing.TestingT, options *terraform.Options, planDir string) {
+	changes, err := PlanChangesE(t, options, planDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) > 0 {
+		t.Errorf("%s does not converge, a second apply would change %d resources:\n%s",
+			options.TerraformDir, len(changes), FormatPendingChanges(changes))
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecondPlanJSON = `{
+  "format_version": "1.2",
+  "planned_values": {"root_module": {}},
+  "resource_changes": [
+    {
+      "address": "aws_vpc.this", "mode": "managed", "type": "aws_vpc", "name": "this",
+      "change": {"actions": ["no-op"], "before": {"cidr_block": "10.0.0.0/16"}, "after": {"cidr_block": "10.0.0.0/16"}}
+    },
+    {
+      "address": "aws_launch_template.app", "mode": "managed", "type": "aws_launch_template", "name": "app",
+      "change": {
+        "actions": ["update"],
+        "before": {"latest_version": 1, "tags": {"Project": "demo", "Owner": "ops"},
+                   "block_device_mappings": [{"ebs": [{"volume_size": 30}]}]},
+        "after": {"tags": {"Project": "demo"},
+                  "block_device_mappings": [{"ebs": [{"volume_size": 20}]}]},
+        "after_unknown": {"latest_version": true}
+      }
+    },
+    {
+      "address": "aws_autoscaling_group.app", "mode": "managed", "type": "aws_autoscaling_group", "name": "app",
+      "change": {"actions": ["delete", "create"], "before": {"name": "demo-ci-asg"}, "after": {"name": "demo-ci-asg-2"}}
+    },
+    {
+      "address": "aws_eip.nat", "mode": "managed", "type": "aws_eip", "name": "nat",
+      "change": {"actions": ["create"], "before": null, "after": {"domain": "vpc"}}
+    }
+  ]
+}`
+
+func TestPendingChanges(t *testing.T) {
+	plan, err := terraform.ParsePlanJSON(testSecondPlanJSON)
+	require.NoError(t, err)
+
+	changes := PendingChanges(plan)
+	require.Len(t, changes, 3)
+
+	assert.Equal(t, PendingChange{
+		Address: "aws_autoscaling_group.app",
+		Action:  "replace",
+		Attributes: []AttributeChange{
+			{Path: "name", Before: "demo-ci-asg", After: "demo-ci-asg-2"},
+		},
+	}, changes[0])
+	assert.Equal(t, PendingChange{Address: "aws_eip.nat", Action: "create"}, changes[1])
+
+	assert.Equal(t, `  aws_autoscaling_group.app (replace)
+      name: "demo-ci-asg" => "demo-ci-asg-2"
+  aws_eip.nat (create)
+  aws_launch_template.app (update)
+      block_device_mappings[0].ebs[0].volume_size: 30 => 20
+      latest_version: 1 => (known after apply)
+      tags.Owner: "ops" => null
+`, FormatPendingChanges(changes))
+}
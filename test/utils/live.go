@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// LiveALB is a deployed load balancer as the ALB module configures it
+type LiveALB struct {
+	ARN                string
+	Name               string
+	DNSName            string
+	Type               string
+	Scheme             string
+	VpcID              string
+	SecurityGroups     []string
+	DeletionProtection bool
+	Tags               []Tag
+}
+
+// LiveTargetGroup is a deployed target group
+type LiveTargetGroup struct {
+	ARN                string
+	Name               string
+	VpcID              string
+	Protocol           string
+	Port               int
+	HealthCheckPath    string
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	Tags               []Tag
+}
+
+// LiveVolume is an EBS volume of a launch template
+type LiveVolume struct {
+	DeviceName string
+	VolumeSize int
+	VolumeType string
+}
+
+// LiveLaunchTemplate is the latest version of a deployed launch template
+type LiveLaunchTemplate struct {
+	ID            string
+	LatestVersion int
+	InstanceType  string
+	Volumes       []LiveVolume
+	// SecurityGroups are those of the network interfaces, or of the template
+	// itself when it does not configure network interfaces
+	SecurityGroups    []string
+	HTTPTokens        string
+	AssociatePublicIP bool
+	// TagSpecifications holds the tags applied at launch by resource type, e.g. "instance"
+	TagSpecifications map[string][]Tag
+	Tags              []Tag
+}
+
+// LiveAutoScalingGroup is a deployed Auto Scaling group
+type LiveAutoScalingGroup struct {
+	Name                  string
+	DesiredCapacity       int
+	MinSize               int
+	MaxSize               int
+	Subnets               []string
+	TargetGroupARNs       []string
+	LaunchTemplateID      string
+	LaunchTemplateVersion string
+	Tags                  []Tag
+}
+
+// DescribeALBE returns the load balancer with the given name, with its
+// deletion protection and tags
+func DescribeALBE(client ELBv2API, name string) (*LiveALB, error) {
+	result, err := client.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
+		Names: []*string{aws.String(name)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.LoadBalancers) != 1 {
+		return nil, fmt.Errorf("expected 1 load balancer named %s, found %d", name, len(result.LoadBalancers))
+	}
+	lb := result.LoadBalancers[0]
+	alb := &LiveALB{
+		ARN:            aws.StringValue(lb.LoadBalancerArn),
+		Name:           aws.StringValue(lb.LoadBalancerName),
+		DNSName:        aws.StringValue(lb.DNSName),
+		Type:           aws.StringValue(lb.Type),
+		Scheme:         aws.StringValue(lb.Scheme),
+		VpcID:          aws.StringValue(lb.VpcId),
+		SecurityGroups: aws.StringValueSlice(lb.SecurityGroups),
+	}
+
+	attributes, err := client.DescribeLoadBalancerAttributes(&elbv2.DescribeLoadBalancerAttributesInput{
+		LoadBalancerArn: lb.LoadBalancerArn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, attribute := range attributes.Attributes {
+		if aws.StringValue(attribute.Key) == DeletionProtectionAttribute {
+			alb.DeletionProtection = aws.StringValue(attribute.Value) == "true"
+		}
+	}
+
+	tags, err := describeELBv2Tags(client, alb.ARN)
+	if err != nil {
+		return nil, err
+	}
+	alb.Tags = tags[alb.ARN]
+	return alb, nil
+}
+
+// describeELBv2Tags returns the tags of load balancers and target groups by ARN
+func describeELBv2Tags(client ELBv2API, arns ...string) (map[string][]Tag, error) {
+	result, err := client.DescribeTags(&elbv2.DescribeTagsInput{ResourceArns: aws.StringSlice(arns)})
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string][]Tag, len(result.TagDescriptions))
+	for _, description := range result.TagDescriptions {
+		tags[aws.StringValue(description.ResourceArn)] = ELBv2Tags(description.Tags)
+	}
+	return tags, nil
+}
+
+// DescribeTargetGroupsE returns the target groups with the given ARNs, with their
+// tags, in the same order
+func DescribeTargetGroupsE(client ELBv2API, arns []string) ([]LiveTargetGroup, error) {
+	if len(arns) == 0 {
+		return nil, nil
+	}
+	result, err := client.DescribeTargetGroups(&elbv2.DescribeTargetGroupsInput{
+		TargetGroupArns: aws.StringSlice(arns),
+	})
+	if err != nil {
+		return nil, err
+	}
+	byArn := make(map[string]*elbv2.TargetGroup, len(result.TargetGroups))
+	for _, tg := range result.TargetGroups {
+		byArn[aws.StringValue(tg.TargetGroupArn)] = tg
+	}
+	tags, err := describeELBv2Tags(client, arns...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]LiveTargetGroup, 0, len(arns))
+	for _, arn := range arns {
+		tg, ok := byArn[arn]
+		if !ok {
+			return nil, fmt.Errorf("target group %s not found", arn)
+		}
+		groups = append(groups, LiveTargetGroup{
+			ARN:                arn,
+			Name:               aws.StringValue(tg.TargetGroupName),
+			VpcID:              aws.StringValue(tg.VpcId),
+			Protocol:           aws.StringValue(tg.Protocol),
+			Port:               int(aws.Int64Value(tg.Port)),
+			HealthCheckPath:    aws.StringValue(tg.HealthCheckPath),
+			HealthyThreshold:   int(aws.Int64Value(tg.HealthyThresholdCount)),
+			UnhealthyThreshold: int(aws.Int64Value(tg.UnhealthyThresholdCount)),
+			Tags:               tags[arn],
+		})
+	}
+	return groups, nil
+}
+
+// DescribeListenerRulesE returns the rules of the load balancer's listener with
+// the given protocol, e.g. "HTTPS"
+func DescribeListenerRulesE(client ELBv2API, loadBalancerArn, protocol string) ([]*elbv2.Rule, error) {
+	listeners, err := client.DescribeListeners(&elbv2.DescribeListenersInput{
+		LoadBalancerArn: aws.String(loadBalancerArn),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, listener := range listeners.Listeners {
+		if listener != nil && aws.StringValue(listener.Protocol) == protocol {
+			rules, err := client.DescribeRules(&elbv2.DescribeRulesInput{ListenerArn: listener.ListenerArn})
+			if err != nil {
+				return nil, err
+			}
+			return rules.Rules, nil
+		}
+	}
+	return nil, fmt.Errorf("%s listener not found on %s", protocol, loadBalancerArn)
+}
+
+// DescribeSecurityGroupsE returns the security groups with the given IDs, in the same order
+func DescribeSecurityGroupsE(client EC2API, ids ...string) ([]*ec2.SecurityGroup, error) {
+	result, err := client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		GroupIds: aws.StringSlice(ids),
+	})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*ec2.SecurityGroup, len(result.SecurityGroups))
+	for _, group := range result.SecurityGroups {
+		byID[aws.StringValue(group.GroupId)] = group
+	}
+	groups := make([]*ec2.SecurityGroup, 0, len(ids))
+	for _, id := range ids {
+		group, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("security group %s not found", id)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// DescribeLaunchTemplateE returns the latest version of the launch template
+func DescribeLaunchTemplateE(client EC2API, id string) (*LiveLaunchTemplate, error) {
+	result, err := client.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateIds: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.LaunchTemplates) != 1 {
+		return nil, fmt.Errorf("expected 1 launch template %s, found %d", id, len(result.LaunchTemplates))
+	}
+
+	versions, err := client.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId: aws.String(id),
+		Versions:         []*string{aws.String("$Latest")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(versions.LaunchTemplateVersions) != 1 || versions.LaunchTemplateVersions[0].LaunchTemplateData == nil {
+		return nil, fmt.Errorf("launch template %s has no latest version", id)
+	}
+	data := versions.LaunchTemplateVersions[0].LaunchTemplateData
+
+	lt := &LiveLaunchTemplate{
+		ID:                id,
+		LatestVersion:     int(aws.Int64Value(result.LaunchTemplates[0].LatestVersionNumber)),
+		InstanceType:      aws.StringValue(data.InstanceType),
+		SecurityGroups:    aws.StringValueSlice(data.SecurityGroupIds),
+		TagSpecifications: map[string][]Tag{},
+		Tags:              EC2Tags(result.LaunchTemplates[0].Tags),
+	}
+	for _, mapping := range data.BlockDeviceMappings {
+		volume := LiveVolume{DeviceName: aws.StringValue(mapping.DeviceName)}
+		if mapping.Ebs != nil {
+			volume.VolumeSize = int(aws.Int64Value(mapping.Ebs.VolumeSize))
+			volume.VolumeType = aws.StringValue(mapping.Ebs.VolumeType)
+		}
+		lt.Volumes = append(lt.Volumes, volume)
+	}
+	for _, networkInterface := range data.NetworkInterfaces {
+		lt.SecurityGroups = append(lt.SecurityGroups, aws.StringValueSlice(networkInterface.Groups)...)
+		lt.AssociatePublicIP = lt.AssociatePublicIP || aws.BoolValue(networkInterface.AssociatePublicIpAddress)
+	}
+	if data.MetadataOptions != nil {
+		lt.HTTPTokens = aws.StringValue(data.MetadataOptions.HttpTokens)
+	}
+	for _, specification := range data.TagSpecifications {
+		lt.TagSpecifications[aws.StringValue(specification.ResourceType)] = EC2Tags(specification.Tags)
+	}
+	return lt, nil
+}
+
+// DescribeAutoScalingGroupE returns the Auto Scaling group with the given name
+func DescribeAutoScalingGroupE(client AutoScalingAPI, name string) (*LiveAutoScalingGroup, error) {
+	result, err := client.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(name)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.AutoScalingGroups) != 1 {
+		return nil, fmt.Errorf("expected 1 auto scaling group named %s, found %d", name, len(result.AutoScalingGroups))
+	}
+	group := result.AutoScalingGroups[0]
+
+	asg := &LiveAutoScalingGroup{
+		Name:            aws.StringValue(group.AutoScalingGroupName),
+		DesiredCapacity: int(aws.Int64Value(group.DesiredCapacity)),
+		MinSize:         int(aws.Int64Value(group.MinSize)),
+		MaxSize:         int(aws.Int64Value(group.MaxSize)),
+		TargetGroupARNs: aws.StringValueSlice(group.TargetGroupARNs),
+		Tags:            AutoScalingTags(group.Tags),
+	}
+	if zones := aws.StringValue(group.VPCZoneIdentifier); zones != "" {
+		asg.Subnets = strings.Split(zones, ",")
+	}
+	if group.LaunchTemplate != nil {
+		asg.LaunchTemplateID = aws.StringValue(group.LaunchTemplate.LaunchTemplateId)
+		asg.LaunchTemplateVersion = aws.StringValue(group.LaunchTemplate.Version)
+	}
+	return asg, nil
+}
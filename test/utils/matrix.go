@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+)
+
+const (
+	// MatrixFileEnvVar overrides the path of the test matrix
+	MatrixFileEnvVar = "TERRATEST_MATRIX"
+	// MatrixIncludeEnvVar and MatrixExcludeEnvVar hold comma separated glob patterns
+	// selecting the matrix cases to run, see MatrixCase.Matches
+	MatrixIncludeEnvVar = "TERRATEST_INCLUDE"
+	MatrixExcludeEnvVar = "TERRATEST_EXCLUDE"
+
+	// DefaultMatrixFile is the matrix the module tests run, relative to the test directory
+	DefaultMatrixFile = "matrix.json"
+	// DefaultAppSet names the DefaultApps, available to every matrix
+	DefaultAppSet = "default"
+)
+
+// Tests a matrix case can run in
+const (
+	MatrixTestVPC     = "vpc"
+	MatrixTestALB     = "alb"
+	MatrixTestCompute = "compute"
+	MatrixTestE2E     = "e2e"
+	MatrixTestUpgrade = "upgrade"
+)
+
+// MatrixCase is one region and environment the tests deploy to, with the inputs
+// of the modules
+type MatrixCase struct {
+	Name        string `json:"name"`
+	Region      string `json:"region"`
+	Environment string `json:"environment"`
+	// ProjectName is generated by each test when empty
+	ProjectName   string `json:"project_name,omitempty"`
+	VPCCIDR       string `json:"vpc_cidr,omitempty"`
+	InstanceType  string `json:"instance_type,omitempty"`
+	InstanceCount int    `json:"instance_count,omitempty"`
+	// AppSet names one of the matrix's app sets, DefaultAppSet if empty
+	AppSet string `json:"apps,omitempty"`
+	// Tests lists the tests that run the case
+	Tests []string `json:"tests"`
+	// Tags are extra names include and exclude patterns can select the case by
+	Tags []string `json:"tags,omitempty"`
+	// Manual cases only run when an include pattern selects them, e.g. because
+	// they are slow or expensive
+	Manual bool `json:"manual,omitempty"`
+
+	// Apps is the resolved app set
+	Apps Apps `json:"-"`
+}
+
+// Matrix is the set of cases the module tests expand into subtests
+type Matrix struct {
+	// AppSets are the named values of the `apps` variable cases can use
+	AppSets map[string]Apps `json:"app_sets,omitempty"`
+	// Budgets are the monthly cost each environment may reach, in the currency of
+	// the price table, see EstimateCostE
+	Budgets map[string]float64 `json:"budgets,omitempty"`
+	Cases   []MatrixCase       `json:"cases"`
+}
+
+// LoadMatrix reads and validates a matrix, filling in the defaults of every case
+func LoadMatrix(file string) (*Matrix, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var matrix Matrix
+	if err := json.Unmarshal(data, &matrix); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if err := matrix.resolve(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &matrix, nil
+}
+
+// MatrixFile returns the matrix the tests should run, DefaultMatrixFile unless
+// MatrixFileEnvVar is set
+func MatrixFile() string {
+	if file := os.Getenv(MatrixFileEnvVar); file != "" {
+		return file
+	}
+	return DefaultMatrixFile
+}
+
+var matrixTests = []string{MatrixTestVPC, MatrixTestALB, MatrixTestCompute, MatrixTestE2E, MatrixTestUpgrade}
+
+func (m *Matrix) resolve() error {
+	if m.AppSets == nil {
+		m.AppSets = map[string]Apps{}
+	}
+	if _, ok := m.AppSets[DefaultAppSet]; !ok {
+		m.AppSets[DefaultAppSet] = DefaultApps()
+	}
+	for name, apps := range m.AppSets {
+		if err := apps.Validate(); err != nil {
+			return fmt.Errorf("app set %s: %w", name, err)
+		}
+	}
+
+	// Budgets, once there are any, are keyed by the environments of the cases
+	environments := make(map[string]bool)
+	for _, c := range m.Cases {
+		environments[c.Environment] = true
+	}
+	for environment, budget := range m.Budgets {
+		if budget <= 0 {
+			return fmt.Errorf("budget of %s: %g is not positive", environment, budget)
+		}
+		if !environments[environment] {
+			return fmt.Errorf("budget of %s: no case runs in that environment", environment)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range m.Cases {
+		c := &m.Cases[i]
+		if c.Name == "" || c.Region == "" || c.Environment == "" {
+			return fmt.Errorf("case %d: name, region and environment are required", i)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("case %s is defined twice", c.Name)
+		}
+		seen[c.Name] = true
+
+		if _, ok := m.Budgets[c.Environment]; len(m.Budgets) > 0 && !ok {
+			return fmt.Errorf("case %s: no budget for environment %s", c.Name, c.Environment)
+		}
+
+		if len(c.Tests) == 0 {
+			return fmt.Errorf("case %s: no tests to run it in", c.Name)
+		}
+		for _, test := range c.Tests {
+			if !contains(matrixTests, test) {
+				return fmt.Errorf("case %s: unknown test %q, expected one of %s", c.Name, test, strings.Join(matrixTests, ", "))
+			}
+		}
+
+		if c.VPCCIDR == "" {
+			c.VPCCIDR = "10.0.0.0/16"
+		}
+		if _, _, err := net.ParseCIDR(c.VPCCIDR); err != nil {
+			return fmt.Errorf("case %s: %w", c.Name, err)
+		}
+		if c.InstanceType == "" {
+			c.InstanceType = "t3.micro"
+		}
+		if c.InstanceCount == 0 {
+			c.InstanceCount = 2
+		}
+		if c.AppSet == "" {
+			c.AppSet = DefaultAppSet
+		}
+		apps, ok := m.AppSets[c.AppSet]
+		if !ok {
+			return fmt.Errorf("case %s: unknown app set %q", c.Name, c.AppSet)
+		}
+		c.Apps = apps
+	}
+	return nil
+}
+
+// Matches reports whether a glob pattern, as understood by path.Match, matches the
+// case's name, region, environment or one of its tags
+func (c MatrixCase) Matches(pattern string) bool {
+	for _, value := range append([]string{c.Name, c.Region, c.Environment}, c.Tags...) {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the cases run by the test that match an include pattern, or that
+// are not manual when there are none, and match no exclude pattern
+func (m *Matrix) Select(test string, include, exclude []string) []MatrixCase {
+	matchesAny := func(c MatrixCase, patterns []string) bool {
+		for _, pattern := range patterns {
+			if c.Matches(pattern) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var cases []MatrixCase
+	for _, c := range m.Cases {
+		if !contains(c.Tests, test) || matchesAny(c, exclude) {
+			continue
+		}
+		if len(include) > 0 && !matchesAny(c, include) {
+			continue
+		}
+		if c.Manual && len(include) == 0 {
+			continue
+		}
+		cases = append(cases, c)
+	}
+	return cases
+}
+
+// splitPatterns splits a comma separated list of patterns, dropping empty ones
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Run runs fn as a parallel subtest for every case of the test selected by the
+// TERRATEST_INCLUDE and TERRATEST_EXCLUDE environment variables. When a SKIP_<stage>
+// variable is set the stage data lives in the module folder rather than a copy per
+// case, so only a single case may be selected.
+func (m *Matrix) Run(t *testing.T, test string, fn func(t *testing.T, tc MatrixCase)) {
+	cases := m.Select(test, splitPatterns(os.Getenv(MatrixIncludeEnvVar)), splitPatterns(os.Getenv(MatrixExcludeEnvVar)))
+	if len(cases) == 0 {
+		t.Skipf("No %s cases selected by %s=%q and %s=%q", test,
+			MatrixIncludeEnvVar, os.Getenv(MatrixIncludeEnvVar), MatrixExcludeEnvVar, os.Getenv(MatrixExcludeEnvVar))
+	}
+	if len(cases) > 1 && test_structure.SkipStageEnvVarSet() {
+		t.Fatalf("%d %s cases selected, select a single one with %s when skipping stages", len(cases), test, MatrixIncludeEnvVar)
+	}
+
+	for _, testCase := range cases {
+		tc := testCase
+
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			fn(t, tc)
+		})
+	}
+}
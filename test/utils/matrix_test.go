@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func caseNames(cases []MatrixCase) []string {
+	var names []string
+	for _, c := range cases {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestSuiteMatrix(t *testing.T) {
+	matrix, err := LoadMatrix(filepath.Join("..", DefaultMatrixFile))
+	require.NoError(t, err)
+
+	// Manual cases only run when selected
+	assert.Equal(t, []string{"us-east-1-ci"}, caseNames(matrix.Select(MatrixTestVPC, nil, nil)))
+	assert.Equal(t, []string{"us-east-1-prod"}, caseNames(matrix.Select(MatrixTestALB, []string{"prod-like"}, nil)))
+	assert.Equal(t, []string{"us-east-1-ci", "eu-west-1-staging", "us-east-1-prod"}, caseNames(matrix.Select(MatrixTestVPC, []string{"*"}, nil)))
+	assert.Equal(t, []string{"eu-west-1-staging"}, caseNames(matrix.Select(MatrixTestVPC, []string{"*"}, []string{"us-*"})))
+	assert.Empty(t, matrix.Select(MatrixTestE2E, nil, []string{"test"}))
+	assert.Equal(t, []string{"Upgrade Path"}, caseNames(matrix.Select(MatrixTestUpgrade, nil, nil)))
+
+	for _, c := range matrix.Cases {
+		assert.NotEmpty(t, c.Apps, "case %s has no apps", c.Name)
+	}
+	assert.Len(t, matrix.Budgets, 4, "every environment of the matrix has a budget")
+}
+
+func TestLoadMatrix(t *testing.T) {
+	testCases := []struct {
+		name   string
+		matrix string
+		err    string
+	}{
+		{
+			name:   "defaults",
+			matrix: `{"cases": [{"name": "ci", "region": "us-east-1", "environment": "ci", "tests": ["vpc"]}]}`,
+		},
+		{
+			name:   "unknown test",
+			matrix: `{"cases": [{"name": "ci", "region": "us-east-1", "environment": "ci", "tests": ["vcp"]}]}`,
+			err:    `case ci: unknown test "vcp"`,
+		},
+		{
+			name:   "unknown app set",
+			matrix: `{"cases": [{"name": "ci", "region": "us-east-1", "environment": "ci", "apps": "big", "tests": ["alb"]}]}`,
+			err:    `case ci: unknown app set "big"`,
+		},
+		{
+			name: "invalid app set",
+			matrix: `{"app_sets": {"big": {"app1": {"port": 0, "path": "/app1/*", "health_check_url": "/app1/status", "domain": ["a.example.com"], "priority": 1}}},
+			          "cases": [{"name": "ci", "region": "us-east-1", "environment": "ci", "apps": "big", "tests": ["alb"]}]}`,
+			err: "app set big: invalid apps: app app1: port 0",
+		},
+		{
+			name: "duplicate case",
+			matrix: `{"cases": [{"name": "ci", "region": "us-east-1", "environment": "ci", "tests": ["vpc"]},
+			                    {"name": "ci", "region": "eu-west-1", "environment": "ci", "tests": ["vpc"]}]}`,
+			err: "case ci is defined twice",
+		},
+		{
+			name:   "missing region",
+			matrix: `{"cases": [{"name": "ci", "environment": "ci", "tests": ["vpc"]}]}`,
+			err:    "case 0: name, region and environment are required",
+		},
+		{
+			name:   "invalid budget",
+			matrix: `{"budgets": {"prod": 0}, "cases": [{"name": "ci", "region": "us-east-1", "environment": "ci", "tests": ["vpc"]}]}`,
+			err:    "budget of prod: 0 is not positive",
+		},
+		{
+			name:   "budget of an environment without cases",
+			matrix: `{"budgets": {"ci": 100, "dev": 100}, "cases": [{"name": "ci", "region": "us-east-1", "environment": "ci", "tests": ["vpc"]}]}`,
+			err:    "budget of dev: no case runs in that environment",
+		},
+		{
+			name:   "environment without a budget",
+			matrix: `{"budgets": {"ci": 100}, "cases": [{"name": "ci", "region": "us-east-1", "environment": "ci", "tests": ["vpc"]}, {"name": "e2e", "region": "us-east-1", "environment": "test", "tests": ["e2e"]}]}`,
+			err:    "case e2e: no budget for environment test",
+		},
+	}
+
+	for _, tc := range testCases {
+		file := filepath.Join(t.TempDir(), "matrix.json")
+		require.NoError(t, os.WriteFile(file, []byte(tc.matrix), 0o644))
+
+		matrix, err := LoadMatrix(file)
+		if tc.err != "" {
+			require.Error(t, err, tc.name)
+			assert.Contains(t, err.Error(), tc.err, tc.name)
+			continue
+		}
+		require.NoError(t, err, tc.name)
+		c := matrix.Cases[0]
+		assert.Equal(t, "10.0.0.0/16", c.VPCCIDR)
+		assert.Equal(t, "t3.micro", c.InstanceType)
+		assert.Equal(t, 2, c.InstanceCount)
+		assert.Equal(t, DefaultApps(), c.Apps)
+	}
+}
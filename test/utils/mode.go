@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TestModeEnvVar is the environment variable used to select how the module tests run
+const TestModeEnvVar = "TERRATEST_MODE"
+
+const (
+	// ModeApply deploys the modules with `terraform apply` and verifies them against AWS
+	ModeApply = "apply"
+	// ModePlan only runs `terraform plan` and verifies the planned values, nothing is
+	// deployed. The plans are made against the fake endpoint, see InitAndPlanOffline.
+	ModePlan = "plan"
+)
+
+// TestModeE returns the selected test mode. The TERRATEST_MODE environment variable
+// takes precedence over the default chosen at build time with the `plan` build tag.
+// A value other than apply or plan is an error, so a typo never falls back to a
+// deploy.
+func TestModeE() (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv(TestModeEnvVar)))
+	switch mode {
+	case "":
+		return defaultTestMode, nil
+	case ModeApply, ModePlan:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%s=%q: must be %q or %q", TestModeEnvVar, os.Getenv(TestModeEnvVar), ModeApply, ModePlan)
+}
+
+// TestMode is like TestModeE but panics on an unknown mode. TestMain checks the
+// mode first, so the tests never get there.
+func TestMode() string {
+	mode, err := TestModeE()
+	if err != nil {
+		panic(err)
+	}
+	return mode
+}
+
+// IsPlanMode reports whether the tests should only plan instead of deploying
+func IsPlanMode() bool {
+	return TestMode() == ModePlan
+}
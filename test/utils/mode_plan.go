@@ -0,0 +1,6 @@
+//go:build plan
+
+package utils
+
+// defaultTestMode is used when TERRATEST_MODE is not set
+const defaultTestMode = ModePlan
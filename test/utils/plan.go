@@ -0,0 +1,436 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+
+	"test/fakeaws"
+)
+
+// Placeholder inputs used when a module is only planned. The modules never look
+// these up, so they only have to be well formed.
+const (
+	PlanVPCID              = "vpc-0123456789abcdef0"
+	PlanALBSecurityGroupID = "sg-0123456789abcdef0"
+	PlanCertificateArn     = "arn:aws:acm:us-east-1:123456789012:certificate/00000000-0000-0000-0000-000000000000"
+)
+
+// PlanPublicSubnets returns placeholder public subnet IDs for plan-only runs
+func PlanPublicSubnets() []string {
+	return []string{"subnet-0a000000000000001", "subnet-0a000000000000002", "subnet-0a000000000000003"}
+}
+
+// PlanPrivateSubnets returns placeholder private subnet IDs for plan-only runs
+func PlanPrivateSubnets() []string {
+	return []string{"subnet-0b000000000000001", "subnet-0b000000000000002", "subnet-0b000000000000003"}
+}
+
+// PlanTargetGroupArns returns placeholder target group ARNs, one per app name
+func PlanTargetGroupArns(region string, appNames []string) []string {
+	arns := make([]string, 0, len(appNames))
+	for i, name := range appNames {
+		arns = append(arns, fmt.Sprintf("arn:aws:elasticloadbalancing:%s:123456789012:targetgroup/%s/%016x", region, name, i+1))
+	}
+	return arns
+}
+
+// InitAndPlan runs `terraform init`, `terraform plan -out` and `terraform show -json`
+// for the given options and returns the parsed plan. The plan file is written to planDir.
+func InitAndPlan(t testing.TestingT, options *terraform.Options, planDir string) *terraform.PlanStruct {
+	options.PlanFilePath = filepath.Join(planDir, "terraform.tfplan")
+	return terraform.InitAndPlanAndShowWithStruct(t, options)
+}
+
+// offlineProviderFile is the provider configuration InitAndPlanOffline adds to the
+// planned configuration
+const offlineProviderFile = "zz_offline_provider.tf"
+
+// InitAndPlanOffline is InitAndPlan without an AWS account. The lookups made while
+// planning (the AZs, the AMI and the caller identity of the flow log role) are
+// answered by a fake endpoint, which the AWS provider is pointed at with dummy
+// credentials. The provider configuration is written to options.TerraformDir, so
+// it must be a copy such as the one made by CopyTerraformFolderToTemp.
+// `terraform init` still downloads the providers and modules.
+func InitAndPlanOffline(t testing.TestingT, options *terraform.Options, planDir string) *terraform.PlanStruct {
+	region := options.EnvVars["AWS_DEFAULT_REGION"]
+	if region == "" {
+		t.Fatal("planning offline needs AWS_DEFAULT_REGION in the options' EnvVars")
+	}
+
+	server := fakeaws.NewServer(planFixtures(region))
+	defer server.Close()
+
+	if err := os.WriteFile(filepath.Join(options.TerraformDir, offlineProviderFile), []byte(offlineProvider(region, server.URL)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return InitAndPlan(t, options, planDir)
+}
+
+// offlineProvider returns an AWS provider configuration that sends every call made
+// while planning to endpoint, without checking the credentials or the account
+func offlineProvider(region, endpoint string) string {
+	return fmt.Sprintf(`provider "aws" {
+  region     = %[1]q
+  access_key = "fake"
+  secret_key = "fake"
+
+  skip_credentials_validation = true
+  skip_requesting_account_id  = true
+  skip_metadata_api_check     = true
+  skip_region_validation      = true
+
+  endpoints {
+    ec2 = %[2]q
+    iam = %[2]q
+    sts = %[2]q
+  }
+}
+`, region, endpoint)
+}
+
+// planFixtures returns what the modules look up while planning in region: three
+// available AZs and an Amazon Linux 2 AMI
+func planFixtures(region string) *fakeaws.Fixtures {
+	fixtures := &fakeaws.Fixtures{
+		Images: []*ec2.Image{{
+			ImageId:            aws.String("ami-0123456789abcdef0"),
+			Name:               aws.String("amzn2-ami-hvm-2.0.20241001.0-x86_64-gp2"),
+			ImageOwnerAlias:    aws.String("amazon"),
+			OwnerId:            aws.String("137112412989"),
+			Architecture:       aws.String(ec2.ArchitectureValuesX8664),
+			State:              aws.String(ec2.ImageStateAvailable),
+			CreationDate:       aws.String("2024-10-01T00:00:00.000Z"),
+			RootDeviceName:     aws.String("/dev/xvda"),
+			RootDeviceType:     aws.String(ec2.DeviceTypeEbs),
+			VirtualizationType: aws.String(ec2.VirtualizationTypeHvm),
+		}},
+	}
+	for i, suffix := range []string{"a", "b", "c"} {
+		fixtures.AvailabilityZones = append(fixtures.AvailabilityZones, &ec2.AvailabilityZone{
+			ZoneName:   aws.String(region + suffix),
+			ZoneId:     aws.String(fmt.Sprintf("%s-az%d", region, i+1)),
+			RegionName: aws.String(region),
+			State:      aws.String(ec2.AvailabilityZoneStateAvailable),
+		})
+	}
+	return fixtures
+}
+
+// SubnetPlan holds the planned values of a subnet
+type SubnetPlan struct {
+	Address             string
+	CIDR                string
+	AvailabilityZone    string
+	MapPublicIPOnLaunch bool
+	Tags                map[string]string
+}
+
+// VPCPlan holds the planned values of the VPC module
+type VPCPlan struct {
+	CIDR               string
+	EnableDNSHostnames bool
+	EnableDNSSupport   bool
+	PrivateSubnets     []SubnetPlan
+	PublicSubnets      []SubnetPlan
+	NATGateways        int
+	// PrivateRouteTables is one per NAT gateway, as each routes its AZ through its own
+	PrivateRouteTables int
+	FlowLogs           int
+	Tags               map[string]string
+}
+
+// TargetGroupPlan holds the planned values of an app target group
+type TargetGroupPlan struct {
+	Address            string
+	Port               int
+	Protocol           string
+	HealthCheckPath    string
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	Tags               map[string]string
+}
+
+// ListenerRulePlan holds the planned values of an app listener rule
+type ListenerRulePlan struct {
+	Address      string
+	Priority     int
+	PathPatterns []string
+	HostHeaders  []string
+}
+
+// ALBPlan holds the planned values of the ALB module. Target groups and
+// listener rules are keyed by app name.
+type ALBPlan struct {
+	Name                     string
+	Internal                 bool
+	LoadBalancerType         string
+	EnableDeletionProtection bool
+	Tags                     map[string]string
+	TargetGroups             map[string]TargetGroupPlan
+	ListenerRules            map[string]ListenerRulePlan
+}
+
+// EBSVolumePlan holds the planned EBS settings of a launch template block device
+type EBSVolumePlan struct {
+	DeviceName string
+	VolumeSize int
+	VolumeType string
+}
+
+// LaunchTemplatePlan holds the planned values of the compute launch template
+type LaunchTemplatePlan struct {
+	InstanceType string
+	Volumes      []EBSVolumePlan
+	Tags         map[string]string
+}
+
+// AutoScalingGroupPlan holds the planned sizing of the compute autoscaling group
+type AutoScalingGroupPlan struct {
+	Name            string
+	DesiredCapacity int
+	MinSize         int
+	MaxSize         int
+}
+
+// ComputePlan holds the planned values of the compute module
+type ComputePlan struct {
+	LaunchTemplate   LaunchTemplatePlan
+	AutoScalingGroup AutoScalingGroupPlan
+}
+
+// plannedResource is a managed resource from the planned values
+type plannedResource struct {
+	Address string
+	Type    string
+	Name    string
+	Index   interface{}
+	Values  map[string]interface{}
+}
+
+// plannedResources returns the managed resources of the given type and name, in any module,
+// sorted by address. An empty name matches every resource of the type.
+func plannedResources(plan *terraform.PlanStruct, resourceType, name string) []plannedResource {
+	var resources []plannedResource
+	for address, resource := range plan.ResourcePlannedValuesMap {
+		if resource == nil || resource.Mode != "managed" || resource.Type != resourceType {
+			continue
+		}
+		if name != "" && resource.Name != name {
+			continue
+		}
+		resources = append(resources, plannedResource{
+			Address: address,
+			Type:    resource.Type,
+			Name:    resource.Name,
+			Index:   resource.Index,
+			Values:  resource.AttributeValues,
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Address < resources[j].Address })
+	return resources
+}
+
+// ParseVPCPlan extracts the VPC module resources from a plan
+func ParseVPCPlan(plan *terraform.PlanStruct) VPCPlan {
+	var vpcPlan VPCPlan
+	for _, vpc := range plannedResources(plan, "aws_vpc", "this") {
+		vpcPlan.CIDR = attrString(vpc.Values, "cidr_block")
+		vpcPlan.EnableDNSHostnames = attrBool(vpc.Values, "enable_dns_hostnames")
+		vpcPlan.EnableDNSSupport = attrBool(vpc.Values, "enable_dns_support")
+		vpcPlan.Tags = attrStringMap(vpc.Values, "tags")
+	}
+	for _, subnet := range plannedResources(plan, "aws_subnet", "private") {
+		vpcPlan.PrivateSubnets = append(vpcPlan.PrivateSubnets, parseSubnetPlan(subnet))
+	}
+	for _, subnet := range plannedResources(plan, "aws_subnet", "public") {
+		vpcPlan.PublicSubnets = append(vpcPlan.PublicSubnets, parseSubnetPlan(subnet))
+	}
+	vpcPlan.NATGateways = len(plannedResources(plan, "aws_nat_gateway", ""))
+	vpcPlan.PrivateRouteTables = len(plannedResources(plan, "aws_route_table", "private"))
+	vpcPlan.FlowLogs = len(plannedResources(plan, "aws_flow_log", ""))
+	return vpcPlan
+}
+
+func parseSubnetPlan(subnet plannedResource) SubnetPlan {
+	return SubnetPlan{
+		Address:             subnet.Address,
+		CIDR:                attrString(subnet.Values, "cidr_block"),
+		AvailabilityZone:    attrString(subnet.Values, "availability_zone"),
+		MapPublicIPOnLaunch: attrBool(subnet.Values, "map_public_ip_on_launch"),
+		Tags:                attrStringMap(subnet.Values, "tags"),
+	}
+}
+
+// ParseALBPlan extracts the ALB module resources from a plan
+func ParseALBPlan(plan *terraform.PlanStruct) ALBPlan {
+	albPlan := ALBPlan{
+		TargetGroups:  map[string]TargetGroupPlan{},
+		ListenerRules: map[string]ListenerRulePlan{},
+	}
+	for _, lb := range plannedResources(plan, "aws_lb", "main") {
+		albPlan.Name = attrString(lb.Values, "name")
+		albPlan.Internal = attrBool(lb.Values, "internal")
+		albPlan.LoadBalancerType = attrString(lb.Values, "load_balancer_type")
+		albPlan.EnableDeletionProtection = attrBool(lb.Values, "enable_deletion_protection")
+		albPlan.Tags = attrStringMap(lb.Values, "tags")
+	}
+	for _, tg := range plannedResources(plan, "aws_lb_target_group", "apps") {
+		healthCheck := firstBlock(tg.Values, "health_check")
+		albPlan.TargetGroups[indexKey(tg.Index)] = TargetGroupPlan{
+			Address:            tg.Address,
+			Port:               attrInt(tg.Values, "port"),
+			Protocol:           attrString(tg.Values, "protocol"),
+			HealthCheckPath:    attrString(healthCheck, "path"),
+			HealthyThreshold:   attrInt(healthCheck, "healthy_threshold"),
+			UnhealthyThreshold: attrInt(healthCheck, "unhealthy_threshold"),
+			Tags:               attrStringMap(tg.Values, "tags"),
+		}
+	}
+	for _, rule := range plannedResources(plan, "aws_lb_listener_rule", "apps") {
+		rulePlan := ListenerRulePlan{
+			Address:  rule.Address,
+			Priority: attrInt(rule.Values, "priority"),
+		}
+		for _, condition := range attrBlocks(rule.Values, "condition") {
+			if pathPattern := firstBlock(condition, "path_pattern"); pathPattern != nil {
+				rulePlan.PathPatterns = append(rulePlan.PathPatterns, attrStringList(pathPattern, "values")...)
+			}
+			if hostHeader := firstBlock(condition, "host_header"); hostHeader != nil {
+				rulePlan.HostHeaders = append(rulePlan.HostHeaders, attrStringList(hostHeader, "values")...)
+			}
+		}
+		albPlan.ListenerRules[indexKey(rule.Index)] = rulePlan
+	}
+	return albPlan
+}
+
+// ParseComputePlan extracts the compute module resources from a plan
+func ParseComputePlan(plan *terraform.PlanStruct) ComputePlan {
+	var computePlan ComputePlan
+	for _, lt := range plannedResources(plan, "aws_launch_template", "app") {
+		computePlan.LaunchTemplate.InstanceType = attrString(lt.Values, "instance_type")
+		computePlan.LaunchTemplate.Tags = attrStringMap(lt.Values, "tags")
+		for _, mapping := range attrBlocks(lt.Values, "block_device_mappings") {
+			ebs := firstBlock(mapping, "ebs")
+			computePlan.LaunchTemplate.Volumes = append(computePlan.LaunchTemplate.Volumes, EBSVolumePlan{
+				DeviceName: attrString(mapping, "device_name"),
+				VolumeSize: attrInt(ebs, "volume_size"),
+				VolumeType: attrString(ebs, "volume_type"),
+			})
+		}
+	}
+	for _, asg := range plannedResources(plan, "aws_autoscaling_group", "app") {
+		computePlan.AutoScalingGroup = AutoScalingGroupPlan{
+			Name:            attrString(asg.Values, "name"),
+			DesiredCapacity: attrInt(asg.Values, "desired_capacity"),
+			MinSize:         attrInt(asg.Values, "min_size"),
+			MaxSize:         attrInt(asg.Values, "max_size"),
+		}
+	}
+	return computePlan
+}
+
+// PlanTaggedResources returns the planned resources of the given types as tagged
+// resources, identified by address. Auto Scaling groups carry their tags in tag blocks.
+func PlanTaggedResources(plan *terraform.PlanStruct, resourceTypes ...string) []TaggedResource {
+	var resources []TaggedResource
+	for _, resourceType := range resourceTypes {
+		for _, resource := range plannedResources(plan, resourceType, "") {
+			tags := attrStringMap(resource.Values, "tags")
+			for _, block := range attrBlocks(resource.Values, "tag") {
+				tags[attrString(block, "key")] = attrString(block, "value")
+			}
+			resources = append(resources, TaggedResource{Kind: resource.Type, ID: resource.Address, Tags: MapTags(tags)})
+		}
+	}
+	return resources
+}
+
+// indexKey returns the for_each key or count index of a resource as a string
+func indexKey(index interface{}) string {
+	switch v := index.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.Itoa(int(v))
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func attrString(values map[string]interface{}, key string) string {
+	s, _ := values[key].(string)
+	return s
+}
+
+func attrBool(values map[string]interface{}, key string) bool {
+	b, _ := values[key].(bool)
+	return b
+}
+
+// attrInt reads a number attribute. JSON numbers decode as float64, while
+// some providers encode numeric attributes such as ports as strings.
+func attrInt(values map[string]interface{}, key string) int {
+	switch v := values[key].(type) {
+	case float64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	default:
+		return 0
+	}
+}
+
+func attrStringList(values map[string]interface{}, key string) []string {
+	raw, _ := values[key].([]interface{})
+	list := make([]string, 0, len(raw))
+	for _, item := range raw {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func attrStringMap(values map[string]interface{}, key string) map[string]string {
+	raw, _ := values[key].(map[string]interface{})
+	m := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			m[k] = s
+		}
+	}
+	return m
+}
+
+// attrBlocks returns a nested block list, which the plan JSON encodes as a list of objects
+func attrBlocks(values map[string]interface{}, key string) []map[string]interface{} {
+	raw, _ := values[key].([]interface{})
+	blocks := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if block, ok := item.(map[string]interface{}); ok {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// firstBlock returns the first nested block with the given name, or nil
+func firstBlock(values map[string]interface{}, key string) map[string]interface{} {
+	blocks := attrBlocks(values, key)
+	if len(blocks) == 0 {
+		return nil
+	}
+	return blocks[0]
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/fakeaws"
+)
+
+const testPlanJSON = `{
+  "format_version": "1.2",
+  "planned_values": {
+    "root_module": {
+      "resources": [
+        {
+          "address": "aws_lb.main", "mode": "managed", "type": "aws_lb", "name": "main",
+          "values": {"name": "demo-ci-alb", "internal": false, "load_balancer_type": "application",
+                     "enable_deletion_protection": false, "tags": {"Environment": "ci"}}
+        },
+        {
+          "address": "aws_lb_target_group.apps[\"app1\"]", "mode": "managed", "type": "aws_lb_target_group", "name": "apps", "index": "app1",
+          "values": {"port": 8085, "protocol": "HTTP",
+                     "health_check": [{"path": "/app1/status", "healthy_threshold": 3, "unhealthy_threshold": 3}]}
+        },
+        {
+          "address": "aws_lb_listener_rule.apps[\"app1\"]", "mode": "managed", "type": "aws_lb_listener_rule", "name": "apps", "index": "app1",
+          "values": {"priority": 100, "condition": [
+            {"host_header": [], "path_pattern": [{"values": ["/app1/*"]}]},
+            {"host_header": [{"values": ["merkata.cloudns.be"]}], "path_pattern": []}
+          ]}
+        },
+        {
+          "address": "aws_launch_template.app", "mode": "managed", "type": "aws_launch_template", "name": "app",
+          "values": {"instance_type": "t3.micro", "block_device_mappings": [
+            {"device_name": "/dev/xvda", "ebs": [{"volume_size": 30, "volume_type": "gp3"}]}
+          ]}
+        },
+        {
+          "address": "aws_autoscaling_group.app", "mode": "managed", "type": "aws_autoscaling_group", "name": "app",
+          "values": {"name": "demo-ci-asg", "desired_capacity": 2, "min_size": 2, "max_size": 4,
+                     "tag": [{"key": "Project", "value": "demo", "propagate_at_launch": true}]}
+        }
+      ],
+      "child_modules": [
+        {
+          "address": "module.vpc",
+          "resources": [
+            {
+              "address": "module.vpc.aws_vpc.this[0]", "mode": "managed", "type": "aws_vpc", "name": "this", "index": 0,
+              "values": {"cidr_block": "10.0.0.0/16", "enable_dns_hostnames": true, "enable_dns_support": true}
+            },
+            {
+              "address": "module.vpc.aws_subnet.private[0]", "mode": "managed", "type": "aws_subnet", "name": "private", "index": 0,
+              "values": {"cidr_block": "10.0.0.0/20", "availability_zone": "us-east-1a", "map_public_ip_on_launch": false}
+            },
+            {
+              "address": "module.vpc.aws_subnet.public[0]", "mode": "managed", "type": "aws_subnet", "name": "public", "index": 0,
+              "values": {"cidr_block": "10.0.48.0/20", "availability_zone": "us-east-1a", "map_public_ip_on_launch": true}
+            },
+            {
+              "address": "module.vpc.aws_nat_gateway.this[0]", "mode": "managed", "type": "aws_nat_gateway", "name": "this", "index": 0,
+              "values": {}
+            },
+            {
+              "address": "module.vpc.aws_route_table.private[0]", "mode": "managed", "type": "aws_route_table", "name": "private", "index": 0,
+              "values": {}
+            }
+          ]
+        }
+      ]
+    }
+  }
+}`
+
+func TestParsePlans(t *testing.T) {
+	plan, err := terraform.ParsePlanJSON(testPlanJSON)
+	require.NoError(t, err)
+
+	vpc := ParseVPCPlan(plan)
+	assert.Equal(t, "10.0.0.0/16", vpc.CIDR)
+	assert.True(t, vpc.EnableDNSHostnames)
+	require.Len(t, vpc.PrivateSubnets, 1)
+	require.Len(t, vpc.PublicSubnets, 1)
+	assert.False(t, vpc.PrivateSubnets[0].MapPublicIPOnLaunch)
+	assert.True(t, vpc.PublicSubnets[0].MapPublicIPOnLaunch)
+	assert.Equal(t, 1, vpc.NATGateways)
+	assert.Equal(t, 1, vpc.PrivateRouteTables)
+
+	alb := ParseALBPlan(plan)
+	assert.Equal(t, "application", alb.LoadBalancerType)
+	require.Contains(t, alb.TargetGroups, "app1")
+	assert.Equal(t, 8085, alb.TargetGroups["app1"].Port)
+	assert.Equal(t, "/app1/status", alb.TargetGroups["app1"].HealthCheckPath)
+	require.Contains(t, alb.ListenerRules, "app1")
+	assert.Equal(t, 100, alb.ListenerRules["app1"].Priority)
+	assert.Equal(t, []string{"/app1/*"}, alb.ListenerRules["app1"].PathPatterns)
+	assert.Equal(t, []string{"merkata.cloudns.be"}, alb.ListenerRules["app1"].HostHeaders)
+
+	compute := ParseComputePlan(plan)
+	assert.Equal(t, "t3.micro", compute.LaunchTemplate.InstanceType)
+	require.Len(t, compute.LaunchTemplate.Volumes, 1)
+	assert.Equal(t, 30, compute.LaunchTemplate.Volumes[0].VolumeSize)
+	assert.Equal(t, "gp3", compute.LaunchTemplate.Volumes[0].VolumeType)
+	assert.Equal(t, 4, compute.AutoScalingGroup.MaxSize)
+
+	tagged := PlanTaggedResources(plan, "aws_lb", "aws_autoscaling_group")
+	assert.Equal(t, []TaggedResource{
+		{Kind: "aws_lb", ID: "aws_lb.main", Tags: []Tag{{Key: "Environment", Value: "ci"}}},
+		{Kind: "aws_autoscaling_group", ID: "aws_autoscaling_group.app", Tags: []Tag{{Key: "Project", Value: "demo"}}},
+	}, tagged)
+}
+
+func TestTestMode(t *testing.T) {
+	t.Setenv(TestModeEnvVar, "PLAN")
+	assert.True(t, IsPlanMode())
+
+	t.Setenv(TestModeEnvVar, "apply")
+	assert.False(t, IsPlanMode())
+
+	t.Setenv(TestModeEnvVar, "")
+	assert.Equal(t, defaultTestMode, TestMode())
+
+	t.Setenv(TestModeEnvVar, "plna")
+	_, err := TestModeE()
+	assert.EqualError(t, err, `TERRATEST_MODE="plna": must be "apply" or "plan"`)
+	assert.Panics(t, func() { IsPlanMode() })
+}
+
+// TestPlanFixtures makes the lookups of the modules against the fixtures served
+// when planning offline
+func TestPlanFixtures(t *testing.T) {
+	server := fakeaws.NewServer(planFixtures("eu-west-1"))
+	t.Cleanup(server.Close)
+	client := ec2.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("fake", "fake", ""),
+	})))
+
+	zones, err := client.DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("state"), Values: aws.StringSlice([]string{"available"})}},
+	})
+	require.NoError(t, err)
+	var names []string
+	for _, zone := range zones.AvailabilityZones {
+		names = append(names, aws.StringValue(zone.ZoneName))
+	}
+	assert.Equal(t, []string{"eu-west-1a", "eu-west-1b", "eu-west-1c"}, names)
+
+	images, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners:  aws.StringSlice([]string{"amazon"}),
+		Filters: []*ec2.Filter{{Name: aws.String("name"), Values: aws.StringSlice([]string{"amzn2-ami-hvm-*-x86_64-gp2"})}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, images.Images, 1)
+
+	assert.Contains(t, offlineProvider("eu-west-1", server.URL), `sts = "`+server.URL+`"`)
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// DeletionProtectionAttribute is the load balancer attribute the ALB module sets in prod
+const DeletionProtectionAttribute = "deletion_protection.enabled"
+
+// DeletionProtectionAPI is the ELBv2 call that turns off deletion protection. It
+// is kept out of ELBv2API so that only teardown code can change a load balancer.
+type DeletionProtectionAPI interface {
+	ModifyLoadBalancerAttributes(*elbv2.ModifyLoadBalancerAttributesInput) (*elbv2.ModifyLoadBalancerAttributesOutput, error)
+}
+
+var _ DeletionProtectionAPI = (*elbv2.ELBV2)(nil)
+
+// DisableDeletionProtectionE turns deletion protection off so the load balancer can
+// be deleted. A load balancer that is already gone is not an error.
+func DisableDeletionProtectionE(client DeletionProtectionAPI, loadBalancerArn string) error {
+	_, err := client.ModifyLoadBalancerAttributes(&elbv2.ModifyLoadBalancerAttributesInput{
+		LoadBalancerArn: aws.String(loadBalancerArn),
+		Attributes: []*elbv2.LoadBalancerAttribute{{
+			Key:   aws.String(DeletionProtectionAttribute),
+			Value: aws.String("false"),
+		}},
+	})
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == elbv2.ErrCodeLoadBalancerNotFoundException {
+		return nil
+	}
+	return err
+}
+
+// protectedLoadBalancers returns the ARNs of the load balancers in the state
+// that have deletion protection enabled
+func protectedLoadBalancers(stateJSON string) ([]string, error) {
+	resources, err := stateResources(stateJSON)
+	if err != nil {
+		return nil, err
+	}
+	var arns []string
+	for _, resource := range resources {
+		if (resource.Type == "aws_lb" || resource.Type == "aws_alb") && attrBool(resource.Values, "enable_deletion_protection") {
+			arns = append(arns, attrString(resource.Values, "arn"))
+		}
+	}
+	return arns, nil
+}
+
+// DestroyE runs terraform destroy, first turning off deletion protection on every
+// load balancer in the state that has it, as the ALB module does in prod
+func DestroyE(t testing.TestingT, options *terraform.Options) (string, error) {
+	// Show the state rather than a plan the options may point at
+	showOptions, err := options.Clone()
+	if err != nil {
+		return "", err
+	}
+	showOptions.PlanFilePath = ""
+	stateJSON, err := terraform.ShowE(t, showOptions)
+	if err != nil {
+		return "", err
+	}
+	arns, err := protectedLoadBalancers(stateJSON)
+	if err != nil {
+		return "", err
+	}
+
+	for _, loadBalancerArn := range arns {
+		parsed, err := arn.Parse(loadBalancerArn)
+		if err != nil {
+			return "", err
+		}
+		if err := DisableDeletionProtectionE(elbv2.New(CreateSession(parsed.Region)), loadBalancerArn); err != nil {
+			return "", fmt.Errorf("disabling deletion protection on %s: %w", loadBalancerArn, err)
+		}
+	}
+	return terraform.DestroyE(t, options)
+}
+
+// Destroy is DestroyE failing the test on error
+func Destroy(t testing.TestingT, options *terraform.Options) string {
+	out, err := DestroyE(t, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/fakeaws"
+)
+
+func TestProtectedLoadBalancers(t *testing.T) {
+	arns, err := protectedLoadBalancers(`{
+  "format_version": "1.0",
+  "values": {
+    "root_module": {
+      "resources": [
+        {"address": "aws_lb.main", "mode": "managed", "type": "aws_lb", "name": "main",
+         "values": {"arn": "arn:aws:elasticloadbalancing:eu-west-1:123456789012:loadbalancer/app/prod/1", "enable_deletion_protection": true}}
+      ],
+      "child_modules": [
+        {
+          "address": "module.alb",
+          "resources": [
+            {"address": "module.alb.aws_lb.main", "mode": "managed", "type": "aws_lb", "name": "main",
+             "values": {"arn": "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/ci/2", "enable_deletion_protection": false}},
+            {"address": "module.alb.data.aws_lb.main", "mode": "data", "type": "aws_lb", "name": "main",
+             "values": {"arn": "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/other/3", "enable_deletion_protection": true}}
+          ]
+        }
+      ]
+    }
+  }
+}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"arn:aws:elasticloadbalancing:eu-west-1:123456789012:loadbalancer/app/prod/1"}, arns)
+
+	// Nothing deployed
+	arns, err = protectedLoadBalancers(`{"format_version": "1.0"}`)
+	require.NoError(t, err)
+	assert.Empty(t, arns)
+}
+
+func TestDisableDeletionProtection(t *testing.T) {
+	const arn = "arn:aws:elasticloadbalancing:us-east-1:123456789012:loadbalancer/app/demo-prod-alb/1"
+	server := fakeaws.Start(t, &fakeaws.Fixtures{
+		LoadBalancers: []*elbv2.LoadBalancer{{LoadBalancerArn: aws.String(arn)}},
+		LoadBalancerAttributes: map[string][]*elbv2.LoadBalancerAttribute{
+			arn: {{Key: aws.String(DeletionProtectionAttribute), Value: aws.String("true")}},
+		},
+	})
+	client := elbv2.New(CreateSession("us-east-1"))
+
+	_, err := client.DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{LoadBalancerArn: aws.String(arn)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), elbv2.ErrCodeOperationNotPermittedException)
+
+	require.NoError(t, DisableDeletionProtectionE(client, arn))
+	_, err = client.DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{LoadBalancerArn: aws.String(arn)})
+	require.NoError(t, err)
+	assert.Contains(t, server.Calls(), "elasticloadbalancing:ModifyLoadBalancerAttributes")
+
+	// Already gone
+	require.NoError(t, DisableDeletionProtectionE(client, arn))
+}
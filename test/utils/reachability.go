@@ -0,0 +1,302 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+// Internet is the source of traffic from anywhere on the internet
+const Internet = "0.0.0.0/0"
+
+// SecurityGroupRule is an ingress or egress rule. Protocol is "-1" for all
+// traffic, in which case the ports are ignored.
+type SecurityGroupRule struct {
+	Protocol string
+	FromPort int
+	ToPort   int
+	// CIDRs and Groups are the peers the rule allows, IPv4 and IPv6 ranges and
+	// security group IDs respectively
+	CIDRs  []string
+	Groups []string
+}
+
+// SecurityGroupModel is a security group reduced to what decides reachability
+type SecurityGroupModel struct {
+	ID   string
+	Name string
+	// Address is the resource address of a group read from a plan
+	Address string
+	Ingress []SecurityGroupRule
+	Egress  []SecurityGroupRule
+}
+
+// SecurityGroupsFromEC2 converts DescribeSecurityGroups output. Prefix list
+// peers are ignored.
+func SecurityGroupsFromEC2(groups []*ec2.SecurityGroup) []SecurityGroupModel {
+	models := make([]SecurityGroupModel, 0, len(groups))
+	for _, group := range groups {
+		models = append(models, SecurityGroupModel{
+			ID:      aws.StringValue(group.GroupId),
+			Name:    aws.StringValue(group.GroupName),
+			Ingress: ec2Rules(group.IpPermissions),
+			Egress:  ec2Rules(group.IpPermissionsEgress),
+		})
+	}
+	return models
+}
+
+func ec2Rules(permissions []*ec2.IpPermission) []SecurityGroupRule {
+	rules := make([]SecurityGroupRule, 0, len(permissions))
+	for _, permission := range permissions {
+		rule := SecurityGroupRule{
+			Protocol: aws.StringValue(permission.IpProtocol),
+			FromPort: int(aws.Int64Value(permission.FromPort)),
+			ToPort:   int(aws.Int64Value(permission.ToPort)),
+		}
+		for _, ipRange := range permission.IpRanges {
+			rule.CIDRs = append(rule.CIDRs, aws.StringValue(ipRange.CidrIp))
+		}
+		for _, ipRange := range permission.Ipv6Ranges {
+			rule.CIDRs = append(rule.CIDRs, aws.StringValue(ipRange.CidrIpv6))
+		}
+		for _, pair := range permission.UserIdGroupPairs {
+			rule.Groups = append(rule.Groups, aws.StringValue(pair.GroupId))
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// SecurityGroupsFromPlan converts the planned aws_security_group resources. A
+// group whose ID is only known after apply is identified by its address, e.g.
+// aws_security_group.alb; references to such groups cannot be resolved.
+func SecurityGroupsFromPlan(plan *terraform.PlanStruct) []SecurityGroupModel {
+	var models []SecurityGroupModel
+	for _, resource := range plannedResources(plan, "aws_security_group", "") {
+		id := attrString(resource.Values, "id")
+		if id == "" {
+			id = resource.Address
+		}
+		models = append(models, SecurityGroupModel{
+			ID:      id,
+			Name:    attrString(resource.Values, "name"),
+			Address: resource.Address,
+			Ingress: planRules(resource.Values, "ingress", id),
+			Egress:  planRules(resource.Values, "egress", id),
+		})
+	}
+	return models
+}
+
+func planRules(values map[string]interface{}, key, groupID string) []SecurityGroupRule {
+	var rules []SecurityGroupRule
+	for _, block := range attrBlocks(values, key) {
+		rule := SecurityGroupRule{
+			Protocol: attrString(block, "protocol"),
+			FromPort: attrInt(block, "from_port"),
+			ToPort:   attrInt(block, "to_port"),
+			CIDRs:    append(attrStringList(block, "cidr_blocks"), attrStringList(block, "ipv6_cidr_blocks")...),
+			Groups:   attrStringList(block, "security_groups"),
+		}
+		if attrBool(block, "self") {
+			rule.Groups = append(rule.Groups, groupID)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// allows reports whether the rule covers the protocol and port
+func (r SecurityGroupRule) allows(protocol string, port int) bool {
+	switch normalizeProtocol(r.Protocol) {
+	case "-1":
+		return true
+	case normalizeProtocol(protocol):
+		return r.FromPort <= port && port <= r.ToPort
+	default:
+		return false
+	}
+}
+
+// normalizeProtocol maps protocol numbers to the names EC2 reports
+func normalizeProtocol(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "6":
+		return "tcp"
+	case "17":
+		return "udp"
+	case "1":
+		return "icmp"
+	case "all":
+		return "-1"
+	default:
+		return strings.ToLower(protocol)
+	}
+}
+
+// cidrsOverlap reports whether two ranges share an address
+func cidrsOverlap(a, b string) bool {
+	_, netA, err := net.ParseCIDR(a)
+	if err != nil {
+		return false
+	}
+	_, netB, err := net.ParseCIDR(b)
+	if err != nil {
+		return false
+	}
+	return netA.Contains(netB.IP) || netB.Contains(netA.IP)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Source is where traffic comes from: a CIDR range or a security group
+type Source struct {
+	CIDR  string
+	Group string
+}
+
+// FromCIDR is traffic from any address in the range, e.g. Internet
+func FromCIDR(cidr string) Source {
+	return Source{CIDR: cidr}
+}
+
+// FromGroup is traffic from a member of the security group
+func FromGroup(groupID string) Source {
+	return Source{Group: groupID}
+}
+
+func (s Source) String() string {
+	if s.Group != "" {
+		return s.Group
+	}
+	return s.CIDR
+}
+
+// SecurityGraph answers which sources can open connections to the members of
+// the security groups it was built from
+type SecurityGraph struct {
+	groups map[string]SecurityGroupModel
+}
+
+// NewSecurityGraph builds the graph from the groups, e.g. from SecurityGroupsFromEC2
+// or SecurityGroupsFromPlan
+func NewSecurityGraph(groups ...SecurityGroupModel) *SecurityGraph {
+	graph := &SecurityGraph{groups: make(map[string]SecurityGroupModel, len(groups))}
+	for _, group := range groups {
+		graph.groups[group.ID] = group
+	}
+	return graph
+}
+
+// CanReach reports whether the source can open a connection to the members of the
+// group on the protocol and port. The group's ingress must admit the source. A
+// source group must also allow the traffic out, to the group itself or to
+// 0.0.0.0/0, as the address of a group's members is not known; its other CIDR
+// egress rules are not assumed to cover them. A CIDR source reaches the group if
+// any address in its range is admitted.
+func (g *SecurityGraph) CanReach(from Source, toGroup, protocol string, port int) bool {
+	target, ok := g.groups[toGroup]
+	if !ok {
+		return false
+	}
+
+	admitted := false
+	for _, rule := range target.Ingress {
+		if !rule.allows(protocol, port) {
+			continue
+		}
+		if from.Group != "" && contains(rule.Groups, from.Group) {
+			admitted = true
+		}
+		for _, cidr := range rule.CIDRs {
+			if from.CIDR != "" && cidrsOverlap(cidr, from.CIDR) {
+				admitted = true
+			}
+		}
+	}
+	if !admitted || from.Group == "" {
+		return admitted
+	}
+
+	source, ok := g.groups[from.Group]
+	if !ok {
+		// A group outside the graph, its egress is unknown
+		return false
+	}
+	for _, rule := range source.Egress {
+		if rule.allows(protocol, port) && (contains(rule.Groups, toGroup) || contains(rule.CIDRs, Internet)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reachability is an expected answer to a CanReach query
+type Reachability struct {
+	From     Source
+	To       string
+	Protocol string
+	Port     int
+	Allowed  bool
+}
+
+func (r Reachability) String() string {
+	verb := "should"
+	if !r.Allowed {
+		verb = "should not"
+	}
+	return fmt.Sprintf("%s %s reach %s on %s/%d", r.From, verb, r.To, r.Protocol, r.Port)
+}
+
+// Reach expects the source to reach the group over TCP on every port
+func Reach(from Source, toGroup string, ports ...int) []Reachability {
+	return reachability(from, toGroup, true, ports)
+}
+
+// NoReach expects the source not to reach the group over TCP on any of the ports
+func NoReach(from Source, toGroup string, ports ...int) []Reachability {
+	return reachability(from, toGroup, false, ports)
+}
+
+func reachability(from Source, toGroup string, allowed bool, ports []int) []Reachability {
+	expectations := make([]Reachability, 0, len(ports))
+	for _, port := range ports {
+		expectations = append(expectations, Reachability{From: from, To: toGroup, Protocol: "tcp", Port: port, Allowed: allowed})
+	}
+	return expectations
+}
+
+// AssertReachability checks every expectation against the graph and reports all
+// the violated ones in a single failure
+func AssertReachability(t AssertT, graph *SecurityGraph, expectations ...[]Reachability) bool {
+	var total int
+	var violations []string
+	for _, group := range expectations {
+		for _, expectation := range group {
+			total++
+			if graph.CanReach(expectation.From, expectation.To, expectation.Protocol, expectation.Port) != expectation.Allowed {
+				violations = append(violations, "  "+expectation.String())
+			}
+		}
+	}
+	if len(violations) == 0 {
+		return true
+	}
+	sort.Strings(violations)
+	t.Errorf("%d of %d security group reachability expectations do not hold:\n%s",
+		len(violations), total, strings.Join(violations, "\n"))
+	return false
+}
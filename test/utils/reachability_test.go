@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The ALB and EC2 security groups as the alb and compute modules create them
+var (
+	testALBGroup = &ec2.SecurityGroup{
+		GroupId: aws.String("sg-alb"),
+		IpPermissions: []*ec2.IpPermission{
+			{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(80), ToPort: aws.Int64(80), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+			{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(443), ToPort: aws.Int64(443), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+		},
+		IpPermissionsEgress: []*ec2.IpPermission{
+			{IpProtocol: aws.String("-1"), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+		},
+	}
+	testEC2Group = &ec2.SecurityGroup{
+		GroupId: aws.String("sg-ec2"),
+		IpPermissions: []*ec2.IpPermission{
+			{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(8085), ToPort: aws.Int64(8085), UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-alb")}}},
+			{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(8086), ToPort: aws.Int64(8086), UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-alb")}}},
+		},
+		IpPermissionsEgress: []*ec2.IpPermission{
+			{IpProtocol: aws.String("-1"), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("0.0.0.0/0")}}},
+		},
+	}
+)
+
+func TestSecurityGraph(t *testing.T) {
+	graph := NewSecurityGraph(SecurityGroupsFromEC2([]*ec2.SecurityGroup{testALBGroup, testEC2Group})...)
+	internet := FromCIDR(Internet)
+	alb := FromGroup("sg-alb")
+
+	testCases := []struct {
+		name     string
+		from     Source
+		to       string
+		protocol string
+		port     int
+		reaches  bool
+	}{
+		{"internet to alb over https", internet, "sg-alb", "tcp", 443, true},
+		{"single address to alb", FromCIDR("203.0.113.10/32"), "sg-alb", "tcp", 80, true},
+		{"protocol number", internet, "sg-alb", "6", 443, true},
+		{"internet to alb over ssh", internet, "sg-alb", "tcp", 22, false},
+		{"internet to alb over udp", internet, "sg-alb", "udp", 443, false},
+		{"internet to app port", internet, "sg-ec2", "tcp", 8085, false},
+		{"alb to app port", alb, "sg-ec2", "tcp", 8086, true},
+		{"alb to ssh", alb, "sg-ec2", "tcp", 22, false},
+		{"instances to alb", FromGroup("sg-ec2"), "sg-alb", "tcp", 443, false},
+		{"unknown group", alb, "sg-missing", "tcp", 8085, false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.reaches, graph.CanReach(tc.from, tc.to, tc.protocol, tc.port), tc.name)
+	}
+}
+
+func TestSecurityGraphRequiresEgress(t *testing.T) {
+	restricted := *testALBGroup
+	restricted.IpPermissionsEgress = []*ec2.IpPermission{
+		{IpProtocol: aws.String("tcp"), FromPort: aws.Int64(8085), ToPort: aws.Int64(8085), UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-ec2")}}},
+		{IpProtocol: aws.String("-1"), IpRanges: []*ec2.IpRange{{CidrIp: aws.String("10.0.0.0/16")}}},
+	}
+	graph := NewSecurityGraph(SecurityGroupsFromEC2([]*ec2.SecurityGroup{&restricted, testEC2Group})...)
+
+	assert.True(t, graph.CanReach(FromGroup("sg-alb"), "sg-ec2", "tcp", 8085))
+	// The VPC range is not assumed to cover the instances
+	assert.False(t, graph.CanReach(FromGroup("sg-alb"), "sg-ec2", "tcp", 8086))
+}
+
+func TestSecurityGroupsFromPlan(t *testing.T) {
+	plan, err := terraform.ParsePlanJSON(`{
+  "format_version": "1.2",
+  "planned_values": {
+    "root_module": {
+      "resources": [
+        {
+          "address": "aws_security_group.ec2", "mode": "managed", "type": "aws_security_group", "name": "ec2",
+          "values": {"name": "demo-ci-ec2-sg",
+            "ingress": [
+              {"protocol": "tcp", "from_port": 8085, "to_port": 8085, "cidr_blocks": [], "security_groups": ["sg-0123456789abcdef0"], "self": false},
+              {"protocol": "tcp", "from_port": 9100, "to_port": 9100, "cidr_blocks": [], "security_groups": [], "self": true}
+            ],
+            "egress": [{"protocol": "-1", "from_port": 0, "to_port": 0, "cidr_blocks": ["0.0.0.0/0"], "security_groups": [], "self": false}]
+          }
+        }
+      ]
+    }
+  }
+}`)
+	require.NoError(t, err)
+
+	groups := SecurityGroupsFromPlan(plan)
+	require.Len(t, groups, 1)
+	ec2Group := groups[0]
+	// Not created yet, so the address stands in for the ID
+	assert.Equal(t, "aws_security_group.ec2", ec2Group.ID)
+	assert.Equal(t, "demo-ci-ec2-sg", ec2Group.Name)
+
+	alb := SecurityGroupModel{
+		ID:     "sg-0123456789abcdef0",
+		Egress: []SecurityGroupRule{{Protocol: "-1", CIDRs: []string{Internet}}},
+	}
+	graph := NewSecurityGraph(ec2Group, alb)
+	assert.True(t, graph.CanReach(FromGroup(alb.ID), ec2Group.ID, "tcp", 8085))
+	assert.False(t, graph.CanReach(FromGroup(alb.ID), ec2Group.ID, "tcp", 9100))
+	assert.True(t, graph.CanReach(FromGroup(ec2Group.ID), ec2Group.ID, "tcp", 9100))
+	assert.False(t, graph.CanReach(FromCIDR(Internet), ec2Group.ID, "tcp", 8085))
+}
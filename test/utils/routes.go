@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Kinds of SubnetEgress, i.e. where a subnet's 0.0.0.0/0 route leads
+const (
+	EgressInternetGateway = "internet gateway"
+	EgressNATGateway      = "NAT gateway"
+	// EgressBlackhole is a default route whose target no longer exists
+	EgressBlackhole = "blackhole"
+	// EgressNone is a subnet without a default route
+	EgressNone = "no default route"
+	// EgressOther is any other target, e.g. a transit gateway or a network interface
+	EgressOther = "other"
+)
+
+// SubnetEgress is the path traffic to the internet takes out of a subnet
+type SubnetEgress struct {
+	SubnetID         string
+	AvailabilityZone string
+	RouteTableID     string
+	Kind             string
+	// Target is the ID of the gateway the default route points at
+	Target string
+	// TargetAvailabilityZone is the AZ of a NAT gateway target
+	TargetAvailabilityZone string
+	// Blackholes are the destinations of any route in the subnet's table whose target is gone
+	Blackholes []string
+	// InternetRoutes are the destinations of any route in the subnet's table through an internet gateway
+	InternetRoutes []string
+}
+
+func (e SubnetEgress) String() string {
+	path := fmt.Sprintf("%s (%s) -> %s -> %s", e.SubnetID, e.AvailabilityZone, orNone(e.RouteTableID), e.Kind)
+	if e.Target != "" {
+		path += " " + e.Target
+	}
+	if e.TargetAvailabilityZone != "" {
+		path += " (" + e.TargetAvailabilityZone + ")"
+	}
+	return path
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// RouteTopologyFromEC2 works out the egress path of every subnet from the VPC's
+// subnets, route tables and NAT gateways. Subnets without an explicit route table
+// association use the main route table.
+func RouteTopologyFromEC2(subnets []*ec2.Subnet, tables []*ec2.RouteTable, natGateways []*ec2.NatGateway) map[string]SubnetEgress {
+	subnetAZs := make(map[string]string, len(subnets))
+	for _, subnet := range subnets {
+		subnetAZs[aws.StringValue(subnet.SubnetId)] = aws.StringValue(subnet.AvailabilityZone)
+	}
+	natAZs := make(map[string]string, len(natGateways))
+	for _, nat := range natGateways {
+		natAZs[aws.StringValue(nat.NatGatewayId)] = subnetAZs[aws.StringValue(nat.SubnetId)]
+	}
+
+	var main *ec2.RouteTable
+	associated := make(map[string]*ec2.RouteTable)
+	for _, table := range tables {
+		for _, association := range table.Associations {
+			if aws.BoolValue(association.Main) {
+				main = table
+			}
+			if association.SubnetId != nil {
+				associated[aws.StringValue(association.SubnetId)] = table
+			}
+		}
+	}
+
+	topology := make(map[string]SubnetEgress, len(subnets))
+	for id, az := range subnetAZs {
+		table, ok := associated[id]
+		if !ok {
+			table = main
+		}
+		topology[id] = subnetEgress(id, az, table, natAZs)
+	}
+	return topology
+}
+
+func subnetEgress(subnetID, az string, table *ec2.RouteTable, natAZs map[string]string) SubnetEgress {
+	egress := SubnetEgress{SubnetID: subnetID, AvailabilityZone: az, Kind: EgressNone}
+	if table == nil {
+		return egress
+	}
+	egress.RouteTableID = aws.StringValue(table.RouteTableId)
+
+	for _, route := range table.Routes {
+		destination := aws.StringValue(route.DestinationCidrBlock)
+		if destination == "" {
+			destination = aws.StringValue(route.DestinationIpv6CidrBlock)
+		}
+		if destination == "" {
+			destination = aws.StringValue(route.DestinationPrefixListId)
+		}
+		blackhole := aws.StringValue(route.State) == ec2.RouteStateBlackhole
+		if blackhole {
+			egress.Blackholes = append(egress.Blackholes, destination)
+		}
+		if strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-") {
+			egress.InternetRoutes = append(egress.InternetRoutes, destination)
+		}
+		if destination != Internet {
+			continue
+		}
+
+		switch {
+		case route.NatGatewayId != nil:
+			egress.Kind = EgressNATGateway
+			egress.Target = aws.StringValue(route.NatGatewayId)
+			egress.TargetAvailabilityZone = natAZs[egress.Target]
+		case strings.HasPrefix(aws.StringValue(route.GatewayId), "igw-"):
+			egress.Kind = EgressInternetGateway
+			egress.Target = aws.StringValue(route.GatewayId)
+		default:
+			egress.Kind = EgressOther
+			egress.Target = routeTarget(route)
+		}
+		if blackhole {
+			egress.Kind = EgressBlackhole
+		}
+	}
+	sort.Strings(egress.Blackholes)
+	sort.Strings(egress.InternetRoutes)
+	return egress
+}
+
+// routeTarget returns the ID of whatever the route points at
+func routeTarget(route *ec2.Route) string {
+	for _, target := range []*string{
+		route.GatewayId, route.NatGatewayId, route.TransitGatewayId, route.NetworkInterfaceId,
+		route.VpcPeeringConnectionId, route.InstanceId, route.EgressOnlyInternetGatewayId,
+	} {
+		if target != nil {
+			return aws.StringValue(target)
+		}
+	}
+	return ""
+}
+
+// RouteTopologyE describes the subnets, route tables and NAT gateways of the VPC
+// and returns the egress path of every subnet
+func RouteTopologyE(client EC2API, vpcID string) (map[string]SubnetEgress, error) {
+	filters := []*ec2.Filter{{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{vpcID})}}
+
+	subnets, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	tables, err := client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	natGateways, err := client.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{Filter: filters})
+	if err != nil {
+		return nil, err
+	}
+	return RouteTopologyFromEC2(subnets.Subnets, tables.RouteTables, natGateways.NatGateways), nil
+}
+
+// RouteExpectation is how the VPC module routes its subnets to the internet
+type RouteExpectation struct {
+	PublicSubnets  []string
+	PrivateSubnets []string
+	// NATPerAZ requires every private subnet to use a NAT gateway in its own AZ,
+	// otherwise they all share a single one
+	NATPerAZ bool
+}
+
+// AnalyzeRouteTopology returns every way the egress paths differ from the
+// expectation, sorted
+func AnalyzeRouteTopology(topology map[string]SubnetEgress, expected RouteExpectation) []string {
+	var problems []string
+	check := func(subnetID, role, kind string) (SubnetEgress, bool) {
+		egress, ok := topology[subnetID]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s subnet %s not found in the VPC", role, subnetID))
+			return egress, false
+		}
+		for _, destination := range egress.Blackholes {
+			problems = append(problems, fmt.Sprintf("%s subnet %s: route to %s in %s is a blackhole", role, subnetID, destination, egress.RouteTableID))
+		}
+		if egress.Kind == EgressBlackhole {
+			return egress, false
+		}
+		if egress.Kind != kind {
+			problems = append(problems, fmt.Sprintf("%s subnet %s: expected 0.0.0.0/0 through a %s, got %s", role, subnetID, kind, egress))
+			return egress, false
+		}
+		return egress, true
+	}
+
+	for _, subnetID := range expected.PublicSubnets {
+		check(subnetID, "public", EgressInternetGateway)
+	}
+
+	natSubnets := make(map[string][]string)
+	for _, subnetID := range expected.PrivateSubnets {
+		egress, ok := check(subnetID, "private", EgressNATGateway)
+		if !ok {
+			continue
+		}
+		// The default route is through the NAT gateway, but nothing else may bypass it
+		for _, destination := range egress.InternetRoutes {
+			problems = append(problems, fmt.Sprintf("private subnet %s: route to %s in %s goes through an internet gateway", subnetID, destination, egress.RouteTableID))
+		}
+		natSubnets[egress.Target] = append(natSubnets[egress.Target], subnetID)
+		if expected.NATPerAZ && egress.TargetAvailabilityZone != egress.AvailabilityZone {
+			problems = append(problems, fmt.Sprintf("private subnet %s: uses NAT gateway %s in %s instead of one in its own AZ %s",
+				subnetID, egress.Target, orNone(egress.TargetAvailabilityZone), egress.AvailabilityZone))
+		}
+	}
+	if expected.NATPerAZ {
+		for nat, subnets := range natSubnets {
+			if len(subnets) > 1 {
+				sort.Strings(subnets)
+				problems = append(problems, fmt.Sprintf("NAT gateway %s is shared by private subnets %s", nat, strings.Join(subnets, ", ")))
+			}
+		}
+	} else if len(natSubnets) > 1 {
+		nats := make([]string, 0, len(natSubnets))
+		for nat := range natSubnets {
+			nats = append(nats, nat)
+		}
+		sort.Strings(nats)
+		problems = append(problems, fmt.Sprintf("private subnets should share a single NAT gateway, they use %s", strings.Join(nats, ", ")))
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// AssertRouteTopology logs the egress path of every expected subnet and reports
+// all the problems AnalyzeRouteTopology finds in a single failure
+func AssertRouteTopology(t AssertT, topology map[string]SubnetEgress, expected RouteExpectation) bool {
+	for _, subnetID := range append(append([]string{}, expected.PublicSubnets...), expected.PrivateSubnets...) {
+		if egress, ok := topology[subnetID]; ok {
+			t.Logf("Egress path: %s", egress)
+		}
+	}
+
+	problems := AnalyzeRouteTopology(topology, expected)
+	if len(problems) == 0 {
+		return true
+	}
+	t.Errorf("%d route topology problems:\n  %s", len(problems), strings.Join(problems, "\n  "))
+	return false
+}
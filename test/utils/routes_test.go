@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRoute(destination string, route ec2.Route) *ec2.Route {
+	route.DestinationCidrBlock = aws.String(destination)
+	if route.State == nil {
+		route.State = aws.String(ec2.RouteStateActive)
+	}
+	return &route
+}
+
+func testRouteTable(id string, main bool, subnets []string, routes ...*ec2.Route) *ec2.RouteTable {
+	table := &ec2.RouteTable{RouteTableId: aws.String(id), Routes: routes}
+	if main {
+		table.Associations = append(table.Associations, &ec2.RouteTableAssociation{Main: aws.Bool(true)})
+	}
+	for _, subnet := range subnets {
+		table.Associations = append(table.Associations, &ec2.RouteTableAssociation{SubnetId: aws.String(subnet)})
+	}
+	return table
+}
+
+func TestRouteTopology(t *testing.T) {
+	subnets := []*ec2.Subnet{
+		{SubnetId: aws.String("subnet-public-a"), AvailabilityZone: aws.String("us-east-1a")},
+		{SubnetId: aws.String("subnet-private-a"), AvailabilityZone: aws.String("us-east-1a")},
+		{SubnetId: aws.String("subnet-private-b"), AvailabilityZone: aws.String("us-east-1b")},
+	}
+	natGateways := []*ec2.NatGateway{{NatGatewayId: aws.String("nat-a"), SubnetId: aws.String("subnet-public-a")}}
+	tables := []*ec2.RouteTable{
+		testRouteTable("rtb-main", true, nil, testRoute("10.0.0.0/16", ec2.Route{GatewayId: aws.String("local")})),
+		testRouteTable("rtb-public", false, []string{"subnet-public-a"}, testRoute(Internet, ec2.Route{GatewayId: aws.String("igw-1")})),
+		testRouteTable("rtb-private", false, []string{"subnet-private-a"},
+			testRoute(Internet, ec2.Route{NatGatewayId: aws.String("nat-a")}),
+			testRoute("192.168.0.0/16", ec2.Route{TransitGatewayId: aws.String("tgw-1"), State: aws.String(ec2.RouteStateBlackhole)}),
+			testRoute("198.51.100.0/24", ec2.Route{GatewayId: aws.String("igw-1")})),
+	}
+
+	topology := RouteTopologyFromEC2(subnets, tables, natGateways)
+	assert.Equal(t, "subnet-public-a (us-east-1a) -> rtb-public -> internet gateway igw-1", topology["subnet-public-a"].String())
+	assert.Equal(t, "subnet-private-a (us-east-1a) -> rtb-private -> NAT gateway nat-a (us-east-1a)", topology["subnet-private-a"].String())
+	// Not associated with any table, so it falls back to the main one
+	assert.Equal(t, "subnet-private-b (us-east-1b) -> rtb-main -> no default route", topology["subnet-private-b"].String())
+
+	assert.Equal(t, []string{
+		"private subnet subnet-private-a: route to 192.168.0.0/16 in rtb-private is a blackhole",
+		"private subnet subnet-private-a: route to 198.51.100.0/24 in rtb-private goes through an internet gateway",
+		"private subnet subnet-private-b: expected 0.0.0.0/0 through a NAT gateway, got subnet-private-b (us-east-1b) -> rtb-main -> no default route",
+		"public subnet subnet-missing not found in the VPC",
+	}, AnalyzeRouteTopology(topology, RouteExpectation{
+		PublicSubnets:  []string{"subnet-public-a", "subnet-missing"},
+		PrivateSubnets: []string{"subnet-private-a", "subnet-private-b"},
+	}))
+}
+
+func TestAnalyzeRouteTopologyNATGateways(t *testing.T) {
+	topology := map[string]SubnetEgress{
+		"subnet-a": {SubnetID: "subnet-a", AvailabilityZone: "us-east-1a", Kind: EgressNATGateway, Target: "nat-a", TargetAvailabilityZone: "us-east-1a"},
+		"subnet-b": {SubnetID: "subnet-b", AvailabilityZone: "us-east-1b", Kind: EgressNATGateway, Target: "nat-b", TargetAvailabilityZone: "us-east-1b"},
+	}
+	private := []string{"subnet-a", "subnet-b"}
+
+	// One NAT gateway per AZ is right in prod, but not elsewhere
+	assert.Empty(t, AnalyzeRouteTopology(topology, RouteExpectation{PrivateSubnets: private, NATPerAZ: true}))
+	assert.Equal(t, []string{"private subnets should share a single NAT gateway, they use nat-a, nat-b"},
+		AnalyzeRouteTopology(topology, RouteExpectation{PrivateSubnets: private}))
+
+	shared := topology["subnet-b"]
+	shared.Target, shared.TargetAvailabilityZone = "nat-a", "us-east-1a"
+	topology["subnet-b"] = shared
+	assert.Empty(t, AnalyzeRouteTopology(topology, RouteExpectation{PrivateSubnets: private}))
+	assert.Equal(t, []string{
+		"NAT gateway nat-a is shared by private subnets subnet-a, subnet-b",
+		"private subnet subnet-b: uses NAT gateway nat-a in us-east-1a instead of one in its own AZ us-east-1b",
+	}, AnalyzeRouteTopology(topology, RouteExpectation{PrivateSubnets: private, NATPerAZ: true}))
+}
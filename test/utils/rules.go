@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// ListenerRule is a forwarding rule of the HTTPS listener, either as the ALB module
+// would create it for an app or as read back from DescribeRules. A request matches
+// when its host matches one of Hosts and its path one of Paths; an empty list
+// matches anything, like a rule without that condition.
+type ListenerRule struct {
+	// Name identifies the rule in reports, the app name or "priority N" for a live rule
+	Name     string
+	Priority int
+	Hosts    []string
+	Paths    []string
+}
+
+// RulesFromApps returns the listener rules the ALB module creates for the apps
+func RulesFromApps(apps Apps) []ListenerRule {
+	rules := make([]ListenerRule, 0, len(apps))
+	for _, name := range apps.Names() {
+		app := apps[name]
+		rules = append(rules, ListenerRule{
+			Name:     name,
+			Priority: app.Priority,
+			Hosts:    app.Domain,
+			Paths:    []string{app.Path},
+		})
+	}
+	return rules
+}
+
+// RulesFromELBv2 converts the output of DescribeRules, skipping the default rule
+func RulesFromELBv2(rules []*elbv2.Rule) ([]ListenerRule, error) {
+	var result []ListenerRule
+	for _, rule := range rules {
+		if aws.BoolValue(rule.IsDefault) || aws.StringValue(rule.Priority) == "default" {
+			continue
+		}
+		priority, err := strconv.Atoi(aws.StringValue(rule.Priority))
+		if err != nil {
+			return nil, fmt.Errorf("rule %s has an invalid priority %q", aws.StringValue(rule.RuleArn), aws.StringValue(rule.Priority))
+		}
+
+		converted := ListenerRule{Name: fmt.Sprintf("priority %d", priority), Priority: priority}
+		for _, condition := range rule.Conditions {
+			// Values is the legacy form of the condition's config block
+			values := aws.StringValueSlice(condition.Values)
+			switch aws.StringValue(condition.Field) {
+			case "host-header":
+				if condition.HostHeaderConfig != nil {
+					values = aws.StringValueSlice(condition.HostHeaderConfig.Values)
+				}
+				converted.Hosts = append(converted.Hosts, values...)
+			case "path-pattern":
+				if condition.PathPatternConfig != nil {
+					values = aws.StringValueSlice(condition.PathPatternConfig.Values)
+				}
+				converted.Paths = append(converted.Paths, values...)
+			}
+		}
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+// Kinds of RuleConflict
+const (
+	// ConflictDuplicatePriority is a priority shared by several rules, which the ALB rejects
+	ConflictDuplicatePriority = "duplicate priority"
+	// ConflictShadowed is a host and path combination of a rule that an earlier rule always matches first
+	ConflictShadowed = "shadowed"
+	// ConflictUnreachable is a rule whose every host and path combination is shadowed
+	ConflictUnreachable = "unreachable"
+)
+
+// RuleConflict is a problem with the routing of a set of listener rules
+type RuleConflict struct {
+	Kind string
+	// Rule is the rule that is affected
+	Rule string
+	// By lists the rules taking precedence over it, or sharing its priority
+	By []string
+	// Host and Path are the shadowed combination, "*" when the rule has no such condition
+	Host string
+	Path string
+}
+
+func (c RuleConflict) String() string {
+	switch c.Kind {
+	case ConflictDuplicatePriority:
+		return fmt.Sprintf("%s: priority is also used by %s", c.Rule, strings.Join(c.By, ", "))
+	case ConflictShadowed:
+		return fmt.Sprintf("%s: host %s path %s is always matched first by %s", c.Rule, c.Host, c.Path, strings.Join(c.By, ", "))
+	default:
+		return fmt.Sprintf("%s: unreachable, every request it matches is matched first by %s", c.Rule, strings.Join(c.By, ", "))
+	}
+}
+
+// AnalyzeRules reports duplicate priorities, host and path combinations shadowed
+// by a rule with a lower priority and rules that can never match. Rules are
+// evaluated in priority order like the ALB does, rules sharing a priority by name.
+func AnalyzeRules(rules []ListenerRule) []RuleConflict {
+	sorted := make([]ListenerRule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	var conflicts []RuleConflict
+	for i, rule := range sorted {
+		var samePriority []string
+		for j, other := range sorted {
+			if i != j && other.Priority == rule.Priority {
+				samePriority = append(samePriority, other.Name)
+			}
+		}
+		if len(samePriority) > 0 {
+			conflicts = append(conflicts, RuleConflict{Kind: ConflictDuplicatePriority, Rule: rule.Name, By: samePriority})
+		}
+
+		var shadowed []RuleConflict
+		shadowedBy := make(map[string]bool)
+		combinations := 0
+		for _, host := range orAny(rule.Hosts) {
+			for _, path := range orAny(rule.Paths) {
+				combinations++
+				var by []string
+				for _, earlier := range sorted[:i] {
+					if ruleCovers(earlier, host, path) {
+						by = append(by, earlier.Name)
+						shadowedBy[earlier.Name] = true
+					}
+				}
+				if len(by) > 0 {
+					shadowed = append(shadowed, RuleConflict{Kind: ConflictShadowed, Rule: rule.Name, By: by, Host: host, Path: path})
+				}
+			}
+		}
+
+		if len(shadowed) > 0 && len(shadowed) == combinations {
+			by := make([]string, 0, len(shadowedBy))
+			for _, earlier := range sorted[:i] {
+				if shadowedBy[earlier.Name] {
+					by = append(by, earlier.Name)
+				}
+			}
+			conflicts = append(conflicts, RuleConflict{Kind: ConflictUnreachable, Rule: rule.Name, By: by})
+		} else {
+			conflicts = append(conflicts, shadowed...)
+		}
+	}
+	return conflicts
+}
+
+// orAny stands in "*" for a missing condition
+func orAny(values []string) []string {
+	if len(values) == 0 {
+		return []string{"*"}
+	}
+	return values
+}
+
+// ruleCovers reports whether the rule matches every request matching host and path
+func ruleCovers(rule ListenerRule, host, path string) bool {
+	hostCovered := len(rule.Hosts) == 0
+	for _, pattern := range rule.Hosts {
+		// Host headers are matched case-insensitively, paths are not
+		if patternCovers(strings.ToLower(pattern), strings.ToLower(host)) {
+			hostCovered = true
+			break
+		}
+	}
+	pathCovered := len(rule.Paths) == 0
+	for _, pattern := range rule.Paths {
+		if patternCovers(pattern, path) {
+			pathCovered = true
+			break
+		}
+	}
+	return hostCovered && pathCovered
+}
+
+// patternCovers reports whether every string matched by the ALB wildcard pattern
+// inner (* for any characters, ? for exactly one) is also matched by outer
+func patternCovers(outer, inner string) bool {
+	memo := make(map[[2]int]bool)
+	var covers func(i, j int) bool
+	covers = func(i, j int) bool {
+		key := [2]int{i, j}
+		if result, ok := memo[key]; ok {
+			return result
+		}
+		var result bool
+		switch {
+		case i == len(outer):
+			result = j == len(inner)
+		case outer[i] == '*':
+			// Match nothing, or swallow the next character or wildcard of inner
+			result = covers(i+1, j) || (j < len(inner) && covers(i, j+1))
+		case j == len(inner), inner[j] == '*':
+			result = false
+		case outer[i] == '?' || (inner[j] != '?' && outer[i] == inner[j]):
+			result = covers(i+1, j+1)
+		}
+		memo[key] = result
+		return result
+	}
+	return covers(0, 0)
+}
+
+// AssertNoRuleConflicts fails the test with every conflict between the rules
+func AssertNoRuleConflicts(t AssertT, rules []ListenerRule) bool {
+	conflicts := AnalyzeRules(rules)
+	if len(conflicts) == 0 {
+		return true
+	}
+	lines := make([]string, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		lines = append(lines, "  "+conflict.String())
+	}
+	t.Errorf("%d listener rule conflicts:\n%s", len(conflicts), strings.Join(lines, "\n"))
+	return false
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternCovers(t *testing.T) {
+	testCases := []struct {
+		outer, inner string
+		covers       bool
+	}{
+		{"/app1/*", "/app1/*", true},
+		{"/*", "/app1/*", true},
+		{"/app*", "/app1/*", true},
+		{"/app1/*", "/*", false},
+		{"/app1/*", "/app2/*", false},
+		{"/app?/*", "/app1/status", true},
+		{"/app1/status", "/app?/status", false},
+		{"*.cloudns.be", "merkata.cloudns.be", true},
+		{"merkata.cloudns.be", "*.cloudns.be", false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.covers, patternCovers(tc.outer, tc.inner), "%q covers %q", tc.outer, tc.inner)
+	}
+}
+
+func TestAnalyzeRules(t *testing.T) {
+	require.Empty(t, AnalyzeRules(RulesFromApps(DefaultApps())))
+
+	apps := DefaultApps()
+	apps["catchall"] = AppConfig{Path: "/*", Domain: []string{"merkata.cloudns.be"}, Priority: 50}
+	apps["docs"] = AppConfig{Path: "/app1/*", Domain: []string{"merkata.cloudns.be", "docs.example.com"}, Priority: 300}
+	apps["app3"] = AppConfig{Path: "/app3/*", Domain: []string{"example.com"}, Priority: 200}
+
+	var reported []string
+	for _, conflict := range AnalyzeRules(RulesFromApps(apps)) {
+		reported = append(reported, conflict.String())
+	}
+	assert.Equal(t, []string{
+		"app1: unreachable, every request it matches is matched first by catchall",
+		"app2: priority is also used by app3",
+		"app2: unreachable, every request it matches is matched first by catchall",
+		"app3: priority is also used by app2",
+		"docs: host merkata.cloudns.be path /app1/* is always matched first by catchall, app1",
+	}, reported)
+}
+
+func TestRulesFromELBv2(t *testing.T) {
+	rules, err := RulesFromELBv2([]*elbv2.Rule{
+		{Priority: aws.String("default"), IsDefault: aws.Bool(true)},
+		{
+			RuleArn:  aws.String("rule-1"),
+			Priority: aws.String("100"),
+			Conditions: []*elbv2.RuleCondition{
+				{Field: aws.String("path-pattern"), PathPatternConfig: &elbv2.PathPatternConditionConfig{Values: aws.StringSlice([]string{"/app1/*"})}},
+				{Field: aws.String("host-header"), Values: aws.StringSlice([]string{"merkata.cloudns.be"})},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []ListenerRule{{
+		Name:     "priority 100",
+		Priority: 100,
+		Hosts:    []string{"merkata.cloudns.be"},
+		Paths:    []string{"/app1/*"},
+	}}, rules)
+}
+
+// The example configuration is checked before it is ever applied
+func TestExampleAppsHaveNoRuleConflicts(t *testing.T) {
+	apps, err := AppsFromVarFile(t, "../../examples/complete/terraform.tfvars")
+	require.NoError(t, err)
+	require.NoError(t, apps.Validate())
+	assert.Empty(t, AnalyzeRules(RulesFromApps(apps)))
+}
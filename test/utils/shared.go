@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// FixtureT is the subset of testing.T needed to consume a shared fixture
+type FixtureT interface {
+	testing.TestingT
+	Cleanup(func())
+	Logf(format string, args ...interface{})
+}
+
+// Deployer applies and destroys the Terraform configuration behind a fixture
+type Deployer interface {
+	Apply(t testing.TestingT, options *terraform.Options) (Outputs, error)
+	Destroy(t testing.TestingT, options *terraform.Options) error
+}
+
+// TerraformDeployer deploys fixtures with the terraform binary
+type TerraformDeployer struct{}
+
+// Apply runs init and apply and returns all outputs
+func (TerraformDeployer) Apply(t testing.TestingT, options *terraform.Options) (Outputs, error) {
+	if _, err := terraform.InitAndApplyE(t, options); err != nil {
+		return nil, err
+	}
+	return terraform.OutputAllE(t, options)
+}
+
+// Destroy runs terraform destroy, turning off deletion protection on load balancers first
+func (TerraformDeployer) Destroy(t testing.TestingT, options *terraform.Options) error {
+	_, err := DestroyE(t, options)
+	return err
+}
+
+// SharedVPC holds the outputs of a shared VPC fixture
+type SharedVPC struct {
+	ProjectName    string
+	ID             string
+	PublicSubnets  []string
+	PrivateSubnets []string
+	Options        *terraform.Options
+}
+
+// SharedALB holds the outputs of a shared ALB fixture
+type SharedALB struct {
+	VPC             SharedVPC
+	Name            string
+	DNSName         string
+	SecurityGroupID string
+	TargetGroupArns map[string]string
+	// CertificateArn is the self-signed certificate imported for the ALB, deleted
+	// once the ALB is destroyed
+	CertificateArn string
+	Options        *terraform.Options
+}
+
+// SharedFixtures provisions the VPC, and optionally the ALB, once per region,
+// environment and VPC CIDR. Every consumer holds a reference until its test finishes, and
+// the last one to finish destroys the fixture unless Keep is set.
+type SharedFixtures struct {
+	// Keep leaves the fixtures deployed after the last consumer is done
+	Keep bool
+	// ModulesDir is the directory holding the vpc and alb modules
+	ModulesDir string
+	// Deployer applies and destroys the fixtures
+	Deployer Deployer
+	// ACM returns the client importing the ALB's self-signed certificate
+	ACM func(region string) ACMAPI
+
+	mu       sync.Mutex
+	fixtures map[string]*sharedFixture
+}
+
+type sharedFixture struct {
+	key     string
+	ready   chan struct{}
+	refs    int
+	options *terraform.Options
+	outputs Outputs
+	err     error
+	// dependency is a fixture this one holds a reference on
+	dependency *sharedFixture
+	// afterDestroy removes what the fixture needed outside of terraform
+	afterDestroy func() error
+}
+
+// NewSharedFixtures creates a fixture manager that deploys with terraform
+func NewSharedFixtures() *SharedFixtures {
+	return &SharedFixtures{
+		ModulesDir: "../modules",
+		Deployer:   TerraformDeployer{},
+		ACM:        func(region string) ACMAPI { return CreateClients(region).ACM },
+		fixtures:   map[string]*sharedFixture{},
+	}
+}
+
+// VPC returns the shared VPC with the CIDR for the region and environment,
+// deploying it for the first consumer
+func (s *SharedFixtures) VPC(t FixtureT, region, environment, vpcCIDR string) SharedVPC {
+	fixture, err := s.acquireVPC(t, region, environment, vpcCIDR)
+	t.Cleanup(func() { s.release(t, fixture.key) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sharedVPCFromFixture(fixture)
+}
+
+// ALB returns the shared ALB serving the apps in the region and environment, in
+// the shared VPC with the CIDR, deploying both for the first consumer
+func (s *SharedFixtures) ALB(t FixtureT, region, environment, vpcCIDR string, apps Apps) SharedALB {
+	appsKey, err := json.Marshal(apps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := fmt.Sprintf("alb/%s/%s/%s/%s", region, environment, vpcCIDR, appsKey)
+	fixture, err := s.acquire(t, key, func(fixture *sharedFixture) (*terraform.Options, error) {
+		// The ALB holds its own reference on the VPC, dropped once it is destroyed
+		vpcFixture, err := s.acquireVPC(t, region, environment, vpcCIDR)
+		fixture.dependency = vpcFixture
+		if err != nil {
+			return nil, err
+		}
+		vpc := sharedVPCFromFixture(vpcFixture)
+
+		workingDir, err := files.CopyTerraformFolderToTemp(s.ModulesDir+"/alb", "shared-alb")
+		if err != nil {
+			return nil, err
+		}
+		// The certificate outlives the ALB, so it is deleted once the ALB is destroyed
+		acmClient := s.ACM(region)
+		certificateArn, err := ImportSelfSignedCertificateE(acmClient, apps.Domains(), sharedCertificateValidity, map[string]string{
+			"Environment": environment,
+			"Project":     vpc.ProjectName,
+		})
+		if err != nil {
+			return nil, err
+		}
+		fixture.afterDestroy = func() error {
+			return DeleteCertificateE(acmClient, certificateArn, CertificateDeleteWaitOptions())
+		}
+
+		options := CreateALB(t, region, environment, vpc.ProjectName, vpc.ID, vpc.PublicSubnets, apps, certificateArn)
+		options.TerraformDir = workingDir
+		return options, nil
+	})
+	t.Cleanup(func() { s.release(t, key) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return SharedALB{
+		VPC:             sharedVPCFromFixture(fixture.dependency),
+		Name:            fixture.outputs.String("alb_name"),
+		DNSName:         fixture.outputs.String("alb_dns_name"),
+		SecurityGroupID: fixture.outputs.String("alb_security_group_id"),
+		TargetGroupArns: fixture.outputs.Map("target_group_arns"),
+		CertificateArn:  fmt.Sprint(fixture.options.Vars["certificate_arn"]),
+		Options:         fixture.options,
+	}
+}
+
+func (s *SharedFixtures) acquireVPC(t FixtureT, region, environment, vpcCIDR string) (*sharedFixture, error) {
+	key := fmt.Sprintf("vpc/%s/%s/%s", region, environment, vpcCIDR)
+	return s.acquire(t, key, func(*sharedFixture) (*terraform.Options, error) {
+		workingDir, err := files.CopyTerraformFolderToTemp(s.ModulesDir+"/vpc", "shared-vpc")
+		if err != nil {
+			return nil, err
+		}
+		options := CreateVPC(t, region, environment, sharedProjectName(), vpcCIDR)
+		options.TerraformDir = workingDir
+		return options, nil
+	})
+}
+
+// acquire takes a reference on the fixture, deploying it with the options from
+// create if this is the first reference. Consumers arriving during the deploy
+// wait for it to finish. The caller must release the reference, even if an
+// error is returned.
+func (s *SharedFixtures) acquire(t FixtureT, key string, create func(*sharedFixture) (*terraform.Options, error)) (*sharedFixture, error) {
+	s.mu.Lock()
+	fixture, exists := s.fixtures[key]
+	if !exists {
+		fixture = &sharedFixture{key: key, ready: make(chan struct{})}
+		s.fixtures[key] = fixture
+	}
+	fixture.refs++
+	s.mu.Unlock()
+
+	if !exists {
+		func() {
+			defer close(fixture.ready)
+			// Stays set if the deploy stops the test halfway
+			fixture.err = errors.New("deployment was aborted")
+
+			options, err := create(fixture)
+			fixture.options, fixture.err = options, err
+			if err == nil {
+				t.Logf("Deploying shared fixture %s", key)
+				fixture.outputs, fixture.err = s.Deployer.Apply(t, options)
+			}
+		}()
+	}
+	<-fixture.ready
+
+	if fixture.err != nil {
+		return fixture, fmt.Errorf("shared fixture %s failed to deploy: %w", key, fixture.err)
+	}
+	return fixture, nil
+}
+
+// adopt takes a reference on a fixture an earlier run deployed and saved, so
+// that it is destroyed after its last consumer in this run like the fixtures
+// deployed in it. The fixture is keyed by its working directory, which every
+// test that saved it shares. dependency and afterDestroy are only used by the
+// first consumer, the reference later ones pass on the dependency is dropped.
+func (s *SharedFixtures) adopt(t FixtureT, options *terraform.Options, dependency *sharedFixture, afterDestroy func() error) *sharedFixture {
+	key := "saved/" + options.TerraformDir
+	s.mu.Lock()
+	fixture, exists := s.fixtures[key]
+	if !exists {
+		fixture = &sharedFixture{key: key, ready: make(chan struct{}), options: options, dependency: dependency, afterDestroy: afterDestroy}
+		close(fixture.ready)
+		s.fixtures[key] = fixture
+	}
+	fixture.refs++
+	s.mu.Unlock()
+
+	// The fixture already holds its own reference on the dependency
+	if exists && dependency != nil {
+		s.release(t, dependency.key)
+	}
+	return fixture
+}
+
+// release drops a reference and destroys the fixture after the last one
+func (s *SharedFixtures) release(t FixtureT, key string) {
+	s.mu.Lock()
+	fixture := s.fixtures[key]
+	fixture.refs--
+	if fixture.refs > 0 || s.Keep {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.fixtures, key)
+	s.mu.Unlock()
+
+	// A failed apply may still have left resources behind
+	if fixture.options != nil {
+		t.Logf("Destroying shared fixture %s", key)
+		if err := s.Deployer.Destroy(t, fixture.options); err != nil {
+			t.Errorf("Failed to destroy shared fixture %s: %v", key, err)
+		} else if fixture.afterDestroy != nil {
+			if err := fixture.afterDestroy(); err != nil {
+				t.Errorf("Failed to clean up after shared fixture %s: %v", key, err)
+			}
+		}
+	}
+	if fixture.dependency != nil {
+		s.release(t, fixture.dependency.key)
+	}
+}
+
+// Close reports the fixtures left deployed because Keep is set. It is meant to
+// be called from TestMain once all tests have finished.
+func (s *SharedFixtures) Close(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.fixtures {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fixture := s.fixtures[key]
+		if fixture.options == nil {
+			continue
+		}
+		fmt.Fprintf(w, "Kept shared fixture %s in %s, remove it with: terraform -chdir=%s destroy\n",
+			key, fixture.options.TerraformDir, fixture.options.TerraformDir)
+	}
+}
+
+// sharedCertificateValidity leaves room for fixtures kept deployed between runs
+const sharedCertificateValidity = 7 * 24 * time.Hour
+
+func sharedProjectName() string {
+	// The modules lowercase the project name
+	return "shared" + strings.ToLower(random.UniqueId())
+}
+
+func sharedVPCFromFixture(fixture *sharedFixture) SharedVPC {
+	return SharedVPC{
+		ProjectName:    fmt.Sprint(fixture.options.Vars["project_name"]),
+		ID:             fixture.outputs.String("vpc_id"),
+		PublicSubnets:  fixture.outputs.List("public_subnets"),
+		PrivateSubnets: fixture.outputs.List("private_subnets"),
+		Options:        fixture.options,
+	}
+}
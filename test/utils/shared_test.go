@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"test/fakeaws"
+)
+
+// recordingDeployer pretends to deploy the fixtures and records what it did
+type recordingDeployer struct {
+	mu        sync.Mutex
+	applied   []string
+	destroyed []string
+	fail      bool
+}
+
+func (d *recordingDeployer) Apply(t terratesting.TestingT, options *terraform.Options) (Outputs, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.applied = append(d.applied, options.TerraformDir)
+	if d.fail {
+		return nil, errors.New("apply failed")
+	}
+	if _, ok := options.Vars["vpc_cidr"]; ok {
+		return Outputs{
+			"vpc_id":          "vpc-0shared",
+			"public_subnets":  []interface{}{"subnet-pub-a", "subnet-pub-b"},
+			"private_subnets": []interface{}{"subnet-priv-a", "subnet-priv-b"},
+		}, nil
+	}
+	return Outputs{
+		"alb_name":              "shared-ci-alb",
+		"alb_security_group_id": "sg-0shared",
+		"target_group_arns":     map[string]interface{}{"app1": "arn:tg/app1"},
+	}, nil
+}
+
+func (d *recordingDeployer) Destroy(t terratesting.TestingT, options *terraform.Options) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.destroyed = append(d.destroyed, options.TerraformDir)
+	return nil
+}
+
+// newTestFixtures imports the ALB's certificates into a fake ACM
+func newTestFixtures(t *testing.T, deployer *recordingDeployer) (*SharedFixtures, *fakeaws.Server) {
+	server := fakeaws.Start(t, nil)
+	fixtures := NewSharedFixtures()
+	fixtures.ModulesDir = "../../modules"
+	fixtures.Deployer = deployer
+	return fixtures, server
+}
+
+func TestSharedFixturesReferenceCounting(t *testing.T) {
+	deployer := &recordingDeployer{}
+	fixtures, server := newTestFixtures(t, deployer)
+
+	// Nested consumers overlap the way parallel module tests do: each one
+	// still holds its reference while the next one acquires
+	t.Run("alb", func(t *testing.T) {
+		alb := fixtures.ALB(t, "us-east-1", "ci", "10.0.0.0/16", DefaultApps())
+		assert.Equal(t, "sg-0shared", alb.SecurityGroupID)
+		assert.Equal(t, "arn:tg/app1", alb.TargetGroupArns["app1"])
+		assert.Equal(t, "vpc-0shared", alb.VPC.ID)
+		certificateArn := alb.Options.Vars["certificate_arn"].(string)
+		server.Update(func(f *fakeaws.Fixtures) {
+			require.Len(t, f.Certificates, 1)
+			assert.Equal(t, certificateArn, aws.StringValue(f.Certificates[0].CertificateArn))
+			assert.Equal(t, []string{"merkata.cloudns.be"}, aws.StringValueSlice(f.Certificates[0].SubjectAlternativeNames))
+		})
+
+		t.Run("vpc", func(t *testing.T) {
+			vpc := fixtures.VPC(t, "us-east-1", "ci", "10.0.0.0/16")
+			assert.Equal(t, "vpc-0shared", vpc.ID)
+			assert.Equal(t, []string{"subnet-priv-a", "subnet-priv-b"}, vpc.PrivateSubnets)
+		})
+		assert.Empty(t, deployer.destroyed, "the alb still holds the vpc")
+	})
+
+	// One VPC and one ALB, both torn down once every consumer is done
+	require.Len(t, deployer.applied, 2)
+	require.Len(t, deployer.destroyed, 2)
+	assert.ElementsMatch(t, deployer.applied, deployer.destroyed)
+	assert.Empty(t, fixtures.fixtures)
+
+	// The ALB's certificate is gone with it
+	server.Update(func(f *fakeaws.Fixtures) { assert.Empty(t, f.Certificates) })
+}
+
+func TestSharedFixturesPerVPCCIDR(t *testing.T) {
+	deployer := &recordingDeployer{}
+	fixtures, _ := newTestFixtures(t, deployer)
+
+	t.Run("consumers", func(t *testing.T) {
+		first := fixtures.VPC(t, "us-east-1", "ci", "10.0.0.0/16")
+		second := fixtures.VPC(t, "us-east-1", "ci", "10.1.0.0/16")
+		again := fixtures.VPC(t, "us-east-1", "ci", "10.1.0.0/16")
+
+		assert.Equal(t, "10.0.0.0/16", first.Options.Vars["vpc_cidr"])
+		assert.Equal(t, "10.1.0.0/16", second.Options.Vars["vpc_cidr"])
+		assert.Equal(t, second.ProjectName, again.ProjectName)
+		assert.NotEqual(t, first.ProjectName, second.ProjectName)
+	})
+
+	assert.Len(t, deployer.applied, 2)
+	assert.Len(t, deployer.destroyed, 2)
+}
+
+func TestSharedFixturesKeep(t *testing.T) {
+	deployer := &recordingDeployer{}
+	fixtures, _ := newTestFixtures(t, deployer)
+	fixtures.Keep = true
+
+	t.Run("consumer", func(t *testing.T) {
+		fixtures.VPC(t, "us-east-1", "ci", "10.0.0.0/16")
+	})
+
+	assert.Len(t, deployer.applied, 1)
+	assert.Empty(t, deployer.destroyed)
+	assert.Len(t, fixtures.fixtures, 1)
+}
+
+func TestSharedFixturesFailedDeploy(t *testing.T) {
+	deployer := &recordingDeployer{fail: true}
+	fixtures, _ := newTestFixtures(t, deployer)
+
+	_, err := fixtures.acquireVPC(t, "us-east-1", "ci", "10.0.0.0/16")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "apply failed")
+
+	// Whatever the failed apply left behind is still destroyed
+	fixtures.release(t, "vpc/us-east-1/ci/10.0.0.0/16")
+	assert.Len(t, deployer.destroyed, 1)
+	assert.Empty(t, fixtures.fixtures)
+}
+
+func TestSharedFixturesSavedByEarlierRun(t *testing.T) {
+	deployer := &recordingDeployer{}
+	fixtures, server := newTestFixtures(t, deployer)
+	t.Setenv("SKIP_"+StageDeployVPC, "true")
+	t.Setenv("SKIP_"+StageDeployALB, "true")
+
+	// What the ALB and compute tests saved when the earlier run deployed the fixtures
+	certificateArn := "arn:aws:acm:us-east-1:123456789012:certificate/saved"
+	server.Update(func(f *fakeaws.Fixtures) {
+		f.Certificates = []*acm.CertificateDetail{{CertificateArn: aws.String(certificateArn)}}
+	})
+	vpc := SharedVPC{ID: "vpc-0saved", Options: &terraform.Options{TerraformDir: "/tmp/shared-vpc"}}
+	alb := SharedALB{VPC: vpc, CertificateArn: certificateArn, Options: &terraform.Options{TerraformDir: "/tmp/shared-alb"}}
+	albFolder, computeFolder := t.TempDir(), t.TempDir()
+	test_structure.SaveTestData(t, test_structure.FormatTestDataPath(albFolder, "SharedVPC.json"), true, vpc)
+	test_structure.SaveTestData(t, test_structure.FormatTestDataPath(computeFolder, "SharedALB.json"), true, alb)
+
+	// The ALB test holds the VPC while the compute tests hold the ALB, which holds it too
+	t.Run("alb", func(t *testing.T) {
+		assert.Equal(t, "vpc-0saved", fixtures.VPCStage(t, albFolder, "us-east-1", "ci", "10.0.0.0/16").ID)
+
+		t.Run("compute", func(t *testing.T) {
+			assert.Equal(t, certificateArn, fixtures.ALBStage(t, computeFolder, "us-east-1", "ci", "10.0.0.0/16", DefaultApps()).CertificateArn)
+
+			t.Run("compute", func(t *testing.T) {
+				fixtures.ALBStage(t, computeFolder, "us-east-1", "ci", "10.0.0.0/16", DefaultApps())
+			})
+		})
+		assert.Equal(t, []string{"/tmp/shared-alb"}, deployer.destroyed, "the alb test still holds the vpc")
+	})
+
+	// Each is destroyed once, the VPC after the ALB deployed into it
+	assert.Empty(t, deployer.applied)
+	assert.Equal(t, []string{"/tmp/shared-alb", "/tmp/shared-vpc"}, deployer.destroyed)
+	assert.Empty(t, fixtures.fixtures)
+	server.Update(func(f *fakeaws.Fixtures) { assert.Empty(t, f.Certificates) })
+}
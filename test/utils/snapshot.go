@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+// PlanSnapshot is what a plan would create, reduced to what is stable between runs:
+// the managed resources with their known values. Unknown values, the terraform
+// and provider versions and anything else in the plan are left out, and volatile
+// IDs are replaced by placeholders.
+type PlanSnapshot struct {
+	Resources map[string]SnapshotResource `json:"resources"`
+}
+
+// SnapshotResource is a resource of a PlanSnapshot
+type SnapshotResource struct {
+	// Actions are the planned actions, e.g. ["create"]
+	Actions []string               `json:"actions"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+// Placeholders of the values that change between accounts, regions and runs
+const (
+	snapshotSensitive = "(sensitive)"
+	snapshotAccount   = "000000000000"
+)
+
+var (
+	// awsID matches the IDs of EC2 resources, e.g. the AMI a data source looked up
+	awsID = regexp.MustCompile(`\b(ami|vpc|subnet|sg|igw|nat|rtb|eipalloc|lt|i|acl|eni|vol|snap)-[0-9a-f]{8,17}\b`)
+	// arnAccount matches the account of an ARN
+	arnAccount = regexp.MustCompile(`\b(arn:aws[a-z-]*:[a-z0-9-]*:[a-z0-9-]*:)\d{12}:`)
+)
+
+// NormalizePlan returns the snapshot of a plan
+func NormalizePlan(plan *terraform.PlanStruct) PlanSnapshot {
+	snapshot := PlanSnapshot{Resources: map[string]SnapshotResource{}}
+	for address, resource := range plan.ResourceChangesMap {
+		if resource == nil || resource.Mode != "managed" || resource.Change == nil {
+			continue
+		}
+		change := resource.Change
+		values, _ := normalizeValue(change.After, change.AfterUnknown, change.AfterSensitive).(map[string]interface{})
+		if values == nil {
+			values = map[string]interface{}{}
+		}
+		actions := make([]string, 0, len(change.Actions))
+		for _, action := range change.Actions {
+			actions = append(actions, string(action))
+		}
+		snapshot.Resources[address] = SnapshotResource{Actions: actions, Values: values}
+	}
+	return snapshot
+}
+
+// normalizeValue drops the parts of value that unknown marks as known after apply,
+// masks the parts sensitive marks and replaces volatile IDs. unknown and sensitive
+// mirror value, with true where the mark applies.
+func normalizeValue(value, unknown, sensitive interface{}) interface{} {
+	if isSensitive, _ := sensitive.(bool); isSensitive {
+		return snapshotSensitive
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		unknownMap, _ := unknown.(map[string]interface{})
+		sensitiveMap, _ := sensitive.(map[string]interface{})
+		normalized := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			if isUnknown, _ := unknownMap[key].(bool); isUnknown {
+				continue
+			}
+			normalized[key] = normalizeValue(child, unknownMap[key], sensitiveMap[key])
+		}
+		return normalized
+	case []interface{}:
+		unknownList, _ := unknown.([]interface{})
+		sensitiveList, _ := sensitive.([]interface{})
+		normalized := make([]interface{}, 0, len(value))
+		for i, child := range value {
+			var childUnknown, childSensitive interface{}
+			if i < len(unknownList) {
+				childUnknown = unknownList[i]
+			}
+			if i < len(sensitiveList) {
+				childSensitive = sensitiveList[i]
+			}
+			// Keep the positions of unknown list elements, as they are part of the shape
+			if isUnknown, _ := childUnknown.(bool); isUnknown {
+				normalized = append(normalized, nil)
+				continue
+			}
+			normalized = append(normalized, normalizeValue(child, childUnknown, childSensitive))
+		}
+		return normalized
+	case string:
+		return arnAccount.ReplaceAllString(awsID.ReplaceAllString(value, "$1-00000000"), "${1}"+snapshotAccount+":")
+	default:
+		return value
+	}
+}
+
+// DiffPlanSnapshots compares a plan's snapshot with the expected one and returns
+// every resource that was added, removed or changed, with the changed attributes,
+// sorted by address. Actions are "added", "removed" and "changed".
+func DiffPlanSnapshots(expected, actual PlanSnapshot) []PendingChange {
+	addresses := make(map[string]bool)
+	for address := range expected.Resources {
+		addresses[address] = true
+	}
+	for address := range actual.Resources {
+		addresses[address] = true
+	}
+
+	var changes []PendingChange
+	for address := range addresses {
+		before, inExpected := expected.Resources[address]
+		after, inActual := actual.Resources[address]
+		switch {
+		case !inExpected:
+			changes = append(changes, PendingChange{Address: address, Action: "added"})
+		case !inActual:
+			changes = append(changes, PendingChange{Address: address, Action: "removed"})
+		default:
+			attributes := diffAttributes("", before.Values, after.Values, nil)
+			if !equalStrings(before.Actions, after.Actions) {
+				attributes = append([]AttributeChange{{Path: "(actions)", Before: before.Actions, After: after.Actions}}, attributes...)
+			}
+			if len(attributes) > 0 {
+				changes = append(changes, PendingChange{Address: address, Action: "changed", Attributes: attributes})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+	return changes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WritePlanSnapshot writes the snapshot as indented JSON with sorted keys, so
+// changes to it review well
+func WritePlanSnapshot(file string, snapshot PlanSnapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0o644)
+}
+
+// ReadPlanSnapshot reads a snapshot written by WritePlanSnapshot
+func ReadPlanSnapshot(file string) (PlanSnapshot, error) {
+	var snapshot PlanSnapshot
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	return snapshot, nil
+}
+
+// AssertPlanSnapshot compares the plan with the snapshot in file and reports every
+// added, removed and changed resource in a single failure. With update set it
+// writes the plan's snapshot to file instead.
+func AssertPlanSnapshot(t AssertT, plan *terraform.PlanStruct, file string, update bool) bool {
+	snapshot := NormalizePlan(plan)
+	if update {
+		if err := WritePlanSnapshot(file, snapshot); err != nil {
+			t.Errorf("writing plan snapshot: %v", err)
+			return false
+		}
+		t.Logf("Updated plan snapshot %s", file)
+		return true
+	}
+
+	expected, err := ReadPlanSnapshot(file)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Errorf("plan snapshot %s does not exist, create it with -update", file)
+		return false
+	}
+	if err != nil {
+		t.Errorf("reading plan snapshot: %v", err)
+		return false
+	}
+
+	// Compare the JSON forms, in which numbers are float64 on both sides
+	actual, err := roundTrip(snapshot)
+	if err != nil {
+		t.Errorf("encoding plan snapshot: %v", err)
+		return false
+	}
+	changes := DiffPlanSnapshots(expected, actual)
+	if len(changes) == 0 {
+		return true
+	}
+	t.Errorf("plan differs from snapshot %s in %d resources, review and accept with -update:\n%s",
+		file, len(changes), FormatPendingChanges(changes))
+	return false
+}
+
+func roundTrip(snapshot PlanSnapshot) (PlanSnapshot, error) {
+	var decoded PlanSnapshot
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return decoded, err
+	}
+	err = json.Unmarshal(data, &decoded)
+	return decoded, err
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSnapshotPlanJSON = `{
+  "format_version": "1.2",
+  "terraform_version": "1.9.8",
+  "planned_values": {"root_module": {}},
+  "resource_changes": [
+    {
+      "address": "module.compute.aws_launch_template.app", "mode": "managed", "type": "aws_launch_template", "name": "app",
+      "provider_name": "registry.terraform.io/hashicorp/aws",
+      "change": {
+        "actions": ["create"], "before": null,
+        "after": {"image_id": "ami-0abcdef1234567890", "instance_type": "t3.micro", "user_data": "c2VjcmV0",
+                  "iam_instance_profile": [{"arn": "arn:aws:iam::123456789012:instance-profile/demo"}],
+                  "vpc_security_group_ids": ["sg-0123456789abcdef0", null]},
+        "after_unknown": {"id": true, "arn": true, "latest_version": true, "iam_instance_profile": [{}],
+                          "vpc_security_group_ids": [false, true]},
+        "after_sensitive": {"user_data": true}
+      }
+    },
+    {
+      "address": "data.aws_ami.amazon_linux", "mode": "data", "type": "aws_ami", "name": "amazon_linux",
+      "change": {"actions": ["read"], "before": null, "after": {"id": "ami-0abcdef1234567890"}}
+    }
+  ]
+}`
+
+func testSnapshot(t *testing.T) PlanSnapshot {
+	plan, err := terraform.ParsePlanJSON(testSnapshotPlanJSON)
+	require.NoError(t, err)
+	return NormalizePlan(plan)
+}
+
+func TestNormalizePlan(t *testing.T) {
+	snapshot := testSnapshot(t)
+
+	// Data sources are left out, unknowns dropped and IDs masked
+	assert.Equal(t, PlanSnapshot{Resources: map[string]SnapshotResource{
+		"module.compute.aws_launch_template.app": {
+			Actions: []string{"create"},
+			Values: map[string]interface{}{
+				"image_id":               "ami-00000000",
+				"instance_type":          "t3.micro",
+				"user_data":              "(sensitive)",
+				"iam_instance_profile":   []interface{}{map[string]interface{}{"arn": "arn:aws:iam::000000000000:instance-profile/demo"}},
+				"vpc_security_group_ids": []interface{}{"sg-00000000", nil},
+			},
+		},
+	}}, snapshot)
+}
+
+func TestDiffPlanSnapshots(t *testing.T) {
+	expected := testSnapshot(t)
+	expected.Resources["aws_eip.nat[1]"] = SnapshotResource{Actions: []string{"create"}, Values: map[string]interface{}{"domain": "vpc"}}
+
+	actual := testSnapshot(t)
+	actual.Resources["module.compute.aws_launch_template.app"].Values["instance_type"] = "t3.small"
+	actual.Resources["aws_s3_bucket.logs"] = SnapshotResource{Actions: []string{"create"}, Values: map[string]interface{}{}}
+
+	changes := DiffPlanSnapshots(expected, actual)
+	assert.Equal(t, []PendingChange{
+		{Address: "aws_eip.nat[1]", Action: "removed"},
+		{Address: "aws_s3_bucket.logs", Action: "added"},
+		{Address: "module.compute.aws_launch_template.app", Action: "changed", Attributes: []AttributeChange{
+			{Path: "instance_type", Before: "t3.micro", After: "t3.small"},
+		}},
+	}, changes)
+	assert.Empty(t, DiffPlanSnapshots(expected, expected))
+}
+
+// snapshotT records the failures of AssertPlanSnapshot
+type snapshotT struct {
+	errors []string
+}
+
+func (t *snapshotT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+func (t *snapshotT) FailNow()                                {}
+func (t *snapshotT) Logf(format string, args ...interface{}) {}
+
+func TestAssertPlanSnapshot(t *testing.T) {
+	plan, err := terraform.ParsePlanJSON(testSnapshotPlanJSON)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "snapshots", "compute.json")
+
+	recorder := &snapshotT{}
+	assert.False(t, AssertPlanSnapshot(recorder, plan, file, false))
+	assert.Equal(t, []string{"plan snapshot " + file + " does not exist, create it with -update"}, recorder.errors)
+
+	assert.True(t, AssertPlanSnapshot(t, plan, file, true))
+	assert.True(t, AssertPlanSnapshot(t, plan, file, false), "a written snapshot should match its plan")
+
+	changed := NormalizePlan(plan)
+	changed.Resources["module.compute.aws_launch_template.app"].Values["instance_type"] = "t3.small"
+	require.NoError(t, WritePlanSnapshot(file, changed))
+	recorder = &snapshotT{}
+	assert.False(t, AssertPlanSnapshot(recorder, plan, file, false))
+	assert.Equal(t, []string{"plan differs from snapshot " + file + " in 1 resources, review and accept with -update:\n" +
+		"  module.compute.aws_launch_template.app (changed)\n" +
+		"      instance_type: \"t3.small\" => \"t3.micro\"\n"}, recorder.errors)
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/gruntwork-io/terratest/modules/testing"
+)
+
+// Test stages. Setting SKIP_<stage> skips the stage, so e.g. with SKIP_teardown on
+// the first run and every SKIP_deploy_* afterwards only the validation is rerun
+// against the infrastructure that is already up.
+const (
+	StageDeployVPC     = "deploy_vpc"
+	StageDeployALB     = "deploy_alb"
+	StageDeployCompute = "deploy_compute"
+	StageValidate      = "validate"
+	StageTeardown      = "teardown"
+)
+
+// StageSkipped reports whether SKIP_<stage> is set
+func StageSkipped(stage string) bool {
+	return os.Getenv("SKIP_"+stage) != ""
+}
+
+// Outputs holds the outputs of an applied module, as returned by terraform output -json
+type Outputs map[string]interface{}
+
+// String returns a string output, or "" if it is missing
+func (o Outputs) String(name string) string {
+	if value, ok := o[name]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+// List returns a list output
+func (o Outputs) List(name string) []string {
+	values, _ := o[name].([]interface{})
+	var list []string
+	for _, value := range values {
+		list = append(list, fmt.Sprint(value))
+	}
+	return list
+}
+
+// Map returns a map output
+func (o Outputs) Map(name string) map[string]string {
+	values, _ := o[name].(map[string]interface{})
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[key] = fmt.Sprint(value)
+	}
+	return result
+}
+
+// SaveOutputs stores all outputs of the module in the test folder
+func SaveOutputs(t testing.TestingT, testFolder string, options *terraform.Options) Outputs {
+	outputs := Outputs(terraform.OutputAll(t, options))
+	test_structure.SaveTestData(t, test_structure.FormatTestDataPath(testFolder, "Outputs.json"), true, outputs)
+	return outputs
+}
+
+// LoadOutputs loads the outputs stored by SaveOutputs
+func LoadOutputs(t testing.TestingT, testFolder string) Outputs {
+	var outputs Outputs
+	test_structure.LoadTestData(t, test_structure.FormatTestDataPath(testFolder, "Outputs.json"), &outputs)
+	return outputs
+}
+
+// VPCStage runs the deploy_vpc stage, taking the shared VPC and saving it in the
+// test folder. When the stage is skipped the VPC saved by an earlier run is used,
+// and destroyed after its last consumer in this run.
+func (s *SharedFixtures) VPCStage(t FixtureT, testFolder, region, environment, vpcCIDR string) SharedVPC {
+	path := test_structure.FormatTestDataPath(testFolder, "SharedVPC.json")
+	test_structure.RunTestStage(t, StageDeployVPC, func() {
+		test_structure.SaveTestData(t, path, true, s.VPC(t, region, environment, vpcCIDR))
+	})
+
+	var vpc SharedVPC
+	test_structure.LoadTestData(t, path, &vpc)
+	if StageSkipped(StageDeployVPC) {
+		fixture := s.adopt(t, vpc.Options, nil, nil)
+		t.Cleanup(func() { s.release(t, fixture.key) })
+	}
+	return vpc
+}
+
+// ALBStage runs the deploy_alb stage, taking the shared ALB and saving it in the
+// test folder. When the stage is skipped the ALB saved by an earlier run is used,
+// and destroyed with its certificate after its last consumer in this run. The VPC
+// it was deployed into goes after the ALB and its other consumers.
+func (s *SharedFixtures) ALBStage(t FixtureT, testFolder, region, environment, vpcCIDR string, apps Apps) SharedALB {
+	path := test_structure.FormatTestDataPath(testFolder, "SharedALB.json")
+	test_structure.RunTestStage(t, StageDeployALB, func() {
+		test_structure.SaveTestData(t, path, true, s.ALB(t, region, environment, vpcCIDR, apps))
+	})
+
+	var alb SharedALB
+	test_structure.LoadTestData(t, path, &alb)
+	if StageSkipped(StageDeployALB) {
+		acmClient := s.ACM(region)
+		fixture := s.adopt(t, alb.Options, s.adopt(t, alb.VPC.Options, nil, nil), func() error {
+			return DeleteCertificateE(acmClient, alb.CertificateArn, CertificateDeleteWaitOptions())
+		})
+		t.Cleanup(func() { s.release(t, fixture.key) })
+	}
+	return alb
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputs(t *testing.T) {
+	outputs := Outputs{
+		"vpc_id":            "vpc-0abc",
+		"public_subnets":    []interface{}{"subnet-a", "subnet-b"},
+		"target_group_arns": map[string]interface{}{"app1": "arn:tg/app1"},
+	}
+
+	assert.Equal(t, "vpc-0abc", outputs.String("vpc_id"))
+	assert.Equal(t, "", outputs.String("missing"))
+	assert.Equal(t, []string{"subnet-a", "subnet-b"}, outputs.List("public_subnets"))
+	assert.Equal(t, map[string]string{"app1": "arn:tg/app1"}, outputs.Map("target_group_arns"))
+}
+
+func TestVPCStageReusesSavedVPC(t *testing.T) {
+	testFolder := t.TempDir()
+	deployer := &recordingDeployer{}
+	fixtures, _ := newTestFixtures(t, deployer)
+	fixtures.Keep = true
+
+	// The first run deploys the VPC and leaves it in place
+	t.Run("first run", func(t *testing.T) {
+		vpc := fixtures.VPCStage(t, testFolder, "us-east-1", "ci", "10.0.0.0/16")
+		assert.Equal(t, "vpc-0shared", vpc.ID)
+	})
+
+	// A rerun skipping the stage loads it instead of deploying another one
+	t.Run("rerun", func(t *testing.T) {
+		t.Setenv("SKIP_"+StageDeployVPC, "true")
+		rerun, _ := newTestFixtures(t, deployer)
+
+		vpc := rerun.VPCStage(t, testFolder, "us-east-1", "ci", "10.0.0.0/16")
+		assert.Equal(t, "vpc-0shared", vpc.ID)
+		assert.Equal(t, []string{"subnet-pub-a", "subnet-pub-b"}, vpc.PublicSubnets)
+		require.NotNil(t, vpc.Options)
+		assert.NotEmpty(t, vpc.Options.TerraformDir)
+	})
+
+	assert.Len(t, deployer.applied, 1)
+}
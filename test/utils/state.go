@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// stateModule is a module in the output of `terraform show -json` without a plan
+type stateModule struct {
+	Resources []struct {
+		Address string                 `json:"address"`
+		Mode    string                 `json:"mode"`
+		Type    string                 `json:"type"`
+		Name    string                 `json:"name"`
+		Index   interface{}            `json:"index"`
+		Values  map[string]interface{} `json:"values"`
+	} `json:"resources"`
+	ChildModules []stateModule `json:"child_modules"`
+}
+
+// stateResources returns the managed resources recorded in the output of
+// `terraform show -json` without a plan, in any module, sorted by address. Their
+// values have the shape of planned values, so the attr helpers read both.
+func stateResources(stateJSON string) ([]plannedResource, error) {
+	var state struct {
+		Values *struct {
+			RootModule stateModule `json:"root_module"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
+		return nil, fmt.Errorf("parsing terraform state: %w", err)
+	}
+	// An empty state has no values
+	if state.Values == nil {
+		return nil, nil
+	}
+
+	var resources []plannedResource
+	var walk func(module stateModule)
+	walk = func(module stateModule) {
+		for _, resource := range module.Resources {
+			if resource.Mode != "managed" {
+				continue
+			}
+			resources = append(resources, plannedResource{
+				Address: resource.Address,
+				Type:    resource.Type,
+				Name:    resource.Name,
+				Index:   resource.Index,
+				Values:  resource.Values,
+			})
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	walk(state.Values.RootModule)
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Address < resources[j].Address })
+	return resources, nil
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// Tag represents a key-value pair tag
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// EC2Tags normalises EC2 tags
+func EC2Tags(tags []*ec2.Tag) []Tag {
+	result := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, Tag{Key: aws.StringValue(tag.Key), Value: aws.StringValue(tag.Value)})
+	}
+	return result
+}
+
+// ELBv2Tags normalises load balancer and target group tags
+func ELBv2Tags(tags []*elbv2.Tag) []Tag {
+	result := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, Tag{Key: aws.StringValue(tag.Key), Value: aws.StringValue(tag.Value)})
+	}
+	return result
+}
+
+// AutoScalingTags normalises Auto Scaling group tags
+func AutoScalingTags(tags []*autoscaling.TagDescription) []Tag {
+	result := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, Tag{Key: aws.StringValue(tag.Key), Value: aws.StringValue(tag.Value)})
+	}
+	return result
+}
+
+// IAMTags normalises IAM role and instance profile tags
+func IAMTags(tags []*iam.Tag) []Tag {
+	result := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, Tag{Key: aws.StringValue(tag.Key), Value: aws.StringValue(tag.Value)})
+	}
+	return result
+}
+
+// MapTags normalises a tag map, e.g. the tags of a planned resource
+func MapTags(tags map[string]string) []Tag {
+	result := make([]Tag, 0, len(tags))
+	for key, value := range tags {
+		result = append(result, Tag{Key: key, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// TaggedResource is a resource to check against a TagPolicy
+type TaggedResource struct {
+	// Kind describes the resource in reports, e.g. "subnet" or "aws_lb"
+	Kind string
+	ID   string
+	Tags []Tag
+}
+
+// TagPolicy maps the keys of the tags every resource must carry to their value.
+// An empty value only requires the key to be present.
+type TagPolicy map[string]string
+
+// RequiredTags is the policy every module follows
+func RequiredTags(environment, projectName string) TagPolicy {
+	return TagPolicy{
+		"Environment": environment,
+		"Project":     projectName,
+		"ManagedBy":   "terraform",
+	}
+}
+
+// TagViolation is a required tag that is missing or has another value
+type TagViolation struct {
+	Key      string
+	Expected string
+	Actual   string
+	Missing  bool
+}
+
+// Check returns the violations of a single resource's tags, sorted by key
+func (p TagPolicy) Check(tags []Tag) []TagViolation {
+	actual := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		actual[tag.Key] = tag.Value
+	}
+
+	var violations []TagViolation
+	for key, expected := range p {
+		value, ok := actual[key]
+		switch {
+		case !ok:
+			violations = append(violations, TagViolation{Key: key, Expected: expected, Missing: true})
+		case expected != "" && value != expected:
+			violations = append(violations, TagViolation{Key: key, Expected: expected, Actual: value})
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool { return violations[i].Key < violations[j].Key })
+	return violations
+}
+
+// TagFinding is a resource that does not comply with a TagPolicy
+type TagFinding struct {
+	Resource   TaggedResource
+	Violations []TagViolation
+}
+
+// TagReport lists the non-compliant resources, in the order they were evaluated
+type TagReport []TagFinding
+
+// Evaluate checks every resource against the policy
+func (p TagPolicy) Evaluate(resources ...TaggedResource) TagReport {
+	var report TagReport
+	for _, resource := range resources {
+		if violations := p.Check(resource.Tags); len(violations) > 0 {
+			report = append(report, TagFinding{Resource: resource, Violations: violations})
+		}
+	}
+	return report
+}
+
+// String renders the report as a diff of the required (-) and actual (+) tags
+func (r TagReport) String() string {
+	var b strings.Builder
+	for _, finding := range r {
+		fmt.Fprintf(&b, "%s %s:\n", finding.Resource.Kind, finding.Resource.ID)
+		for _, violation := range finding.Violations {
+			if violation.Expected == "" {
+				fmt.Fprintf(&b, "  - %s: (any value)\n", violation.Key)
+			} else {
+				fmt.Fprintf(&b, "  - %s: %q\n", violation.Key, violation.Expected)
+			}
+			if violation.Missing {
+				fmt.Fprintf(&b, "  + %s: (missing)\n", violation.Key)
+			} else {
+				fmt.Fprintf(&b, "  + %s: %q\n", violation.Key, violation.Actual)
+			}
+		}
+	}
+	return b.String()
+}
+
+// AssertTagPolicy checks the resources against the policy and reports all the
+// non-compliant ones in a single failure
+func AssertTagPolicy(t AssertT, policy TagPolicy, resources ...TaggedResource) bool {
+	report := policy.Evaluate(resources...)
+	if len(report) == 0 {
+		return true
+	}
+	t.Errorf("%d of %d resources do not comply with the tag policy (- required, + actual):\n%s",
+		len(report), len(resources), report)
+	return false
+}
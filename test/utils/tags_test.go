@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagPolicyReport(t *testing.T) {
+	policy := RequiredTags("ci", "demo")
+	policy["Name"] = ""
+
+	report := policy.Evaluate(
+		TaggedResource{Kind: "subnet", ID: "subnet-1", Tags: EC2Tags([]*ec2.Tag{
+			{Key: aws.String("Environment"), Value: aws.String("ci")},
+			{Key: aws.String("Project"), Value: aws.String("demo")},
+			{Key: aws.String("ManagedBy"), Value: aws.String("terraform")},
+			{Key: aws.String("Name"), Value: aws.String("demo-ci-private")},
+		})},
+		TaggedResource{Kind: "auto scaling group", ID: "demo-ci-asg", Tags: AutoScalingTags([]*autoscaling.TagDescription{
+			{Key: aws.String("Environment"), Value: aws.String("prod")},
+			{Key: aws.String("Project"), Value: aws.String("demo")},
+		})},
+	)
+
+	assert.Len(t, report, 1, "only the non-compliant resource should be reported")
+	assert.Equal(t, `auto scaling group demo-ci-asg:
+  - Environment: "ci"
+  + Environment: "prod"
+  - ManagedBy: "terraform"
+  + ManagedBy: (missing)
+  - Name: (any value)
+  + Name: (missing)
+`, report.String())
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+// UpgradeBaseRefEnvVar selects the git ref the upgrade test deploys before
+// upgrading to the working tree, e.g. the base branch of a pull request
+const UpgradeBaseRefEnvVar = "UPGRADE_BASE_REF"
+
+// DefaultUpgradeBaseRef is the ref the upgrade test starts from when UpgradeBaseRefEnvVar is not set
+const DefaultUpgradeBaseRef = "origin/main"
+
+// ProtectedResourceTypes are the resources an upgrade must never destroy or
+// replace: losing them takes a live environment down or changes its addresses
+var ProtectedResourceTypes = []string{"aws_vpc", "aws_lb", "aws_nat_gateway", "aws_lb_target_group"}
+
+// UpgradeBaseRef returns the ref the upgrade test starts from
+func UpgradeBaseRef() string {
+	if ref := os.Getenv(UpgradeBaseRefEnvVar); ref != "" {
+		return ref
+	}
+	return DefaultUpgradeBaseRef
+}
+
+// git runs git in dir and returns its output
+func git(dir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// GitRefExists reports whether ref names a commit in the repository dir is in,
+// e.g. false for a remote branch a shallow clone did not fetch
+func GitRefExists(dir, ref string) bool {
+	_, err := git(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
+
+// ChangedSinceE reports whether any of the paths, relative to the root of the
+// repository dir is in, differs between ref and the working tree
+func ChangedSinceE(dir, ref string, paths ...string) (bool, error) {
+	root, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return false, err
+	}
+	_, err = git(strings.TrimSpace(string(root)), append([]string{"diff", "--quiet", ref, "--"}, paths...)...)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return true, nil
+	}
+	return false, err
+}
+
+// ExportGitRefE writes the paths as they are at ref into dest. The paths are
+// relative to the root of the repository dir is in and keep their layout, so
+// relative module sources between them still resolve.
+func ExportGitRefE(dir, ref, dest string, paths ...string) error {
+	root, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	archive, err := git(strings.TrimSpace(string(root)), append([]string{"archive", "--format=tar", ref, "--"}, paths...)...)
+	if err != nil {
+		return err
+	}
+
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading the archive of %s: %w", ref, err)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(filepath.Separator)) {
+			return fmt.Errorf("archive of %s has an entry outside the destination: %s", ref, header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, data, os.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// DestructiveChanges returns the resources of the given types the plan would
+// destroy or replace, sorted by address
+func DestructiveChanges(plan *terraform.PlanStruct, resourceTypes ...string) []PendingChange {
+	var destructive []PendingChange
+	for _, change := range PendingChanges(plan) {
+		if change.Action != "delete" && change.Action != "replace" {
+			continue
+		}
+		if resource := plan.ResourceChangesMap[change.Address]; resource != nil && contains(resourceTypes, resource.Type) {
+			destructive = append(destructive, change)
+		}
+	}
+	return destructive
+}
+
+// AssertNoDestructiveChanges fails with every resource of the given types the plan
+// would destroy or replace, and the attributes that force a replacement
+func AssertNoDestructiveChanges(t AssertT, plan *terraform.PlanStruct, resourceTypes ...string) bool {
+	changes := DestructiveChanges(plan, resourceTypes...)
+	if len(changes) == 0 {
+		return true
+	}
+	t.Errorf("plan would destroy or replace %d protected resources (%s):\n%s",
+		len(changes), strings.Join(resourceTypes, ", "), FormatPendingChanges(changes))
+	return false
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRepo creates a git repository with a module and an example using it, and
+// returns its root and the commit
+func testRepo(t *testing.T) (string, string) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "vpc"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "examples", "complete"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "vpc", "main.tf"), []byte("resource \"aws_vpc\" \"this\" {}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "examples", "complete", "main.tf"), []byte("module \"vpc\" {\n  source = \"../../modules/vpc\"\n}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "README.md"), []byte("# module\n"), 0o644))
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "base"},
+	} {
+		_, err := git(root, args...)
+		require.NoError(t, err)
+	}
+	commit, err := git(root, "rev-parse", "HEAD")
+	require.NoError(t, err)
+	return root, string(commit[:len(commit)-1])
+}
+
+func TestExportGitRef(t *testing.T) {
+	root, commit := testRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "vpc", "main.tf"), []byte("resource \"aws_vpc\" \"main\" {}\n"), 0o644))
+
+	dest := t.TempDir()
+	require.NoError(t, ExportGitRefE(filepath.Join(root, "examples"), commit, dest, "modules", "examples/complete"))
+
+	module, err := os.ReadFile(filepath.Join(dest, "modules", "vpc", "main.tf"))
+	require.NoError(t, err)
+	assert.Equal(t, "resource \"aws_vpc\" \"this\" {}\n", string(module), "the export holds the committed module")
+	assert.FileExists(t, filepath.Join(dest, "examples", "complete", "main.tf"))
+	assert.NoFileExists(t, filepath.Join(dest, "README.md"))
+
+	assert.Error(t, ExportGitRefE(root, "no-such-ref", t.TempDir(), "modules"))
+}
+
+func TestChangedSince(t *testing.T) {
+	root, commit := testRepo(t)
+
+	changed, err := ChangedSinceE(root, commit, "modules", "examples/complete")
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "README.md"), []byte("# module\n\nUsage\n"), 0o644))
+	changed, err = ChangedSinceE(root, commit, "modules", "examples/complete")
+	require.NoError(t, err)
+	assert.False(t, changed, "only the given paths count")
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "vpc", "main.tf"), []byte("resource \"aws_vpc\" \"main\" {}\n"), 0o644))
+	changed, err = ChangedSinceE(filepath.Join(root, "modules"), commit, "modules", "examples/complete")
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	_, err = ChangedSinceE(root, "no-such-ref", "modules")
+	assert.Error(t, err)
+}
+
+func TestGitRefExists(t *testing.T) {
+	root, commit := testRepo(t)
+
+	assert.True(t, GitRefExists(root, commit))
+	assert.True(t, GitRefExists(filepath.Join(root, "modules"), "HEAD"))
+	assert.False(t, GitRefExists(root, "origin/main"), "nothing was fetched")
+	assert.False(t, GitRefExists(t.TempDir(), "HEAD"), "not a repository")
+}
+
+const testUpgradePlanJSON = `{
+  "format_version": "1.2",
+  "planned_values": {"root_module": {}},
+  "resource_changes": [
+    {
+      "address": "module.vpc.aws_vpc.this", "mode": "managed", "type": "aws_vpc", "name": "this",
+      "change": {"actions": ["no-op"], "before": {"cidr_block": "10.0.0.0/16"}, "after": {"cidr_block": "10.0.0.0/16"}}
+    },
+    {
+      "address": "module.vpc.aws_nat_gateway.this[0]", "mode": "managed", "type": "aws_nat_gateway", "name": "this", "index": 0,
+      "change": {"actions": ["delete"], "before": {"subnet_id": "subnet-1"}, "after": null}
+    },
+    {
+      "address": "module.alb.aws_lb_target_group.app[\"app1\"]", "mode": "managed", "type": "aws_lb_target_group", "name": "app", "index": "app1",
+      "change": {"actions": ["create", "delete"], "before": {"port": 8080}, "after": {"port": 8081}}
+    },
+    {
+      "address": "module.alb.aws_lb.this", "mode": "managed", "type": "aws_lb", "name": "this",
+      "change": {"actions": ["update"], "before": {"idle_timeout": 60}, "after": {"idle_timeout": 120}}
+    },
+    {
+      "address": "module.compute.aws_autoscaling_group.app", "mode": "managed", "type": "aws_autoscaling_group", "name": "app",
+      "change": {"actions": ["delete", "create"], "before": {"name": "demo-ci-asg"}, "after": {"name": "demo-ci-asg-2"}}
+    }
+  ]
+}`
+
+func TestDestructiveChanges(t *testing.T) {
+	plan, err := terraform.ParsePlanJSON(testUpgradePlanJSON)
+	require.NoError(t, err)
+
+	changes := DestructiveChanges(plan, ProtectedResourceTypes...)
+	assert.Equal(t, []PendingChange{
+		{
+			Address:    `module.alb.aws_lb_target_group.app["app1"]`,
+			Action:     "replace",
+			Attributes: []AttributeChange{{Path: "port", Before: float64(8080), After: float64(8081)}},
+		},
+		{Address: "module.vpc.aws_nat_gateway.this[0]", Action: "delete"},
+	}, changes)
+
+	recorder := &snapshotT{}
+	assert.False(t, AssertNoDestructiveChanges(recorder, plan, ProtectedResourceTypes...))
+	require.Len(t, recorder.errors, 1)
+	assert.Contains(t, recorder.errors[0], "plan would destroy or replace 2 protected resources")
+	assert.Contains(t, recorder.errors[0], "module.vpc.aws_nat_gateway.this[0] (delete)")
+
+	assert.True(t, AssertNoDestructiveChanges(t, plan, "aws_vpc", "aws_lb"))
+}
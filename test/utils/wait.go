@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// WaitOptions controls how long the waiters poll and how the interval between
+// polls grows
+type WaitOptions struct {
+	// Timeout is the total time to wait before giving up
+	Timeout time.Duration
+	// Interval is the delay before the second poll
+	Interval time.Duration
+	// MaxInterval caps the delay between polls
+	MaxInterval time.Duration
+	// Backoff multiplies the delay after every poll; values below 1 keep it fixed
+	Backoff float64
+}
+
+// DefaultWaitOptions suits instances booting from scratch behind an ALB
+func DefaultWaitOptions() WaitOptions {
+	return WaitOptions{
+		Timeout:     10 * time.Minute,
+		Interval:    5 * time.Second,
+		MaxInterval: 30 * time.Second,
+		Backoff:     1.5,
+	}
+}
+
+// Poll calls check until it reports done, an error is returned or the timeout
+// expires. On timeout the last state described by check is part of the error.
+func Poll(description string, options WaitOptions, check func() (done bool, state string, err error)) error {
+	deadline := time.Now().Add(options.Timeout)
+	interval := options.Interval
+
+	for attempt := 1; ; attempt++ {
+		done, state, err := check()
+		if err != nil {
+			return fmt.Errorf("%s: %w", description, err)
+		}
+		if done {
+			return nil
+		}
+
+		if !time.Now().Add(interval).Before(deadline) {
+			return fmt.Errorf("timed out after %s and %d attempts waiting for %s; last observed state:\n%s",
+				options.Timeout, attempt, description, state)
+		}
+		time.Sleep(interval)
+
+		if options.Backoff > 1 {
+			interval = time.Duration(float64(interval) * options.Backoff)
+		}
+		if options.MaxInterval > 0 && interval > options.MaxInterval {
+			interval = options.MaxInterval
+		}
+	}
+}
+
+// WaitForASGCapacityE waits until the Auto Scaling group has as many InService
+// instances as its desired capacity
+func WaitForASGCapacityE(client AutoScalingAPI, asgName string, options WaitOptions) error {
+	return Poll(fmt.Sprintf("auto scaling group %s to reach desired capacity", asgName), options, func() (bool, string, error) {
+		output, err := client.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: []*string{aws.String(asgName)},
+		})
+		if err != nil {
+			return false, "", err
+		}
+		if len(output.AutoScalingGroups) == 0 {
+			return false, "  group not found", nil
+		}
+
+		group := output.AutoScalingGroups[0]
+		desired := aws.Int64Value(group.DesiredCapacity)
+		inService := int64(0)
+		var lines []string
+		for _, instance := range group.Instances {
+			state := aws.StringValue(instance.LifecycleState)
+			if state == autoscaling.LifecycleStateInService {
+				inService++
+			}
+			lines = append(lines, fmt.Sprintf("  %s: %s (%s)",
+				aws.StringValue(instance.InstanceId), state, aws.StringValue(instance.HealthStatus)))
+		}
+		sort.Strings(lines)
+		summary := fmt.Sprintf("  %d of %d instances InService", inService, desired)
+		lines = append([]string{summary}, lines...)
+
+		return desired > 0 && inService >= desired, strings.Join(lines, "\n"), nil
+	})
+}
+
+// WaitForASGCapacity is like WaitForASGCapacityE but fails the test on error
+func WaitForASGCapacity(t TestingT, client AutoScalingAPI, asgName string, options WaitOptions) {
+	if err := WaitForASGCapacityE(client, asgName, options); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// WaitForHealthyTargetsE waits until every target group has at least one target
+// registered and all of its registered targets report healthy
+func WaitForHealthyTargetsE(client ELBv2API, targetGroupArns []string, options WaitOptions) error {
+	description := fmt.Sprintf("healthy targets in %d target group(s)", len(targetGroupArns))
+	return Poll(description, options, func() (bool, string, error) {
+		done := true
+		var lines []string
+		for _, arn := range targetGroupArns {
+			output, err := client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{
+				TargetGroupArn: aws.String(arn),
+			})
+			if err != nil {
+				return false, "", err
+			}
+
+			lines = append(lines, "  "+arn+":")
+			if len(output.TargetHealthDescriptions) == 0 {
+				done = false
+				lines = append(lines, "    no registered targets")
+				continue
+			}
+			for _, description := range output.TargetHealthDescriptions {
+				lines = append(lines, "    "+describeTargetHealth(description))
+				if description.TargetHealth == nil || aws.StringValue(description.TargetHealth.State) != elbv2.TargetHealthStateEnumHealthy {
+					done = false
+				}
+			}
+		}
+		return done, strings.Join(lines, "\n"), nil
+	})
+}
+
+// WaitForHealthyTargets is like WaitForHealthyTargetsE but fails the test on error
+func WaitForHealthyTargets(t TestingT, client ELBv2API, targetGroupArns []string, options WaitOptions) {
+	if err := WaitForHealthyTargetsE(client, targetGroupArns, options); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// describeTargetHealth renders a target as "id:port state (reason: description)"
+func describeTargetHealth(description *elbv2.TargetHealthDescription) string {
+	target := aws.StringValue(description.Target.Id)
+	if description.Target.Port != nil {
+		target = fmt.Sprintf("%s:%d", target, aws.Int64Value(description.Target.Port))
+	}
+	health := description.TargetHealth
+	if health == nil {
+		return target + " unknown"
+	}
+	line := target + " " + aws.StringValue(health.State)
+	if health.Reason != nil {
+		line += fmt.Sprintf(" (%s: %s)", aws.StringValue(health.Reason), aws.StringValue(health.Description))
+	}
+	return line
+}
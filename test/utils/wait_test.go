@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fastWait = WaitOptions{
+	Timeout:     200 * time.Millisecond,
+	Interval:    time.Millisecond,
+	MaxInterval: 5 * time.Millisecond,
+	Backoff:     2,
+}
+
+// scalingGroup returns one more InService instance on every call
+type scalingGroup struct {
+	AutoScalingAPI
+	calls int
+}
+
+func (s *scalingGroup) DescribeAutoScalingGroups(*autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	s.calls++
+	group := &autoscaling.Group{DesiredCapacity: aws.Int64(3)}
+	for i := 0; i < 3; i++ {
+		state := autoscaling.LifecycleStatePending
+		if i < s.calls {
+			state = autoscaling.LifecycleStateInService
+		}
+		group.Instances = append(group.Instances, &autoscaling.Instance{
+			InstanceId:     aws.String("i-" + string(rune('a'+i))),
+			LifecycleState: aws.String(state),
+			HealthStatus:   aws.String("Healthy"),
+		})
+	}
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: []*autoscaling.Group{group}}, nil
+}
+
+// targetHealth serves a fixed health state per target group
+type targetHealth struct {
+	ELBv2API
+	states map[string]*elbv2.TargetHealth
+}
+
+func (s *targetHealth) DescribeTargetHealth(input *elbv2.DescribeTargetHealthInput) (*elbv2.DescribeTargetHealthOutput, error) {
+	health, ok := s.states[aws.StringValue(input.TargetGroupArn)]
+	if !ok {
+		return &elbv2.DescribeTargetHealthOutput{}, nil
+	}
+	return &elbv2.DescribeTargetHealthOutput{TargetHealthDescriptions: []*elbv2.TargetHealthDescription{{
+		Target:       &elbv2.TargetDescription{Id: aws.String("i-a"), Port: aws.Int64(8085)},
+		TargetHealth: health,
+	}}}, nil
+}
+
+func TestWaitForASGCapacity(t *testing.T) {
+	client := &scalingGroup{}
+	require.NoError(t, WaitForASGCapacityE(client, "demo-ci-asg", fastWait))
+	assert.Equal(t, 3, client.calls)
+}
+
+func TestWaitForASGCapacityTimeout(t *testing.T) {
+	err := WaitForASGCapacityE(&scalingGroup{calls: -100}, "demo-ci-asg", fastWait)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "0 of 3 instances InService")
+	assert.Contains(t, err.Error(), "i-a: Pending")
+}
+
+func TestWaitForHealthyTargets(t *testing.T) {
+	client := &targetHealth{states: map[string]*elbv2.TargetHealth{
+		"tg-app1": {State: aws.String(elbv2.TargetHealthStateEnumHealthy)},
+		"tg-app2": {State: aws.String(elbv2.TargetHealthStateEnumHealthy)},
+	}}
+	require.NoError(t, WaitForHealthyTargetsE(client, []string{"tg-app1", "tg-app2"}, fastWait))
+}
+
+func TestWaitForHealthyTargetsTimeout(t *testing.T) {
+	client := &targetHealth{states: map[string]*elbv2.TargetHealth{
+		"tg-app1": {State: aws.String(elbv2.TargetHealthStateEnumHealthy)},
+		"tg-app2": {
+			State:       aws.String(elbv2.TargetHealthStateEnumUnhealthy),
+			Reason:      aws.String(elbv2.TargetHealthReasonEnumTargetFailedHealthChecks),
+			Description: aws.String("Health checks failed"),
+		},
+	}}
+
+	err := WaitForHealthyTargetsE(client, []string{"tg-app1", "tg-app2", "tg-app3"}, fastWait)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "i-a:8085 healthy")
+	assert.Contains(t, err.Error(), "i-a:8085 unhealthy (Target.FailedHealthChecks: Health checks failed)")
+	assert.Contains(t, err.Error(), "tg-app3:\n    no registered targets")
+}
@@ -6,98 +6,73 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
-	terratest_aws "github.com/gruntwork-io/terratest/modules/aws"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-)
 
-// Helper function to check if a map contains specific tags
-func hasRequiredTags(tags []*ec2.Tag, requiredTags map[string]string) bool {
-	tagMap := make(map[string]string)
-	for _, tag := range tags {
-		tagMap[*tag.Key] = *tag.Value
-	}
-
-	for key, value := range requiredTags {
-		actualValue, exists := tagMap[key]
-		if !exists {
-			fmt.Printf("Missing required tag: %s\n", key)
-			return false
-		}
-		if actualValue != value {
-			fmt.Printf("Tag mismatch for %s: expected '%s', got '%s'\n", key, value, actualValue)
-			return false
-		}
-	}
-	return true
-}
+	"test/utils"
+)
 
 func TestVPCModule(t *testing.T) {
-	// t.Parallel()
-
-	// Generate a random name to prevent a naming conflict
-	uniqueID := random.UniqueId()
-	projectName := fmt.Sprintf("vpc-test-%s", uniqueID)
-
-	// Construct the test cases
-	testCases := []struct {
-		name        string
-		region      string
-		environment string
-		vpcCidr     string
-	}{
-		{
-			name:        "us-east-1-ci",
-			region:      "us-east-1",
-			environment: "ci",
-			vpcCidr:     "10.0.0.0/16",
-		},
-		//		{
-		//			name:        "eu-west-1-staging",
-		//			region:      "eu-west-1",
-		//			environment: "staging",
-		//			vpcCidr:     "10.1.0.0/16",
-		//		},
-	}
-
-	for _, testCase := range testCases {
-		// Local scope for parallel tests
-		tc := testCase
-
-		t.Run(tc.name, func(t *testing.T) {
-			t.Parallel()
-
-			terraformOptions := &terraform.Options{
-				// The path to where your Terraform code is located
-				TerraformDir: "../modules/vpc",
-
-				// Variables to pass to our Terraform code using -var options
-				Vars: map[string]interface{}{
-					"environment":  tc.environment,
-					"project_name": projectName,
-					"vpc_cidr":     tc.vpcCidr,
-				},
+	loadTestMatrix(t).Run(t, utils.MatrixTestVPC, func(t *testing.T, tc utils.MatrixCase) {
+		// Keep the copy of the module, its state and the stage data in one place
+		workingDir := test_structure.CopyTerraformFolderToTemp(t, "../", "modules/vpc")
+
+		// Generate a random name to prevent a naming conflict
+		uniqueID := random.UniqueId()
+		projectName := fmt.Sprintf("vpc-test-%s", uniqueID)
+
+		terraformOptions := &terraform.Options{
+			// The path to where your Terraform code is located
+			TerraformDir: workingDir,
+
+			// Variables to pass to our Terraform code using -var options
+			Vars: map[string]interface{}{
+				"environment":  tc.Environment,
+				"project_name": projectName,
+				"vpc_cidr":     tc.VPCCIDR,
+			},
+
+			// Environment variables to set when running Terraform
+			EnvVars: map[string]string{
+				"AWS_DEFAULT_REGION": tc.Region,
+			},
+		}
 
-				// Environment variables to set when running Terraform
-				EnvVars: map[string]string{
-					"AWS_DEFAULT_REGION": tc.region,
-				},
-			}
+		// In plan mode only validate the planned values
+		if utils.IsPlanMode() {
+			plan := utils.InitAndPlanOffline(t, terraformOptions, t.TempDir())
+			validateVPCPlan(t, plan, tc.Environment, projectName, tc.VPCCIDR)
+			return
+		}
 
-			// At the end of the test, run `terraform destroy`
-			defer terraform.Destroy(t, terraformOptions)
+		// At the end of the test, run `terraform destroy`
+		defer test_structure.RunTestStage(t, utils.StageTeardown, func() {
+			terraform.Destroy(t, test_structure.LoadTerraformOptions(t, workingDir))
+		})
 
-			// Run `terraform init` and `terraform apply`
+		// Run `terraform init` and `terraform apply`
+		test_structure.RunTestStage(t, utils.StageDeployVPC, func() {
+			test_structure.SaveTerraformOptions(t, workingDir, terraformOptions)
 			terraform.InitAndApply(t, terraformOptions)
+			utils.AssertIdempotent(t, terraformOptions, t.TempDir())
+			utils.SaveOutputs(t, workingDir, terraformOptions)
+		})
+
+		test_structure.RunTestStage(t, utils.StageValidate, func() {
+			// A rerun has a new random name, so use the one the VPC was deployed with
+			terraformOptions := test_structure.LoadTerraformOptions(t, workingDir)
+			projectName := terraformOptions.Vars["project_name"].(string)
+			outputs := utils.LoadOutputs(t, workingDir)
 
 			// Get VPC ID from Terraform outputs
-			vpcID := terraform.Output(t, terraformOptions, "vpc_id")
+			vpcID := outputs.String("vpc_id")
 			require.NotEmpty(t, vpcID, "VPC ID should not be empty")
 
 			// Create AWS EC2 service client
-			ec2Client := terratest_aws.NewEc2Client(t, tc.region)
+			ec2Client := utils.CreateEC2Client(tc.Region)
 
 			// Verify VPC exists and check CIDR
 			vpcOutput, err := ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{
@@ -105,11 +80,14 @@ func TestVPCModule(t *testing.T) {
 			})
 			require.NoError(t, err)
 			require.Len(t, vpcOutput.Vpcs, 1)
-			assert.Equal(t, tc.vpcCidr, *vpcOutput.Vpcs[0].CidrBlock)
+			assert.Equal(t, tc.VPCCIDR, *vpcOutput.Vpcs[0].CidrBlock)
+
+			// Tags are checked for all resources at once at the end
+			tagged := []utils.TaggedResource{{Kind: "vpc", ID: vpcID, Tags: utils.EC2Tags(vpcOutput.Vpcs[0].Tags)}}
 
 			// Get subnet IDs from Terraform outputs
-			privateSubnetsStr := terraform.OutputList(t, terraformOptions, "private_subnets")
-			publicSubnetsStr := terraform.OutputList(t, terraformOptions, "public_subnets")
+			privateSubnetsStr := outputs.List("private_subnets")
+			publicSubnetsStr := outputs.List("public_subnets")
 
 			// Verify number of subnets
 			assert.Equal(t, 3, len(privateSubnetsStr), "Should have 3 private subnets")
@@ -133,23 +111,7 @@ func TestVPCModule(t *testing.T) {
 
 			privateAZs := make(map[string]bool)
 			for _, subnet := range privateSubnets.Subnets {
-				// Print all tags for debugging
-				fmt.Printf("Private subnet tags:\n")
-				for _, tag := range subnet.Tags {
-					fmt.Printf("  %s: %s\n", *tag.Key, *tag.Value)
-				}
-
-				// Verify subnet tags
-				expectedTags := map[string]string{
-					"Environment": tc.environment,
-					"Project":     projectName,
-					"ManagedBy":   "terraform",
-				}
-				if !hasRequiredTags(subnet.Tags, expectedTags) {
-					fmt.Printf("Expected tags: %v\n", expectedTags)
-				}
-				assert.True(t, hasRequiredTags(subnet.Tags, expectedTags),
-					"Private subnet should have all required tags")
+				tagged = append(tagged, utils.TaggedResource{Kind: "private subnet", ID: *subnet.SubnetId, Tags: utils.EC2Tags(subnet.Tags)})
 
 				// Verify subnet is private (no auto-assign public IP)
 				assert.False(t, *subnet.MapPublicIpOnLaunch)
@@ -164,21 +126,7 @@ func TestVPCModule(t *testing.T) {
 
 			publicAZs := make(map[string]bool)
 			for _, subnet := range publicSubnets.Subnets {
-				fmt.Printf("Public subnet tags:\n")
-				for _, tag := range subnet.Tags {
-					fmt.Printf("  %s: %s\n", *tag.Key, *tag.Value)
-				}
-
-				expectedTags := map[string]string{
-					"Environment": tc.environment,
-					"Project":     projectName,
-					"ManagedBy":   "terraform",
-				}
-				if !hasRequiredTags(subnet.Tags, expectedTags) {
-					fmt.Printf("Expected tags: %v\n", expectedTags)
-				}
-				assert.True(t, hasRequiredTags(subnet.Tags, expectedTags),
-					"Public subnet should have all required tags")
+				tagged = append(tagged, utils.TaggedResource{Kind: "public subnet", ID: *subnet.SubnetId, Tags: utils.EC2Tags(subnet.Tags)})
 
 				// Verify subnet is public (auto-assign public IP)
 				assert.True(t, *subnet.MapPublicIpOnLaunch)
@@ -200,11 +148,16 @@ func TestVPCModule(t *testing.T) {
 			})
 			require.NoError(t, err)
 
-			if tc.environment == "prod" {
+			if tc.Environment == "prod" {
 				assert.Equal(t, 3, len(natGateways.NatGateways), "Production should have one NAT Gateway per AZ")
 			} else {
 				assert.Equal(t, 1, len(natGateways.NatGateways), "Non-production should have a single NAT Gateway")
 			}
+			for _, nat := range natGateways.NatGateways {
+				tagged = append(tagged, utils.TaggedResource{Kind: "NAT gateway", ID: *nat.NatGatewayId, Tags: utils.EC2Tags(nat.Tags)})
+			}
+
+			utils.AssertTagPolicy(t, utils.RequiredTags(tc.Environment, projectName), tagged...)
 
 			// Verify VPC attributes
 			describeVpcAttributeInput := &ec2.DescribeVpcAttributeInput{
@@ -234,6 +187,23 @@ func TestVPCModule(t *testing.T) {
 			})
 			require.NoError(t, err)
 			assert.NotEmpty(t, flowLogs.FlowLogs, "VPC should have flow logs enabled")
+
+			// Check every subnet reaches the internet the way it should
+			testRouteTopology(t, ec2Client, vpcID, privateSubnetsStr, publicSubnetsStr, tc.Environment)
 		})
-	}
+	})
+}
+
+// testRouteTopology checks the public subnets route to the internet through the
+// internet gateway, and the private ones through a NAT gateway in their own AZ in
+// prod or the single shared one elsewhere, with no blackhole routes
+func testRouteTopology(t utils.AssertT, ec2Client utils.EC2API, vpcID string, privateSubnets, publicSubnets []string, environment string) {
+	topology, err := utils.RouteTopologyE(ec2Client, vpcID)
+	require.NoError(t, err)
+
+	utils.AssertRouteTopology(t, topology, utils.RouteExpectation{
+		PublicSubnets:  publicSubnets,
+		PrivateSubnets: privateSubnets,
+		NATPerAZ:       environment == "prod",
+	})
 }